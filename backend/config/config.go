@@ -15,6 +15,17 @@ type Config struct {
 	Database DatabaseConfig `yaml:"database"`
 	JWT      JWTConfig      `yaml:"jwt"`
 	DeepSeek DeepSeekConfig `yaml:"deepseek"`
+	Models   []ModelConfig  `yaml:"models"`
+	SMS      SMSConfig      `yaml:"sms"`
+	OIDC     OIDCConfig     `yaml:"oidc"`
+	Security SecurityConfig `yaml:"security"`
+	RBAC     RBACConfig     `yaml:"rbac"`
+	Account  AccountConfig  `yaml:"account"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Chat     ChatConfig     `yaml:"chat"`
+	RAG      RAGConfig      `yaml:"rag"`
+	MCP      MCPConfig      `yaml:"mcp"`
+	OpenAI   OpenAIConfig   `yaml:"openai"`
 }
 
 // ServerConfig 服务器配置
@@ -48,6 +59,146 @@ type DeepSeekConfig struct {
 	MaxTokens     uint   `yaml:"max_tokens"`
 }
 
+// ModelConfig 可供选择的模型，服务商需兼容OpenAI的聊天补全接口
+// 未填写 base_url 和 api_key 时使用 deepseek 配置
+type ModelConfig struct {
+	ID       string `yaml:"id"`       // 对外使用的模型标识
+	Name     string `yaml:"name"`     // 显示名称
+	Provider string `yaml:"provider"` // 服务商名称，仅用于显示
+	Model    string `yaml:"model"`    // 服务商的模型名，为空时与 id 相同
+	BaseURL  string `yaml:"base_url"`
+	APIKey   string `yaml:"api_key"`
+	Vision   bool   `yaml:"vision"` // 是否支持图片输入
+	Tools    bool   `yaml:"tools"`  // 是否支持工具调用
+	// 单次回答的最大输出长度，为 0 时不限制
+	MaxTokens int `yaml:"max_tokens"`
+	// 模型不支持的生成参数，例如思考模型不支持 temperature，请求中指定时返回错误，会话和助手的设置会被忽略
+	UnsupportedParams []string `yaml:"unsupported_params"`
+	// 是否支持 response_format 的 json_object 和 json_schema，不支持时通过提示词要求模型输出JSON
+	JSONOutput bool `yaml:"json_output"`
+	JSONSchema bool `yaml:"json_schema"`
+}
+
+// SMSConfig 短信验证码配置
+type SMSConfig struct {
+	Provider      string `yaml:"provider"`        // 短信网关，目前支持 console
+	CodeTTL       int    `yaml:"code_ttl"`        // 验证码有效期（秒）
+	SendInterval  int    `yaml:"send_interval"`   // 同一手机号两次发送的最小间隔（秒）
+	DailyLimit    int    `yaml:"daily_limit"`     // 同一手机号每日最多发送次数
+	IPHourlyLimit int    `yaml:"ip_hourly_limit"` // 同一IP每小时最多发送次数
+	MaxAttempts   int    `yaml:"max_attempts"`    // 单个验证码最多校验次数
+	// 不带国际区号的手机号使用的区号，默认为 86
+	DefaultCountryCode string `yaml:"default_country_code"`
+}
+
+// OIDCConfig OpenID Connect 单点登录配置
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // 回调地址，对应 /api/auth/oidc/callback
+	Scopes       []string `yaml:"scopes"`
+	FrontendURL  string   `yaml:"frontend_url"` // 登录完成后跳转的前端地址，为空时直接返回JSON
+}
+
+// SecurityConfig 安全相关配置
+type SecurityConfig struct {
+	Login LoginProtectionConfig `yaml:"login"`
+}
+
+// LoginProtectionConfig 登录防暴力破解配置
+type LoginProtectionConfig struct {
+	AccountMaxFailures int `yaml:"account_max_failures"` // 同一账号连续失败达到该次数后锁定
+	IPMaxFailures      int `yaml:"ip_max_failures"`      // 同一IP连续失败达到该次数后锁定
+	FailureWindow      int `yaml:"failure_window"`       // 失败次数统计窗口（分钟）
+	LockoutDuration    int `yaml:"lockout_duration"`     // 锁定时长（分钟）
+	DelayBase          int `yaml:"delay_base"`           // 失败后递增延迟的基数（毫秒）
+	DelayMax           int `yaml:"delay_max"`            // 单次失败的最大延迟（毫秒）
+}
+
+// RBACConfig 角色权限配置
+type RBACConfig struct {
+	BootstrapAdmins []string `yaml:"bootstrap_admins"` // 启动时授予管理员角色的账号（用户名、邮箱或手机号）
+}
+
+// AccountConfig 账号生命周期配置
+type AccountConfig struct {
+	DeletionGraceDays int `yaml:"deletion_grace_days"` // 申请注销后保留数据的天数，期间可撤销
+}
+
+// StorageConfig 文件存储配置
+type StorageConfig struct {
+	Driver        string             `yaml:"driver"`          // 存储驱动，支持 local 和 s3
+	PublicURL     string             `yaml:"public_url"`      // 文件访问地址前缀，默认 /api/files
+	AvatarMaxSize int64              `yaml:"avatar_max_size"` // 头像文件大小上限（字节）
+	Local         LocalStorageConfig `yaml:"local"`
+	S3            S3StorageConfig    `yaml:"s3"`
+}
+
+// LocalStorageConfig 本地文件系统存储配置
+type LocalStorageConfig struct {
+	Dir string `yaml:"dir"` // 存储根目录
+}
+
+// S3StorageConfig S3兼容对象存储配置
+type S3StorageConfig struct {
+	Endpoint  string `yaml:"endpoint"` // 例如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	PathStyle bool   `yaml:"path_style"` // 使用路径方式访问存储桶，MinIO等通常需要开启
+}
+
+// ChatConfig 聊天功能配置
+type ChatConfig struct {
+	TrashRetentionDays     int   `yaml:"trash_retention_days"`     // 回收站中的会话保留天数，到期后彻底删除
+	AttachmentMaxSize      int64 `yaml:"attachment_max_size"`      // 单个附件的大小上限（字节）
+	AttachmentMaxFiles     int   `yaml:"attachment_max_files"`     // 每条消息的附件数量上限
+	AttachmentContextChars int   `yaml:"attachment_context_chars"` // 附件内容注入模型上下文的总字符数上限
+	MaxToolRounds          int   `yaml:"max_tool_rounds"`          // 单次回答中工具调用的最大轮数
+	JSONRepairRetries      int   `yaml:"json_repair_retries"`      // 结构化输出校验失败后要求模型修复的最大次数
+}
+
+// RAGConfig 知识库检索增强配置
+type RAGConfig struct {
+	Embedder        EmbedderConfig `yaml:"embedder"`
+	VectorStore     string         `yaml:"vector_store"`      // 向量存储，支持 db（在数据库中暴力检索）和 memory（仅用于测试）
+	ChunkSize       int            `yaml:"chunk_size"`        // 文档切块的字符数
+	ChunkOverlap    int            `yaml:"chunk_overlap"`     // 相邻切块重叠的字符数
+	TopK            int            `yaml:"top_k"`             // 每次提问检索的切块数量
+	MinScore        float64        `yaml:"min_score"`         // 相似度低于该值的切块不作为参考资料
+	DocumentMaxSize int64          `yaml:"document_max_size"` // 单个文档的大小上限（字节）
+}
+
+// EmbedderConfig 向量化模型配置
+type EmbedderConfig struct {
+	Provider   string `yaml:"provider"` // openai（兼容OpenAI的接口）、ollama 或 hash（仅用于测试）
+	BaseURL    string `yaml:"base_url"` // 完整的接口地址，例如 https://api.openai.com/v1/embeddings
+	APIKey     string `yaml:"api_key"`
+	Model      string `yaml:"model"`
+	Dimensions int    `yaml:"dimensions"` // hash 的向量维度，openai 指定时作为 dimensions 参数传递
+	BatchSize  int    `yaml:"batch_size"` // 每次请求向量化的文本数量
+}
+
+// MCPConfig Model Context Protocol 服务器配置，服务器提供的工具可供支持工具调用的模型使用
+type MCPConfig struct {
+	Servers []MCPServerConfig `yaml:"servers"`
+}
+
+// MCPServerConfig 单个MCP服务器，transport 为 stdio 时启动子进程通信，为 http 时使用 streamable HTTP
+type MCPServerConfig struct {
+	Name      string            `yaml:"name"`      // 服务器名称，只能包含字母、数字、下划线和连字符
+	Transport string            `yaml:"transport"` // stdio 或 http
+	Command   string            `yaml:"command"`   // stdio 启动的命令
+	Args      []string          `yaml:"args"`
+	Env       map[string]string `yaml:"env"`     // stdio 子进程额外的环境变量
+	URL       string            `yaml:"url"`     // http 的接口地址
+	Headers   map[string]string `yaml:"headers"` // http 请求额外的请求头，例如 Authorization
+	Enabled   bool              `yaml:"enabled"` // 会话未单独设置时是否启用
+}
+
 // DSN 生成数据库连接字符串
 func (db *DatabaseConfig) DSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=true&loc=Local",
@@ -110,3 +261,12 @@ func GetConfig() (*Config, error) {
 	}
 	return AppConfig, nil
 }
+
+// OpenAIConfig 兼容OpenAI的 /v1 接口配置，使用个人API密钥认证
+type OpenAIConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	SystemPrompt      string `yaml:"system_prompt"`       // 放在每次请求最前面的系统提示词，客户端无法覆盖
+	MaxKeysPerUser    int    `yaml:"max_keys_per_user"`   // 每个用户最多可以创建的密钥数量
+	DailyRequestLimit int64  `yaml:"daily_request_limit"` // 每个用户每日的请求次数上限，为 0 时不限制
+	DailyTokenLimit   int64  `yaml:"daily_token_limit"`   // 每个用户每日的token用量上限，为 0 时不限制
+}
@@ -70,6 +70,8 @@ func InitDB() error {
 
 	db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
 		Logger: newLogger,
+		// 将唯一索引冲突等数据库错误转换为gorm的通用错误，便于业务层判断
+		TranslateError: true,
 	})
 	if err != nil {
 		return err
@@ -86,6 +88,36 @@ func InitDB() error {
 		&models.User{},
 		&models.UserSession{},
 		&models.UserSettings{},
+		&models.SMSCode{},
+		&models.UserIdentity{},
+		&models.LoginFailure{},
+		&models.Role{},
+		&models.UserRole{},
+		&models.AuditLog{},
+		&models.AccountDeletion{},
+		&models.Workspace{},
+		&models.WorkspaceMember{},
+		&models.Folder{},
+		&models.Tag{},
+		&models.SessionTag{},
+		&models.Bookmark{},
+		&models.BookmarkTag{},
+		&models.MessageFeedback{},
+		&models.Attachment{},
+		&models.KnowledgeBase{},
+		&models.KnowledgeDocument{},
+		&models.KnowledgeChunk{},
+		&models.KnowledgeVector{},
+		&models.MessageCitation{},
+		&models.MessageToolCall{},
+		&models.RealtimeTicket{},
+		&models.SessionMCPServer{},
+		&models.PromptTemplate{},
+		&models.Assistant{},
+		&models.AssistantVersion{},
+		&models.APIKey{},
+		&models.APIKeyUsage{},
+		&models.APIUserUsage{},
 		&models.ChatSession{},
 		&models.ChatMessage{},
 		&models.AIResponse{},
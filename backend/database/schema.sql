@@ -24,7 +24,7 @@ CREATE TABLE IF NOT EXISTS `users` (
 CREATE TABLE IF NOT EXISTS `user_sessions` (
   `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '会话ID',
   `user_id` BIGINT UNSIGNED NOT NULL COMMENT '用户ID',
-  `token` VARCHAR(255) NOT NULL COMMENT '会话令牌',
+  `token` VARCHAR(512) NOT NULL COMMENT '会话令牌',
   `expire_time` DATETIME NOT NULL COMMENT '过期时间',
   `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   `updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
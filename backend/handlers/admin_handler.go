@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLoginLocksHandler 获取当前被锁定的账号和IP
+func GetLoginLocksHandler(c *gin.Context) {
+	locks, err := services.GetActiveLoginLocks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取登录锁定失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locks": locks,
+		"total": len(locks),
+	})
+}
+
+// UnlockLoginHandler 解除账号或IP的登录锁定
+func UnlockLoginHandler(c *gin.Context) {
+	var req models.UnlockLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	err := services.UnlockLogin(req.Scope, req.Identifier)
+	recordAudit(c, models.AuditActionAdminLoginUnlock, req.Scope, req.Identifier, auditResult(err), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除锁定失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
+
+// ListRolesHandler 获取全部角色
+func ListRolesHandler(c *gin.Context) {
+	roles, err := services.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取角色失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles":       roles,
+		"permissions": models.AllPermissions,
+	})
+}
+
+// CreateRoleHandler 创建自定义角色
+func CreateRoleHandler(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	role, err := services.CreateRole(c.GetUint("userID"), req)
+	recordAudit(c, models.AuditActionAdminRoleCreate, "role", req.Name, auditResult(err), strings.Join(req.Permissions, ","))
+	if err != nil {
+		if errors.Is(err, services.ErrRoleExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "角色已存在"})
+		} else if errors.Is(err, services.ErrUnknownPermission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知的权限: " + err.Error()})
+		} else if errors.Is(err, services.ErrPermissionEscalation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不能授予自己没有的权限"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建角色失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRoleHandler 更新角色
+func UpdateRoleHandler(c *gin.Context) {
+	roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	role, err := services.UpdateRole(c.GetUint("userID"), uint(roleID), req)
+	recordAudit(c, models.AuditActionAdminRoleUpdate, "role", c.Param("id"), auditResult(err), strings.Join(req.Permissions, ","))
+	if err != nil {
+		if errors.Is(err, services.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		} else if errors.Is(err, services.ErrBuiltInRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "内置角色的权限不可修改"})
+		} else if errors.Is(err, services.ErrUnknownPermission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "未知的权限: " + err.Error()})
+		} else if errors.Is(err, services.ErrPermissionEscalation) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不能修改超出自己权限的角色"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新角色失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRoleHandler 删除自定义角色
+func DeleteRoleHandler(c *gin.Context) {
+	roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return
+	}
+
+	err = services.DeleteRole(uint(roleID))
+	recordAudit(c, models.AuditActionAdminRoleDelete, "role", c.Param("id"), auditResult(err), "")
+	if err != nil {
+		if errors.Is(err, services.ErrRoleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		} else if errors.Is(err, services.ErrBuiltInRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "内置角色不可删除"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除角色失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色已删除"})
+}
+
+// parseUserIDParam 解析路径中的用户ID
+func parseUserIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondAdminUserError 返回用户管理操作的通用错误
+func respondAdminUserError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	} else if errors.Is(err, services.ErrCannotModifySelf) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能对自己执行此操作"})
+	} else if errors.Is(err, services.ErrRoleNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在"})
+	} else if errors.Is(err, services.ErrUserDisabled) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户已被禁用"})
+	} else if errors.Is(err, services.ErrCannotImpersonateAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能代登录管理员或权限超出自己的账号"})
+	} else if errors.Is(err, services.ErrCannotManageUser) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能管理权限超出自己的账号"})
+	} else if errors.Is(err, services.ErrPermissionEscalation) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能授予或移除超出自己权限的角色"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback + ": " + err.Error()})
+	}
+}
+
+// ListUsersHandler 分页查询用户
+func ListUsersHandler(c *gin.Context) {
+	var query models.AdminUserQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	users, total, err := services.ListUsers(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"total": total,
+	})
+}
+
+// GetUserDetailHandler 获取用户详情及使用情况
+func GetUserDetailHandler(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	detail, err := services.GetUserDetail(userID)
+	if err != nil {
+		respondAdminUserError(c, err, "获取用户详情失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// SetUserStatusHandler 启用或禁用用户
+func SetUserStatusHandler(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetUserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	action := models.AuditActionAdminUserEnable
+	if *req.Status != 1 {
+		action = models.AuditActionAdminUserDisable
+	}
+	targetID := strconv.FormatUint(uint64(userID), 10)
+
+	operatorID, _ := c.Get("userID")
+	if err := services.SetUserStatus(operatorID.(uint), userID, *req.Status); err != nil {
+		recordAudit(c, action, "user", targetID, models.AuditResultFailure, err.Error())
+		respondAdminUserError(c, err, "更新用户状态失败")
+		return
+	}
+	recordAudit(c, action, "user", targetID, models.AuditResultSuccess, req.Reason)
+
+	c.JSON(http.StatusOK, gin.H{"message": "用户状态已更新"})
+}
+
+// ResetUserPasswordHandler 管理员重置用户密码
+func ResetUserPasswordHandler(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.AdminResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	targetID := strconv.FormatUint(uint64(userID), 10)
+	operatorID, _ := c.Get("userID")
+	tempPassword, err := services.AdminResetPassword(operatorID.(uint), userID, req.NewPassword)
+	if err != nil {
+		recordAudit(c, models.AuditActionAdminUserResetPassword, "user", targetID, models.AuditResultFailure, err.Error())
+		respondAdminUserError(c, err, "重置密码失败")
+		return
+	}
+	recordAudit(c, models.AuditActionAdminUserResetPassword, "user", targetID, models.AuditResultSuccess, "")
+
+	resp := gin.H{"message": "密码已重置"}
+	if tempPassword != "" {
+		resp["temp_password"] = tempPassword
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetUserRolesHandler 设置用户角色
+func SetUserRolesHandler(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.SetUserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	targetID := strconv.FormatUint(uint64(userID), 10)
+	detail := strings.Join(req.Roles, ",")
+
+	operatorID, _ := c.Get("userID")
+	if err := services.SetUserRoles(operatorID.(uint), userID, req.Roles); err != nil {
+		recordAudit(c, models.AuditActionAdminUserSetRoles, "user", targetID, models.AuditResultFailure, detail+": "+err.Error())
+		respondAdminUserError(c, err, "设置角色失败")
+		return
+	}
+	recordAudit(c, models.AuditActionAdminUserSetRoles, "user", targetID, models.AuditResultSuccess, detail)
+
+	c.JSON(http.StatusOK, gin.H{"message": "角色已更新"})
+}
+
+// ImpersonateUserHandler 管理员以目标用户身份登录，用于排查问题
+func ImpersonateUserHandler(c *gin.Context) {
+	userID, ok := parseUserIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写代登录原因"})
+		return
+	}
+
+	// 代登录期间不允许再次代登录
+	if _, impersonating := c.Get("impersonatorID"); impersonating {
+		c.JSON(http.StatusForbidden, gin.H{"error": "代登录期间不能再次代登录"})
+		return
+	}
+
+	targetID := strconv.FormatUint(uint64(userID), 10)
+	adminID, _ := c.Get("userID")
+	token, expiresAt, err := services.ImpersonateUser(adminID.(uint), userID)
+	if err != nil {
+		recordAudit(c, models.AuditActionAdminUserImpersonate, "user", targetID, models.AuditResultFailure, req.Reason+": "+err.Error())
+		respondAdminUserError(c, err, "代登录失败")
+		return
+	}
+	recordAudit(c, models.AuditActionAdminUserImpersonate, "user", targetID, models.AuditResultSuccess, req.Reason)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAPIKeysHandler 获取当前用户的API密钥，不包含完整密钥
+func ListAPIKeysHandler(c *gin.Context) {
+	keys, err := services.ListAPIKeys(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取API密钥失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys, "total": len(keys)})
+}
+
+// CreateAPIKeyHandler 创建API密钥，完整密钥只在本次响应中返回
+func CreateAPIKeyHandler(c *gin.Context) {
+	// 代登录令牌很快过期，不能借此为被代登录的账号创建长期有效的凭证
+	if _, impersonated := c.Get("impersonatorID"); impersonated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "代登录状态下不能创建API密钥"})
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	key, err := services.CreateAPIKey(c.GetUint("userID"), req)
+	targetID := ""
+	if err == nil {
+		targetID = strconv.FormatUint(uint64(key.ID), 10)
+	}
+	recordAudit(c, models.AuditActionAPIKeyCreate, "api_key", targetID, auditResult(err), req.Name)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyLimit) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "API密钥数量已达上限"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建API密钥失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+// DeleteAPIKeyHandler 删除API密钥，使用该密钥的请求立即失效
+func DeleteAPIKeyHandler(c *gin.Context) {
+	keyID, ok := parseIDParam(c, "id", "无效的密钥ID")
+	if !ok {
+		return
+	}
+
+	err := services.DeleteAPIKey(c.GetUint("userID"), keyID)
+	recordAudit(c, models.AuditActionAPIKeyDelete, "api_key", c.Param("id"), auditResult(err), "")
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API密钥不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除API密钥失败"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API密钥已删除"})
+}
+
+// GetAPIKeyUsageHandler 获取最近若干天每个API密钥的用量，days 默认为 30
+func GetAPIKeyUsageHandler(c *gin.Context) {
+	var query struct {
+		Days int `form:"days" binding:"omitempty,min=1,max=366"`
+	}
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+	if query.Days == 0 {
+		query.Days = 30
+	}
+
+	usage, err := services.GetAPIKeyUsage(c.GetUint("userID"), query.Days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用量失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondAssistantError 返回助手操作的通用错误
+func respondAssistantError(c *gin.Context, err error) {
+	var paramsErr *services.InvalidGenerationParamsError
+	if errors.As(err, &paramsErr) {
+		respondGenerationParamsError(c, err)
+	} else if errors.Is(err, services.ErrAssistantNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "助手不存在"})
+	} else if errors.Is(err, services.ErrAssistantForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此助手"})
+	} else if errors.Is(err, services.ErrUnknownModel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模型不存在"})
+	} else if errors.Is(err, services.ErrUnknownTool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工具不存在: " + err.Error()})
+	} else if errors.Is(err, services.ErrKnowledgeBaseNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+	} else if errors.Is(err, services.ErrWorkspaceNotFound) || errors.Is(err, services.ErrWorkspaceForbidden) {
+		respondWorkspaceError(c, err)
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// ListAssistantsHandler 获取可用的助手
+func ListAssistantsHandler(c *gin.Context) {
+	var query models.AssistantListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	assistants, err := services.ListAssistants(c.GetUint("userID"), query)
+	if err != nil {
+		respondAssistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"assistants": assistants, "total": len(assistants)})
+}
+
+// CreateAssistantHandler 创建助手，指定 workspace_id 时与工作区成员共享
+func CreateAssistantHandler(c *gin.Context) {
+	var req models.CreateAssistantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	assistant, err := services.CreateAssistant(c.GetUint("userID"), req)
+	if err != nil {
+		respondAssistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, assistant)
+}
+
+// GetAssistantHandler 获取助手及其当前版本的设置
+func GetAssistantHandler(c *gin.Context) {
+	assistantID, ok := parseIDParam(c, "id", "无效的助手ID")
+	if !ok {
+		return
+	}
+
+	assistant, err := services.GetAssistant(c.GetUint("userID"), assistantID)
+	if err != nil {
+		respondAssistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, assistant)
+}
+
+// UpdateAssistantHandler 修改助手，修改设置时生成新版本
+func UpdateAssistantHandler(c *gin.Context) {
+	assistantID, ok := parseIDParam(c, "id", "无效的助手ID")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateAssistantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	assistant, err := services.UpdateAssistant(c.GetUint("userID"), assistantID, req)
+	if err != nil {
+		respondAssistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, assistant)
+}
+
+// DeleteAssistantHandler 删除助手，已使用该助手的会话不受影响
+func DeleteAssistantHandler(c *gin.Context) {
+	assistantID, ok := parseIDParam(c, "id", "无效的助手ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteAssistant(c.GetUint("userID"), assistantID); err != nil {
+		respondAssistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "助手已删除"})
+}
+
+// ListAssistantVersionsHandler 获取助手的历史版本
+func ListAssistantVersionsHandler(c *gin.Context) {
+	assistantID, ok := parseIDParam(c, "id", "无效的助手ID")
+	if !ok {
+		return
+	}
+
+	versions, err := services.ListAssistantVersions(c.GetUint("userID"), assistantID)
+	if err != nil {
+		respondAssistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "total": len(versions)})
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readAttachmentUploads 读取表单中 files 字段上传的附件，失败时直接写入错误响应
+func readAttachmentUploads(c *gin.Context) ([]services.AttachmentUpload, bool) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+		return nil, false
+	}
+
+	files := form.File["files"]
+	if len(files) > services.AttachmentMaxFiles() {
+		respondAttachmentError(c, services.ErrTooManyAttachments)
+		return nil, false
+	}
+
+	uploads := make([]services.AttachmentUpload, 0, len(files))
+	for _, fileHeader := range files {
+		if fileHeader.Size > services.AttachmentMaxSize() {
+			respondAttachmentError(c, services.ErrAttachmentTooLarge)
+			return nil, false
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+			return nil, false
+		}
+		data, err := io.ReadAll(io.LimitReader(file, services.AttachmentMaxSize()+1))
+		file.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+			return nil, false
+		}
+		uploads = append(uploads, services.AttachmentUpload{FileName: fileHeader.Filename, Data: data})
+	}
+	return uploads, true
+}
+
+// respondAttachmentError 返回附件操作的通用错误
+func respondAttachmentError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrAttachmentTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("单个附件不能超过%dMB", services.AttachmentMaxSize()>>20)})
+	} else if errors.Is(err, services.ErrTooManyAttachments) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("每条消息最多上传%d个附件", services.AttachmentMaxFiles())})
+	} else if errors.Is(err, services.ErrEmptyAttachmentName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "附件文件名不能为空"})
+	} else if errors.Is(err, services.ErrAttachmentNotFound) || errors.Is(err, services.ErrBlobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+	} else if errors.Is(err, services.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "附件处理失败: " + err.Error()})
+	}
+}
+
+// DownloadAttachmentHandler 下载消息附件
+func DownloadAttachmentHandler(c *gin.Context) {
+	attachmentID, ok := parseIDParam(c, "id", "无效的附件ID")
+	if !ok {
+		return
+	}
+
+	attachment, reader, err := services.OpenAttachment(c.Request.Context(), c.GetUint("userID"), attachmentID)
+	if err != nil {
+		respondAttachmentError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, reader, nil)
+}
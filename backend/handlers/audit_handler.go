@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit 记录当前请求的审计日志，操作人、IP和User-Agent从请求上下文获取
+func recordAudit(c *gin.Context, action, targetType, targetID, result, detail string) {
+	var actorID uint
+	if userID, exists := c.Get("userID"); exists {
+		actorID = userID.(uint)
+	}
+	recordAuditAs(c, actorID, action, targetType, targetID, result, detail)
+}
+
+// recordAuditAs 以指定操作人记录审计日志，用于登录等尚未建立认证上下文的请求
+func recordAuditAs(c *gin.Context, actorID uint, action, targetType, targetID, result, detail string) {
+	entry := &models.AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Result:     result,
+		Detail:     detail,
+	}
+	if impersonatorID, exists := c.Get("impersonatorID"); exists {
+		entry.ImpersonatorID = impersonatorID.(uint)
+	}
+	if len(entry.UserAgent) > 255 {
+		entry.UserAgent = entry.UserAgent[:255]
+	}
+
+	services.RecordAudit(entry)
+}
+
+// auditResult 根据错误返回审计结果
+func auditResult(err error) string {
+	if err != nil {
+		return models.AuditResultFailure
+	}
+	return models.AuditResultSuccess
+}
+
+// GetAuditLogsHandler 查询审计日志，format=csv 时导出CSV
+func GetAuditLogsHandler(c *gin.Context) {
+	var query models.AuditLogQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		filename := "audit-logs-" + time.Now().Format("20060102150405") + ".csv"
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		// 写入UTF-8 BOM，便于表格软件正确识别中文
+		c.Writer.Write([]byte("\xEF\xBB\xBF"))
+		if err := services.ExportAuditLogsCSV(query, c.Writer); err != nil {
+			// 响应头已发送，只能中断输出
+			c.Error(err)
+		}
+		return
+	}
+
+	logs, total, err := services.QueryAuditLogs(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":  logs,
+		"total": total,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondBookmarkError 返回收藏操作的通用错误
+func respondBookmarkError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrBookmarkNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "收藏不存在"})
+	} else if errors.Is(err, services.ErrBookmarkExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "已收藏该消息版本"})
+	} else if errors.Is(err, services.ErrMessageNotFound) || errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+	} else if errors.Is(err, services.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+	} else if errors.Is(err, services.ErrTagNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "标签不存在"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// ListBookmarksHandler 获取收藏列表，包含定位到原会话所需的信息
+func ListBookmarksHandler(c *gin.Context) {
+	var query models.BookmarkQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	bookmarks, total, err := services.ListBookmarks(c.GetUint("userID"), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取收藏失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bookmarks": bookmarks, "total": total})
+}
+
+// CreateBookmarkHandler 收藏消息
+func CreateBookmarkHandler(c *gin.Context) {
+	var req models.CreateBookmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	bookmark, err := services.CreateBookmark(c.GetUint("userID"), req)
+	if err != nil {
+		respondBookmarkError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, bookmark)
+}
+
+// UpdateBookmarkHandler 修改收藏的备注和标签
+func UpdateBookmarkHandler(c *gin.Context) {
+	bookmarkID, ok := parseIDParam(c, "id", "无效的收藏ID")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateBookmarkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	bookmark, err := services.UpdateBookmark(c.GetUint("userID"), bookmarkID, req)
+	if err != nil {
+		respondBookmarkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, bookmark)
+}
+
+// DeleteBookmarkHandler 取消收藏
+func DeleteBookmarkHandler(c *gin.Context) {
+	bookmarkID, ok := parseIDParam(c, "id", "无效的收藏ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteBookmark(c.GetUint("userID"), bookmarkID); err != nil {
+		respondBookmarkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已取消收藏"})
+}
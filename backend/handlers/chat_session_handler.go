@@ -4,11 +4,13 @@ import (
 	"aiChat/backend/database"
 	"aiChat/backend/models"
 	"aiChat/backend/services"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strconv"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -29,26 +31,49 @@ func CreateSessionHandler(c *gin.Context) {
 		return
 	}
 
+	// 在工作区中创建会话需要编辑权限
+	if req.WorkspaceID != nil {
+		if _, err := services.RequireWorkspaceRole(*req.WorkspaceID, userID.(uint), models.WorkspaceRoleEditor); err != nil {
+			respondWorkspaceError(c, err)
+			return
+		}
+	}
+
 	// 创建新会话
 	session := models.ChatSession{
-		SessionID: uuid.New().String(), // 生成唯一会话ID
-		UserID:    userID.(uint),
-		Title:     req.Title,
-		IsPinned:  0,
+		SessionID:   uuid.New().String(), // 生成唯一会话ID
+		UserID:      userID.(uint),
+		WorkspaceID: req.WorkspaceID,
+		Title:       req.Title,
+		IsPinned:    0,
+	}
+
+	// 使用助手时固定助手的当前版本
+	if req.AssistantID != nil {
+		if err := services.ApplyAssistant(userID.(uint), &session, *req.AssistantID); err != nil {
+			respondAssistantError(c, err)
+			return
+		}
 	}
 
 	// 调用服务保存会话
-	if err := services.SaveChatSession(&session); err != nil {
+	err := services.SaveChatSession(&session)
+	recordAudit(c, models.AuditActionSessionCreate, "chat_session", session.SessionID, auditResult(err), "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
 		return
 	}
 
 	// 返回响应，包含会话ID
 	c.JSON(http.StatusCreated, gin.H{
-		"id":         session.ID,
-		"session_id": session.SessionID,
-		"title":      session.Title,
-		"created_at": session.CreatedAt,
+		"id":                session.ID,
+		"session_id":        session.SessionID,
+		"workspace_id":      session.WorkspaceID,
+		"assistant_id":      session.AssistantID,
+		"assistant_version": session.AssistantVersion,
+		"knowledge_base_id": session.KnowledgeBaseID,
+		"title":             session.Title,
+		"created_at":        session.CreatedAt,
 	})
 }
 
@@ -61,8 +86,30 @@ func GetSessionsHandler(c *gin.Context) {
 		return
 	}
 
-	// 调用服务获取会话列表
-	sessions, err := services.GetSessionsByUserID(userID.(uint))
+	var query models.SessionListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	// 文件夹和标签仅用于整理个人会话，不能与工作区同时指定
+	if query.WorkspaceID != nil && (query.FolderID != nil || query.TagID != 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工作区会话不支持按文件夹或标签过滤"})
+		return
+	}
+
+	// 指定工作区时返回工作区的共享会话，否则返回个人会话
+	var sessions []models.ChatSession
+	var err error
+	if query.WorkspaceID != nil {
+		sessions, err = services.GetSessionsByWorkspace(*query.WorkspaceID, userID.(uint), query.Archived)
+		if errors.Is(err, services.ErrWorkspaceNotFound) || errors.Is(err, services.ErrWorkspaceForbidden) {
+			respondWorkspaceError(c, err)
+			return
+		}
+	} else {
+		sessions, err = services.GetSessionsByUserID(userID.(uint), query)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
 		return
@@ -82,23 +129,9 @@ func GetSessionHandler(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
-	// 调用服务获取会话详情
-	session, err := services.GetSessionByID(sessionID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话详情失败"})
-		return
-	}
-
-	// 验证会话所有权
-	if session.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+	// 获取会话并验证访问权限
+	session, ok := authorizeSession(c, sessionID, services.SessionPermissionRead)
+	if !ok {
 		return
 	}
 
@@ -110,9 +143,10 @@ func GetSessionHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"session_id": session.SessionID,
-		"title":      session.Title,
-		"messages":   messages,
+		"session_id":   session.SessionID,
+		"workspace_id": session.WorkspaceID,
+		"title":        session.Title,
+		"messages":     messages,
 	})
 }
 
@@ -130,23 +164,10 @@ func UpdateSessionHandler(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
-	// 获取现有会话
-	session, err := services.GetSessionByID(sessionID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话失败"})
-		return
-	}
-
-	// 验证会话所有权
-	if session.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此会话"})
+	// 获取现有会话并验证修改权限
+	session, ok := authorizeSession(c, sessionID, services.SessionPermissionWrite)
+	if !ok {
+		recordAudit(c, models.AuditActionSessionUpdate, "chat_session", sessionID, models.AuditResultFailure, "forbidden")
 		return
 	}
 
@@ -163,12 +184,54 @@ func UpdateSessionHandler(c *gin.Context) {
 		}
 	}
 
+	if req.IsArchived != nil {
+		session.IsArchived = *req.IsArchived
+	}
+
+	// 改用助手的最新版本，知识库随助手设置更新
+	if req.UpgradeAssistant && session.AssistantID != nil {
+		if err := services.ApplyAssistant(c.GetUint("userID"), session, *session.AssistantID); err != nil {
+			respondAssistantError(c, err)
+			return
+		}
+	}
+
+	if req.GenerationParams != nil {
+		session.GenerationParams = *req.GenerationParams
+	}
+
+	// 只能关联自己的知识库
+	if req.KnowledgeBaseID != nil {
+		if *req.KnowledgeBaseID == 0 {
+			session.KnowledgeBaseID = nil
+		} else {
+			if err := services.CheckKnowledgeBaseAccess(c.GetUint("userID"), *req.KnowledgeBaseID); err != nil {
+				if errors.Is(err, services.ErrKnowledgeBaseNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "查询知识库失败"})
+				}
+				return
+			}
+			session.KnowledgeBaseID = req.KnowledgeBaseID
+		}
+	}
+
 	// 保存更新
-	if err := services.UpdateSession(session); err != nil {
+	err := services.UpdateSession(session)
+	recordAudit(c, models.AuditActionSessionUpdate, "chat_session", sessionID, auditResult(err), "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新会话失败"})
 		return
 	}
 
+	services.PublishSessionEvent(sessionID, services.SessionEventSessionUpdated, c.GetUint("userID"), gin.H{
+		"title":             session.Title,
+		"is_pinned":         session.IsPinned,
+		"is_archived":       session.IsArchived,
+		"knowledge_base_id": session.KnowledgeBaseID,
+	})
+
 	c.JSON(http.StatusOK, session)
 }
 
@@ -180,36 +243,30 @@ func DeleteSessionHandler(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
-	// 获取现有会话
-	session, err := services.GetSessionByID(sessionID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话失败"})
-		return
-	}
-
-	// 验证会话所有权
-	if session.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权删除此会话"})
+	// 获取现有会话并验证删除权限
+	if _, ok := authorizeSession(c, sessionID, services.SessionPermissionDelete); !ok {
+		recordAudit(c, models.AuditActionSessionDelete, "chat_session", sessionID, models.AuditResultFailure, "forbidden")
 		return
 	}
 
 	// 删除会话及相关消息
-	if err := services.DeleteSession(sessionID); err != nil {
+	err := services.DeleteSession(sessionID)
+	recordAudit(c, models.AuditActionSessionDelete, "chat_session", sessionID, auditResult(err), "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除会话失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "会话已删除"})
+	services.PublishSessionEvent(sessionID, services.SessionEventSessionDeleted, c.GetUint("userID"), nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "会话已移入回收站"})
 }
 
 // SendMessageHandler 在指定会话中发送消息，并流式返回AI响应
+// 支持 multipart/form-data 请求，通过 files 字段上传附件
+// 指定 template_id 时用 variables 渲染提示词模板作为消息内容，content 作为补充内容附加在后面
+// 请求中的生成参数优先于会话和助手的设置
+// 指定 response_format 时要求回答为JSON，回复流最后以 $structured$ 返回解析后的对象和校验结果
 func SendMessageHandler(c *gin.Context) {
 	sessionID := c.Param("id")
 	if sessionID == "" {
@@ -218,16 +275,51 @@ func SendMessageHandler(c *gin.Context) {
 	}
 
 	var req struct {
-		Content      string `json:"content" binding:"required"`
-		DeepThinking bool   `json:"thinking"`             // 是否使用深度思考模式（使用reasoner模型）
-		MessageID    string `json:"message_id,omitempty"` // 可选的消息ID，用于重试
+		Content      string            `json:"content" form:"content"`
+		DeepThinking bool              `json:"thinking" form:"thinking"`                 // 是否使用深度思考模式（使用reasoner模型）
+		MessageID    string            `json:"message_id,omitempty" form:"message_id"`   // 可选的消息ID，用于重试
+		TemplateID   uint              `json:"template_id,omitempty" form:"template_id"` // 可选的提示词模板ID
+		Variables    map[string]string `json:"variables,omitempty" form:"-"`             // 模板变量，表单请求中为JSON字符串
+		models.GenerationParams
+		// 输出格式，表单请求中为JSON字符串
+		ResponseFormat *models.ResponseFormat `json:"response_format,omitempty" form:"-"`
+	}
+
+	isMultipart := c.ContentType() == gin.MIMEMultipartPOSTForm
+	if isMultipart {
+		// 限制请求体大小，预留表单字段的空间
+		maxBody := services.AttachmentMaxSize()*int64(services.AttachmentMaxFiles()) + 1<<20
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+	}
+
+	if err := c.ShouldBind(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "上传的附件过大"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式有误"})
+		}
+		return
 	}
-
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "请求数据格式有误"})
+	if isMultipart && c.PostForm("variables") != "" {
+		if err := json.Unmarshal([]byte(c.PostForm("variables")), &req.Variables); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "模板变量格式有误"})
+			return
+		}
+	}
+	if isMultipart && c.PostForm("response_format") != "" {
+		req.ResponseFormat = &models.ResponseFormat{}
+		if err := json.Unmarshal([]byte(c.PostForm("response_format")), req.ResponseFormat); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "输出格式有误"})
+			return
+		}
+	}
+	responseFormat, err := services.NewResponseFormat(req.ResponseFormat)
+	if err != nil {
+		respondResponseFormatError(c, err)
 		return
 	}
-	if req.Content == "" {
+	if req.Content == "" && req.TemplateID == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
 		return
 	}
@@ -239,17 +331,43 @@ func SendMessageHandler(c *gin.Context) {
 		return
 	}
 
-	// 验证会话存在且属于当前用户
-	session, err := services.GetSessionByID(sessionID)
+	// 验证会话存在且当前用户有发送消息的权限
+	session, ok := authorizeSession(c, sessionID, services.SessionPermissionWrite)
+	if !ok {
+		return
+	}
+
+	// 使用模板时渲染模板内容，缺少必填变量时不发送
+	if req.TemplateID != 0 {
+		rendered, err := services.RenderPromptTemplateForUser(userID.(uint), req.TemplateID, req.Variables)
+		if err != nil {
+			respondPromptTemplateError(c, err)
+			return
+		}
+		if req.Content != "" {
+			rendered += "\n\n" + req.Content
+		}
+		req.Content = rendered
+	}
+
+	// 工作区会话使用工作区的默认提示词和模型
+	chatOptions, err := services.ResolveChatOptions(session, req.DeepThinking)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话失败"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话设置失败"})
 		return
 	}
 
-	if session.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+	// 获取AI服务实例，会话使用的模型由对应的服务商生成
+	aiService := services.ResolveChatService(&chatOptions)
+	modelName := aiService.ResolveModel(chatOptions)
+
+	// 请求指定的生成参数需要被模型支持
+	if err := services.ValidateGenerationParams(modelName, req.GenerationParams); err != nil {
+		respondGenerationParamsError(c, err)
 		return
 	}
+	chatOptions.Params = services.MergeGenerationParams(chatOptions.Params, req.GenerationParams)
+	chatOptions.ResponseFormat = responseFormat
 
 	// 生成消息ID
 	messageID := req.MessageID
@@ -257,26 +375,56 @@ func SendMessageHandler(c *gin.Context) {
 		messageID = uuid.New().String()
 	}
 
+	// 支持工具调用的模型可以使用内置工具和会话启用的MCP服务器提供的工具，使用助手时只提供助手选择的工具
+	if services.ModelSupportsTools(modelName) {
+		tools := append(services.ListTools(), services.SessionMCPTools(c.Request.Context(), sessionID)...)
+		chatOptions.Tools = services.FilterTools(tools, chatOptions.AllowedTools)
+		chatOptions.ToolEnv = services.ToolEnv{UserID: userID.(uint), SessionID: sessionID, MessageID: messageID}
+	}
+
 	// 判断是否是重试
 	isRetry := req.MessageID != ""
 	var version int = 1
+	var attachments []models.Attachment
+
+	// 读取上传的附件，重试时沿用原消息的附件
+	var uploads []services.AttachmentUpload
+	if isMultipart && !isRetry {
+		uploads, ok = readAttachmentUploads(c)
+		if !ok {
+			return
+		}
+		// 图片需要模型支持，在保存任何内容之前检查
+		for _, upload := range uploads {
+			if upload.IsImage() && !services.ModelSupportsVision(modelName) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "当前模型不支持图片输入: " + modelName})
+				return
+			}
+		}
+	}
 
 	if isRetry {
-		// 如果是重试，先检查原始消息是否存在
-		_, err := services.GetMessageByID(messageID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无法找到原始消息"})
+		// 如果是重试，先检查原始消息是否存在并且属于当前会话
+		original, err := services.GetMessageByID(messageID)
+		if err != nil || original.SessionID != sessionID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "无法找到原始消息"})
 			return
 		}
 
-		// 获取所有响应，确定新的版本号
-		responses, err := services.GetAIResponsesByMessageID(messageID)
-		if err == nil {
-			version = len(responses) + 2 // 原始消息是版本1，新回答版本递增
-		} else {
-			version = 2 // 没有找到额外回答，这是第一次重试
+		attachments, err = services.GetMessageAttachments(messageID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息附件失败"})
+			return
 		}
 	} else {
+		if len(uploads) > 0 {
+			attachments, err = services.SaveAttachments(c.Request.Context(), userID.(uint), sessionID, messageID, uploads)
+			if err != nil {
+				respondAttachmentError(c, err)
+				return
+			}
+		}
+
 		// 创建用户消息
 		userMessage := models.ChatMessage{
 			UserID:    userID.(uint),
@@ -290,9 +438,46 @@ func SendMessageHandler(c *gin.Context) {
 
 		// 保存用户消息
 		if err := services.SaveMessage(&userMessage); err != nil {
+			services.DeleteAttachments(c.Request.Context(), attachments)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
 			return
 		}
+		userMessage.Attachments = attachments
+		services.PublishSessionEvent(sessionID, services.SessionEventMessageCreated, userID.(uint), userMessage)
+
+		if req.TemplateID != 0 {
+			if err := services.IncrementPromptTemplateUsage(req.TemplateID); err != nil {
+				fmt.Printf("更新模板使用次数失败: %v\n", err)
+			}
+		}
+	}
+
+	// 检索会话关联的知识库，检索失败时不使用参考资料继续回答
+	citations, err := services.RetrieveSessionKnowledge(c.Request.Context(), session, req.Content)
+	if err != nil {
+		fmt.Printf("检索知识库失败: %v\n", err)
+		citations = nil
+	}
+
+	// 组合附件内容，图片作为多段内容发送
+	chatMessage, err := services.BuildUserChatMessage(c.Request.Context(), attachments, services.BuildKnowledgePrompt(citations, req.Content))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取消息附件失败"})
+		return
+	}
+	if err := services.CheckVisionSupport(modelName, chatMessage); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "当前模型不支持图片输入: " + modelName})
+		return
+	}
+
+	// 重试时预留新的回答版本，原始消息是版本1
+	if isRetry {
+		versions, err := services.ReserveResponseVersions(sessionID, messageID, 1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "分配回答版本失败"})
+			return
+		}
+		version = versions[0]
 	}
 
 	// 设置流式响应头
@@ -305,14 +490,25 @@ func SendMessageHandler(c *gin.Context) {
 	// 刷新响应头
 	c.Writer.Flush()
 
-	// 添加一个包装器，在每次写入后刷新缓冲区
-	flushWriter := &FlushWriter{Writer: c.Writer}
+	// 添加一个包装器，在每次写入后刷新缓冲区，同时广播给会话的其他查看者
+	flushWriter := io.MultiWriter(&FlushWriter{Writer: c.Writer}, &services.SessionStreamWriter{
+		SessionID: sessionID,
+		MessageID: messageID,
+		Version:   version,
+		UserID:    userID.(uint),
+	})
 
-	// 获取AI服务实例
-	aiService := services.GetDefaultDeepSeekService()
+	// 调用流式API获取回复
+	result, genErr := aiService.RunChat([]services.ChatMessage{chatMessage}, chatOptions, flushWriter)
+	aiReply, aiThinking := result.Content, result.Thinking
 
-	// 调用流式API获取回复，传递deep_thinking参数
-	aiReply, aiThinking, _ := aiService.StreamChatResponse(req.Content, flushWriter, req.DeepThinking)
+	// 生成失败的回答也保存一个版本，保证版本号连续，但不会被激活
+	if genErr != nil {
+		fmt.Printf("会话 %s 生成回答失败: %v\n", sessionID, genErr)
+		if aiReply == "" {
+			aiReply = "生成失败: " + genErr.Error()
+		}
+	}
 
 	// 根据是否是重试，决定保存到哪个表
 	if isRetry {
@@ -324,15 +520,34 @@ func SendMessageHandler(c *gin.Context) {
 			Content:      aiReply,
 			Version:      version,
 			IsActive:     false, // 默认不激活新回答
+			ModelName:    modelName,
+			Citations:    citations,
+			// 记录实际使用的生成参数和系统提示词
+			GenerationParams: &result.Params,
+			SystemPrompt:     result.SystemPrompt,
 		}
 
 		// 保存AI响应
 		if err := services.SaveAIResponse(&aiResponse); err != nil {
 			fmt.Printf("保存AI回复失败: %v\n", err)
+		} else {
+			if err := services.SaveMessageCitations(sessionID, messageID, version, citations); err != nil {
+				fmt.Printf("保存回答引用失败: %v\n", err)
+			}
+			if aiResponse.ToolCalls, err = services.SaveToolCalls(sessionID, messageID, version, result.ToolCalls); err != nil {
+				fmt.Printf("保存工具调用记录失败: %v\n", err)
+			}
 		}
+		services.PublishSessionEvent(sessionID, services.SessionEventMessageCompleted, userID.(uint), aiResponse)
 
-		// 返回响应版本信息
-		c.Writer.Write([]byte(fmt.Sprintf("\n\n$responseVersion$%d", version)))
+		// 返回引用、结构化输出和响应版本信息，失败时只返回错误
+		if genErr != nil {
+			writeGenerationError(c, genErr)
+		} else {
+			writeCitations(c, citations)
+			writeStructuredOutput(c, result.Structured)
+			c.Writer.Write([]byte(fmt.Sprintf("\n\n$responseVersion$%d", version)))
+		}
 	} else {
 		// 创建AI消息并保存到数据库（使用完整的回复内容）
 		aiMessage := models.ChatMessage{
@@ -343,17 +558,36 @@ func SendMessageHandler(c *gin.Context) {
 			ThinkContent: aiThinking,
 			Content:      aiReply,
 			Version:      1,
-			IsActive:     true,
+			IsActive:     genErr == nil,
+			ModelName:    modelName,
+			Citations:    citations,
+			// 记录实际使用的生成参数和系统提示词
+			GenerationParams: &result.Params,
+			SystemPrompt:     result.SystemPrompt,
 		}
 
 		// 保存AI消息
 		if err := services.SaveMessage(&aiMessage); err != nil {
 			// 仅记录错误，不中断响应
 			fmt.Printf("保存AI回复失败: %v\n", err)
+		} else {
+			if err := services.SaveMessageCitations(sessionID, messageID, 1, citations); err != nil {
+				fmt.Printf("保存回答引用失败: %v\n", err)
+			}
+			if aiMessage.ToolCalls, err = services.SaveToolCalls(sessionID, messageID, 1, result.ToolCalls); err != nil {
+				fmt.Printf("保存工具调用记录失败: %v\n", err)
+			}
 		}
+		services.PublishSessionEvent(sessionID, services.SessionEventMessageCompleted, userID.(uint), aiMessage)
 
-		// 返回消息ID
-		c.Writer.Write([]byte(fmt.Sprintf("\n\n$messageId$%s", messageID)))
+		// 返回引用、结构化输出和消息ID，失败时只返回错误
+		if genErr != nil {
+			writeGenerationError(c, genErr)
+		} else {
+			writeCitations(c, citations)
+			writeStructuredOutput(c, result.Structured)
+			c.Writer.Write([]byte(fmt.Sprintf("\n\n$messageId$%s", messageID)))
+		}
 	}
 
 	// 更新会话的最后更新时间
@@ -363,6 +597,57 @@ func SendMessageHandler(c *gin.Context) {
 	}
 }
 
+// respondGenerationParamsError 返回生成参数校验的错误
+func respondGenerationParamsError(c *gin.Context, err error) {
+	var paramsErr *services.InvalidGenerationParamsError
+	if errors.As(err, &paramsErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": paramsErr.Reason, "param": paramsErr.Param})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "生成参数无效"})
+}
+
+// writeGenerationError 在流式回复之后返回生成失败的原因，代替消息ID或版本信息
+func writeGenerationError(c *gin.Context, err error) {
+	c.Writer.Write([]byte("\n\n$error$生成回答失败: " + err.Error()))
+}
+
+// writeCitations 在流式回复之后返回引用的知识库片段，没有引用时不输出
+func writeCitations(c *gin.Context, citations []models.MessageCitation) {
+	if len(citations) == 0 {
+		return
+	}
+	data, err := json.Marshal(citations)
+	if err != nil {
+		return
+	}
+	c.Writer.Write([]byte("\n\n$citations$"))
+	c.Writer.Write(data)
+}
+
+// respondResponseFormatError 返回输出格式校验的错误
+func respondResponseFormatError(c *gin.Context, err error) {
+	var formatErr *services.InvalidResponseFormatError
+	if errors.As(err, &formatErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "输出格式有误: " + formatErr.Reason})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "输出格式有误"})
+}
+
+// writeStructuredOutput 返回结构化输出的解析和校验结果，未要求输出JSON时不输出
+func writeStructuredOutput(c *gin.Context, output *services.StructuredOutput) {
+	if output == nil {
+		return
+	}
+	data, err := json.Marshal(output)
+	if err != nil {
+		return
+	}
+	c.Writer.Write([]byte("\n\n$structured$"))
+	c.Writer.Write(data)
+}
+
 // FlushWriter 用于确保每次写入后立即刷新
 type FlushWriter struct {
 	Writer gin.ResponseWriter
@@ -383,22 +668,8 @@ func GetMessagesHandler(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
-	// 验证会话存在且属于当前用户
-	session, err := services.GetSessionByID(sessionID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话失败"})
-		return
-	}
-
-	if session.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+	// 验证会话存在且当前用户有查看权限
+	if _, ok := authorizeSession(c, sessionID, services.SessionPermissionRead); !ok {
 		return
 	}
 
@@ -431,6 +702,8 @@ func RetryMessageHandler(c *gin.Context) {
 	var req struct {
 		MessageID    string `json:"message_id" binding:"required"`
 		DeepThinking bool   `json:"thinking"` // 是否使用深度思考模式
+		models.GenerationParams
+		ResponseFormat *models.ResponseFormat `json:"response_format,omitempty"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -480,19 +753,27 @@ func RetryMessageHandler(c *gin.Context) {
 		Content      string `json:"content"`
 		DeepThinking bool   `json:"thinking"`
 		MessageID    string `json:"message_id"`
+		models.GenerationParams
+		ResponseFormat *models.ResponseFormat `json:"response_format,omitempty"`
 	}{
-		Content:      userMessage.Content,
-		DeepThinking: req.DeepThinking,
-		MessageID:    req.MessageID,
+		Content:          userMessage.Content,
+		DeepThinking:     req.DeepThinking,
+		MessageID:        req.MessageID,
+		GenerationParams: req.GenerationParams,
+		ResponseFormat:   req.ResponseFormat,
 	}
 
 	// 将原始请求参数传递给SendMessageHandler
 	c.Set("retryRequest", retryReq)
+	body, err := json.Marshal(retryReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "构建重试请求失败"})
+		return
+	}
 
 	// 设置参数并调用SendMessageHandler
 	c.Params = append(c.Params, gin.Param{Key: "id", Value: message.SessionID})
-	c.Request.Body = io.NopCloser(strings.NewReader(fmt.Sprintf(`{"content":"%s","thinking":%v,"message_id":"%s"}`,
-		userMessage.Content, req.DeepThinking, req.MessageID)))
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 
 	SendMessageHandler(c)
 }
@@ -509,13 +790,6 @@ func SetActiveResponseHandler(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
 	// 获取消息
 	message, err := services.GetMessageByID(req.MessageID)
 	if err != nil {
@@ -524,9 +798,7 @@ func SetActiveResponseHandler(c *gin.Context) {
 	}
 
 	// 验证用户是否有权限修改此会话
-	session, err := services.GetSessionByID(message.SessionID)
-	if err != nil || session.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此会话"})
+	if _, ok := authorizeSession(c, message.SessionID, services.SessionPermissionWrite); !ok {
 		return
 	}
 
@@ -536,5 +808,44 @@ func SetActiveResponseHandler(c *gin.Context) {
 		return
 	}
 
+	services.PublishSessionEvent(message.SessionID, services.SessionEventResponseActivated, c.GetUint("userID"), gin.H{
+		"message_id": req.MessageID,
+		"version":    req.Version,
+	})
+
 	c.JSON(http.StatusOK, gin.H{"message": "已设置活跃版本"})
 }
+
+// authorizeSession 获取会话并检查当前用户的访问权限，失败时直接写入错误响应
+func authorizeSession(c *gin.Context, sessionID string, permission services.SessionPermission) (*models.ChatSession, bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return nil, false
+	}
+
+	session, err := services.GetSessionByID(sessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话失败"})
+		}
+		return nil, false
+	}
+
+	if err := services.CheckSessionAccess(userID.(uint), session, permission); err != nil {
+		if errors.Is(err, services.ErrSessionForbidden) {
+			if permission == services.SessionPermissionRead {
+				c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+			} else {
+				c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此会话"})
+			}
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检查会话权限失败"})
+		}
+		return nil, false
+	}
+
+	return session, true
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// compareEventWriter 向同一个SSE响应并发写入事件
+type compareEventWriter struct {
+	mu     sync.Mutex
+	writer gin.ResponseWriter
+}
+
+// send 写入一个SSE事件并立即刷新
+func (w *compareEventWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := fmt.Fprintf(w.writer, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return nil
+}
+
+// compareChannelWriter 将单个模型的流式输出写为带模型标识的 delta 事件
+type compareChannelWriter struct {
+	events  *compareEventWriter
+	model   string
+	version int
+}
+
+// Write 实现io.Writer接口，片段内容与普通流式响应一致，包括思考结束标记
+func (w *compareChannelWriter) Write(p []byte) (int, error) {
+	if err := w.events.send("delta", gin.H{"model": w.model, "version": w.version, "delta": string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ListModelsHandler 获取可供选择的模型
+func ListModelsHandler(c *gin.Context) {
+	modelList := services.ListModels()
+	c.JSON(http.StatusOK, gin.H{"models": modelList, "total": len(modelList)})
+}
+
+// CompareModelsHandler 将同一个问题并发发送给多个模型进行对比
+// 以SSE返回：delta 事件为各模型的流式片段，done 事件为单个模型的结果，最后的 end 事件包含消息ID
+// 各模型的回答保存为同一消息的不同版本，用户可通过设置活跃版本选出最佳回答
+func CompareModelsHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req models.CompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择2到4个不同的模型"})
+		return
+	}
+	if req.Content == "" && req.MessageID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
+		return
+	}
+	for _, modelID := range req.Models {
+		if _, err := services.GetModelService(modelID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的模型: " + modelID})
+			return
+		}
+	}
+
+	session, ok := authorizeSession(c, sessionID, services.SessionPermissionWrite)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("userID")
+
+	chatOptions, err := services.ResolveChatOptions(session, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话设置失败"})
+		return
+	}
+
+	// 新问题的第一个模型的回答作为版本1保存在消息表中，其余保存为替代回答
+	// 对已有问题重新对比时全部作为新的替代回答
+	messageID := req.MessageID
+	content := req.Content
+	isNew := messageID == ""
+	var attachments []models.Attachment
+	if isNew {
+		messageID = uuid.New().String()
+		userMessage := models.ChatMessage{
+			UserID:    userID,
+			SessionID: sessionID,
+			Role:      "user",
+			MessageID: messageID,
+			Content:   content,
+			IsActive:  true,
+			Version:   1,
+		}
+		if err := services.SaveMessage(&userMessage); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存消息失败"})
+			return
+		}
+		services.PublishSessionEvent(sessionID, services.SessionEventMessageCreated, userID, userMessage)
+	} else {
+		question, err := services.GetMessageByID(messageID)
+		if err != nil || question.SessionID != sessionID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无法找到原始消息"})
+			return
+		}
+		if question.Role == "user" {
+			content = question.Content
+			if attachments, err = services.GetMessageAttachments(messageID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "获取消息附件失败"})
+				return
+			}
+		} else if content == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "消息内容不能为空"})
+			return
+		}
+	}
+
+	chatMessage, err := services.BuildUserChatMessage(c.Request.Context(), attachments, content)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取消息附件失败"})
+		return
+	}
+	// 问题包含图片时所有参与对比的模型都需要支持图片输入
+	for _, model := range req.Models {
+		if err := services.CheckVisionSupport(model, chatMessage); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "当前模型不支持图片输入: " + model})
+			return
+		}
+	}
+
+	// 替代回答的版本号在事务中预留，避免并发的重试或对比得到相同的版本号
+	reserveCount := len(req.Models)
+	if isNew {
+		reserveCount--
+	}
+	reserved, err := services.ReserveResponseVersions(sessionID, messageID, reserveCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "分配回答版本失败"})
+		return
+	}
+	versions := reserved
+	if isNew {
+		versions = append([]int{1}, reserved...)
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no") // 禁用Nginx缓冲
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	events := &compareEventWriter{writer: c.Writer}
+	events.send("start", gin.H{"message_id": messageID, "models": req.Models, "versions": versions})
+
+	results := services.CompareModels([]services.ChatMessage{chatMessage},
+		chatOptions, req.Models, versions,
+		func(model string, version int) io.Writer {
+			return io.MultiWriter(&compareChannelWriter{events: events, model: model, version: version},
+				&services.SessionStreamWriter{SessionID: sessionID, MessageID: messageID, Version: version, UserID: userID})
+		})
+
+	// 新问题激活第一个生成成功的回答，全部失败时不激活任何版本
+	activeVersion := 0
+	if isNew {
+		for _, result := range results {
+			if result.Err == nil {
+				activeVersion = result.Version
+				break
+			}
+		}
+	}
+
+	for _, result := range results {
+		// 失败的模型也保存一个版本，保证版本号连续
+		answer := result.Content
+		errMessage := ""
+		if result.Err != nil {
+			errMessage = result.Err.Error()
+			log.Printf("模型 %s 对比生成失败: %v", result.Model, result.Err)
+			if answer == "" {
+				answer = "生成失败: " + errMessage
+			}
+		}
+
+		params := result.Params
+		var saved interface{}
+		if isNew && result.Version == 1 {
+			aiMessage := models.ChatMessage{
+				SessionID:    sessionID,
+				Role:         "ai",
+				MessageID:    messageID,
+				ThinkContent: result.Thinking,
+				Content:      answer,
+				Version:      1,
+				IsActive:     result.Version == activeVersion,
+				ModelName:    result.Model,
+				// 记录实际使用的生成参数和系统提示词
+				GenerationParams: &params,
+				SystemPrompt:     result.SystemPrompt,
+			}
+			err = services.SaveMessage(&aiMessage)
+			saved = aiMessage
+		} else {
+			aiResponse := models.AIResponse{
+				MessageID:    messageID,
+				SessionID:    sessionID,
+				ThinkContent: result.Thinking,
+				Content:      answer,
+				Version:      result.Version,
+				IsActive:     result.Version == activeVersion,
+				ModelName:    result.Model,
+				// 记录实际使用的生成参数和系统提示词
+				GenerationParams: &params,
+				SystemPrompt:     result.SystemPrompt,
+			}
+			err = services.SaveAIResponse(&aiResponse)
+			saved = aiResponse
+		}
+		if err != nil {
+			log.Printf("保存对比回答失败: %v", err)
+			if errMessage == "" {
+				errMessage = "保存回答失败"
+			}
+		}
+		services.PublishSessionEvent(sessionID, services.SessionEventMessageCompleted, userID, saved)
+
+		done := gin.H{"model": result.Model, "version": result.Version, "active": result.Version == activeVersion}
+		if errMessage != "" {
+			done["error"] = errMessage
+		}
+		events.send("done", done)
+	}
+
+	if err := services.UpdateSession(session); err != nil {
+		log.Printf("更新会话失败: %v", err)
+	}
+	events.send("end", gin.H{"message_id": messageID})
+}
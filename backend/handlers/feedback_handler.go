@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondFeedbackError 返回回答评价的通用错误
+func respondFeedbackError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrMessageNotFound) || errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回答不存在"})
+	} else if errors.Is(err, services.ErrFeedbackNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "尚未评价该回答"})
+	} else if errors.Is(err, services.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此会话"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// SubmitFeedbackHandler 评价AI回答
+func SubmitFeedbackHandler(c *gin.Context) {
+	var req models.MessageFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	feedback, err := services.SubmitFeedback(c.GetUint("userID"), c.Param("id"), req)
+	if err != nil {
+		respondFeedbackError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, feedback)
+}
+
+// DeleteFeedbackHandler 撤回对AI回答的评价
+func DeleteFeedbackHandler(c *gin.Context) {
+	version := 0
+	if value := c.Query("version"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号"})
+			return
+		}
+		version = parsed
+	}
+
+	if err := services.DeleteFeedback(c.GetUint("userID"), c.Param("id"), version); err != nil {
+		respondFeedbackError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "评价已撤回"})
+}
+
+// GetFeedbackStatsHandler 按模型统计回答评价
+func GetFeedbackStatsHandler(c *gin.Context) {
+	var query models.FeedbackQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	stats, err := services.GetFeedbackStats(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取反馈统计失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"models": stats, "total": len(stats)})
+}
+
+// ExportFeedbackHandler 将回答评价导出为JSONL，用于构建评测数据集
+func ExportFeedbackHandler(c *gin.Context) {
+	var query models.FeedbackQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	filename := "feedback-" + time.Now().Format("20060102150405") + ".jsonl"
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	err := services.ExportFeedbackJSONL(query, c.Writer)
+	recordAudit(c, models.AuditActionAdminFeedbackExport, "feedback", "", auditResult(err), c.Request.URL.RawQuery)
+	if err != nil {
+		// 响应头已发送，只能中断输出
+		c.Error(err)
+	}
+}
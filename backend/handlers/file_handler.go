@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFileHandler 读取公开文件处理器，例如用户头像
+func GetFileHandler(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	reader, info, err := services.OpenPublicFile(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrBlobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败: " + err.Error()})
+		}
+		return
+	}
+	defer reader.Close()
+
+	// 文件键每次上传都会变化，可以长期缓存
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", info.ContentType)
+	if info.Size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, reader)
+}
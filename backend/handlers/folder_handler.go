@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseIDParam 解析路径中的数字ID
+func parseIDParam(c *gin.Context, name, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondOrganizeError 返回文件夹、标签和批量操作的通用错误
+func respondOrganizeError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrFolderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件夹不存在"})
+	} else if errors.Is(err, services.ErrFolderCycle) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能将文件夹移动到自身或其子文件夹中"})
+	} else if errors.Is(err, services.ErrFolderTooDeep) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件夹层级过深"})
+	} else if errors.Is(err, services.ErrTagNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "标签不存在"})
+	} else if errors.Is(err, services.ErrTagExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "标签已存在"})
+	} else if errors.Is(err, services.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+	} else if errors.Is(err, services.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能整理自己的个人会话"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// ListFoldersHandler 获取文件夹列表
+func ListFoldersHandler(c *gin.Context) {
+	folders, err := services.ListFolders(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取文件夹失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"folders": folders, "total": len(folders)})
+}
+
+// CreateFolderHandler 创建文件夹
+func CreateFolderHandler(c *gin.Context) {
+	var req models.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	folder, err := services.CreateFolder(c.GetUint("userID"), req)
+	if err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, folder)
+}
+
+// UpdateFolderHandler 重命名或移动文件夹
+func UpdateFolderHandler(c *gin.Context) {
+	folderID, ok := parseIDParam(c, "id", "无效的文件夹ID")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	folder, err := services.UpdateFolder(c.GetUint("userID"), folderID, req)
+	if err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, folder)
+}
+
+// DeleteFolderHandler 删除文件夹，其中的内容移动到上一级
+func DeleteFolderHandler(c *gin.Context) {
+	folderID, ok := parseIDParam(c, "id", "无效的文件夹ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteFolder(c.GetUint("userID"), folderID); err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "文件夹已删除"})
+}
+
+// ListTagsHandler 获取标签列表
+func ListTagsHandler(c *gin.Context) {
+	tags, err := services.ListTags(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tags": tags, "total": len(tags)})
+}
+
+// CreateTagHandler 创建标签
+func CreateTagHandler(c *gin.Context) {
+	var req models.CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	tag, err := services.CreateTag(c.GetUint("userID"), req)
+	if err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, tag)
+}
+
+// UpdateTagHandler 修改标签
+func UpdateTagHandler(c *gin.Context) {
+	tagID, ok := parseIDParam(c, "id", "无效的标签ID")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	tag, err := services.UpdateTag(c.GetUint("userID"), tagID, req)
+	if err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tag)
+}
+
+// DeleteTagHandler 删除标签
+func DeleteTagHandler(c *gin.Context) {
+	tagID, ok := parseIDParam(c, "id", "无效的标签ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteTag(c.GetUint("userID"), tagID); err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "标签已删除"})
+}
+
+// BulkMoveSessionsHandler 批量移动会话到文件夹
+func BulkMoveSessionsHandler(c *gin.Context) {
+	var req models.BulkMoveSessionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if err := services.MoveSessions(c.GetUint("userID"), req.SessionIDs, *req.FolderID); err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "会话已移动", "count": len(req.SessionIDs)})
+}
+
+// BulkTagSessionsHandler 批量添加或移除会话标签
+func BulkTagSessionsHandler(c *gin.Context) {
+	var req models.BulkTagSessionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定要添加或移除的标签"})
+		return
+	}
+
+	if err := services.TagSessions(c.GetUint("userID"), req.SessionIDs, req.Add, req.Remove); err != nil {
+		respondOrganizeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "标签已更新", "count": len(req.SessionIDs)})
+}
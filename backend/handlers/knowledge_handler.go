@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondKnowledgeError 返回知识库操作的通用错误
+func respondKnowledgeError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrKnowledgeBaseNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "知识库不存在"})
+	} else if errors.Is(err, services.ErrKnowledgeDocumentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+	} else if errors.Is(err, services.ErrDocumentTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("单个文档不能超过%dMB", services.KnowledgeDocumentMaxSize()>>20)})
+	} else if errors.Is(err, services.ErrUnsupportedDocument) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的文档类型，请上传文本文件或PDF"})
+	} else if errors.Is(err, services.ErrEmptyDocument) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文档中没有可提取的文本"})
+	} else if errors.Is(err, services.ErrEmptyAttachmentName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件名不能为空"})
+	} else if errors.Is(err, services.ErrEmbeddingModelChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "向量化模型已变更，请先重建知识库索引"})
+	} else if errors.Is(err, services.ErrEmbedderNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未配置向量化模型"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// ListKnowledgeBasesHandler 获取当前用户的知识库
+func ListKnowledgeBasesHandler(c *gin.Context) {
+	kbs, err := services.ListKnowledgeBases(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取知识库失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"knowledge_bases": kbs})
+}
+
+// CreateKnowledgeBaseHandler 创建知识库
+func CreateKnowledgeBaseHandler(c *gin.Context) {
+	var req models.CreateKnowledgeBaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	kb, err := services.CreateKnowledgeBase(c.GetUint("userID"), req)
+	if err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, kb)
+}
+
+// UpdateKnowledgeBaseHandler 修改知识库名称和描述
+func UpdateKnowledgeBaseHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+
+	var req models.UpdateKnowledgeBaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	kb, err := services.UpdateKnowledgeBase(c.GetUint("userID"), kbID, req)
+	if err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, kb)
+}
+
+// DeleteKnowledgeBaseHandler 删除知识库及其全部文档
+func DeleteKnowledgeBaseHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteKnowledgeBase(c.Request.Context(), c.GetUint("userID"), kbID); err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "知识库已删除"})
+}
+
+// ListKnowledgeDocumentsHandler 获取知识库中的文档
+func ListKnowledgeDocumentsHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+
+	documents, err := services.ListKnowledgeDocuments(c.GetUint("userID"), kbID)
+	if err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"documents": documents})
+}
+
+// UploadKnowledgeDocumentHandler 上传文档到知识库，文件通过表单的 file 字段上传
+// 切块和向量化在请求中完成，向量化失败时文档保留为失败状态
+func UploadKnowledgeDocumentHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.KnowledgeDocumentMaxSize()+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondKnowledgeError(c, services.ErrDocumentTooLarge)
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的文档"})
+		}
+		return
+	}
+	if fileHeader.Size > services.KnowledgeDocumentMaxSize() {
+		respondKnowledgeError(c, services.ErrDocumentTooLarge)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, services.KnowledgeDocumentMaxSize()+1))
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+		return
+	}
+
+	document, err := services.AddKnowledgeDocument(c.Request.Context(), c.GetUint("userID"), kbID,
+		services.AttachmentUpload{FileName: fileHeader.Filename, Data: data})
+	if err != nil {
+		if document != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "文档处理失败: " + err.Error(), "document": document})
+			return
+		}
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, document)
+}
+
+// DeleteKnowledgeDocumentHandler 删除知识库中的文档
+func DeleteKnowledgeDocumentHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+	documentID, ok := parseIDParam(c, "documentId", "无效的文档ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteKnowledgeDocument(c.Request.Context(), c.GetUint("userID"), kbID, documentID); err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "文档已删除"})
+}
+
+// ReindexKnowledgeBaseHandler 使用当前的向量化模型重建知识库索引
+func ReindexKnowledgeBaseHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+
+	kb, failed, err := services.ReindexKnowledgeBase(c.Request.Context(), c.GetUint("userID"), kbID)
+	if err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"knowledge_base": kb, "failed": failed})
+}
+
+// SearchKnowledgeBaseHandler 在知识库中检索，用于查看检索效果
+func SearchKnowledgeBaseHandler(c *gin.Context) {
+	kbID, ok := parseIDParam(c, "id", "无效的知识库ID")
+	if !ok {
+		return
+	}
+
+	var req models.KnowledgeSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	results, err := services.SearchKnowledgeBase(c.Request.Context(), c.GetUint("userID"), kbID, req)
+	if err != nil {
+		respondKnowledgeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSessionMCPServersHandler 获取会话可用的MCP服务器及其启用状态和工具
+func ListSessionMCPServersHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, ok := authorizeSession(c, sessionID, services.SessionPermissionRead); !ok {
+		return
+	}
+
+	servers, err := services.ListSessionMCPServers(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取MCP服务器失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"servers": servers, "total": len(servers)})
+}
+
+// UpdateSessionMCPServerHandler 启用或停用会话的MCP服务器
+func UpdateSessionMCPServerHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+	if _, ok := authorizeSession(c, sessionID, services.SessionPermissionWrite); !ok {
+		return
+	}
+
+	var req models.UpdateSessionMCPServerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	name := c.Param("name")
+	if err := services.SetSessionMCPServer(sessionID, name, *req.Enabled); err != nil {
+		if errors.Is(err, services.ErrMCPServerNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "MCP服务器不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新MCP设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"server_name": name, "enabled": *req.Enabled})
+}
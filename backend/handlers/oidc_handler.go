@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCLoginHandler 跳转到身份提供方进行单点登录
+func OIDCLoginHandler(c *gin.Context) {
+	provider, err := services.GetOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	authURL, stateCookie, err := provider.AuthCodeURL(c.Request.Context(), services.OIDCPurposeLogin, 0)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "连接身份提供方失败: " + err.Error()})
+		return
+	}
+
+	setOIDCStateCookie(c, stateCookie, int(services.OIDCStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCLinkHandler 已登录用户发起外部身份绑定，返回身份提供方的授权地址，由前端跳转
+func OIDCLinkHandler(c *gin.Context) {
+	// 代登录时绑定的外部身份会在代登录结束后继续可用
+	if _, impersonated := c.Get("impersonatorID"); impersonated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "代登录状态下不能绑定外部身份"})
+		return
+	}
+	oidcStartForUser(c, services.OIDCPurposeLink)
+}
+
+// OIDCReauthHandler 已登录用户通过单点登录重新认证，回调后获得用于确认注销账号的短期凭证
+func OIDCReauthHandler(c *gin.Context) {
+	oidcStartForUser(c, services.OIDCPurposeReauth)
+}
+
+// oidcStartForUser 为当前登录的用户发起指定用途的授权请求
+func oidcStartForUser(c *gin.Context, purpose string) {
+	provider, err := services.GetOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	authURL, stateCookie, err := provider.AuthCodeURL(c.Request.Context(), purpose, c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "连接身份提供方失败: " + err.Error()})
+		return
+	}
+
+	setOIDCStateCookie(c, stateCookie, int(services.OIDCStateTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// setOIDCStateCookie 写入或清除授权状态Cookie，只在回调路径下发送且脚本不可读取
+// 身份提供方通过顶级跳转回调，SameSite=Lax 下Cookie仍会随回调请求发送
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(services.OIDCStateCookie, value, maxAge, "/api/auth/oidc", "", secure, true)
+}
+
+// OIDCCallbackHandler 处理身份提供方的授权回调
+func OIDCCallbackHandler(c *gin.Context) {
+	provider, err := services.GetOIDCProvider()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	// 身份提供方返回的错误，例如用户拒绝授权
+	if idpError := c.Query("error"); idpError != "" {
+		oidcFail(c, provider, http.StatusUnauthorized, idpError, "单点登录失败: "+idpError)
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		oidcFail(c, provider, http.StatusBadRequest, "invalid_request", "缺少授权参数")
+		return
+	}
+
+	// 授权状态只能使用一次
+	stateCookie, _ := c.Cookie(services.OIDCStateCookie)
+	setOIDCStateCookie(c, "", -1)
+
+	result, err := provider.HandleCallback(c.Request.Context(), stateCookie, state, code, c.ClientIP())
+	if err != nil {
+		recordAudit(c, models.AuditActionOIDCLogin, "", "", models.AuditResultFailure, err.Error())
+
+		if errors.Is(err, services.ErrOIDCInvalidState) {
+			oidcFail(c, provider, http.StatusBadRequest, "invalid_state", "登录请求已失效，请重新登录")
+		} else if errors.Is(err, services.ErrOIDCInvalidIDToken) {
+			oidcFail(c, provider, http.StatusUnauthorized, "invalid_token", "身份令牌校验失败")
+		} else if errors.Is(err, services.ErrOIDCEmailNotVerified) {
+			oidcFail(c, provider, http.StatusForbidden, "email_not_verified", "身份提供方未验证邮箱")
+		} else if errors.Is(err, services.ErrOIDCLinkRequired) {
+			oidcFail(c, provider, http.StatusConflict, "link_required", "该邮箱已注册，请登录原账号后绑定单点登录")
+		} else if errors.Is(err, services.ErrOIDCIdentityInUse) {
+			oidcFail(c, provider, http.StatusConflict, "identity_in_use", "该身份已绑定其他账号")
+		} else if errors.Is(err, services.ErrOIDCIdentityMismatch) {
+			oidcFail(c, provider, http.StatusForbidden, "identity_mismatch", "该身份未绑定当前账号")
+		} else if errors.Is(err, services.ErrUserDisabled) {
+			oidcFail(c, provider, http.StatusForbidden, "user_disabled", "账号已被禁用")
+		} else {
+			oidcFail(c, provider, http.StatusInternalServerError, "server_error", "单点登录失败: "+err.Error())
+		}
+		return
+	}
+
+	if result.Linked != nil {
+		recordAuditAs(c, result.Linked.ID, models.AuditActionOIDCLink, "user", strconv.FormatUint(uint64(result.Linked.ID), 10), models.AuditResultSuccess, "")
+		if frontendURL := provider.FrontendURL(); frontendURL != "" {
+			c.Redirect(http.StatusFound, frontendURL+"#linked=1")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "绑定成功"})
+		return
+	}
+
+	if result.ReauthToken != "" {
+		if frontendURL := provider.FrontendURL(); frontendURL != "" {
+			c.Redirect(http.StatusFound, frontendURL+"#reauth="+url.QueryEscape(result.ReauthToken))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"reauth_token": result.ReauthToken})
+		return
+	}
+
+	resp := result.Login
+	recordAuditAs(c, resp.User.ID, models.AuditActionOIDCLogin, "user", strconv.FormatUint(uint64(resp.User.ID), 10), models.AuditResultSuccess, "")
+
+	// 配置了前端地址时通过URL片段传递令牌，避免令牌出现在服务端日志中
+	if frontendURL := provider.FrontendURL(); frontendURL != "" {
+		c.Redirect(http.StatusFound, frontendURL+"#token="+url.QueryEscape(resp.Token))
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// oidcFail 返回单点登录错误，配置了前端地址时跳转回前端
+func oidcFail(c *gin.Context, provider *services.OIDCProvider, status int, code, message string) {
+	if frontendURL := provider.FrontendURL(); frontendURL != "" {
+		c.Redirect(http.StatusFound, frontendURL+"#error="+url.QueryEscape(code))
+		return
+	}
+	c.JSON(status, gin.H{"error": message})
+}
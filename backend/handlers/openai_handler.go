@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// openAIChatRequest 兼容OpenAI的聊天补全请求
+// 除标准字段外，log_session 为 true 时把本次问答记录为新会话，session_id 指定时记录到已有会话
+type openAIChatRequest struct {
+	Model         string                 `json:"model" binding:"required"`
+	Messages      []services.ChatMessage `json:"messages" binding:"required,min=1"`
+	Stream        bool                   `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	Temperature         *float64               `json:"temperature" binding:"omitempty,min=0,max=2"`
+	TopP                *float64               `json:"top_p" binding:"omitempty,gt=0,max=1"`
+	MaxTokens           *int                   `json:"max_tokens" binding:"omitempty,min=1"`
+	MaxCompletionTokens *int                   `json:"max_completion_tokens" binding:"omitempty,min=1"`
+	Stop                json.RawMessage        `json:"stop"` // 字符串或字符串数组
+	PresencePenalty     *float64               `json:"presence_penalty" binding:"omitempty,min=-2,max=2"`
+	FrequencyPenalty    *float64               `json:"frequency_penalty" binding:"omitempty,min=-2,max=2"`
+	ResponseFormat      *models.ResponseFormat `json:"response_format"`
+	N                   *int                   `json:"n"`
+	Tools               json.RawMessage        `json:"tools"`
+	LogSession          bool                   `json:"log_session"`
+	SessionID           string                 `json:"session_id"`
+}
+
+// generationParams 转换为生成参数，max_completion_tokens 优先于 max_tokens
+func (r *openAIChatRequest) generationParams() (models.GenerationParams, error) {
+	params := models.GenerationParams{
+		Temperature:      r.Temperature,
+		TopP:             r.TopP,
+		MaxTokens:        r.MaxTokens,
+		PresencePenalty:  r.PresencePenalty,
+		FrequencyPenalty: r.FrequencyPenalty,
+	}
+	if r.MaxCompletionTokens != nil {
+		params.MaxTokens = r.MaxCompletionTokens
+	}
+	if len(r.Stop) > 0 && string(r.Stop) != "null" {
+		var stop string
+		if err := json.Unmarshal(r.Stop, &stop); err == nil {
+			params.Stop = []string{stop}
+		} else if err := json.Unmarshal(r.Stop, &params.Stop); err != nil {
+			return params, errors.New("stop 必须是字符串或字符串数组")
+		}
+		if len(params.Stop) > 4 {
+			return params, errors.New("stop 最多只能有 4 项")
+		}
+	}
+	return params, nil
+}
+
+// openAICompletion 聊天补全的响应，流式响应的每个片段使用相同的结构
+type openAICompletion struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []openAIChoice      `json:"choices"`
+	Usage   *services.ChatUsage `json:"usage,omitempty"`
+}
+
+// openAIChoice 响应中的一个回答，非流式响应使用 message，流式响应使用 delta
+type openAIChoice struct {
+	Index        int            `json:"index"`
+	Message      *openAIMessage `json:"message,omitempty"`
+	Delta        *openAIMessage `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+// openAIMessage 回答的内容，reasoning_content 为思考模型的思考过程
+type openAIMessage struct {
+	Role             string `json:"role,omitempty"`
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// respondOpenAIError 按OpenAI的错误格式返回
+func respondOpenAIError(c *gin.Context, status int, errType, param, message string) {
+	body := gin.H{"message": message, "type": errType}
+	if param != "" {
+		body["param"] = param
+	}
+	c.JSON(status, gin.H{"error": body})
+}
+
+// OpenAIListModelsHandler 兼容OpenAI的模型列表
+func OpenAIListModelsHandler(c *gin.Context) {
+	modelList := services.ListModels()
+	data := make([]gin.H, 0, len(modelList))
+	for _, model := range modelList {
+		owner := model.Provider
+		if owner == "" {
+			owner = "system"
+		}
+		data = append(data, gin.H{"id": model.ID, "object": "model", "created": 0, "owned_by": owner})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// OpenAIChatCompletionsHandler 兼容OpenAI的聊天补全接口，通过配置的模型服务商生成回答
+// 请求计入API密钥的用量和每日配额，配置的系统提示词放在客户端的消息之前
+// 不支持客户端定义的工具；要求输出JSON时需要先完整生成并校验，流式请求会在校验后一次性返回内容
+func OpenAIChatCompletionsHandler(c *gin.Context) {
+	var req openAIChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "请求数据格式有误")
+		return
+	}
+	if len(req.Tools) > 0 && string(req.Tools) != "null" && string(req.Tools) != "[]" {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "tools", "不支持客户端定义的工具")
+		return
+	}
+	if req.N != nil && *req.N != 1 {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "n", "只支持生成一个回答")
+		return
+	}
+
+	userID := c.GetUint("userID")
+	apiKey := c.MustGet("apiKey").(*models.APIKey)
+
+	service, err := services.GetModelService(req.Model)
+	if err != nil {
+		respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", "model", "模型不存在: "+req.Model)
+		return
+	}
+	params, err := req.generationParams()
+	if err != nil {
+		respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "stop", err.Error())
+		return
+	}
+	if err := services.ValidateGenerationParams(req.Model, params); err != nil {
+		var paramsErr *services.InvalidGenerationParamsError
+		if errors.As(err, &paramsErr) {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", paramsErr.Param, paramsErr.Reason)
+		} else {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "", "生成参数无效")
+		}
+		return
+	}
+	responseFormat, err := services.NewResponseFormat(req.ResponseFormat)
+	if err != nil {
+		var formatErr *services.InvalidResponseFormatError
+		if errors.As(err, &formatErr) {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "response_format", formatErr.Reason)
+		} else {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "response_format", "输出格式有误")
+		}
+		return
+	}
+	for _, message := range req.Messages {
+		if err := services.CheckVisionSupport(req.Model, message); err != nil {
+			respondOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "messages", "当前模型不支持图片输入: "+req.Model)
+			return
+		}
+	}
+
+	// 记录到已有会话时需要会话的发送消息权限
+	var session *models.ChatSession
+	if req.SessionID != "" {
+		session, err = services.GetSessionByID(req.SessionID)
+		if err == nil {
+			err = services.CheckSessionAccess(userID, session, services.SessionPermissionWrite)
+		}
+		if err != nil {
+			if errors.Is(err, services.ErrSessionNotFound) || errors.Is(err, services.ErrSessionForbidden) {
+				respondOpenAIError(c, http.StatusNotFound, "invalid_request_error", "session_id", "会话不存在")
+			} else {
+				respondOpenAIError(c, http.StatusInternalServerError, "api_error", "", "获取会话失败")
+			}
+			return
+		}
+	}
+
+	chatOptions, err := services.ResolveAPIChatOptions(session)
+	if err != nil {
+		respondOpenAIError(c, http.StatusInternalServerError, "api_error", "", "获取会话设置失败")
+		return
+	}
+	chatOptions.Params = services.MergeGenerationParams(chatOptions.Params, params)
+	chatOptions.ResponseFormat = responseFormat
+
+	// 最后一条用户消息作为会话记录中的提问
+	question := ""
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			question = req.Messages[i].Content
+			break
+		}
+	}
+	// 调用模型之前预留今日的请求次数，并发的请求不会超过上限
+	if err := services.ReserveAPIQuota(userID); err != nil {
+		if errors.Is(err, services.ErrAPIQuotaExceeded) {
+			respondOpenAIError(c, http.StatusTooManyRequests, "insufficient_quota", "", "今日的API用量已达上限")
+		} else {
+			respondOpenAIError(c, http.StatusInternalServerError, "api_error", "", "检查用量失败")
+		}
+		return
+	}
+	if session == nil && req.LogSession {
+		if session, err = services.CreateAPISession(userID, question); err != nil {
+			respondOpenAIError(c, http.StatusInternalServerError, "api_error", "", "创建会话失败")
+			return
+		}
+	}
+	if session != nil {
+		c.Header("X-Session-Id", session.SessionID)
+	}
+
+	completion := openAICompletion{
+		ID:      "chatcmpl-" + uuid.New().String(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+
+	var result services.ChatResult
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		result, err = streamOpenAICompletion(c, service, req.Messages, chatOptions, completion, includeUsage)
+	} else {
+		result, err = service.RunChat(req.Messages, chatOptions, io.Discard)
+		if err != nil {
+			respondOpenAIError(c, http.StatusBadGateway, "api_error", "", "模型服务请求失败: "+err.Error())
+		} else {
+			finishReason := openAIFinishReason(result)
+			completion.Choices = []openAIChoice{{
+				Message:      &openAIMessage{Role: "assistant", Content: result.Content, ReasoningContent: result.Thinking},
+				FinishReason: &finishReason,
+			}}
+			completion.Usage = &result.Usage
+			c.JSON(http.StatusOK, completion)
+		}
+	}
+
+	if err := services.RecordAPIUsage(apiKey, result.Usage); err != nil {
+		log.Printf("记录API用量失败: %v", err)
+	}
+	if session != nil && err == nil {
+		if err := services.SaveAPIExchange(session, userID, question, req.Model, result); err != nil {
+			log.Printf("记录API对话失败: %v", err)
+		}
+	}
+}
+
+// streamOpenAICompletion 以OpenAI的SSE格式流式返回回答，最后发送结束原因、可选的用量和 [DONE]
+func streamOpenAICompletion(c *gin.Context, service *services.DeepSeekService, messages []services.ChatMessage, opts services.ChatOptions, completion openAICompletion, includeUsage bool) (services.ChatResult, error) {
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Writer.Header().Set("X-Accel-Buffering", "no") // 禁用Nginx缓冲
+	c.Writer.WriteHeader(http.StatusOK)
+
+	completion.Object = "chat.completion.chunk"
+	writer := &openAIStreamWriter{c: c, completion: completion}
+	writer.sendDelta(openAIMessage{Role: "assistant"})
+
+	var result services.ChatResult
+	var err error
+	if opts.ResponseFormat != nil {
+		// 修复前输出的内容无法撤回，校验通过后再一次性返回
+		result, err = service.RunChat(messages, opts, io.Discard)
+		if err == nil {
+			if result.Thinking != "" {
+				writer.sendDelta(openAIMessage{ReasoningContent: result.Thinking})
+			}
+			writer.sendDelta(openAIMessage{Content: result.Content})
+		}
+	} else {
+		result, err = service.RunChat(messages, opts, writer)
+	}
+	if err != nil {
+		writer.send(gin.H{"error": gin.H{"message": "模型服务请求失败: " + err.Error(), "type": "api_error"}})
+		writer.done()
+		return result, err
+	}
+
+	finishReason := openAIFinishReason(result)
+	chunk := writer.completion
+	chunk.Choices = []openAIChoice{{Delta: &openAIMessage{}, FinishReason: &finishReason}}
+	writer.send(chunk)
+	if includeUsage {
+		chunk.Choices = []openAIChoice{}
+		chunk.Usage = &result.Usage
+		writer.send(chunk)
+	}
+	writer.done()
+	return result, nil
+}
+
+// openAIFinishReason 回答的结束原因，服务商未返回时视为正常结束
+func openAIFinishReason(result services.ChatResult) string {
+	if result.FinishReason != "" {
+		return result.FinishReason
+	}
+	return "stop"
+}
+
+// openAIStreamWriter 将模型的流式输出转换为OpenAI格式的SSE片段，思考内容作为 reasoning_content 单独返回
+type openAIStreamWriter struct {
+	c          *gin.Context
+	completion openAICompletion
+}
+
+// Write 输出回答内容的片段
+func (w *openAIStreamWriter) Write(p []byte) (int, error) {
+	if err := w.sendDelta(openAIMessage{Content: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteReasoning 输出思考内容的片段
+func (w *openAIStreamWriter) WriteReasoning(p []byte) (int, error) {
+	if err := w.sendDelta(openAIMessage{ReasoningContent: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// sendDelta 发送一个增量片段
+func (w *openAIStreamWriter) sendDelta(delta openAIMessage) error {
+	chunk := w.completion
+	chunk.Choices = []openAIChoice{{Delta: &delta}}
+	return w.send(chunk)
+}
+
+// send 以 data: 行的形式发送一个JSON片段
+func (w *openAIStreamWriter) send(data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.c.Writer, "data: %s\n\n", payload); err != nil {
+		return err
+	}
+	w.c.Writer.Flush()
+	return nil
+}
+
+// done 发送流结束标记
+func (w *openAIStreamWriter) done() {
+	w.c.Writer.Write([]byte("data: [DONE]\n\n"))
+	w.c.Writer.Flush()
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondPromptTemplateError 返回模板操作的通用错误
+func respondPromptTemplateError(c *gin.Context, err error) {
+	var missingErr *services.MissingPromptVariablesError
+	if errors.As(err, &missingErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少必填变量: " + strings.Join(missingErr.Names, ", "), "missing": missingErr.Names})
+	} else if errors.Is(err, services.ErrPromptTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+	} else if errors.Is(err, services.ErrPromptTemplateForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权修改此模板"})
+	} else if errors.Is(err, services.ErrWorkspaceNotFound) || errors.Is(err, services.ErrWorkspaceForbidden) {
+		respondWorkspaceError(c, err)
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// ListPromptTemplatesHandler 获取可用的提示词模板，sort=popular 时按使用次数排序
+func ListPromptTemplatesHandler(c *gin.Context) {
+	var query models.PromptTemplateListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的查询参数"})
+		return
+	}
+
+	templates, err := services.ListPromptTemplates(c.GetUint("userID"), query)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates, "total": len(templates)})
+}
+
+// CreatePromptTemplateHandler 创建提示词模板，指定 workspace_id 时与工作区成员共享
+func CreatePromptTemplateHandler(c *gin.Context) {
+	var req models.CreatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	template, err := services.CreatePromptTemplate(c.GetUint("userID"), req)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, template)
+}
+
+// GetPromptTemplateHandler 获取提示词模板详情
+func GetPromptTemplateHandler(c *gin.Context) {
+	templateID, ok := parseIDParam(c, "id", "无效的模板ID")
+	if !ok {
+		return
+	}
+
+	template, err := services.GetPromptTemplate(c.GetUint("userID"), templateID)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdatePromptTemplateHandler 修改提示词模板
+func UpdatePromptTemplateHandler(c *gin.Context) {
+	templateID, ok := parseIDParam(c, "id", "无效的模板ID")
+	if !ok {
+		return
+	}
+
+	var req models.UpdatePromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	template, err := services.UpdatePromptTemplate(c.GetUint("userID"), templateID, req)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// DeletePromptTemplateHandler 删除提示词模板
+func DeletePromptTemplateHandler(c *gin.Context) {
+	templateID, ok := parseIDParam(c, "id", "无效的模板ID")
+	if !ok {
+		return
+	}
+
+	if err := services.DeletePromptTemplate(c.GetUint("userID"), templateID); err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "模板已删除"})
+}
+
+// RenderPromptTemplateHandler 用变量值渲染模板，用于发送前预览
+func RenderPromptTemplateHandler(c *gin.Context) {
+	templateID, ok := parseIDParam(c, "id", "无效的模板ID")
+	if !ok {
+		return
+	}
+
+	var req models.RenderPromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	content, err := services.RenderPromptTemplateForUser(c.GetUint("userID"), templateID, req.Variables)
+	if err != nil {
+		respondPromptTemplateError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"content": content})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket连接参数
+const (
+	wsWriteWait  = 10 * time.Second    // 单次写入超时
+	wsPongWait   = 60 * time.Second    // 等待客户端响应心跳的时间
+	wsPingPeriod = wsPongWait * 9 / 10 // 发送心跳的间隔
+	wsMaxMessage = 4096                // 客户端消息大小上限
+	// 推送事件前重新检查权限的最小间隔，成员被移出、会话被删除或登出后连接在此时间内断开
+	wsAccessCheckInterval = 5 * time.Second
+)
+
+// wsUpgrader WebSocket升级器，认证基于一次性票据而非Cookie，因此允许跨域连接
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// SessionWebSocketTicketHandler 获取连接会话实时协作的一次性票据
+// 浏览器无法为WebSocket握手设置请求头，票据通过 ticket 参数传递，避免登录令牌出现在地址和访问日志中
+func SessionWebSocketTicketHandler(c *gin.Context) {
+	session, ok := authorizeSession(c, c.Param("id"), services.SessionPermissionRead)
+	if !ok {
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	ticket, err := services.IssueRealtimeTicket(token, c.GetUint("userID"), session.SessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的登录凭证"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成票据失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"expires_in": int(services.RealtimeTicketTTL.Seconds()),
+	})
+}
+
+// SessionWebSocketHandler 会话实时协作连接
+// 连接建立后推送当前查看者列表，之后推送新消息、流式片段、版本切换、标题变化和查看者变化
+// 推送期间定期重新检查权限，失去权限时关闭连接
+func SessionWebSocketHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+	ticket, err := services.ConsumeRealtimeTicket(c.Query("ticket"), sessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRealtimeTicket) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "票据无效或已过期"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "校验票据失败"})
+		}
+		return
+	}
+	c.Set("userID", ticket.UserID)
+
+	session, ok := authorizeSession(c, sessionID, services.SessionPermissionRead)
+	if !ok {
+		return
+	}
+
+	userID := ticket.UserID
+	user, err := services.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	// 先订阅再升级，避免错过连接建立期间的事件
+	subscription, err := services.SubscribeSession(session.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "订阅会话失败"})
+		return
+	}
+	defer subscription.Close()
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 已经写入了错误响应
+		return
+	}
+	defer conn.Close()
+
+	viewers := services.JoinSessionPresence(session.SessionID, user)
+	defer services.LeaveSessionPresence(session.SessionID, userID)
+
+	// 读取循环只处理心跳和关闭，客户端断开时结束
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadLimit(wsMaxMessage)
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// 推送连接时的查看者列表
+	welcome, _ := json.Marshal(services.SessionEvent{
+		Type:      services.SessionEventPresence,
+		SessionID: session.SessionID,
+		UserID:    userID,
+		Data:      gin.H{"action": "snapshot", "viewers": viewers},
+		Time:      time.Now(),
+	})
+	conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := conn.WriteMessage(websocket.TextMessage, welcome); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+
+	// checkAccess 距上次检查超过间隔时重新检查权限，失去权限时通知客户端关闭
+	lastCheck := time.Now()
+	checkAccess := func(force bool) bool {
+		if !force && time.Since(lastCheck) < wsAccessCheckInterval {
+			return true
+		}
+		lastCheck = time.Now()
+		err := services.CheckRealtimeAccess(ticket.UserSessionID, userID, session.SessionID)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, services.ErrInvalidToken) && !errors.Is(err, services.ErrSessionNotFound) &&
+			!errors.Is(err, services.ErrSessionForbidden) {
+			// 数据库暂时不可用时保持连接，下次推送时再检查
+			log.Printf("检查实时协作权限失败: %v", err)
+			return true
+		}
+		closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "access revoked")
+		conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(wsWriteWait))
+		return false
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case payload, ok := <-subscription.Messages():
+			if !ok {
+				return
+			}
+			if !checkAccess(false) {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				log.Printf("推送会话事件失败: %v", err)
+				return
+			}
+		case <-ticker.C:
+			if !checkAccess(true) {
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListToolsHandler 获取模型可以调用的服务端工具
+func ListToolsHandler(c *gin.Context) {
+	tools := services.ListTools()
+	definitions := make([]gin.H, 0, len(tools))
+	for _, tool := range tools {
+		definitions = append(definitions, gin.H{
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  tool.Parameters,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"tools": definitions, "total": len(definitions)})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrashHandler 获取回收站中的会话
+func ListTrashHandler(c *gin.Context) {
+	sessions, err := services.ListTrashSessions(c.GetUint("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回收站失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversations": sessions, "total": len(sessions)})
+}
+
+// RestoreSessionHandler 从回收站恢复会话
+func RestoreSessionHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+	session, err := services.RestoreSession(c.GetUint("userID"), sessionID)
+	recordAudit(c, models.AuditActionSessionRestore, "chat_session", sessionID, auditResult(err), "")
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该会话"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复会话失败: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// PurgeSessionHandler 彻底删除回收站中的会话
+func PurgeSessionHandler(c *gin.Context) {
+	sessionID := c.Param("id")
+	err := services.PurgeSession(c.GetUint("userID"), sessionID)
+	recordAudit(c, models.AuditActionSessionPurge, "chat_session", sessionID, auditResult(err), "")
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该会话"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "彻底删除会话失败: " + err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "会话已彻底删除"})
+}
+
+// EmptyTrashHandler 清空回收站
+func EmptyTrashHandler(c *gin.Context) {
+	count, err := services.EmptyTrash(c.GetUint("userID"))
+	recordAudit(c, models.AuditActionSessionPurge, "chat_session", "", auditResult(err), "empty trash count="+strconv.Itoa(count))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清空回收站失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "回收站已清空", "count": count})
+}
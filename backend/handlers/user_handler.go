@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"aiChat/backend/models"
 	"aiChat/backend/services"
@@ -38,6 +43,15 @@ func RegisterHandler(c *gin.Context) {
 
 	// 注册用户
 	userID, err := services.RegisterUser(req)
+	account := req.Email
+	if req.LoginType == 2 {
+		account = req.Phone
+	}
+	if err != nil {
+		recordAudit(c, models.AuditActionRegister, "account", account, models.AuditResultFailure, err.Error())
+	} else {
+		recordAuditAs(c, userID, models.AuditActionRegister, "user", strconv.FormatUint(uint64(userID), 10), models.AuditResultSuccess, account)
+	}
 	if err != nil {
 		if errors.Is(err, services.ErrUsernameExists) {
 			c.JSON(http.StatusConflict, gin.H{"error": "用户名已存在"})
@@ -45,6 +59,8 @@ func RegisterHandler(c *gin.Context) {
 			c.JSON(http.StatusConflict, gin.H{"error": "邮箱已存在"})
 		} else if errors.Is(err, services.ErrPhoneExists) {
 			c.JSON(http.StatusConflict, gin.H{"error": "手机号已存在"})
+		} else if errors.Is(err, services.ErrInvalidPhone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "手机号格式不正确"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败: " + err.Error()})
 		}
@@ -66,17 +82,87 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	// 登录
-	resp, err := services.LoginUser(req)
+	resp, err := services.LoginUser(req, c.ClientIP())
 	if err != nil {
-		if errors.Is(err, services.ErrUserNotFound) {
+		recordAudit(c, models.AuditActionLogin, "account", req.Account, models.AuditResultFailure, err.Error())
+
+		var lockErr *services.LockoutError
+		if errors.As(err, &lockErr) {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockErr.RetryAfter.Seconds()))))
+		}
+
+		if errors.Is(err, services.ErrAccountLocked) {
+			c.JSON(http.StatusLocked, gin.H{"error": "登录失败次数过多，账号已被临时锁定", "code": "ACCOUNT_LOCKED"})
+		} else if errors.Is(err, services.ErrIPLocked) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "登录失败次数过多，请稍后再试", "code": "IP_LOCKED"})
+		} else if errors.Is(err, services.ErrUserNotFound) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
 		} else if errors.Is(err, services.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "账号或密码错误"})
+		} else if errors.Is(err, services.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "账号已被禁用", "code": "USER_DISABLED"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败: " + err.Error()})
 		}
 		return
 	}
+	recordAuditAs(c, resp.User.ID, models.AuditActionLogin, "account", req.Account, models.AuditResultSuccess, "")
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SendSMSCodeHandler 发送短信验证码处理器
+func SendSMSCodeHandler(c *gin.Context) {
+	var req models.SendSMSCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	if err := services.SendSMSCode(req.Phone, c.ClientIP()); err != nil {
+		if errors.Is(err, services.ErrInvalidPhone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "手机号格式不正确"})
+		} else if errors.Is(err, services.ErrSMSTooFrequent) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证码发送过于频繁，请稍后再试"})
+		} else if errors.Is(err, services.ErrSMSDailyLimitExceeded) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "今日验证码发送次数已达上限"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "发送验证码失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "验证码已发送"})
+}
+
+// SMSLoginHandler 短信验证码登录处理器，未注册的手机号自动注册
+func SMSLoginHandler(c *gin.Context) {
+	var req models.SMSLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	resp, err := services.VerifySMSCode(req, c.ClientIP())
+	if err != nil {
+		recordAudit(c, models.AuditActionSMSLogin, "account", req.Phone, models.AuditResultFailure, err.Error())
+
+		if errors.Is(err, services.ErrInvalidPhone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "手机号格式不正确"})
+		} else if errors.Is(err, services.ErrInvalidSMSCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+		} else if errors.Is(err, services.ErrSMSCodeExpired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码已过期，请重新获取"})
+		} else if errors.Is(err, services.ErrSMSCodeAttemptsExceeded) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证码错误次数过多，请重新获取"})
+		} else if errors.Is(err, services.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "账号已被禁用"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败: " + err.Error()})
+		}
+		return
+	}
+	recordAuditAs(c, resp.User.ID, models.AuditActionSMSLogin, "account", req.Phone, models.AuditResultSuccess, "")
 
 	c.JSON(http.StatusOK, resp)
 }
@@ -98,7 +184,9 @@ func LogoutHandler(c *gin.Context) {
 	}
 
 	// 使令牌失效
-	if err := services.InvalidateToken(tokenString); err != nil {
+	err := services.InvalidateToken(tokenString)
+	recordAudit(c, models.AuditActionLogout, "", "", auditResult(err), "")
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "登出失败: " + err.Error()})
 		return
 	}
@@ -145,6 +233,7 @@ func UpdateUserProfileHandler(c *gin.Context) {
 
 	// 更新用户资料
 	err := services.UpdateUserProfile(userID.(uint), req)
+	recordAudit(c, models.AuditActionProfileUpdate, "user", strconv.FormatUint(uint64(userID.(uint)), 10), auditResult(err), "")
 	if err != nil {
 		if errors.Is(err, services.ErrUsernameExists) {
 			c.JSON(http.StatusConflict, gin.H{"error": "用户名已存在"})
@@ -173,7 +262,8 @@ func UpdatePasswordHandler(c *gin.Context) {
 	}
 
 	// 更新密码
-	err := services.UpdateUserPassword(userID.(uint64), req)
+	err := services.UpdateUserPassword(userID.(uint), req)
+	recordAudit(c, models.AuditActionPasswordChange, "user", strconv.FormatUint(uint64(userID.(uint)), 10), auditResult(err), "")
 	if err != nil {
 		if errors.Is(err, services.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "原密码错误"})
@@ -220,7 +310,8 @@ func UpdateUserSettingsHandler(c *gin.Context) {
 	}
 
 	// 更新设置
-	err := services.UpdateUserSettings(userID.(uint64), req)
+	err := services.UpdateUserSettings(userID.(uint), req)
+	recordAudit(c, models.AuditActionSettingsUpdate, "user", strconv.FormatUint(uint64(userID.(uint)), 10), auditResult(err), "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败: " + err.Error()})
 		return
@@ -228,3 +319,209 @@ func UpdateUserSettingsHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "设置更新成功"})
 }
+
+// ExportUserDataHandler 导出个人数据处理器，返回zip压缩包
+func ExportUserDataHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权，请先登录"})
+		return
+	}
+
+	targetID := strconv.FormatUint(uint64(userID.(uint)), 10)
+	filename := fmt.Sprintf("user-%s-data-%s.zip", targetID, time.Now().Format("20060102150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	err := services.ExportUserData(userID.(uint), c.Writer)
+	recordAudit(c, models.AuditActionDataExport, "user", targetID, auditResult(err), "")
+	if err != nil {
+		// 尚未写出数据时仍可返回错误信息
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			if errors.Is(err, services.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "导出数据失败: " + err.Error()})
+			}
+		}
+	}
+}
+
+// DeleteAccountHandler 申请注销账号处理器，需要再次确认密码
+func DeleteAccountHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权，请先登录"})
+		return
+	}
+
+	// 代登录时不允许注销被代登录的账号
+	if _, impersonated := c.Get("impersonatorID"); impersonated {
+		c.JSON(http.StatusForbidden, gin.H{"error": "代登录状态下不能注销账号"})
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	deletion, err := services.ScheduleAccountDeletion(userID.(uint), req)
+	targetID := strconv.FormatUint(uint64(userID.(uint)), 10)
+	if err != nil {
+		recordAudit(c, models.AuditActionDeletionSchedule, "user", targetID, models.AuditResultFailure, err.Error())
+		if errors.Is(err, services.ErrConfirmationRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入密码、短信验证码或通过单点登录重新认证"})
+		} else if errors.Is(err, services.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误或认证已过期"})
+		} else if errors.Is(err, services.ErrPhoneNotBound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "账号未绑定手机号"})
+		} else if errors.Is(err, services.ErrInvalidSMSCode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+		} else if errors.Is(err, services.ErrSMSCodeExpired) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码已过期，请重新获取"})
+		} else if errors.Is(err, services.ErrSMSCodeAttemptsExceeded) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证码错误次数过多，请重新获取"})
+		} else if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "申请注销失败: " + err.Error()})
+		}
+		return
+	}
+	recordAudit(c, models.AuditActionDeletionSchedule, "user", targetID, models.AuditResultSuccess,
+		"scheduled_for="+deletion.ScheduledFor.Format(time.RFC3339))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "已申请注销账号，保留期内可撤销",
+		"deletion": deletion,
+	})
+}
+
+// SendAccountDeletionSMSHandler 向绑定的手机号发送注销账号的确认验证码
+func SendAccountDeletionSMSHandler(c *gin.Context) {
+	if err := services.SendAccountDeletionSMSCode(c.GetUint("userID"), c.ClientIP()); err != nil {
+		if errors.Is(err, services.ErrPhoneNotBound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "账号未绑定手机号"})
+		} else if errors.Is(err, services.ErrSMSTooFrequent) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证码发送过于频繁，请稍后再试"})
+		} else if errors.Is(err, services.ErrSMSDailyLimitExceeded) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "今日验证码发送次数已达上限"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "发送验证码失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "验证码已发送"})
+}
+
+// GetAccountDeletionHandler 查询注销申请状态处理器
+func GetAccountDeletionHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权，请先登录"})
+		return
+	}
+
+	deletion, err := services.GetPendingAccountDeletion(userID.(uint))
+	if err != nil {
+		if errors.Is(err, services.ErrNoPendingDeletion) {
+			c.JSON(http.StatusOK, gin.H{"pending": false})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询注销申请失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pending": true, "deletion": deletion})
+}
+
+// CancelAccountDeletionHandler 撤销注销申请处理器
+func CancelAccountDeletionHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权，请先登录"})
+		return
+	}
+
+	err := services.CancelAccountDeletion(userID.(uint))
+	recordAudit(c, models.AuditActionDeletionCancel, "user", strconv.FormatUint(uint64(userID.(uint)), 10), auditResult(err), "")
+	if err != nil {
+		if errors.Is(err, services.ErrNoPendingDeletion) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "没有待执行的注销申请"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销注销申请失败: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已撤销注销申请"})
+}
+
+// UploadAvatarHandler 上传头像处理器，表单字段为 file
+func UploadAvatarHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权，请先登录"})
+		return
+	}
+
+	// 限制请求体大小，预留表单字段的空间
+	maxSize := services.AvatarMaxSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+64<<10)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("头像文件不能超过%dKB", maxSize>>10)})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要上传的头像"})
+		}
+		return
+	}
+	if fileHeader.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("头像文件不能超过%dKB", maxSize>>10)})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取上传文件失败"})
+		return
+	}
+
+	urls, err := services.UploadAvatar(c.Request.Context(), userID.(uint), data)
+	recordAudit(c, models.AuditActionAvatarUpload, "user", strconv.FormatUint(uint64(userID.(uint)), 10), auditResult(err), "")
+	if err != nil {
+		if errors.Is(err, services.ErrImageTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("头像文件不能超过%dKB", maxSize>>10)})
+		} else if errors.Is(err, services.ErrUnsupportedImageType) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "仅支持PNG、JPEG和GIF格式的图片"})
+		} else if errors.Is(err, services.ErrInvalidImageDimensions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "图片尺寸需在32到4096像素之间"})
+		} else if errors.Is(err, services.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "上传头像失败: " + err.Error()})
+		}
+		return
+	}
+
+	largest := strconv.Itoa(services.AvatarSizes[len(services.AvatarSizes)-1])
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "头像上传成功",
+		"avatar":     urls[largest],
+		"thumbnails": urls,
+	})
+}
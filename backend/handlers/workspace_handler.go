@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"aiChat/backend/models"
+	"aiChat/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseWorkspaceIDParam 解析路径中的工作区ID
+func parseWorkspaceIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的工作区ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseMemberIDParam 解析路径中的成员用户ID
+func parseMemberIDParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("userId"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWorkspaceError 返回工作区操作的通用错误
+func respondWorkspaceError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrWorkspaceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "工作区不存在"})
+	} else if errors.Is(err, services.ErrWorkspaceForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权执行此操作"})
+	} else if errors.Is(err, services.ErrWorkspaceMemberExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": "该用户已是工作区成员"})
+	} else if errors.Is(err, services.ErrWorkspaceMemberNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "成员不存在"})
+	} else if errors.Is(err, services.ErrLastWorkspaceOwner) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工作区至少需要保留一个所有者"})
+	} else if errors.Is(err, services.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败: " + err.Error()})
+	}
+}
+
+// CreateWorkspaceHandler 创建工作区
+func CreateWorkspaceHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+
+	var req models.CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	workspace, err := services.CreateWorkspace(userID.(uint), req)
+	if err != nil {
+		recordAudit(c, models.AuditActionWorkspaceCreate, "workspace", "", models.AuditResultFailure, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建工作区失败: " + err.Error()})
+		return
+	}
+	recordAudit(c, models.AuditActionWorkspaceCreate, "workspace", strconv.FormatUint(uint64(workspace.ID), 10), models.AuditResultSuccess, workspace.Name)
+
+	c.JSON(http.StatusCreated, workspace)
+}
+
+// ListWorkspacesHandler 获取当前用户加入的工作区
+func ListWorkspacesHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+
+	workspaces, err := services.ListUserWorkspaces(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取工作区列表失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workspaces": workspaces, "total": len(workspaces)})
+}
+
+// GetWorkspaceHandler 获取工作区详情
+func GetWorkspaceHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+
+	workspace, err := services.GetWorkspaceForMember(workspaceID, userID.(uint))
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// UpdateWorkspaceHandler 更新工作区信息和默认设置
+func UpdateWorkspaceHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	workspace, err := services.UpdateWorkspace(workspaceID, userID.(uint), req)
+	recordAudit(c, models.AuditActionWorkspaceUpdate, "workspace", c.Param("id"), auditResult(err), "")
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+// DeleteWorkspaceHandler 删除工作区及其共享会话
+func DeleteWorkspaceHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+
+	err := services.DeleteWorkspace(workspaceID, userID.(uint))
+	recordAudit(c, models.AuditActionWorkspaceDelete, "workspace", c.Param("id"), auditResult(err), "")
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "工作区已删除"})
+}
+
+// ListWorkspaceMembersHandler 获取工作区成员列表
+func ListWorkspaceMembersHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+
+	members, err := services.ListWorkspaceMembers(workspaceID, userID.(uint))
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members, "total": len(members)})
+}
+
+// AddWorkspaceMemberHandler 添加工作区成员
+func AddWorkspaceMemberHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.AddWorkspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	member, err := services.AddWorkspaceMember(workspaceID, userID.(uint), req)
+	if err != nil {
+		recordAudit(c, models.AuditActionWorkspaceMemberAdd, "workspace", c.Param("id"), models.AuditResultFailure, req.Account+": "+err.Error())
+		respondWorkspaceError(c, err)
+		return
+	}
+	recordAudit(c, models.AuditActionWorkspaceMemberAdd, "workspace", c.Param("id"), models.AuditResultSuccess,
+		"user_id="+strconv.FormatUint(uint64(member.UserID), 10)+" role="+member.Role)
+
+	c.JSON(http.StatusCreated, member)
+}
+
+// UpdateWorkspaceMemberHandler 修改工作区成员角色
+func UpdateWorkspaceMemberHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+	memberID, ok := parseMemberIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateWorkspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	err := services.UpdateWorkspaceMemberRole(workspaceID, userID.(uint), memberID, req.Role)
+	recordAudit(c, models.AuditActionWorkspaceMemberUpdate, "workspace", c.Param("id"), auditResult(err),
+		"user_id="+c.Param("userId")+" role="+req.Role)
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "成员角色已更新"})
+}
+
+// RemoveWorkspaceMemberHandler 移除工作区成员或退出工作区
+func RemoveWorkspaceMemberHandler(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+		return
+	}
+	workspaceID, ok := parseWorkspaceIDParam(c)
+	if !ok {
+		return
+	}
+	memberID, ok := parseMemberIDParam(c)
+	if !ok {
+		return
+	}
+
+	err := services.RemoveWorkspaceMember(workspaceID, userID.(uint), memberID)
+	recordAudit(c, models.AuditActionWorkspaceMemberRemove, "workspace", c.Param("id"), auditResult(err), "user_id="+c.Param("userId"))
+	if err != nil {
+		respondWorkspaceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
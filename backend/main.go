@@ -31,6 +31,43 @@ func main() {
 	deepseekService.SetModel(appConfig.DeepSeek.Model)
 	deepseekService.SetReasonerModel(appConfig.DeepSeek.ReasonerModel)
 
+	// 初始化短信网关
+	smsSender, err := services.NewSMSSender(appConfig.SMS.Provider)
+	if err != nil {
+		log.Fatalf("初始化短信网关失败: %v", err)
+	}
+	services.SetSMSSender(smsSender)
+
+	// 初始化文件存储
+	blobStore, err := services.NewBlobStore(appConfig.Storage)
+	if err != nil {
+		log.Fatalf("初始化文件存储失败: %v", err)
+	}
+	services.SetBlobStore(blobStore)
+
+	// 初始化知识库的向量化模型和向量存储
+	embedder, err := services.NewEmbedder(appConfig.RAG.Embedder)
+	if err != nil {
+		log.Fatalf("初始化向量化模型失败: %v", err)
+	}
+	services.SetEmbedder(embedder)
+	vectorStore, err := services.NewVectorStore(appConfig.RAG.VectorStore)
+	if err != nil {
+		log.Fatalf("初始化向量存储失败: %v", err)
+	}
+	services.SetVectorStore(vectorStore)
+
+	// 初始化MCP服务器，首次使用时才建立连接
+	if err := services.SetMCPServers(appConfig.MCP.Servers); err != nil {
+		log.Fatalf("初始化MCP服务器失败: %v", err)
+	}
+	defer services.CloseMCPServers()
+
+	// 初始化单点登录
+	if appConfig.OIDC.Enabled {
+		services.SetOIDCProvider(services.NewOIDCProvider(appConfig.OIDC, nil))
+	}
+
 	// 初始化数据库连接
 	if err := database.InitDB(); err != nil {
 		log.Fatalf("初始化数据库连接失败: %v", err)
@@ -42,6 +79,20 @@ func main() {
 		log.Fatalf("设置数据库表结构失败: %v", err)
 	}
 
+	// 初始化内置角色和初始管理员
+	if err := services.SeedBuiltInRoles(); err != nil {
+		log.Fatalf("初始化角色失败: %v", err)
+	}
+	if err := services.BootstrapAdmins(appConfig.RBAC.BootstrapAdmins); err != nil {
+		log.Fatalf("初始化管理员失败: %v", err)
+	}
+
+	// 启动后台任务
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go services.RunAccountDeletionWorker(workerCtx, time.Hour)
+	go services.RunTrashPurgeWorker(workerCtx, time.Hour)
+
 	// 创建Gin引擎
 	r := gin.Default()
 
@@ -70,6 +121,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("关闭服务器...")
+	stopWorkers()
 
 	// 设置5秒的超时时间
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
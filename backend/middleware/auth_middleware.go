@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"aiChat/backend/config"
 	"aiChat/backend/services"
 	"errors"
 	"net/http"
@@ -14,6 +15,7 @@ func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 从请求头获取Token
 		authHeader := c.GetHeader("Authorization")
+
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "请先登录"})
 			c.Abort()
@@ -40,8 +42,65 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 将用户ID设置到上下文
+		// 将用户ID设置到上下文，权限由 RequirePermission 按用户当前的角色实时判断
 		c.Set("userID", claims.UserID)
+		if claims.ImpersonatorID != 0 {
+			c.Set("impersonatorID", claims.ImpersonatorID)
+		}
+		c.Next()
+	}
+}
+
+// APIKeyMiddleware 兼容OpenAI接口的认证中间件，使用个人API密钥，错误按OpenAI的格式返回
+func APIKeyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.AppConfig.OpenAI.Enabled {
+			abortOpenAIError(c, http.StatusNotFound, "invalid_request_error", "接口未开放")
+			return
+		}
+
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenString == "" || tokenString == c.GetHeader("Authorization") {
+			abortOpenAIError(c, http.StatusUnauthorized, "invalid_request_error", "请在 Authorization 请求头中提供API密钥")
+			return
+		}
+
+		apiKey, err := services.AuthenticateAPIKey(tokenString)
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidAPIKey) {
+				abortOpenAIError(c, http.StatusUnauthorized, "invalid_request_error", "API密钥无效或已过期")
+			} else {
+				abortOpenAIError(c, http.StatusInternalServerError, "api_error", "校验API密钥失败")
+			}
+			return
+		}
+
+		c.Set("userID", apiKey.UserID)
+		c.Set("apiKey", apiKey)
+		c.Next()
+	}
+}
+
+// abortOpenAIError 按OpenAI的错误格式返回并中止请求
+func abortOpenAIError(c *gin.Context, status int, errType, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": gin.H{"message": message, "type": errType}})
+}
+
+// RequirePermission 权限校验中间件，需放在AuthMiddleware之后
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := services.UserHasPermission(c.GetUint("userID"), permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "权限校验失败"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "权限不足"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// AdminUserQuery 管理端用户查询条件
+type AdminUserQuery struct {
+	Keyword  string `form:"keyword"` // 匹配用户名、邮箱或手机号
+	Status   *int   `form:"status"`
+	Role     string `form:"role"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+}
+
+// AdminUserSummary 管理端用户列表项
+type AdminUserSummary struct {
+	User
+	Roles []string `json:"roles"`
+}
+
+// AdminUserDetail 管理端用户详情，包含使用情况
+type AdminUserDetail struct {
+	User
+	Roles            []string   `json:"roles"`
+	SessionCount     int64      `json:"session_count"`      // 聊天会话数
+	MessageCount     int64      `json:"message_count"`      // 发送的消息数
+	AIResponseCount  int64      `json:"ai_response_count"`  // 生成的AI回答数（含重试）
+	ActiveLoginCount int64      `json:"active_login_count"` // 未过期的登录会话数
+	LastMessageAt    *time.Time `json:"last_message_at"`    // 最后一次发送消息时间
+}
+
+// SetUserStatusRequest 设置用户状态请求
+type SetUserStatusRequest struct {
+	Status *int   `json:"status" binding:"required,oneof=0 1"`
+	Reason string `json:"reason" binding:"omitempty,max=255"`
+}
+
+// AdminResetPasswordRequest 管理员重置密码请求，未提供新密码时生成临时密码
+type AdminResetPasswordRequest struct {
+	NewPassword string `json:"new_password" binding:"omitempty,min=6,max=100"`
+}
+
+// SetUserRolesRequest 设置用户角色请求
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+// ImpersonateRequest 代登录请求，必须说明原因
+type ImpersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
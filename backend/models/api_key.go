@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// APIKey 个人API密钥，用于通过兼容OpenAI的接口调用模型，只保存密钥的哈希值
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     uint       `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"` // 密钥的开头部分，用于辨认
+	KeyHash    string     `gorm:"type:char(64);not null;unique" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"` // 为空时不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// APIKeyUsage API密钥每日的用量，用于统计和配额检查
+type APIKeyUsage struct {
+	ID               uint   `gorm:"primaryKey" json:"-"`
+	APIKeyID         uint   `gorm:"not null;uniqueIndex:uk_api_key_usage_date" json:"api_key_id"`
+	UserID           uint   `gorm:"not null;index:idx_api_usage_user_date" json:"-"`
+	Date             string `gorm:"type:char(10);not null;uniqueIndex:uk_api_key_usage_date;index:idx_api_usage_user_date" json:"date"` // 2006-01-02
+	Requests         int64  `gorm:"not null;default:0" json:"requests"`
+	PromptTokens     int64  `gorm:"not null;default:0" json:"prompt_tokens"` // 服务商未返回用量时不计入
+	CompletionTokens int64  `gorm:"not null;default:0" json:"completion_tokens"`
+}
+
+// APIUserUsage 用户每日通过API密钥的用量合计，用于原子地预留每日配额
+type APIUserUsage struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	UserID   uint   `gorm:"not null;uniqueIndex:uk_api_user_usage_date"`
+	Date     string `gorm:"type:char(10);not null;uniqueIndex:uk_api_user_usage_date"` // 2006-01-02
+	Requests int64  `gorm:"not null;default:0"`                                        // 包括已预留但尚未完成的请求
+	Tokens   int64  `gorm:"not null;default:0"`
+}
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	ExpiresInDays int    `json:"expires_in_days" binding:"omitempty,min=1,max=3650"` // 为空时不过期
+}
+
+// CreateAPIKeyResponse 创建API密钥的结果，完整密钥只在创建时返回一次
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Assistant 自定义助手，打包系统提示词、默认模型、生成参数、工具和知识库
+// 个人助手只有创建者可见，工作区助手对全体成员共享
+// 修改设置会生成新版本，会话固定使用创建时的版本，不会因助手被修改而改变
+type Assistant struct {
+	gorm.Model
+	UserID         uint   `gorm:"not null;index" json:"user_id"`
+	WorkspaceID    *uint  `gorm:"index" json:"workspace_id"`
+	Name           string `gorm:"type:varchar(100);not null" json:"name"`
+	Description    string `gorm:"type:varchar(500)" json:"description"`
+	CurrentVersion int    `gorm:"not null;default:1" json:"current_version"`
+	// 这些字段不存储在数据库中，用于前端显示
+	Settings *AssistantVersion `gorm:"-" json:"settings,omitempty"` // 当前版本的设置
+}
+
+// AssistantSettings 助手的对话设置
+type AssistantSettings struct {
+	SystemPrompt     string           `gorm:"type:text" json:"system_prompt"`
+	Model            string           `gorm:"type:varchar(100)" json:"model" binding:"omitempty,max=100"` // 为空时使用会话或全局的默认模型
+	GenerationParams GenerationParams `gorm:"type:text;serializer:json" json:"generation_params"`         // 会话未设置的生成参数使用助手的设置
+	Tools            []string         `gorm:"type:text;serializer:json" json:"tools"`                     // 允许调用的工具，MCP工具为 服务器名__工具名，为空时不使用工具
+	KnowledgeBaseID  *uint            `json:"knowledge_base_id"`                                          // 创建会话时关联的知识库
+}
+
+// AssistantVersion 助手某个版本的设置，创建后不再修改
+type AssistantVersion struct {
+	ID                uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt         time.Time `json:"created_at"`
+	AssistantID       uint      `gorm:"not null;uniqueIndex:uk_assistant_version" json:"assistant_id"`
+	Version           int       `gorm:"not null;uniqueIndex:uk_assistant_version" json:"version"`
+	CreatedBy         uint      `gorm:"not null" json:"created_by"`
+	AssistantSettings `gorm:"embedded"`
+}
+
+// AssistantListQuery 助手列表的过滤条件
+type AssistantListQuery struct {
+	WorkspaceID *uint `form:"workspace_id"` // 为空时返回个人助手和所在工作区的助手，为 0 时只返回个人助手
+}
+
+// CreateAssistantRequest 创建助手请求
+type CreateAssistantRequest struct {
+	WorkspaceID *uint             `json:"workspace_id"`
+	Name        string            `json:"name" binding:"required,max=100"`
+	Description string            `json:"description" binding:"omitempty,max=500"`
+	Settings    AssistantSettings `json:"settings"`
+}
+
+// UpdateAssistantRequest 修改助手请求，提供 settings 时生成新版本
+type UpdateAssistantRequest struct {
+	Name        *string            `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string            `json:"description,omitempty" binding:"omitempty,max=500"`
+	Settings    *AssistantSettings `json:"settings,omitempty"`
+}
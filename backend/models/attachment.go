@@ -0,0 +1,18 @@
+package models
+
+import "gorm.io/gorm"
+
+// Attachment 用户消息的附件，文件保存在文件存储中，提取的文本保存在数据库中
+type Attachment struct {
+	gorm.Model
+	UserID      uint   `gorm:"not null;index" json:"user_id"`
+	SessionID   string `gorm:"type:varchar(50);not null;index" json:"session_id"`
+	MessageID   string `gorm:"type:varchar(50);not null;index" json:"message_id"`
+	FileName    string `gorm:"type:varchar(255);not null" json:"file_name"`
+	ContentType string `gorm:"type:varchar(100)" json:"content_type"`
+	Size        int64  `gorm:"not null" json:"size"`
+	BlobKey     string `gorm:"type:varchar(255);not null" json:"-"`
+	Text        string `gorm:"type:mediumtext" json:"-"`                // 提取的文本，过长时截断保存
+	TextLength  int    `gorm:"not null;default:0" json:"text_length"`   // 提取的文本字符数（截断前）
+	Extracted   bool   `gorm:"not null;default:false" json:"extracted"` // 是否成功提取了文本
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogImmutable 审计日志不可修改或删除错误
+var ErrAuditLogImmutable = errors.New("audit log is append-only")
+
+// 审计结果
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// 审计动作
+const (
+	AuditActionRegister               = "auth.register"
+	AuditActionLogin                  = "auth.login"
+	AuditActionSMSLogin               = "auth.login_sms"
+	AuditActionOIDCLogin              = "auth.login_oidc"
+	AuditActionLogout                 = "auth.logout"
+	AuditActionProfileUpdate          = "user.profile.update"
+	AuditActionPasswordChange         = "user.password.change"
+	AuditActionSettingsUpdate         = "user.settings.update"
+	AuditActionAvatarUpload           = "user.avatar.upload"
+	AuditActionDataExport             = "user.data.export"
+	AuditActionDeletionSchedule       = "user.deletion.schedule"
+	AuditActionDeletionCancel         = "user.deletion.cancel"
+	AuditActionDeletionComplete       = "user.deletion.complete"
+	AuditActionAPIKeyCreate           = "user.api_key.create"
+	AuditActionAPIKeyDelete           = "user.api_key.delete"
+	AuditActionOIDCLink               = "user.oidc.link"
+	AuditActionSessionCreate          = "chat.session.create"
+	AuditActionSessionUpdate          = "chat.session.update"
+	AuditActionSessionDelete          = "chat.session.delete"
+	AuditActionSessionRestore         = "chat.session.restore"
+	AuditActionSessionPurge           = "chat.session.purge"
+	AuditActionWorkspaceCreate        = "workspace.create"
+	AuditActionWorkspaceUpdate        = "workspace.update"
+	AuditActionWorkspaceDelete        = "workspace.delete"
+	AuditActionWorkspaceMemberAdd     = "workspace.member.add"
+	AuditActionWorkspaceMemberUpdate  = "workspace.member.update"
+	AuditActionWorkspaceMemberRemove  = "workspace.member.remove"
+	AuditActionAdminRoleCreate        = "admin.role.create"
+	AuditActionAdminRoleUpdate        = "admin.role.update"
+	AuditActionAdminRoleDelete        = "admin.role.delete"
+	AuditActionAdminLoginUnlock       = "admin.login.unlock"
+	AuditActionAdminUserDisable       = "admin.user.disable"
+	AuditActionAdminUserEnable        = "admin.user.enable"
+	AuditActionAdminUserResetPassword = "admin.user.reset_password"
+	AuditActionAdminUserSetRoles      = "admin.user.set_roles"
+	AuditActionAdminUserImpersonate   = "admin.user.impersonate"
+	AuditActionAdminFeedbackExport    = "admin.feedback.export"
+)
+
+// AuditLog 审计日志，只允许追加
+type AuditLog struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+	ActorID        uint      `gorm:"index" json:"actor_id"`            // 操作人，未登录时为0
+	ImpersonatorID uint      `gorm:"default:0" json:"impersonator_id"` // 代登录时的真实操作人
+	Action         string    `gorm:"type:varchar(64);not null;index" json:"action"`
+	TargetType     string    `gorm:"type:varchar(32)" json:"target_type"`
+	TargetID       string    `gorm:"type:varchar(64);index" json:"target_id"`
+	IP             string    `gorm:"type:varchar(50)" json:"ip"`
+	UserAgent      string    `gorm:"type:varchar(255)" json:"user_agent"`
+	Result         string    `gorm:"type:varchar(16);not null" json:"result"`
+	Detail         string    `gorm:"type:text" json:"detail"`
+}
+
+// BeforeUpdate 禁止修改审计日志
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete 禁止删除审计日志
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// AuditLogQuery 审计日志查询条件
+type AuditLogQuery struct {
+	ActorID    uint      `form:"actor_id"`
+	Action     string    `form:"action"` // 支持前缀匹配，例如 admin.
+	TargetType string    `form:"target_type"`
+	TargetID   string    `form:"target_id"`
+	Result     string    `form:"result"`
+	IP         string    `form:"ip"`
+	From       time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page       int       `form:"page"`
+	PageSize   int       `form:"page_size"`
+}
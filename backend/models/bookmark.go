@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Bookmark 消息收藏，指向某条消息的特定版本，切换活跃版本后仍指向原来的内容
+type Bookmark struct {
+	gorm.Model
+	UserID    uint   `gorm:"not null;uniqueIndex:uk_user_message_version" json:"user_id"`
+	SessionID string `gorm:"type:varchar(50);not null;index" json:"session_id"`
+	MessageID string `gorm:"type:varchar(50);not null;uniqueIndex:uk_user_message_version" json:"message_id"`
+	Role      string `gorm:"type:varchar(20);not null;uniqueIndex:uk_user_message_version" json:"role"` // user 或 ai
+	Version   int    `gorm:"not null;uniqueIndex:uk_user_message_version" json:"version"`               // 1 为原始消息，大于 1 为重试生成的回答
+	Note      string `gorm:"type:text" json:"note"`
+	Tags      []Tag  `gorm:"-" json:"tags"`
+}
+
+// BookmarkTag 收藏与标签的关联，标签与会话标签共用
+type BookmarkTag struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt  time.Time `json:"-"`
+	BookmarkID uint      `gorm:"not null;uniqueIndex:uk_bookmark_tag" json:"bookmark_id"`
+	TagID      uint      `gorm:"not null;uniqueIndex:uk_bookmark_tag;index" json:"tag_id"`
+}
+
+// BookmarkDetail 收藏列表项，包含被收藏的内容和定位到原会话所需的信息
+type BookmarkDetail struct {
+	Bookmark
+	SessionTitle string     `json:"session_title"`
+	WorkspaceID  *uint      `json:"workspace_id,omitempty"`
+	Content      string     `json:"content"`
+	ThinkContent string     `json:"think_content,omitempty"`
+	Question     string     `json:"question,omitempty"`   // 收藏AI回答时对应的用户提问
+	IsActive     bool       `json:"is_active"`            // 收藏的版本是否为当前显示的版本
+	MessageAt    *time.Time `json:"message_at,omitempty"` // 消息的生成时间
+}
+
+// CreateBookmarkRequest 收藏消息请求，version 为空时收藏当前活跃版本
+type CreateBookmarkRequest struct {
+	MessageID string `json:"message_id" binding:"required,max=50"`
+	Role      string `json:"role" binding:"omitempty,oneof=user ai"` // 默认为 ai
+	Version   int    `json:"version" binding:"omitempty,min=1"`
+	Note      string `json:"note" binding:"omitempty,max=2000"`
+	TagIDs    []uint `json:"tag_ids" binding:"omitempty,max=20"`
+}
+
+// UpdateBookmarkRequest 修改收藏请求，tag_ids 会替换原有标签
+type UpdateBookmarkRequest struct {
+	Note   *string `json:"note,omitempty" binding:"omitempty,max=2000"`
+	TagIDs *[]uint `json:"tag_ids,omitempty" binding:"omitempty,max=20"`
+}
+
+// BookmarkQuery 收藏列表查询条件
+type BookmarkQuery struct {
+	SessionID string `form:"session_id"`
+	TagID     uint   `form:"tag_id"`
+	Keyword   string `form:"keyword"` // 匹配备注
+	Page      int    `form:"page"`
+	PageSize  int    `form:"page_size"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -9,13 +10,63 @@ import (
 // ChatSession 聊天会话模型
 type ChatSession struct {
 	gorm.Model
-	SessionID string `gorm:"type:varchar(50);not null;unique" json:"session_id"`
-	UserID    uint   `gorm:"not null" json:"user_id"`
-	Title     string `gorm:"type:varchar(100);not null" json:"title"`
-	IsPinned  int    `gorm:"type:tinyint;default:0" json:"is_pinned"`
+	SessionID   string `gorm:"type:varchar(50);not null;unique" json:"session_id"`
+	UserID      uint   `gorm:"not null" json:"user_id"`             // 创建者
+	WorkspaceID *uint  `gorm:"index" json:"workspace_id,omitempty"` // 所属工作区，为空时为个人会话
+	FolderID    *uint  `gorm:"index" json:"folder_id,omitempty"`    // 所属文件夹，仅用于个人会话
+	Title       string `gorm:"type:varchar(100);not null" json:"title"`
+	IsPinned    int    `gorm:"type:tinyint;default:0" json:"is_pinned"`
+	IsArchived  bool   `gorm:"type:boolean;default:false;index" json:"is_archived"` // 已归档的会话不出现在默认列表中
+	// 关联的知识库，提问时检索其中的文档作为参考资料
+	KnowledgeBaseID *uint `gorm:"index" json:"knowledge_base_id,omitempty"`
+	// 使用的助手及其版本，助手修改后会话仍使用创建时的版本
+	AssistantID      *uint `gorm:"index" json:"assistant_id,omitempty"`
+	AssistantVersion int   `json:"assistant_version,omitempty"`
+	// 会话默认的生成参数，优先于助手的设置
+	GenerationParams GenerationParams `gorm:"type:text;serializer:json" json:"generation_params"`
 	// 这些字段不存储在数据库中，用于前端显示
 	MessageCount int          `gorm:"-" json:"message_count,omitempty"`
 	LastMessage  *ChatMessage `gorm:"-" json:"last_message,omitempty"`
+	Tags         []Tag        `gorm:"-" json:"tags,omitempty"`
+}
+
+// GenerationParams 生成参数，为空的字段使用默认值，取值范围与OpenAI的聊天补全接口一致
+type GenerationParams struct {
+	Temperature      *float64 `json:"temperature,omitempty" form:"temperature" binding:"omitempty,min=0,max=2"`
+	TopP             *float64 `json:"top_p,omitempty" form:"top_p" binding:"omitempty,gt=0,max=1"`
+	MaxTokens        *int     `json:"max_tokens,omitempty" form:"max_tokens" binding:"omitempty,min=1"`
+	Stop             []string `json:"stop,omitempty" form:"stop" binding:"omitempty,max=4,dive,min=1,max=100"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty" form:"presence_penalty" binding:"omitempty,min=-2,max=2"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty" form:"frequency_penalty" binding:"omitempty,min=-2,max=2"`
+}
+
+// ResponseFormat 回答的输出格式，与OpenAI聊天补全接口的 response_format 一致
+// type 为 json_object 时回答必须是JSON对象，为 json_schema 时还需要符合 json_schema 中的 schema
+type ResponseFormat struct {
+	Type       string              `json:"type" binding:"required,oneof=text json_object json_schema"`
+	JSONSchema *ResponseJSONSchema `json:"json_schema,omitempty" binding:"required_if=Type json_schema"`
+}
+
+// ResponseJSONSchema 回答需要符合的 JSON Schema
+type ResponseJSONSchema struct {
+	Name        string          `json:"name,omitempty" binding:"max=64"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema" binding:"required"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// SessionListQuery 会话列表查询条件
+type SessionListQuery struct {
+	WorkspaceID *uint `form:"workspace_id"` // 指定时返回工作区会话
+	FolderID    *uint `form:"folder_id"`    // 指定文件夹，0 表示未归入文件夹的会话
+	TagID       uint  `form:"tag_id"`       // 指定标签
+	Archived    bool  `form:"archived"`     // 为 true 时只返回已归档的会话，否则只返回未归档的会话
+}
+
+// TrashSession 回收站中的会话
+type TrashSession struct {
+	ChatSession
+	PurgeAt time.Time `json:"purge_at"` // 到期后彻底删除
 }
 
 // ChatMessage 聊天消息模型
@@ -27,32 +78,95 @@ type ChatMessage struct {
 	MessageID    string `gorm:"type:varchar(50);not null" json:"message_id"` // 消息唯一ID
 	ThinkContent string `gorm:"type:text;not null" json:"think_content"`
 	Content      string `gorm:"type:text;not null" json:"content"`
-	Version      int    `gorm:"type:int;default:1" json:"version"`          // 版本号，用于跟踪重试
-	IsActive     bool   `gorm:"type:boolean;default:true" json:"is_active"` // 当前是否是活跃版本
+	Version      int    `gorm:"type:int;default:1" json:"version"`                     // 版本号，用于跟踪重试
+	IsActive     bool   `gorm:"type:boolean;default:true" json:"is_active"`            // 当前是否是活跃版本
+	ModelName    string `gorm:"column:model;type:varchar(100)" json:"model,omitempty"` // 生成回答使用的模型，用户消息为空
+	// 生成回答实际使用的参数，用于复现回答
+	GenerationParams *GenerationParams `gorm:"type:text;serializer:json" json:"generation_params,omitempty"`
+	// 生成回答时使用的系统提示词，会话或助手之后修改也不影响
+	SystemPrompt string `gorm:"type:text" json:"-"`
 	// 关联的其他响应
 	AlternativeResponses []AIResponse `gorm:"-" json:"alternative_responses,omitempty"`
+	// 用户消息的附件
+	Attachments []Attachment `gorm:"-" json:"attachments,omitempty"`
+	// AI回答引用的知识库片段
+	Citations []MessageCitation `gorm:"-" json:"citations,omitempty"`
+	// AI回答过程中的工具调用
+	ToolCalls []MessageToolCall `gorm:"-" json:"tool_calls,omitempty"`
 }
 
 // AIResponse AI响应模型，用于存储同一问题的多个回答
 type AIResponse struct {
 	gorm.Model
-	MessageID    string `gorm:"type:varchar(50);not null" json:"message_id"` // 关联到原始消息
+	MessageID    string `gorm:"type:varchar(50);not null;uniqueIndex:uk_response_message_version" json:"message_id"` // 关联到原始消息
 	SessionID    string `gorm:"type:varchar(50);not null" json:"session_id"`
 	ThinkContent string `gorm:"type:text;not null" json:"think_content"`
 	Content      string `gorm:"type:text;not null" json:"content"`
-	Version      int    `gorm:"type:int;not null" json:"version"`            // 版本号
-	IsActive     bool   `gorm:"type:boolean;default:false" json:"is_active"` // 是否是当前活跃版本
+	Version      int    `gorm:"type:int;not null;uniqueIndex:uk_response_message_version" json:"version"` // 版本号
+	IsActive     bool   `gorm:"type:boolean;default:false" json:"is_active"`                              // 是否是当前活跃版本
+	ModelName    string `gorm:"column:model;type:varchar(100)" json:"model,omitempty"`                    // 生成回答使用的模型
+	// 生成回答实际使用的参数
+	GenerationParams *GenerationParams `gorm:"type:text;serializer:json" json:"generation_params,omitempty"`
+	// 生成回答时使用的系统提示词
+	SystemPrompt string `gorm:"type:text" json:"-"`
+	// 回答引用的知识库片段
+	Citations []MessageCitation `gorm:"-" json:"citations,omitempty"`
+	// 回答过程中的工具调用
+	ToolCalls []MessageToolCall `gorm:"-" json:"tool_calls,omitempty"`
+}
+
+// MessageToolCall 回答某个版本生成过程中的工具调用记录
+type MessageToolCall struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	SessionID string    `gorm:"type:varchar(50);not null;index" json:"-"`
+	MessageID string    `gorm:"type:varchar(50);not null;index:idx_tool_call_message" json:"message_id"`
+	Version   int       `gorm:"not null;index:idx_tool_call_message" json:"version"`
+	Seq       int       `gorm:"not null" json:"seq"`                    // 调用顺序，从 0 开始
+	CallID    string    `gorm:"type:varchar(100)" json:"id"`            // 模型生成的调用ID
+	Name      string    `gorm:"type:varchar(100);not null" json:"name"` // 工具名称
+	Arguments string    `gorm:"type:text" json:"arguments"`
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"` // done 或 error
+	Result    string    `gorm:"type:text" json:"result,omitempty"`
+	Error     string    `gorm:"type:varchar(500)" json:"error,omitempty"`
+}
+
+// RealtimeTicket 建立实时协作连接的一次性票据，代替在地址中传递登录令牌
+type RealtimeTicket struct {
+	ID            uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt     time.Time `json:"-"`
+	TicketHash    string    `gorm:"type:varchar(64);not null;unique"`
+	UserID        uint      `gorm:"not null"`
+	UserSessionID uint      `gorm:"not null"` // 签发票据的登录会话，登出后连接随之断开
+	SessionID     string    `gorm:"type:varchar(50);not null"`
+	ExpireTime    time.Time `gorm:"not null;index"`
 }
 
 // CreateSessionRequest 创建会话请求
 type CreateSessionRequest struct {
-	Title string `json:"title"`
+	Title       string `json:"title"`
+	WorkspaceID *uint  `json:"workspace_id,omitempty"` // 在工作区中创建共享会话
+	AssistantID *uint  `json:"assistant_id,omitempty"` // 使用助手的当前版本
+}
+
+// CompareRequest 多模型对比请求，指定 message_id 时对已有的提问重新生成
+type CompareRequest struct {
+	Content   string   `json:"content"`
+	Models    []string `json:"models" binding:"required,min=2,max=4,unique,dive,required"`
+	MessageID string   `json:"message_id,omitempty"`
 }
 
 // UpdateSessionRequest 更新会话请求
 type UpdateSessionRequest struct {
-	Title    string `json:"title"`
-	IsPinned *bool  `json:"is_pinned,omitempty"`
+	Title      string `json:"title"`
+	IsPinned   *bool  `json:"is_pinned,omitempty"`
+	IsArchived *bool  `json:"is_archived,omitempty"`
+	// 关联知识库，0 表示取消关联
+	KnowledgeBaseID *uint `json:"knowledge_base_id,omitempty"`
+	// 为 true 时改用助手的最新版本
+	UpgradeAssistant bool `json:"upgrade_assistant,omitempty"`
+	// 会话默认的生成参数，提供时整体替换
+	GenerationParams *GenerationParams `json:"generation_params,omitempty"`
 }
 
 // SendMessageRequest 发送消息请求
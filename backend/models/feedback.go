@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 回答评价
+const (
+	FeedbackRatingUp   = 1  // 赞
+	FeedbackRatingDown = -1 // 踩
+)
+
+// 评价原因
+const (
+	FeedbackReasonHelpful     = "helpful"      // 有帮助
+	FeedbackReasonAccurate    = "accurate"     // 准确
+	FeedbackReasonWellWritten = "well_written" // 表达清晰
+	FeedbackReasonInaccurate  = "inaccurate"   // 内容错误
+	FeedbackReasonIncomplete  = "incomplete"   // 回答不完整
+	FeedbackReasonIrrelevant  = "irrelevant"   // 答非所问
+	FeedbackReasonHarmful     = "harmful"      // 有害或不安全
+	FeedbackReasonVerbose     = "verbose"      // 过于冗长
+	FeedbackReasonOther       = "other"        // 其他
+)
+
+// MessageFeedback 用户对AI回答某个版本的评价
+// 保存生成回答时的模型、参数、提示词和回答内容，会话删除后仍可用于构建评测数据集
+type MessageFeedback struct {
+	gorm.Model
+	UserID       uint   `gorm:"not null;uniqueIndex:uk_user_message_version" json:"user_id"`
+	SessionID    string `gorm:"type:varchar(50);not null;index" json:"session_id"`
+	MessageID    string `gorm:"type:varchar(50);not null;uniqueIndex:uk_user_message_version" json:"message_id"`
+	Version      int    `gorm:"not null;uniqueIndex:uk_user_message_version" json:"version"`
+	Rating       int    `gorm:"type:tinyint;not null;index" json:"rating"` // 1 为赞，-1 为踩
+	Reason       string `gorm:"type:varchar(30)" json:"reason"`
+	Comment      string `gorm:"type:text" json:"comment"`
+	ModelName    string `gorm:"column:model;type:varchar(100);index" json:"model"`
+	SystemPrompt string `gorm:"type:text" json:"system_prompt"` // 生成回答时使用的系统提示词
+	Prompt       string `gorm:"type:text" json:"prompt"`        // 用户提问
+	Answer       string `gorm:"type:text" json:"answer"`        // 被评价的回答
+	// 生成回答时使用的参数
+	GenerationParams *GenerationParams `gorm:"type:text;serializer:json" json:"generation_params,omitempty"`
+}
+
+// MessageFeedbackRequest 评价回答请求，version 为空时评价当前活跃版本
+type MessageFeedbackRequest struct {
+	Version int    `json:"version" binding:"omitempty,min=1"`
+	Rating  int    `json:"rating" binding:"required,oneof=1 -1"`
+	Reason  string `json:"reason" binding:"omitempty,oneof=helpful accurate well_written inaccurate incomplete irrelevant harmful verbose other"`
+	Comment string `json:"comment" binding:"omitempty,max=2000"`
+}
+
+// FeedbackQuery 管理端反馈统计和导出条件
+type FeedbackQuery struct {
+	Model  string    `form:"model"`
+	Rating int       `form:"rating"`
+	Reason string    `form:"reason"`
+	From   time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To     time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// FeedbackModelStats 按模型汇总的反馈统计
+type FeedbackModelStats struct {
+	Model        string           `json:"model"`
+	Total        int64            `json:"total"`
+	Positive     int64            `json:"positive"`
+	Negative     int64            `json:"negative"`
+	PositiveRate float64          `json:"positive_rate"` // 好评率，0 到 1
+	Reasons      map[string]int64 `json:"reasons"`       // 各原因的次数
+}
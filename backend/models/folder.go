@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Folder 会话文件夹，支持多级嵌套
+type Folder struct {
+	gorm.Model
+	UserID    uint   `gorm:"not null;index" json:"user_id"`
+	ParentID  *uint  `gorm:"index" json:"parent_id"` // 上级文件夹，为空时位于根目录
+	Name      string `gorm:"type:varchar(100);not null" json:"name"`
+	SortOrder int    `gorm:"type:int;default:0" json:"sort_order"`
+	// 不存储在数据库中，用于前端显示
+	SessionCount int64 `gorm:"-" json:"session_count"`
+}
+
+// Tag 会话标签
+type Tag struct {
+	gorm.Model
+	UserID uint   `gorm:"not null;uniqueIndex:uk_user_tag" json:"user_id"`
+	Name   string `gorm:"type:varchar(50);not null;uniqueIndex:uk_user_tag" json:"name"`
+	Color  string `gorm:"type:varchar(20)" json:"color"`
+	// 不存储在数据库中，用于前端显示
+	SessionCount int64 `gorm:"-" json:"session_count"`
+}
+
+// SessionTag 会话与标签的关联
+type SessionTag struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	SessionID string    `gorm:"type:varchar(50);not null;uniqueIndex:uk_session_tag" json:"session_id"`
+	TagID     uint      `gorm:"not null;uniqueIndex:uk_session_tag;index" json:"tag_id"`
+}
+
+// CreateFolderRequest 创建文件夹请求
+type CreateFolderRequest struct {
+	Name      string `json:"name" binding:"required,max=100"`
+	ParentID  *uint  `json:"parent_id,omitempty"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// UpdateFolderRequest 更新文件夹请求，parent_id 为 0 时移动到根目录
+type UpdateFolderRequest struct {
+	Name      *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	ParentID  *uint   `json:"parent_id,omitempty"`
+	SortOrder *int    `json:"sort_order,omitempty"`
+}
+
+// CreateTagRequest 创建标签请求
+type CreateTagRequest struct {
+	Name  string `json:"name" binding:"required,max=50"`
+	Color string `json:"color" binding:"omitempty,max=20"`
+}
+
+// UpdateTagRequest 更新标签请求
+type UpdateTagRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,min=1,max=50"`
+	Color *string `json:"color,omitempty" binding:"omitempty,max=20"`
+}
+
+// BulkMoveSessionsRequest 批量移动会话请求，folder_id 为 0 时移出文件夹
+type BulkMoveSessionsRequest struct {
+	SessionIDs []string `json:"session_ids" binding:"required,min=1,max=200"`
+	FolderID   *uint    `json:"folder_id" binding:"required"`
+}
+
+// BulkTagSessionsRequest 批量添加或移除会话标签请求
+type BulkTagSessionsRequest struct {
+	SessionIDs []string `json:"session_ids" binding:"required,min=1,max=200"`
+	Add        []uint   `json:"add"`
+	Remove     []uint   `json:"remove"`
+}
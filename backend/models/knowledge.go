@@ -0,0 +1,90 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 知识库文档的处理状态
+const (
+	KnowledgeDocumentReady  = "ready"
+	KnowledgeDocumentFailed = "failed"
+)
+
+// KnowledgeBase 个人知识库，会话关联知识库后提问时会检索其中的文档作为参考资料
+type KnowledgeBase struct {
+	gorm.Model
+	UserID         uint   `gorm:"not null;index" json:"user_id"`
+	Name           string `gorm:"type:varchar(100);not null" json:"name"`
+	Description    string `gorm:"type:varchar(500)" json:"description"`
+	EmbeddingModel string `gorm:"type:varchar(100)" json:"embedding_model"` // 生成向量使用的模型，与当前配置不一致时需要重建索引
+	// 这些字段不存储在数据库中，用于前端显示
+	DocumentCount int64 `gorm:"-" json:"document_count"`
+}
+
+// KnowledgeDocument 知识库中的文档，上传后切块并向量化
+type KnowledgeDocument struct {
+	gorm.Model
+	KnowledgeBaseID uint   `gorm:"not null;index" json:"knowledge_base_id"`
+	UserID          uint   `gorm:"not null;index" json:"user_id"`
+	FileName        string `gorm:"type:varchar(255);not null" json:"file_name"`
+	ContentType     string `gorm:"type:varchar(100)" json:"content_type"`
+	Size            int64  `json:"size"`
+	BlobKey         string `gorm:"type:varchar(255);not null" json:"-"`
+	Status          string `gorm:"type:varchar(20);not null" json:"status"`
+	Error           string `gorm:"type:varchar(500)" json:"error,omitempty"` // 处理失败的原因
+	ChunkCount      int    `json:"chunk_count"`
+}
+
+// KnowledgeChunk 文档切块后的文本片段
+type KnowledgeChunk struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	KnowledgeBaseID uint      `gorm:"not null;index" json:"knowledge_base_id"`
+	DocumentID      uint      `gorm:"not null;index" json:"document_id"`
+	Seq             int       `gorm:"not null" json:"seq"` // 在文档中的顺序，从 0 开始
+	Content         string    `gorm:"type:text;not null" json:"content"`
+}
+
+// KnowledgeVector 切块的向量，由数据库向量存储使用
+type KnowledgeVector struct {
+	ChunkID         uint   `gorm:"primaryKey;autoIncrement:false"`
+	KnowledgeBaseID uint   `gorm:"not null;index"`
+	DocumentID      uint   `gorm:"not null;index"`
+	Vector          []byte `gorm:"type:mediumblob;not null"` // float32 小端序
+}
+
+// MessageCitation 回答引用的知识库片段，对应回答的某个版本
+type MessageCitation struct {
+	ID              uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt       time.Time `json:"-"`
+	SessionID       string    `gorm:"type:varchar(50);not null;index" json:"-"`
+	MessageID       string    `gorm:"type:varchar(50);not null;index:idx_citation_message" json:"message_id"`
+	Version         int       `gorm:"not null;index:idx_citation_message" json:"version"`
+	Index           int       `gorm:"not null" json:"index"` // 回答中引用的编号，从 1 开始
+	KnowledgeBaseID uint      `json:"knowledge_base_id"`
+	DocumentID      uint      `json:"document_id"`
+	ChunkID         uint      `json:"chunk_id"`
+	FileName        string    `gorm:"type:varchar(255)" json:"file_name"`
+	Content         string    `gorm:"type:text" json:"content"`
+	Score           float64   `json:"score"`
+}
+
+// CreateKnowledgeBaseRequest 创建知识库请求
+type CreateKnowledgeBaseRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"omitempty,max=500"`
+}
+
+// UpdateKnowledgeBaseRequest 修改知识库请求
+type UpdateKnowledgeBaseRequest struct {
+	Name        *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description,omitempty" binding:"omitempty,max=500"`
+}
+
+// KnowledgeSearchRequest 在知识库中检索的请求，用于调试检索效果
+type KnowledgeSearchRequest struct {
+	Query string `json:"query" binding:"required"`
+	TopK  int    `json:"top_k" binding:"omitempty,min=1,max=50"`
+}
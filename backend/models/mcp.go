@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SessionMCPServer 会话对MCP服务器的启用设置，没有记录时使用配置中的默认值
+type SessionMCPServer struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	SessionID  string    `gorm:"type:varchar(50);not null;uniqueIndex:uk_session_mcp_server" json:"session_id"`
+	ServerName string    `gorm:"type:varchar(64);not null;uniqueIndex:uk_session_mcp_server" json:"server_name"`
+	Enabled    bool      `gorm:"not null" json:"enabled"`
+}
+
+// UpdateSessionMCPServerRequest 启用或停用会话的MCP服务器
+type UpdateSessionMCPServerRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// PromptTemplate 提示词模板，内容中的 {{变量名}} 在使用时替换为变量值
+// 个人模板只有创建者可见，工作区模板对全体成员共享
+type PromptTemplate struct {
+	gorm.Model
+	UserID      uint             `gorm:"not null;index" json:"user_id"`
+	WorkspaceID *uint            `gorm:"index" json:"workspace_id"`
+	Title       string           `gorm:"type:varchar(100);not null" json:"title"`
+	Description string           `gorm:"type:varchar(500)" json:"description"`
+	Content     string           `gorm:"type:text;not null" json:"content"`
+	Variables   []PromptVariable `gorm:"type:text;serializer:json" json:"variables"` // 按在内容中首次出现的顺序排列
+	UsageCount  int64            `gorm:"not null;default:0" json:"usage_count"`      // 用于发送消息的次数
+}
+
+// PromptVariable 模板变量的说明，没有默认值的变量为必填，使用时必须提供值
+type PromptVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"` // 未提供值时使用的默认值
+	Required    bool   `json:"required"`          // 由默认值决定，请求中的值会被忽略
+}
+
+// PromptTemplateListQuery 模板列表的过滤条件
+type PromptTemplateListQuery struct {
+	WorkspaceID *uint  `form:"workspace_id"` // 为空时返回个人模板和所在工作区的模板，为 0 时只返回个人模板
+	Keyword     string `form:"q"`
+	Sort        string `form:"sort" binding:"omitempty,oneof=recent popular"` // popular 按使用次数排序
+}
+
+// CreatePromptTemplateRequest 创建模板请求，variables 只需说明需要补充描述或默认值的变量
+type CreatePromptTemplateRequest struct {
+	WorkspaceID *uint            `json:"workspace_id"`
+	Title       string           `json:"title" binding:"required,max=100"`
+	Description string           `json:"description" binding:"omitempty,max=500"`
+	Content     string           `json:"content" binding:"required"`
+	Variables   []PromptVariable `json:"variables"`
+}
+
+// UpdatePromptTemplateRequest 修改模板请求
+type UpdatePromptTemplateRequest struct {
+	Title       *string          `json:"title,omitempty" binding:"omitempty,min=1,max=100"`
+	Description *string          `json:"description,omitempty" binding:"omitempty,max=500"`
+	Content     *string          `json:"content,omitempty" binding:"omitempty,min=1"`
+	Variables   []PromptVariable `json:"variables,omitempty"`
+}
+
+// RenderPromptTemplateRequest 渲染模板请求
+type RenderPromptTemplateRequest struct {
+	Variables map[string]string `json:"variables"`
+}
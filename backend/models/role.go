@@ -0,0 +1,64 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// 内置角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// 权限标识
+const (
+	PermissionAll              = "*"                 // 全部权限
+	PermissionUsersRead        = "users:read"        // 查看用户
+	PermissionUsersWrite       = "users:write"       // 管理用户
+	PermissionUsersImpersonate = "users:impersonate" // 代登录用户
+	PermissionRolesManage      = "roles:manage"      // 管理角色
+	PermissionSecurityManage   = "security:manage"   // 管理登录锁定等安全设置
+	PermissionAuditRead        = "audit:read"        // 查看审计日志
+	PermissionFeedbackRead     = "feedback:read"     // 查看和导出回答反馈
+)
+
+// AllPermissions 系统支持的全部权限，自定义角色只能从中选择
+var AllPermissions = []string{
+	PermissionAll,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersImpersonate,
+	PermissionRolesManage,
+	PermissionSecurityManage,
+	PermissionAuditRead,
+	PermissionFeedbackRead,
+}
+
+// Role 角色模型
+type Role struct {
+	gorm.Model
+	Name        string   `gorm:"type:varchar(50);not null;unique" json:"name"`
+	Description string   `gorm:"type:varchar(255)" json:"description"`
+	Permissions []string `gorm:"type:text;serializer:json" json:"permissions"`
+	BuiltIn     bool     `gorm:"type:boolean;default:false" json:"built_in"` // 内置角色不可删除
+}
+
+// UserRole 用户与角色的关联
+type UserRole struct {
+	gorm.Model
+	UserID uint `gorm:"not null;uniqueIndex:uk_user_role" json:"user_id"`
+	RoleID uint `gorm:"not null;uniqueIndex:uk_user_role;index" json:"role_id"`
+}
+
+// CreateRoleRequest 创建角色请求
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=2,max=50"`
+	Description string   `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest 更新角色请求
+type UpdateRoleRequest struct {
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
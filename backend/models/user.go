@@ -6,6 +6,13 @@ import (
 	"gorm.io/gorm"
 )
 
+// 登录类型
+const (
+	LoginTypeEmail = 1 // 邮箱
+	LoginTypePhone = 2 // 手机号
+	LoginTypeOIDC  = 3 // 单点登录
+)
+
 // User 用户模型
 type User struct {
 	gorm.Model
@@ -24,7 +31,7 @@ type User struct {
 type UserSession struct {
 	gorm.Model
 	UserID     uint      `gorm:"not null" json:"user_id"`
-	Token      string    `gorm:"type:varchar(255);not null;unique" json:"token"`
+	Token      string    `gorm:"type:varchar(512);not null;unique" json:"token"`
 	ExpireTime time.Time `gorm:"not null" json:"expire_time"`
 }
 
@@ -39,6 +46,76 @@ type UserSettings struct {
 	Rules               string `gorm:"type:text" json:"rules"`
 }
 
+// UserIdentity 外部身份与本地用户的绑定关系
+type UserIdentity struct {
+	gorm.Model
+	UserID  uint   `gorm:"not null;index" json:"user_id"`
+	Issuer  string `gorm:"type:varchar(255);not null;uniqueIndex:uk_issuer_subject" json:"issuer"`
+	Subject string `gorm:"type:varchar(255);not null;uniqueIndex:uk_issuer_subject" json:"subject"`
+	Email   string `gorm:"type:varchar(100)" json:"email"`
+}
+
+// SMSCode 短信验证码模型，验证码仅保存哈希值
+type SMSCode struct {
+	gorm.Model
+	Phone      string    `gorm:"type:varchar(20);not null;index;uniqueIndex:uk_sms_phone_slot" json:"phone"`
+	CodeHash   string    `gorm:"type:varchar(64);not null" json:"-"`
+	Purpose    string    `gorm:"type:varchar(20);not null" json:"purpose"`
+	ExpireTime time.Time `gorm:"not null" json:"expire_time"`
+	Attempts   int       `gorm:"type:int;default:0" json:"attempts"`
+	Used       bool      `gorm:"type:boolean;default:false" json:"used"`
+	IP         string    `gorm:"type:varchar(50);index" json:"ip"`
+	// SendSlot 发送时间所在的间隔序号，与手机号组成唯一索引，保证并发请求在同一间隔内只能发送一条
+	SendSlot *int64 `gorm:"uniqueIndex:uk_sms_phone_slot" json:"-"`
+}
+
+// 登录失败记录的维度
+const (
+	LoginFailureScopeAccount = "account"
+	LoginFailureScopeIP      = "ip"
+)
+
+// LoginFailure 登录失败记录，按账号和IP分别统计
+type LoginFailure struct {
+	gorm.Model
+	Scope          string     `gorm:"type:varchar(20);not null;uniqueIndex:uk_scope_identifier" json:"scope"`
+	Identifier     string     `gorm:"type:varchar(100);not null;uniqueIndex:uk_scope_identifier" json:"identifier"`
+	Failures       int        `gorm:"type:int;default:0" json:"failures"`
+	FirstFailureAt time.Time  `json:"first_failure_at"`
+	LastFailureAt  time.Time  `json:"last_failure_at"`
+	LockedUntil    *time.Time `json:"locked_until"`
+}
+
+// UnlockLoginRequest 解除登录锁定请求
+type UnlockLoginRequest struct {
+	Scope      string `json:"scope" binding:"required,oneof=account ip"`
+	Identifier string `json:"identifier" binding:"required"`
+}
+
+// 账号注销状态
+const (
+	AccountDeletionPending   = "pending"
+	AccountDeletionCancelled = "cancelled"
+	AccountDeletionCompleted = "completed"
+)
+
+// AccountDeletion 账号注销申请，用户数据删除后仍保留该记录
+type AccountDeletion struct {
+	gorm.Model
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	Status       string     `gorm:"type:varchar(20);not null;index" json:"status"`
+	ScheduledFor time.Time  `gorm:"not null;index" json:"scheduled_for"` // 到期后执行删除
+	CancelledAt  *time.Time `json:"cancelled_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+}
+
+// DeleteAccountRequest 注销账号请求，需要再次确认身份，三种方式任选其一
+type DeleteAccountRequest struct {
+	Password    string `json:"password"`
+	SMSCode     string `json:"sms_code"`     // 发送到绑定手机号的验证码
+	ReauthToken string `json:"reauth_token"` // 单点登录重新认证后获得的凭证
+}
+
 // RegisterRequest 注册请求
 type RegisterRequest struct {
 	Username  string `json:"username" binding:"required,min=3,max=50"`
@@ -61,6 +138,17 @@ type LoginResponse struct {
 	User  User   `json:"user"`
 }
 
+// SendSMSCodeRequest 发送短信验证码请求
+type SendSMSCodeRequest struct {
+	Phone string `json:"phone" binding:"required,min=5,max=20"`
+}
+
+// SMSLoginRequest 短信验证码登录请求
+type SMSLoginRequest struct {
+	Phone string `json:"phone" binding:"required,min=5,max=20"`
+	Code  string `json:"code" binding:"required,len=6,numeric"`
+}
+
 // UpdateProfileRequest 更新用户资料请求
 type UpdateProfileRequest struct {
 	Username string `json:"username" binding:"omitempty,min=3,max=50"`
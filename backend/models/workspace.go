@@ -0,0 +1,72 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// 工作区成员角色
+const (
+	WorkspaceRoleOwner  = "owner"  // 所有者，可管理工作区和成员
+	WorkspaceRoleEditor = "editor" // 编辑者，可创建会话和发送消息
+	WorkspaceRoleViewer = "viewer" // 查看者，只能查看会话
+)
+
+// Workspace 工作区模型，工作区内的会话对全体成员共享
+type Workspace struct {
+	gorm.Model
+	Name          string `gorm:"type:varchar(100);not null" json:"name"`
+	Description   string `gorm:"type:varchar(255)" json:"description"`
+	CreatedBy     uint   `gorm:"not null;index" json:"created_by"`
+	DefaultPrompt string `gorm:"type:text" json:"default_prompt"`        // 工作区会话默认使用的系统提示词
+	DefaultModel  string `gorm:"type:varchar(100)" json:"default_model"` // 工作区会话默认使用的模型，为空时使用全局配置
+}
+
+// WorkspaceMember 工作区成员
+type WorkspaceMember struct {
+	gorm.Model
+	WorkspaceID uint   `gorm:"not null;uniqueIndex:uk_workspace_user" json:"workspace_id"`
+	UserID      uint   `gorm:"not null;uniqueIndex:uk_workspace_user;index" json:"user_id"`
+	Role        string `gorm:"type:varchar(20);not null" json:"role"`
+}
+
+// WorkspaceSummary 工作区列表项，包含当前用户的角色
+type WorkspaceSummary struct {
+	Workspace
+	Role        string `json:"role"`
+	MemberCount int64  `json:"member_count"`
+}
+
+// WorkspaceMemberInfo 工作区成员信息
+type WorkspaceMemberInfo struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Avatar   string `json:"avatar"`
+	Role     string `json:"role"`
+}
+
+// CreateWorkspaceRequest 创建工作区请求
+type CreateWorkspaceRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	Description   string `json:"description" binding:"omitempty,max=255"`
+	DefaultPrompt string `json:"default_prompt"`
+	DefaultModel  string `json:"default_model" binding:"omitempty,max=100"`
+}
+
+// UpdateWorkspaceRequest 更新工作区请求
+type UpdateWorkspaceRequest struct {
+	Name          *string `json:"name,omitempty" binding:"omitempty,min=1,max=100"`
+	Description   *string `json:"description,omitempty" binding:"omitempty,max=255"`
+	DefaultPrompt *string `json:"default_prompt,omitempty"`
+	DefaultModel  *string `json:"default_model,omitempty" binding:"omitempty,max=100"`
+}
+
+// AddWorkspaceMemberRequest 添加工作区成员请求，account 可以是用户名、邮箱或手机号
+type AddWorkspaceMemberRequest struct {
+	Account string `json:"account" binding:"required"`
+	Role    string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
+
+// UpdateWorkspaceMemberRequest 修改工作区成员角色请求
+type UpdateWorkspaceMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+}
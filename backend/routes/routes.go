@@ -3,6 +3,7 @@ package routes
 import (
 	"aiChat/backend/handlers"
 	"aiChat/backend/middleware"
+	"aiChat/backend/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,7 +21,25 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			auth.POST("/register", handlers.RegisterHandler)
 			auth.POST("/login", handlers.LoginHandler)
+			auth.POST("/sms/send", handlers.SendSMSCodeHandler)
+			auth.POST("/sms/verify", handlers.SMSLoginHandler)
+			auth.GET("/oidc/login", handlers.OIDCLoginHandler)
+			auth.GET("/oidc/callback", handlers.OIDCCallbackHandler)
 		}
+
+		// 公开文件，例如用户头像
+		public.GET("/files/*key", handlers.GetFileHandler)
+
+		// 会话实时协作连接，使用 ws-ticket 接口获取的一次性票据认证
+		public.GET("/chat/sessions/:id/ws", handlers.SessionWebSocketHandler)
+	}
+
+	// 兼容OpenAI的接口，使用个人API密钥认证
+	v1 := r.Group("/v1")
+	v1.Use(middleware.APIKeyMiddleware())
+	{
+		v1.GET("/models", handlers.OpenAIListModelsHandler)
+		v1.POST("/chat/completions", handlers.OpenAIChatCompletionsHandler) // stream 为 true 时以SSE返回
 	}
 
 	// 需要认证的路由
@@ -32,22 +51,155 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			user.GET("/profile", handlers.GetUserProfileHandler)
 			user.PUT("/profile", handlers.UpdateUserProfileHandler)
+			user.POST("/avatar", handlers.UploadAvatarHandler)
 			user.PUT("/password", handlers.UpdatePasswordHandler)
 			user.GET("/settings", handlers.GetUserSettingsHandler)
 			user.PUT("/settings", handlers.UpdateUserSettingsHandler)
 			user.POST("/logout", handlers.LogoutHandler)
+			user.GET("/data-export", handlers.ExportUserDataHandler)
+			user.GET("/deletion", handlers.GetAccountDeletionHandler)
+			user.POST("/deletion/cancel", handlers.CancelAccountDeletionHandler)
+			user.POST("/deletion/sms", handlers.SendAccountDeletionSMSHandler)
+			user.DELETE("", handlers.DeleteAccountHandler) // 申请注销账号
+		}
+		// 已登录用户绑定单点登录身份或重新认证，返回授权地址
+		private.POST("/user/oidc/link", handlers.OIDCLinkHandler)
+		private.POST("/user/oidc/reauth", handlers.OIDCReauthHandler)
+		// 个人API密钥，用于调用兼容OpenAI的 /v1 接口
+		apiKeys := private.Group("/user/api-keys")
+		{
+			apiKeys.GET("", handlers.ListAPIKeysHandler)
+			apiKeys.POST("", handlers.CreateAPIKeyHandler) // 完整密钥只在创建时返回
+			apiKeys.DELETE("/:id", handlers.DeleteAPIKeyHandler)
+			apiKeys.GET("/usage", handlers.GetAPIKeyUsageHandler) // 每日用量，days 指定天数
 		}
 		// 聊天相关的需认证路由
 		chat := private.Group("/chat")
 		{
-			chat.POST("/sessions", handlers.CreateSessionHandler)           // 创建会话
-			chat.GET("/sessions", handlers.GetSessionsHandler)              // 获取会话列表
-			chat.GET("/sessions/:id", handlers.GetSessionHandler)           // 获取会话详情
-			chat.PUT("/sessions/:id", handlers.UpdateSessionHandler)        // 更新会话
-			chat.DELETE("/sessions/:id", handlers.DeleteSessionHandler)     // 删除会话
-			chat.POST("/sessions/:id", handlers.SendMessageHandler)         // 发送消息（流式返回）
-			chat.POST("/retry", handlers.RetryMessageHandler)               // 重试生成回答
-			chat.PUT("/response/active", handlers.SetActiveResponseHandler) // or /response/active 设置活跃回答
+			chat.POST("/sessions", handlers.CreateSessionHandler)             // 创建会话
+			chat.GET("/sessions", handlers.GetSessionsHandler)                // 获取会话列表
+			chat.GET("/sessions/:id", handlers.GetSessionHandler)             // 获取会话详情
+			chat.PUT("/sessions/:id", handlers.UpdateSessionHandler)          // 更新会话
+			chat.DELETE("/sessions/:id", handlers.DeleteSessionHandler)       // 删除会话
+			chat.POST("/sessions/:id", handlers.SendMessageHandler)           // 发送消息（流式返回）
+			chat.POST("/sessions/:id/compare", handlers.CompareModelsHandler) // 多模型对比（SSE）
+			chat.GET("/models", handlers.ListModelsHandler)                   // 可供选择的模型
+			chat.GET("/tools", handlers.ListToolsHandler)                     // 支持工具调用的模型可以使用的工具
+			chat.GET("/attachments/:id", handlers.DownloadAttachmentHandler)  // 下载消息附件
+			chat.POST("/retry", handlers.RetryMessageHandler)                 // 重试生成回答
+			chat.PUT("/response/active", handlers.SetActiveResponseHandler)   // or /response/active 设置活跃回答
+
+			// 实时协作连接的一次性票据，连接地址为 /api/chat/sessions/:id/ws?ticket=
+			chat.POST("/sessions/:id/ws-ticket", handlers.SessionWebSocketTicketHandler)
+
+			// 会话可用的MCP服务器，可按会话启用或停用
+			chat.GET("/sessions/:id/mcp-servers", handlers.ListSessionMCPServersHandler)
+			chat.PUT("/sessions/:id/mcp-servers/:name", handlers.UpdateSessionMCPServerHandler)
+
+			// 文件夹和标签，仅用于整理个人会话
+			chat.GET("/folders", handlers.ListFoldersHandler)
+			chat.POST("/folders", handlers.CreateFolderHandler)
+			chat.PUT("/folders/:id", handlers.UpdateFolderHandler)
+			chat.DELETE("/folders/:id", handlers.DeleteFolderHandler)
+			chat.GET("/tags", handlers.ListTagsHandler)
+			chat.POST("/tags", handlers.CreateTagHandler)
+			chat.PUT("/tags/:id", handlers.UpdateTagHandler)
+			chat.DELETE("/tags/:id", handlers.DeleteTagHandler)
+			chat.POST("/sessions/bulk/move", handlers.BulkMoveSessionsHandler) // 批量移动到文件夹
+			chat.POST("/sessions/bulk/tags", handlers.BulkTagSessionsHandler)  // 批量添加或移除标签
+
+			// 消息收藏
+			chat.GET("/bookmarks", handlers.ListBookmarksHandler)
+			chat.POST("/bookmarks", handlers.CreateBookmarkHandler)
+			chat.PUT("/bookmarks/:id", handlers.UpdateBookmarkHandler)
+			chat.DELETE("/bookmarks/:id", handlers.DeleteBookmarkHandler)
+
+			// 回答评价
+			chat.POST("/messages/:id/feedback", handlers.SubmitFeedbackHandler)
+			chat.DELETE("/messages/:id/feedback", handlers.DeleteFeedbackHandler) // 撤回评价，可通过 version 参数指定版本
+
+			// 回收站
+			chat.GET("/trash", handlers.ListTrashHandler)
+			chat.DELETE("/trash", handlers.EmptyTrashHandler)                  // 清空回收站
+			chat.POST("/sessions/:id/restore", handlers.RestoreSessionHandler) // 从回收站恢复
+			chat.DELETE("/trash/:id", handlers.PurgeSessionHandler)            // 彻底删除
+		}
+		// 工作区相关路由，权限由工作区成员角色控制
+		workspaces := private.Group("/workspaces")
+		{
+			workspaces.POST("", handlers.CreateWorkspaceHandler)
+			workspaces.GET("", handlers.ListWorkspacesHandler)
+			workspaces.GET("/:id", handlers.GetWorkspaceHandler)
+			workspaces.PUT("/:id", handlers.UpdateWorkspaceHandler)
+			workspaces.DELETE("/:id", handlers.DeleteWorkspaceHandler)
+			workspaces.GET("/:id/members", handlers.ListWorkspaceMembersHandler)
+			workspaces.POST("/:id/members", handlers.AddWorkspaceMemberHandler)
+			workspaces.PUT("/:id/members/:userId", handlers.UpdateWorkspaceMemberHandler)
+			workspaces.DELETE("/:id/members/:userId", handlers.RemoveWorkspaceMemberHandler)
+		}
+		// 个人知识库，会话关联后提问时检索其中的文档
+		knowledge := private.Group("/knowledge-bases")
+		{
+			knowledge.GET("", handlers.ListKnowledgeBasesHandler)
+			knowledge.POST("", handlers.CreateKnowledgeBaseHandler)
+			knowledge.PUT("/:id", handlers.UpdateKnowledgeBaseHandler)
+			knowledge.DELETE("/:id", handlers.DeleteKnowledgeBaseHandler)
+			knowledge.GET("/:id/documents", handlers.ListKnowledgeDocumentsHandler)
+			knowledge.POST("/:id/documents", handlers.UploadKnowledgeDocumentHandler) // 上传文档，表单字段为 file
+			knowledge.DELETE("/:id/documents/:documentId", handlers.DeleteKnowledgeDocumentHandler)
+			knowledge.POST("/:id/reindex", handlers.ReindexKnowledgeBaseHandler) // 更换向量化模型后重建索引
+			knowledge.POST("/:id/search", handlers.SearchKnowledgeBaseHandler)   // 检索测试
+		}
+		// 提示词模板，个人模板或工作区共享模板
+		prompts := private.Group("/prompt-templates")
+		{
+			prompts.GET("", handlers.ListPromptTemplatesHandler) // sort=popular 按使用次数排序
+			prompts.POST("", handlers.CreatePromptTemplateHandler)
+			prompts.GET("/:id", handlers.GetPromptTemplateHandler)
+			prompts.PUT("/:id", handlers.UpdatePromptTemplateHandler)
+			prompts.DELETE("/:id", handlers.DeletePromptTemplateHandler)
+			prompts.POST("/:id/render", handlers.RenderPromptTemplateHandler) // 预览渲染结果
+		}
+		// 自定义助手，创建会话时选择，修改设置会生成新版本
+		assistants := private.Group("/assistants")
+		{
+			assistants.GET("", handlers.ListAssistantsHandler)
+			assistants.POST("", handlers.CreateAssistantHandler)
+			assistants.GET("/:id", handlers.GetAssistantHandler)
+			assistants.PUT("/:id", handlers.UpdateAssistantHandler)
+			assistants.DELETE("/:id", handlers.DeleteAssistantHandler)
+			assistants.GET("/:id/versions", handlers.ListAssistantVersionsHandler)
+		}
+		// 管理相关路由，按权限控制
+		admin := private.Group("/admin")
+		{
+			roles := admin.Group("/roles", middleware.RequirePermission(models.PermissionRolesManage))
+			{
+				roles.GET("", handlers.ListRolesHandler)         // 角色列表
+				roles.POST("", handlers.CreateRoleHandler)       // 创建角色
+				roles.PUT("/:id", handlers.UpdateRoleHandler)    // 更新角色
+				roles.DELETE("/:id", handlers.DeleteRoleHandler) // 删除角色
+			}
+			users := admin.Group("/users")
+			{
+				users.GET("", middleware.RequirePermission(models.PermissionUsersRead), handlers.ListUsersHandler)                               // 用户列表
+				users.GET("/:id", middleware.RequirePermission(models.PermissionUsersRead), handlers.GetUserDetailHandler)                       // 用户详情
+				users.PUT("/:id/status", middleware.RequirePermission(models.PermissionUsersWrite), handlers.SetUserStatusHandler)               // 启用/禁用
+				users.POST("/:id/password", middleware.RequirePermission(models.PermissionUsersWrite), handlers.ResetUserPasswordHandler)        // 重置密码
+				users.PUT("/:id/roles", middleware.RequirePermission(models.PermissionUsersWrite), handlers.SetUserRolesHandler)                 // 设置角色
+				users.POST("/:id/impersonate", middleware.RequirePermission(models.PermissionUsersImpersonate), handlers.ImpersonateUserHandler) // 代登录
+			}
+			admin.GET("/audit-logs", middleware.RequirePermission(models.PermissionAuditRead), handlers.GetAuditLogsHandler) // 审计日志查询与导出
+			feedback := admin.Group("/feedback", middleware.RequirePermission(models.PermissionFeedbackRead))
+			{
+				feedback.GET("/stats", handlers.GetFeedbackStatsHandler) // 按模型统计
+				feedback.GET("/export", handlers.ExportFeedbackHandler)  // 导出为JSONL评测数据
+			}
+			security := admin.Group("/security", middleware.RequirePermission(models.PermissionSecurityManage))
+			{
+				security.GET("/login-locks", handlers.GetLoginLocksHandler)       // 当前登录锁定
+				security.POST("/login-locks/unlock", handlers.UnlockLoginHandler) // 解除登录锁定
+			}
 		}
 	}
 }
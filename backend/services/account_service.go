@@ -0,0 +1,616 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"archive/zip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNoPendingDeletion 没有待执行的注销申请错误
+	ErrNoPendingDeletion = errors.New("no pending account deletion")
+
+	// ErrConfirmationRequired 敏感操作缺少密码、短信验证码或重新认证凭证错误
+	ErrConfirmationRequired = errors.New("password, sms code or reauthentication required")
+)
+
+// reauthTokenTTL 重新认证凭证的有效期
+const reauthTokenTTL = 5 * time.Minute
+
+// reauthTokenMAC 计算重新认证凭证的签名
+func reauthTokenMAC(payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWT.Secret))
+	mac.Write([]byte("reauth:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IssueReauthToken 为刚通过单点登录重新认证的用户签发短期凭证，用于确认注销账号等敏感操作
+func IssueReauthToken(userID uint) string {
+	payload := fmt.Sprintf("%d.%d", userID, time.Now().Add(reauthTokenTTL).Unix())
+	return payload + "." + reauthTokenMAC(payload)
+}
+
+// verifyReauthToken 校验重新认证凭证属于指定用户且未过期
+func verifyReauthToken(userID uint, token string) bool {
+	i := strings.LastIndex(token, ".")
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(reauthTokenMAC(token[:i]))) {
+		return false
+	}
+	var tokenUserID uint
+	var expiresAt int64
+	if _, err := fmt.Sscanf(token[:i], "%d.%d", &tokenUserID, &expiresAt); err != nil {
+		return false
+	}
+	return tokenUserID == userID && time.Now().Unix() <= expiresAt
+}
+
+// accountDeletionGrace 注销申请的保留期
+func accountDeletionGrace() time.Duration {
+	days := config.AppConfig.Account.DeletionGraceDays
+	if days <= 0 {
+		days = 14
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// exportLoginSession 导出的登录会话，不包含令牌
+type exportLoginSession struct {
+	CreatedAt  time.Time `json:"created_at"`
+	ExpireTime time.Time `json:"expire_time"`
+}
+
+// exportUsage 导出的使用情况汇总
+type exportUsage struct {
+	SessionCount    int64      `json:"session_count"`
+	MessageCount    int64      `json:"message_count"`
+	AIResponseCount int64      `json:"ai_response_count"`
+	FirstMessageAt  *time.Time `json:"first_message_at"`
+	LastMessageAt   *time.Time `json:"last_message_at"`
+	ExportedAt      time.Time  `json:"exported_at"`
+}
+
+// writeZipJSON 向压缩包写入一个JSON文件
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// ExportUserData 将用户的个人数据打包为zip写入w
+// 包含资料、设置、登录记录、会话、消息、回答版本、使用汇总和本人的操作记录
+func ExportUserData(userID uint, w io.Writer) error {
+	db := database.GetDB()
+
+	user, err := getUserAnyStatus(userID)
+	if err != nil {
+		return err
+	}
+	roles, err := GetUserRoleNames(userID)
+	if err != nil {
+		return err
+	}
+
+	var settings []models.UserSettings
+	if err := db.Where("user_id = ?", userID).Find(&settings).Error; err != nil {
+		return fmt.Errorf("查询用户设置失败: %w", err)
+	}
+
+	var identities []models.UserIdentity
+	if err := db.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		return fmt.Errorf("查询外部身份失败: %w", err)
+	}
+
+	var loginSessions []exportLoginSession
+	if err := db.Model(&models.UserSession{}).Select("created_at, expire_time").
+		Where("user_id = ?", userID).Order("id").Scan(&loginSessions).Error; err != nil {
+		return fmt.Errorf("查询登录记录失败: %w", err)
+	}
+
+	var sessions []models.ChatSession
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&sessions).Error; err != nil {
+		return fmt.Errorf("查询会话失败: %w", err)
+	}
+
+	sessionIDs := db.Model(&models.ChatSession{}).Select("session_id").Where("user_id = ?", userID)
+
+	var messages []models.ChatMessage
+	if err := db.Where("session_id IN (?)", sessionIDs).Order("id").Find(&messages).Error; err != nil {
+		return fmt.Errorf("查询消息失败: %w", err)
+	}
+
+	var responses []models.AIResponse
+	if err := db.Where("session_id IN (?)", sessionIDs).Order("id").Find(&responses).Error; err != nil {
+		return fmt.Errorf("查询回答版本失败: %w", err)
+	}
+
+	var bookmarks []models.Bookmark
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&bookmarks).Error; err != nil {
+		return fmt.Errorf("查询收藏失败: %w", err)
+	}
+
+	var feedback []models.MessageFeedback
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&feedback).Error; err != nil {
+		return fmt.Errorf("查询回答评价失败: %w", err)
+	}
+
+	var attachments []models.Attachment
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&attachments).Error; err != nil {
+		return fmt.Errorf("查询附件失败: %w", err)
+	}
+
+	var knowledgeBases []models.KnowledgeBase
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&knowledgeBases).Error; err != nil {
+		return fmt.Errorf("查询知识库失败: %w", err)
+	}
+
+	var knowledgeDocuments []models.KnowledgeDocument
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&knowledgeDocuments).Error; err != nil {
+		return fmt.Errorf("查询知识库文档失败: %w", err)
+	}
+
+	var promptTemplates []models.PromptTemplate
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&promptTemplates).Error; err != nil {
+		return fmt.Errorf("查询提示词模板失败: %w", err)
+	}
+
+	var assistants []models.Assistant
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&assistants).Error; err != nil {
+		return fmt.Errorf("查询助手失败: %w", err)
+	}
+
+	var assistantVersions []models.AssistantVersion
+	assistantIDs := db.Model(&models.Assistant{}).Select("id").Where("user_id = ?", userID)
+	if err := db.Where("assistant_id IN (?)", assistantIDs).Order("id").Find(&assistantVersions).Error; err != nil {
+		return fmt.Errorf("查询助手版本失败: %w", err)
+	}
+
+	var apiKeys []models.APIKey
+	if err := db.Where("user_id = ?", userID).Order("id").Find(&apiKeys).Error; err != nil {
+		return fmt.Errorf("查询API密钥失败: %w", err)
+	}
+
+	var apiKeyUsage []models.APIKeyUsage
+	if err := db.Where("user_id = ?", userID).Order("date, api_key_id").Find(&apiKeyUsage).Error; err != nil {
+		return fmt.Errorf("查询API用量失败: %w", err)
+	}
+
+	var auditLogs []models.AuditLog
+	if err := db.Where("actor_id = ?", userID).Order("id").Find(&auditLogs).Error; err != nil {
+		return fmt.Errorf("查询操作记录失败: %w", err)
+	}
+
+	usage := exportUsage{
+		SessionCount:    int64(len(sessions)),
+		AIResponseCount: int64(len(responses)),
+		ExportedAt:      time.Now(),
+	}
+	for i := range messages {
+		if messages[i].Role == "user" {
+			usage.MessageCount++
+			if usage.FirstMessageAt == nil {
+				usage.FirstMessageAt = &messages[i].CreatedAt
+			}
+			usage.LastMessageAt = &messages[i].CreatedAt
+		} else {
+			usage.AIResponseCount++
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", map[string]interface{}{"user": user, "roles": roles}},
+		{"settings.json", settings},
+		{"identities.json", identities},
+		{"login_sessions.json", loginSessions},
+		{"chat_sessions.json", sessions},
+		{"messages.json", messages},
+		{"ai_responses.json", responses},
+		{"bookmarks.json", bookmarks},
+		{"feedback.json", feedback},
+		{"attachments.json", attachments},
+		{"knowledge_bases.json", knowledgeBases},
+		{"knowledge_documents.json", knowledgeDocuments},
+		{"prompt_templates.json", promptTemplates},
+		{"assistants.json", assistants},
+		{"assistant_versions.json", assistantVersions},
+		{"api_keys.json", apiKeys},
+		{"api_key_usage.json", apiKeyUsage},
+		{"usage.json", usage},
+		{"activity.json", auditLogs},
+	}
+	for _, file := range files {
+		if err := writeZipJSON(zw, file.name, file.data); err != nil {
+			return fmt.Errorf("写入%s失败: %w", file.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// GetPendingAccountDeletion 获取用户待执行的注销申请
+func GetPendingAccountDeletion(userID uint) (*models.AccountDeletion, error) {
+	db := database.GetDB()
+	var deletion models.AccountDeletion
+	err := db.Where("user_id = ? AND status = ?", userID, models.AccountDeletionPending).First(&deletion).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoPendingDeletion
+		}
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// ScheduleAccountDeletion 确认身份后申请注销账号，保留期满后删除全部数据
+// 通过短信或单点登录注册的账号没有可用密码，可以改用绑定手机号的验证码或单点登录的重新认证凭证确认
+// 已有待执行的申请时直接返回该申请
+func ScheduleAccountDeletion(userID uint, req models.DeleteAccountRequest) (*models.AccountDeletion, error) {
+	db := database.GetDB()
+
+	var user models.User
+	if err := db.Select("id, password, phone").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	switch {
+	case req.Password != "":
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			return nil, ErrInvalidCredentials
+		}
+	case req.SMSCode != "":
+		if user.Phone == "" {
+			return nil, ErrPhoneNotBound
+		}
+		if err := consumeSMSCode(canonicalPhone(user.Phone), smsPurposeDeleteAccount, req.SMSCode); err != nil {
+			return nil, err
+		}
+	case req.ReauthToken != "":
+		if !verifyReauthToken(userID, req.ReauthToken) {
+			return nil, ErrInvalidCredentials
+		}
+	default:
+		return nil, ErrConfirmationRequired
+	}
+
+	if deletion, err := GetPendingAccountDeletion(userID); err == nil {
+		return deletion, nil
+	} else if !errors.Is(err, ErrNoPendingDeletion) {
+		return nil, err
+	}
+
+	deletion := models.AccountDeletion{
+		UserID:       userID,
+		Status:       models.AccountDeletionPending,
+		ScheduledFor: time.Now().Add(accountDeletionGrace()),
+	}
+	if err := db.Create(&deletion).Error; err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// CancelAccountDeletion 在保留期内撤销注销申请
+func CancelAccountDeletion(userID uint) error {
+	db := database.GetDB()
+	now := time.Now()
+	result := db.Model(&models.AccountDeletion{}).
+		Where("user_id = ? AND status = ?", userID, models.AccountDeletionPending).
+		Updates(map[string]interface{}{"status": models.AccountDeletionCancelled, "cancelled_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoPendingDeletion
+	}
+	return nil
+}
+
+// purgeUserData 彻底删除用户及其全部个人数据，审计日志保留，返回需要在事务提交后删除的文件
+// 工作区中的共享内容不随个人数据删除，见 releaseUserWorkspaces
+func purgeUserData(tx *gorm.DB, userID uint) ([]string, error) {
+	var user models.User
+	if err := tx.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var sessionIDs []string
+	if err := tx.Unscoped().Model(&models.ChatSession{}).
+		Where("user_id = ? AND workspace_id IS NULL", userID).
+		Pluck("session_id", &sessionIDs).Error; err != nil {
+		return nil, err
+	}
+	keys, err := purgeSessions(tx, sessionIDs)
+	if err != nil {
+		return nil, err
+	}
+	workspaceKeys, err := releaseUserWorkspaces(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, workspaceKeys...)
+
+	knowledgeBaseIDs := tx.Unscoped().Model(&models.KnowledgeBase{}).Select("id").Where("user_id = ?", userID)
+	documentKeys, err := purgeKnowledgeBases(tx, knowledgeBaseIDs)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, documentKeys...)
+
+	// 个人助手的版本仍被工作区会话使用时保留，这些会话继续使用原来的设置
+	assistantIDs := tx.Unscoped().Model(&models.Assistant{}).Select("id").Where("user_id = ? AND workspace_id IS NULL", userID)
+	usedAssistantIDs := tx.Unscoped().Model(&models.ChatSession{}).Select("assistant_id").Where("assistant_id IS NOT NULL")
+	if err := tx.Where("assistant_id IN (?) AND assistant_id NOT IN (?)", assistantIDs, usedAssistantIDs).
+		Delete(&models.AssistantVersion{}).Error; err != nil {
+		return nil, err
+	}
+	for _, model := range []interface{}{&models.Assistant{}, &models.PromptTemplate{}} {
+		if err := tx.Unscoped().Where("user_id = ? AND workspace_id IS NULL", userID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	bookmarkIDs := tx.Unscoped().Model(&models.Bookmark{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("bookmark_id IN (?)", bookmarkIDs).Delete(&models.BookmarkTag{}).Error; err != nil {
+		return nil, err
+	}
+	tagIDs := tx.Unscoped().Model(&models.Tag{}).Select("id").Where("user_id = ?", userID)
+	if err := tx.Where("tag_id IN (?)", tagIDs).Delete(&models.SessionTag{}).Error; err != nil {
+		return nil, err
+	}
+
+	for _, model := range []interface{}{
+		&models.UserSettings{},
+		&models.UserSession{},
+		&models.RealtimeTicket{},
+		&models.UserRole{},
+		&models.UserIdentity{},
+		&models.WorkspaceMember{},
+		&models.Folder{},
+		&models.Tag{},
+		&models.Bookmark{},
+		&models.MessageFeedback{},
+		&models.APIKey{},
+		&models.APIKeyUsage{},
+		&models.APIUserUsage{},
+	} {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if user.Phone != "" {
+		phones := []string{user.Phone, canonicalPhone(user.Phone)}
+		if err := tx.Unscoped().Where("phone IN ?", phones).Delete(&models.SMSCode{}).Error; err != nil {
+			return nil, err
+		}
+	}
+	accounts := []string{user.Username}
+	if user.Email != "" {
+		accounts = append(accounts, user.Email)
+	}
+	if user.Phone != "" {
+		accounts = append(accounts, user.Phone, canonicalPhone(user.Phone))
+	}
+	if err := tx.Unscoped().Where("scope = ? AND identifier IN ?", models.LoginFailureScopeAccount, accounts).
+		Delete(&models.LoginFailure{}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Unscoped().Delete(&models.User{}, userID).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// releaseUserWorkspaces 处理注销用户在工作区中的身份和内容，返回需要删除的文件
+// 没有其他成员的工作区连同内容一起删除；用户是唯一所有者时，所有者转给角色最高、加入最早的成员；
+// 用户在工作区中创建的会话、模板和助手转给工作区的所有者，成员在共享会话中的消息保留
+func releaseUserWorkspaces(tx *gorm.DB, userID uint) ([]string, error) {
+	var memberships []models.WorkspaceMember
+	if err := tx.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, membership := range memberships {
+		var others []models.WorkspaceMember
+		if err := tx.Where("workspace_id = ? AND user_id <> ?", membership.WorkspaceID, userID).
+			Order("id").Find(&others).Error; err != nil {
+			return nil, err
+		}
+		if len(others) == 0 {
+			deleted, err := purgeWorkspace(tx, membership.WorkspaceID)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, deleted...)
+			continue
+		}
+
+		heir := others[0]
+		for _, other := range others[1:] {
+			if workspaceRoleRank[other.Role] > workspaceRoleRank[heir.Role] {
+				heir = other
+			}
+		}
+		if heir.Role != models.WorkspaceRoleOwner {
+			if err := tx.Model(&heir).Update("role", models.WorkspaceRoleOwner).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 包括用户已经退出的工作区中由其创建的内容
+	var workspaceIDs []uint
+	for _, model := range []interface{}{&models.ChatSession{}, &models.PromptTemplate{}, &models.Assistant{}} {
+		var ids []uint
+		if err := tx.Unscoped().Model(model).Distinct("workspace_id").
+			Where("user_id = ? AND workspace_id IS NOT NULL", userID).
+			Pluck("workspace_id", &ids).Error; err != nil {
+			return nil, err
+		}
+		workspaceIDs = append(workspaceIDs, ids...)
+	}
+	for _, workspaceID := range workspaceIDs {
+		var owner models.WorkspaceMember
+		err := tx.Where("workspace_id = ? AND user_id <> ? AND role = ?", workspaceID, userID, models.WorkspaceRoleOwner).
+			Order("id").First(&owner).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 工作区已被删除
+			deleted, err := purgeWorkspace(tx, workspaceID)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, deleted...)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, model := range []interface{}{&models.ChatSession{}, &models.PromptTemplate{}, &models.Assistant{}} {
+			if err := tx.Unscoped().Model(model).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+				Update("user_id", owner.UserID).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	return keys, nil
+}
+
+// purgeWorkspace 彻底删除工作区及其全部会话、模板和助手，返回需要删除的附件文件
+func purgeWorkspace(tx *gorm.DB, workspaceID uint) ([]string, error) {
+	var sessionIDs []string
+	if err := tx.Unscoped().Model(&models.ChatSession{}).Where("workspace_id = ?", workspaceID).
+		Pluck("session_id", &sessionIDs).Error; err != nil {
+		return nil, err
+	}
+	keys, err := purgeSessions(tx, sessionIDs)
+	if err != nil {
+		return nil, err
+	}
+	assistantIDs := tx.Unscoped().Model(&models.Assistant{}).Select("id").Where("workspace_id = ?", workspaceID)
+	if err := tx.Where("assistant_id IN (?)", assistantIDs).Delete(&models.AssistantVersion{}).Error; err != nil {
+		return nil, err
+	}
+	for _, model := range []interface{}{&models.Assistant{}, &models.PromptTemplate{}, &models.WorkspaceMember{}} {
+		if err := tx.Unscoped().Where("workspace_id = ?", workspaceID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Unscoped().Delete(&models.Workspace{}, workspaceID).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// PurgeDueAccountDeletions 执行已到期的注销申请，返回处理的账号数
+func PurgeDueAccountDeletions() (int, error) {
+	db := database.GetDB()
+
+	var due []models.AccountDeletion
+	if err := db.Where("status = ? AND scheduled_for <= ?", models.AccountDeletionPending, time.Now()).
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, deletion := range due {
+		var avatar string
+		db.Unscoped().Model(&models.User{}).Select("avatar").Where("id = ?", deletion.UserID).Scan(&avatar)
+		// 知识库的向量
+		var knowledgeBaseIDs []uint
+		db.Unscoped().Model(&models.KnowledgeBase{}).Where("user_id = ?", deletion.UserID).Pluck("id", &knowledgeBaseIDs)
+
+		var keys []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// 加锁确认申请仍未被撤销
+			result := tx.Model(&models.AccountDeletion{}).
+				Where("id = ? AND status = ?", deletion.ID, models.AccountDeletionPending).
+				Updates(map[string]interface{}{"status": models.AccountDeletionCompleted, "completed_at": time.Now()})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrNoPendingDeletion
+			}
+			var err error
+			keys, err = purgeUserData(tx, deletion.UserID)
+			return err
+		})
+		if errors.Is(err, ErrNoPendingDeletion) {
+			continue
+		}
+
+		userID := strconv.FormatUint(uint64(deletion.UserID), 10)
+		if err != nil {
+			log.Printf("删除用户 %d 的数据失败: %v", deletion.UserID, err)
+			RecordAudit(&models.AuditLog{
+				Action: models.AuditActionDeletionComplete, TargetType: "user", TargetID: userID,
+				Result: models.AuditResultFailure, Detail: err.Error(),
+			})
+			continue
+		}
+		deleteAvatarFiles(context.Background(), deletion.UserID, avatar)
+		deleteAttachmentBlobs(keys)
+		if store := GetVectorStore(); store != nil {
+			for _, id := range knowledgeBaseIDs {
+				if err := store.DeleteKnowledgeBase(context.Background(), id); err != nil {
+					log.Printf("删除知识库 %d 的向量失败: %v", id, err)
+				}
+			}
+		}
+		RecordAudit(&models.AuditLog{
+			Action: models.AuditActionDeletionComplete, TargetType: "user", TargetID: userID,
+			Result: models.AuditResultSuccess,
+		})
+		purged++
+	}
+	return purged, nil
+}
+
+// RunAccountDeletionWorker 定期执行到期的注销申请，直到ctx结束
+func RunAccountDeletionWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := PurgeDueAccountDeletions(); err != nil {
+			log.Printf("执行账号注销任务失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已删除 %d 个注销账号的数据", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
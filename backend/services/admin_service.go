@@ -0,0 +1,358 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCannotModifySelf 管理员不能对自己执行该操作错误
+	ErrCannotModifySelf = errors.New("cannot perform this operation on yourself")
+
+	// ErrCannotImpersonateAdmin 不允许代登录管理员或权限超出操作人的账号错误
+	ErrCannotImpersonateAdmin = errors.New("cannot impersonate an administrator")
+
+	// ErrCannotManageUser 目标用户拥有操作人所没有的权限错误
+	ErrCannotManageUser = errors.New("cannot manage a user holding permissions the operator lacks")
+)
+
+// impersonationTTL 代登录令牌的有效期
+const impersonationTTL = time.Hour
+
+// getUserAnyStatus 获取用户，不过滤状态
+func getUserAnyStatus(userID uint) (*models.User, error) {
+	db := database.GetDB()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	user.Password = ""
+	return &user, nil
+}
+
+// ListUsers 分页查询用户，支持按关键字、状态和角色过滤
+func ListUsers(query models.AdminUserQuery) ([]models.AdminUserSummary, int64, error) {
+	db := database.GetDB()
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+
+	tx := db.Model(&models.User{})
+	if query.Keyword != "" {
+		like := "%" + query.Keyword + "%"
+		tx = tx.Where("username LIKE ? OR email LIKE ? OR phone LIKE ?", like, like, like)
+	}
+	if query.Status != nil {
+		tx = tx.Where("status = ?", *query.Status)
+	}
+	if query.Role != "" {
+		tx = tx.Where("id IN (?)", db.Table("user_roles").
+			Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.name = ? AND user_roles.deleted_at IS NULL", query.Role))
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询用户总数失败: %w", err)
+	}
+
+	var users []models.User
+	err := tx.Order("id DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询用户失败: %w", err)
+	}
+
+	result := make([]models.AdminUserSummary, 0, len(users))
+	for _, user := range users {
+		user.Password = ""
+		roles, err := GetUserRoleNames(user.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		result = append(result, models.AdminUserSummary{User: user, Roles: roles})
+	}
+
+	return result, total, nil
+}
+
+// GetUserDetail 获取用户详情及使用情况
+func GetUserDetail(userID uint) (*models.AdminUserDetail, error) {
+	db := database.GetDB()
+
+	user, err := getUserAnyStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.AdminUserDetail{User: *user}
+	if detail.Roles, err = GetUserRoleNames(userID); err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.ChatSession{}).Where("user_id = ?", userID).
+		Count(&detail.SessionCount).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.ChatMessage{}).Where("user_id = ? AND role = ?", userID, "user").
+		Count(&detail.MessageCount).Error; err != nil {
+		return nil, err
+	}
+
+	sessionIDs := db.Model(&models.ChatSession{}).Select("session_id").Where("user_id = ?", userID)
+	var aiMessages, retries int64
+	if err := db.Model(&models.ChatMessage{}).Where("role = ? AND session_id IN (?)", "ai", sessionIDs).
+		Count(&aiMessages).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.AIResponse{}).Where("session_id IN (?)", sessionIDs).
+		Count(&retries).Error; err != nil {
+		return nil, err
+	}
+	detail.AIResponseCount = aiMessages + retries
+
+	if err := db.Model(&models.UserSession{}).Where("user_id = ? AND expire_time > ?", userID, time.Now()).
+		Count(&detail.ActiveLoginCount).Error; err != nil {
+		return nil, err
+	}
+
+	var lastMessage models.ChatMessage
+	err = db.Where("user_id = ? AND role = ?", userID, "user").Order("created_at DESC").First(&lastMessage).Error
+	if err == nil {
+		detail.LastMessageAt = &lastMessage.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	return detail, nil
+}
+
+// checkCanManageUser 校验操作人可以管理目标用户：不能是自己，目标用户的权限不能超出操作人
+// 与授予角色使用相同的规则，拥有全部权限的账号只能由同样拥有全部权限的操作人管理
+func checkCanManageUser(operatorID, userID uint) error {
+	if operatorID == userID {
+		return ErrCannotModifySelf
+	}
+	if _, err := getUserAnyStatus(userID); err != nil {
+		return err
+	}
+	permissions, err := GetUserPermissions(userID)
+	if err != nil {
+		return err
+	}
+	operatorPermissions, err := GetUserPermissions(operatorID)
+	if err != nil {
+		return err
+	}
+	if err := checkCanGrant(operatorPermissions, permissions); err != nil {
+		return fmt.Errorf("%w: %v", ErrCannotManageUser, err)
+	}
+	return nil
+}
+
+// SetUserStatus 启用或禁用用户，禁用时吊销其全部登录会话
+func SetUserStatus(operatorID, userID uint, status int) error {
+	if err := checkCanManageUser(operatorID, userID); err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("status", status).Error; err != nil {
+			return err
+		}
+		if status != 1 {
+			return tx.Where("user_id = ?", userID).Delete(&models.UserSession{}).Error
+		}
+		return nil
+	})
+}
+
+// generateTempPassword 生成临时密码
+func generateTempPassword() (string, error) {
+	const charset = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz23456789"
+	buf := make([]byte, 12)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", err
+		}
+		buf[i] = charset[n.Int64()]
+	}
+	return string(buf), nil
+}
+
+// AdminResetPassword 管理员重置用户密码并吊销其登录会话
+// 未指定新密码时生成临时密码并返回；不能重置自己或权限超出操作人的账号的密码
+func AdminResetPassword(operatorID, userID uint, newPassword string) (string, error) {
+	if err := checkCanManageUser(operatorID, userID); err != nil {
+		return "", err
+	}
+
+	generated := ""
+	if newPassword == "" {
+		var err error
+		if newPassword, err = generateTempPassword(); err != nil {
+			return "", err
+		}
+		generated = newPassword
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserSession{}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return generated, nil
+}
+
+// SetUserRoles 设置用户的角色，并吊销其登录会话
+// 操作人只能授予或移除自己拥有其全部权限的角色，授予管理员等拥有全部权限的角色需要操作人本身拥有全部权限
+func SetUserRoles(operatorID, userID uint, roleNames []string) error {
+	if _, err := getUserAnyStatus(userID); err != nil {
+		return err
+	}
+
+	// 防止管理员移除自己的管理员角色后无人可以管理
+	if operatorID == userID {
+		hasAdmin := false
+		for _, name := range roleNames {
+			if name == models.RoleAdmin {
+				hasAdmin = true
+			}
+		}
+		if !hasAdmin {
+			return ErrCannotModifySelf
+		}
+	}
+
+	db := database.GetDB()
+	var roles []models.Role
+	if len(roleNames) > 0 {
+		if err := db.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+			return err
+		}
+	}
+	if len(roles) != len(roleNames) {
+		return ErrRoleNotFound
+	}
+
+	var current []models.Role
+	err := db.Joins("JOIN user_roles ON user_roles.role_id = roles.id AND user_roles.deleted_at IS NULL").
+		Where("user_roles.user_id = ?", userID).
+		Find(&current).Error
+	if err != nil {
+		return err
+	}
+	operatorPermissions, err := GetUserPermissions(operatorID)
+	if err != nil {
+		return err
+	}
+	for _, role := range changedRoles(current, roles) {
+		if err := checkCanGrant(operatorPermissions, role.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if err := tx.Create(&models.UserRole{UserID: userID, RoleID: role.ID}).Error; err != nil {
+				return err
+			}
+		}
+		if operatorID == userID {
+			return nil
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserSession{}).Error
+	})
+}
+
+// changedRoles 返回新增和被移除的角色
+func changedRoles(current, next []models.Role) []models.Role {
+	inCurrent := make(map[uint]bool)
+	for _, role := range current {
+		inCurrent[role.ID] = true
+	}
+	inNext := make(map[uint]bool)
+	var changed []models.Role
+	for _, role := range next {
+		inNext[role.ID] = true
+		if !inCurrent[role.ID] {
+			changed = append(changed, role)
+		}
+	}
+	for _, role := range current {
+		if !inNext[role.ID] {
+			changed = append(changed, role)
+		}
+	}
+	return changed
+}
+
+// ImpersonateUser 管理员以目标用户身份登录，返回短期令牌
+// 按实际权限判断：不能代登录拥有全部权限的账号，也不能代登录拥有操作人所没有的权限的账号
+func ImpersonateUser(adminID, userID uint) (string, time.Time, error) {
+	if adminID == userID {
+		return "", time.Time{}, ErrCannotModifySelf
+	}
+
+	user, err := getUserAnyStatus(userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if user.Status != 1 {
+		return "", time.Time{}, ErrUserDisabled
+	}
+
+	permissions, err := GetUserPermissions(userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	adminPermissions, err := GetUserPermissions(adminID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	for _, p := range permissions {
+		if p == models.PermissionAll || !hasPermission(adminPermissions, p) {
+			return "", time.Time{}, ErrCannotImpersonateAdmin
+		}
+	}
+
+	token, err := GenerateImpersonationToken(userID, adminID, impersonationTTL)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, time.Now().Add(impersonationTTL), nil
+}
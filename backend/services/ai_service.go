@@ -1,7 +1,7 @@
 package services
 
 import (
-	"aiChat/backend/config"
+	"aiChat/backend/models"
 	"bufio"
 	"bytes"
 	"encoding/json"
@@ -62,17 +62,123 @@ func (s *DeepSeekService) SetReasonerModel(model string) {
 
 // ChatRequest DeepSeek API聊天请求
 type ChatRequest struct {
-	Model       string        `json:"model"`
-	Messages    []ChatMessage `json:"messages"`
-	Temperature float64       `json:"temperature,omitempty"`
-	MaxTokens   int           `json:"max_tokens,omitempty"`
-	Stream      bool          `json:"stream"`
+	Model            string           `json:"model"`
+	Messages         []ChatMessage    `json:"messages"`
+	Temperature      *float64         `json:"temperature,omitempty"`
+	TopP             *float64         `json:"top_p,omitempty"`
+	MaxTokens        *int             `json:"max_tokens,omitempty"`
+	Stop             []string         `json:"stop,omitempty"`
+	PresencePenalty  *float64         `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64         `json:"frequency_penalty,omitempty"`
+	Stream           bool             `json:"stream"`
+	Tools            []ToolDefinition `json:"tools,omitempty"`
+	// 要求模型输出JSON，模型不支持时为空
+	ResponseFormat *responseFormatRequest `json:"response_format,omitempty"`
+	// 流式响应最后返回token用量
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+}
+
+// streamOptions 流式响应的选项
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// applyGenerationParams 将生成参数写入请求
+func (r *ChatRequest) applyGenerationParams(params models.GenerationParams) {
+	r.Temperature = params.Temperature
+	r.TopP = params.TopP
+	r.MaxTokens = params.MaxTokens
+	r.Stop = params.Stop
+	r.PresencePenalty = params.PresencePenalty
+	r.FrequencyPenalty = params.FrequencyPenalty
 }
 
 // ChatMessage 聊天消息
+// Parts 不为空时按多段内容发送，content 序列化为数组，用于向支持图片的模型发送图片
+// 模型请求调用工具时 ToolCalls 不为空，工具的执行结果以 tool 角色的消息返回，ToolCallID 对应请求的调用
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string
+	Content    string
+	Parts      []ContentPart
+	ToolCalls  []ToolCall
+	ToolCallID string
+}
+
+// ContentPart 多段消息内容中的一段，兼容OpenAI的格式
+type ContentPart struct {
+	Type     string        `json:"type"` // text 或 image_url
+	Text     string        `json:"text,omitempty"`
+	ImageURL *ContentImage `json:"image_url,omitempty"`
+}
+
+// ContentImage 图片内容，URL 可以是 http 地址或 data URL
+type ContentImage struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// chatMessageJSON ChatMessage 的序列化格式
+type chatMessageJSON struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+// MarshalJSON 单段内容序列化为字符串，多段内容序列化为数组
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	var content interface{} = m.Content
+	if len(m.Parts) > 0 {
+		content = m.Parts
+	}
+	raw, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(chatMessageJSON{Role: m.Role, Content: raw, ToolCalls: m.ToolCalls, ToolCallID: m.ToolCallID})
+}
+
+// UnmarshalJSON 支持字符串和数组两种内容格式，数组中的文本段会拼接到 Content
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	var raw chatMessageJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Role = raw.Role
+	m.Content = ""
+	m.Parts = nil
+	m.ToolCalls = raw.ToolCalls
+	m.ToolCallID = raw.ToolCallID
+
+	trimmed := bytes.TrimSpace(raw.Content)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil
+	}
+	if trimmed[0] != '[' {
+		return json.Unmarshal(trimmed, &m.Content)
+	}
+
+	if err := json.Unmarshal(trimmed, &m.Parts); err != nil {
+		return err
+	}
+	var texts []string
+	for _, part := range m.Parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return nil
+}
+
+// HasImages 消息是否包含图片
+func (m ChatMessage) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == "image_url" {
+			return true
+		}
+	}
+	return false
 }
 
 // ChatResponse DeepSeek API聊天响应
@@ -85,52 +191,208 @@ type ChatResponse struct {
 		Message      ChatMessage `json:"message"`
 		FinishReason string      `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage ChatUsage `json:"usage"`
+}
+
+// ChatUsage 一次对话的token用量，由服务商返回
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// add 累加多次请求的用量
+func (u *ChatUsage) add(other ChatUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// ReasoningWriter 可以单独接收思考内容的 writer
+// 回复流的 writer 实现该接口时思考内容写入 WriteReasoning，不再输出 $thinkEnd$ 标记
+type ReasoningWriter interface {
+	io.Writer
+	WriteReasoning(p []byte) (int, error)
+}
+
+// ChatOptions 单次对话的参数
+type ChatOptions struct {
+	Model        string                  // 使用的模型，为空时使用默认模型
+	SystemPrompt string                  // 系统提示词，为空时不发送
+	DeepThinking bool                    // 是否使用深度思考模式，开启时优先使用思考模型
+	Params       models.GenerationParams // 生成参数，未设置的使用默认值
+	Tools        []Tool                  // 允许模型调用的工具，为空时不发送工具定义
+	ToolEnv      ToolEnv                 // 工具执行时的用户和会话
+	AllowedTools []string                // 助手限定的工具名称，为 nil 时不限制
+	// 要求回答为JSON，为空时不限制，回答不符合要求时会要求模型修复
+	ResponseFormat *ResponseFormat
+}
+
+// ResolveModel 根据对话参数选择使用的模型
+func (s *DeepSeekService) ResolveModel(opts ChatOptions) string {
+	if opts.DeepThinking && s.Config.ReasonerModel != "" {
+		return s.Config.ReasonerModel
+	}
+	if opts.Model != "" {
+		return opts.Model
+	}
+	return s.Config.Model
 }
 
 // StreamChatResponse 流式获取聊天回复，同时返回完整的响应文本
 func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Writer, deepThinking bool) (string, string, error) {
+	return s.StreamChat([]ChatMessage{{Role: "user", Content: userMessage}}, ChatOptions{DeepThinking: deepThinking}, writer)
+}
+
+// StreamChat 按照对话参数流式获取回复，返回完整的回复和思考内容
+func (s *DeepSeekService) StreamChat(messages []ChatMessage, opts ChatOptions, writer io.Writer) (string, string, error) {
+	result, err := s.RunChat(messages, opts, writer)
+	return result.Content, result.Thinking, err
+}
+
+// ChatResult 一次对话的完整结果
+type ChatResult struct {
+	Content   string
+	Thinking  string
+	ToolCalls []ToolInvocation        // 按调用顺序排列
+	Params    models.GenerationParams // 实际发送给模型的生成参数
+	// 使用的系统提示词，不含输出格式要求
+	SystemPrompt string
+	// 要求输出JSON时的校验结果
+	Structured *StructuredOutput
+	// 全部请求的token用量之和，服务商未返回时为 0
+	Usage ChatUsage
+	// 最后一次请求的结束原因，例如 stop 或 length
+	FinishReason string
+}
+
+// RunChat 流式获取回复，opts.Tools 不为空时执行模型请求的工具调用并把结果交给模型继续生成，直到得到最终回答
+// 多轮生成的回复内容依次拼接，超过工具调用轮数上限后不再提供工具，要求模型直接回答
+// 指定 opts.ResponseFormat 时校验最终回答，不符合要求时输出 $jsonRepair$ 并要求模型重新生成，回答内容只保留最后一次生成的JSON
+func (s *DeepSeekService) RunChat(messages []ChatMessage, opts ChatOptions, writer io.Writer) (ChatResult, error) {
+	var result ChatResult
+	opts.Params = finalizeGenerationParams(s.ResolveModel(opts), opts.Params)
+	result.Params = opts.Params
+	result.SystemPrompt = opts.SystemPrompt
 	if s.Config.APIKey == "" {
 		response := "未配置API密钥，无法连接DeepSeek服务"
 		writer.Write([]byte(response))
-		return response, "", nil
+		result.Content = response
+		return result, nil
 	}
 
-	// 根据deepThinking标志选择使用的模型
-	modelToUse := s.Config.Model
-	if deepThinking && s.Config.ReasonerModel != "" {
-		modelToUse = s.Config.ReasonerModel
+	// 系统提示词放在最前面，要求输出JSON时附加格式要求
+	history := append([]ChatMessage(nil), messages...)
+	systemPrompt := opts.SystemPrompt
+	if opts.ResponseFormat != nil {
+		instruction := opts.ResponseFormat.instruction(s.ResolveModel(opts))
+		if systemPrompt != "" {
+			systemPrompt += "\n\n" + instruction
+		} else {
+			systemPrompt = instruction
+		}
+	}
+	if systemPrompt != "" {
+		history = append([]ChatMessage{{Role: "system", Content: systemPrompt}}, history...)
+	}
+
+	maxRounds := maxToolRounds()
+	for round := 0; ; round++ {
+		var tools []Tool
+		if round < maxRounds {
+			tools = opts.Tools
+		}
+		reply, err := s.streamRound(history, opts, tools, writer)
+		result.Content += reply.Content
+		result.Thinking += reply.Thinking
+		result.Usage.add(reply.Usage)
+		result.FinishReason = reply.FinishReason
+		if err != nil {
+			return result, err
+		}
+		if len(tools) == 0 || len(reply.ToolCalls) == 0 {
+			if opts.ResponseFormat != nil {
+				history = append(history, ChatMessage{Role: "assistant", Content: reply.Content})
+				return s.repairStructuredOutput(history, opts, writer, result)
+			}
+			return result, nil
+		}
+
+		history = append(history, ChatMessage{Role: "assistant", Content: reply.Content, ToolCalls: reply.ToolCalls})
+		for _, call := range reply.ToolCalls {
+			invocation := runToolCall(tools, opts.ToolEnv, call, writer)
+			result.ToolCalls = append(result.ToolCalls, invocation)
+			history = append(history, ChatMessage{Role: "tool", ToolCallID: call.ID, Content: invocation.modelContent()})
+		}
+	}
+}
+
+// repairStructuredOutput 校验最终回答，不符合要求时把错误交给模型重新生成，直到通过校验或达到修复次数上限
+// history 的最后一条是模型的最终回答
+func (s *DeepSeekService) repairStructuredOutput(history []ChatMessage, opts ChatOptions, writer io.Writer, result ChatResult) (ChatResult, error) {
+	format := opts.ResponseFormat
+	answer := history[len(history)-1].Content
+	for repairs := 0; ; repairs++ {
+		output := format.check(answer)
+		output.Repairs = repairs
+		result.Content = answer
+		result.Structured = &output
+		if output.Valid || repairs >= jsonRepairRetries() {
+			return result, nil
+		}
+
+		writer.Write([]byte("$jsonRepair$"))
+		history = append(history, ChatMessage{Role: "user", Content: format.repairPrompt(output)})
+		reply, err := s.streamRound(history, opts, nil, writer)
+		result.Thinking += reply.Thinking
+		result.Usage.add(reply.Usage)
+		result.FinishReason = reply.FinishReason
+		if err != nil {
+			return result, err
+		}
+		answer = reply.Content
+		history = append(history, ChatMessage{Role: "assistant", Content: answer})
 	}
+}
+
+// roundReply 单次请求模型的结果
+type roundReply struct {
+	Content      string
+	Thinking     string
+	ToolCalls    []ToolCall
+	Usage        ChatUsage
+	FinishReason string
+}
+
+// streamRound 请求模型一次并流式输出回复，模型请求调用工具时返回工具调用
+func (s *DeepSeekService) streamRound(messages []ChatMessage, opts ChatOptions, tools []Tool, writer io.Writer) (roundReply, error) {
+	var reply roundReply
 
 	// 构建请求体
 	requestBody := ChatRequest{
-		Model: modelToUse,
-		Messages: []ChatMessage{
-			{
-				Role:    "user",
-				Content: userMessage,
-			},
-		},
-		Temperature: 0.7,
-		MaxTokens:   int(config.AppConfig.DeepSeek.MaxTokens),
-		Stream:      true, // 启用流式响应
+		Model:    s.ResolveModel(opts),
+		Messages: messages,
+		Stream:   true, // 启用流式响应
+		Tools:    toolDefinitions(tools),
+		// 用于统计API密钥的用量
+		StreamOptions: &streamOptions{IncludeUsage: true},
+	}
+	requestBody.applyGenerationParams(opts.Params)
+	if opts.ResponseFormat != nil {
+		requestBody.ResponseFormat = opts.ResponseFormat.requestFormat(requestBody.Model)
 	}
 
 	// 转换为JSON
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", "", fmt.Errorf("序列化请求失败: %v", err)
+		return reply, fmt.Errorf("序列化请求失败: %v", err)
 	}
 
 	// 创建HTTP请求
 	url := fmt.Sprintf("%s", s.Config.BaseURL)
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", "", fmt.Errorf("创建HTTP请求失败: %v", err)
+		return reply, fmt.Errorf("创建HTTP请求失败: %v", err)
 	}
 
 	// 设置请求头
@@ -142,14 +404,14 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", "", fmt.Errorf("发送请求失败: %v", err)
+		return reply, fmt.Errorf("发送请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// 检查HTTP状态码
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return "", "", fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		return reply, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
 	}
 
 	// 读取响应流
@@ -158,6 +420,9 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 	// 用于收集完整回复
 	var fullResponse strings.Builder
 	var fullThinkingResponse strings.Builder
+	partial := func() roundReply {
+		return roundReply{Content: fullResponse.String(), Thinking: fullThinkingResponse.String()}
+	}
 
 	// 如果DeepSeek API不支持流式输出或出现问题，我们实现一个模拟的流式响应
 	// 这里通过简单地逐字符输出来模拟流式效果
@@ -165,16 +430,16 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 		// 读取整个响应
 		body, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return "", "", fmt.Errorf("读取响应失败: %v", err)
+			return reply, fmt.Errorf("读取响应失败: %v", err)
 		}
 
 		var response ChatResponse
 		if err := json.Unmarshal(body, &response); err != nil {
-			return "", "", fmt.Errorf("解析响应失败: %v", err)
+			return reply, fmt.Errorf("解析响应失败: %v", err)
 		}
 
 		if len(response.Choices) == 0 {
-			return "", "", fmt.Errorf("没有收到有效回复")
+			return reply, fmt.Errorf("没有收到有效回复")
 		}
 
 		// 获取完整回复
@@ -184,15 +449,24 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 		for _, char := range fullReply {
 			_, err := writer.Write([]byte(string(char)))
 			if err != nil {
-				return fullResponse.String(), "", fmt.Errorf("写入响应失败: %v", err)
+				return partial(), fmt.Errorf("写入响应失败: %v", err)
 			}
 			// 小延迟，模拟打字效果
 			time.Sleep(10 * time.Millisecond)
 			fullResponse.WriteRune(char)
 		}
-		return fullResponse.String(), fullThinkingResponse.String(), nil
+		reply = partial()
+		reply.ToolCalls = response.Choices[0].Message.ToolCalls
+		reply.Usage = response.Usage
+		reply.FinishReason = response.Choices[0].FinishReason
+		return reply, nil
 	}
 	thinking := false
+	reasoningWriter, separateReasoning := writer.(ReasoningWriter)
+	var usage ChatUsage
+	var finishReason string
+	// 工具调用的参数分多次返回，按 index 拼接
+	var toolCalls []ToolCall
 	// 处理真正的SSE流
 	for {
 		line, err := reader.ReadString('\n')
@@ -200,7 +474,7 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 			if err == io.EOF {
 				break
 			}
-			return fullResponse.String(), fullThinkingResponse.String(), fmt.Errorf("读取流失败: %v", err)
+			return partial(), fmt.Errorf("读取流失败: %v", err)
 		}
 
 		// 跳过空行
@@ -222,24 +496,37 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 			var streamResponse struct {
 				Choices []struct {
 					Delta struct {
-						Content          string `json:"content"`
-						ReasoningContent string `json:"reasoning_content"`
+						Content          string          `json:"content"`
+						ReasoningContent string          `json:"reasoning_content"`
+						ToolCalls        []toolCallDelta `json:"tool_calls"`
 					} `json:"delta"`
 					FinishReason *string `json:"finish_reason"`
 				} `json:"choices"`
+				Usage *ChatUsage `json:"usage"`
 			}
 
 			if err := json.Unmarshal([]byte(data), &streamResponse); err != nil {
 				continue // 忽略解析错误，继续处理
 			}
+			// 开启 include_usage 后，用量在结束原因之后单独返回
+			if streamResponse.Usage != nil {
+				usage = *streamResponse.Usage
+			}
 			// 检查是否有内容需要写入
 			if len(streamResponse.Choices) > 0 {
+				toolCalls = mergeToolCallDeltas(toolCalls, streamResponse.Choices[0].Delta.ToolCalls)
+
 				reasoning_content := streamResponse.Choices[0].Delta.ReasoningContent
 				if reasoning_content != "" {
-					thinking = true
-					_, err := writer.Write([]byte(reasoning_content))
+					var err error
+					if separateReasoning {
+						_, err = reasoningWriter.WriteReasoning([]byte(reasoning_content))
+					} else {
+						thinking = true
+						_, err = writer.Write([]byte(reasoning_content))
+					}
 					if err != nil {
-						return fullResponse.String(), fullThinkingResponse.String(), fmt.Errorf("写入响应失败: %v", err)
+						return partial(), fmt.Errorf("写入响应失败: %v", err)
 					}
 					// 收集完整回复
 					fullThinkingResponse.WriteString(reasoning_content)
@@ -252,21 +539,25 @@ func (s *DeepSeekService) StreamChatResponse(userMessage string, writer io.Write
 						}
 						_, err := writer.Write([]byte(content))
 						if err != nil {
-							return fullResponse.String(), fullThinkingResponse.String(), fmt.Errorf("写入响应失败: %v", err)
+							return partial(), fmt.Errorf("写入响应失败: %v", err)
 						}
 						// 收集完整回复
 						fullResponse.WriteString(content)
 					}
 				}
-				// 检查是否完成
+				// 记录结束原因，继续读取到 [DONE] 以获取用量
 				if streamResponse.Choices[0].FinishReason != nil {
-					break
+					finishReason = *streamResponse.Choices[0].FinishReason
 				}
 			}
 		}
 	}
 
-	return fullResponse.String(), fullThinkingResponse.String(), nil
+	reply = partial()
+	reply.ToolCalls = toolCalls
+	reply.Usage = usage
+	reply.FinishReason = finishReason
+	return reply, nil
 }
 
 // GetChatResponse 获取聊天回复
@@ -290,9 +581,8 @@ func (s *DeepSeekService) GetChatResponse(userMessage string, deepThinking bool)
 				Content: userMessage,
 			},
 		},
-		Temperature: 0.7,
-		MaxTokens:   2000,
 	}
+	requestBody.applyGenerationParams(finalizeGenerationParams(modelToUse, models.GenerationParams{}))
 
 	// 转换为JSON
 	jsonData, err := json.Marshal(requestBody)
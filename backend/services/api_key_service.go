@@ -0,0 +1,211 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrAPIKeyNotFound API密钥不存在错误
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	// ErrAPIKeyLimit API密钥数量达到上限错误
+	ErrAPIKeyLimit = errors.New("api key limit reached")
+
+	// ErrInvalidAPIKey API密钥无效、已过期或用户已被禁用
+	ErrInvalidAPIKey = errors.New("invalid api key")
+
+	// ErrAPIQuotaExceeded 今日的请求次数或token用量达到上限错误
+	ErrAPIQuotaExceeded = errors.New("api quota exceeded")
+)
+
+// apiKeyPrefix API密钥的前缀，与OpenAI的密钥格式保持一致，便于客户端识别
+const apiKeyPrefix = "sk-"
+
+// apiUsageDateLayout 用量按日统计的日期格式
+const apiUsageDateLayout = "2006-01-02"
+
+// apiKeyTouchInterval 更新密钥最近使用时间的最小间隔
+const apiKeyTouchInterval = time.Minute
+
+// hashAPIKey 计算API密钥的哈希值，密钥本身是足够长的随机串，不需要加盐
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey 创建个人API密钥，返回的完整密钥只在创建时可见
+func CreateAPIKey(userID uint, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	db := database.GetDB()
+	if limit := config.AppConfig.OpenAI.MaxKeysPerUser; limit > 0 {
+		var count int64
+		if err := db.Model(&models.APIKey{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count >= int64(limit) {
+			return nil, ErrAPIKeyLimit
+		}
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %w", err)
+	}
+	key := apiKeyPrefix + hex.EncodeToString(random)
+
+	apiKey := models.APIKey{
+		UserID:  userID,
+		Name:    req.Name,
+		Prefix:  key[:len(apiKeyPrefix)+8],
+		KeyHash: hashAPIKey(key),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+	if err := db.Create(&apiKey).Error; err != nil {
+		return nil, err
+	}
+	return &models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// ListAPIKeys 获取用户的API密钥
+func ListAPIKeys(userID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := database.GetDB().Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey 删除API密钥，删除后立即失效，已产生的用量保留用于配额统计
+func DeleteAPIKey(userID, keyID uint) error {
+	result := database.GetDB().Where("id = ? AND user_id = ?", keyID, userID).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey 校验API密钥，密钥不存在、已过期或用户已被禁用时返回 ErrInvalidAPIKey
+func AuthenticateAPIKey(key string) (*models.APIKey, error) {
+	db := database.GetDB()
+	var apiKey models.APIKey
+	if err := db.Where("key_hash = ?", hashAPIKey(key)).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Where("id = ? AND status = ?", apiKey.UserID, 1).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// 最近使用时间只需要大致准确，间隔较短时不再写入，避免每个请求都更新密钥
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		err := db.Model(&models.APIKey{}).
+			Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", apiKey.ID, now.Add(-apiKeyTouchInterval)).
+			Update("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+		apiKey.LastUsedAt = &now
+	}
+	return &apiKey, nil
+}
+
+// ReserveAPIQuota 在调用模型之前预留用户今日的一次请求，请求次数或token用量已达上限时返回 ErrAPIQuotaExceeded
+// 通过带条件的 UPDATE 原子地累加请求次数，并发的请求不会超过请求次数上限
+// token 用量在回答完成后才能确定，进行中的请求仍可能使用量略微超过token上限
+func ReserveAPIQuota(userID uint) error {
+	cfg := config.AppConfig.OpenAI
+	db := database.GetDB()
+	date := time.Now().Format(apiUsageDateLayout)
+
+	counter := models.APIUserUsage{UserID: userID, Date: date}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+		return err
+	}
+	tx := db.Model(&models.APIUserUsage{}).Where("user_id = ? AND date = ?", userID, date)
+	if cfg.DailyRequestLimit > 0 {
+		tx = tx.Where("requests < ?", cfg.DailyRequestLimit)
+	}
+	if cfg.DailyTokenLimit > 0 {
+		tx = tx.Where("tokens < ?", cfg.DailyTokenLimit)
+	}
+	result := tx.Update("requests", gorm.Expr("requests + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIQuotaExceeded
+	}
+	return nil
+}
+
+// RecordAPIUsage 累加API密钥今日的请求次数和token用量，用户的请求次数已在 ReserveAPIQuota 中预留，只累加token用量
+func RecordAPIUsage(apiKey *models.APIKey, usage ChatUsage) error {
+	date := time.Now().Format(apiUsageDateLayout)
+	record := models.APIKeyUsage{
+		APIKeyID:         apiKey.ID,
+		UserID:           apiKey.UserID,
+		Date:             date,
+		Requests:         1,
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+	}
+	counter := models.APIUserUsage{UserID: apiKey.UserID, Date: date, Tokens: record.PromptTokens + record.CompletionTokens}
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "api_key_id"}, {Name: "date"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"requests":          gorm.Expr("requests + ?", record.Requests),
+				"prompt_tokens":     gorm.Expr("prompt_tokens + ?", record.PromptTokens),
+				"completion_tokens": gorm.Expr("completion_tokens + ?", record.CompletionTokens),
+			}),
+		}).Create(&record).Error
+		if err != nil {
+			return err
+		}
+		// 跨过零点时今日的合计可能还不存在
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"tokens": gorm.Expr("tokens + ?", counter.Tokens)}),
+		}).Create(&counter).Error
+	})
+}
+
+// GetAPIKeyUsage 获取用户最近若干天每个密钥的用量，按日期倒序排列
+func GetAPIKeyUsage(userID uint, days int) ([]models.APIKeyUsage, error) {
+	since := time.Now().AddDate(0, 0, 1-days).Format(apiUsageDateLayout)
+	var usage []models.APIKeyUsage
+	err := database.GetDB().Where("user_id = ? AND date >= ?", userID, since).
+		Order("date DESC, api_key_id").
+		Find(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAssistantNotFound 助手不存在错误
+	ErrAssistantNotFound = errors.New("assistant not found")
+
+	// ErrAssistantForbidden 无权修改助手错误
+	ErrAssistantForbidden = errors.New("assistant permission denied")
+
+	// ErrUnknownTool 工具不存在错误
+	ErrUnknownTool = errors.New("unknown tool")
+)
+
+// validateAssistantSettings 检查助手设置中的模型、工具和知识库，知识库只能使用自己的
+func validateAssistantSettings(userID uint, settings *models.AssistantSettings) error {
+	if settings.Model != "" && !ModelExists(settings.Model) {
+		return fmt.Errorf("%w: %s", ErrUnknownModel, settings.Model)
+	}
+	if settings.Model != "" {
+		if err := ValidateGenerationParams(settings.Model, settings.GenerationParams); err != nil {
+			return err
+		}
+	}
+	if settings.Tools == nil {
+		settings.Tools = []string{}
+	}
+	seen := make(map[string]bool, len(settings.Tools))
+	tools := settings.Tools[:0]
+	for _, name := range settings.Tools {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if _, ok := GetTool(name); !ok && !isMCPToolName(name) {
+			return fmt.Errorf("%w: %s", ErrUnknownTool, name)
+		}
+		tools = append(tools, name)
+	}
+	settings.Tools = tools
+	if settings.KnowledgeBaseID != nil {
+		if *settings.KnowledgeBaseID == 0 {
+			settings.KnowledgeBaseID = nil
+		} else if err := CheckKnowledgeBaseAccess(userID, *settings.KnowledgeBaseID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getAssistantVersion 获取助手的指定版本
+func getAssistantVersion(assistantID uint, version int) (*models.AssistantVersion, error) {
+	var settings models.AssistantVersion
+	err := database.GetDB().Where("assistant_id = ? AND version = ?", assistantID, version).First(&settings).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssistantNotFound
+		}
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// loadAssistantSettings 批量加载助手当前版本的设置
+func loadAssistantSettings(assistants []models.Assistant) error {
+	if len(assistants) == 0 {
+		return nil
+	}
+	db := database.GetDB()
+	tx := db.Where("1 = 0")
+	for _, assistant := range assistants {
+		tx = tx.Or("assistant_id = ? AND version = ?", assistant.ID, assistant.CurrentVersion)
+	}
+	var versions []models.AssistantVersion
+	if err := db.Where(tx).Find(&versions).Error; err != nil {
+		return err
+	}
+	byAssistant := make(map[uint]*models.AssistantVersion, len(versions))
+	for i := range versions {
+		byAssistant[versions[i].AssistantID] = &versions[i]
+	}
+	for i := range assistants {
+		assistants[i].Settings = byAssistant[assistants[i].ID]
+	}
+	return nil
+}
+
+// ListAssistants 获取用户可以使用的助手
+func ListAssistants(userID uint, query models.AssistantListQuery) ([]models.Assistant, error) {
+	db := database.GetDB()
+	tx := db.Model(&models.Assistant{})
+	switch {
+	case query.WorkspaceID == nil:
+		workspaceIDs := db.Model(&models.WorkspaceMember{}).Select("workspace_id").Where("user_id = ?", userID)
+		tx = tx.Where("(workspace_id IS NULL AND user_id = ?) OR workspace_id IN (?)", userID, workspaceIDs)
+	case *query.WorkspaceID == 0:
+		tx = tx.Where("workspace_id IS NULL AND user_id = ?", userID)
+	default:
+		if _, err := RequireWorkspaceRole(*query.WorkspaceID, userID, models.WorkspaceRoleViewer); err != nil {
+			return nil, err
+		}
+		tx = tx.Where("workspace_id = ?", *query.WorkspaceID)
+	}
+
+	var assistants []models.Assistant
+	if err := tx.Order("updated_at DESC").Find(&assistants).Error; err != nil {
+		return nil, fmt.Errorf("查询助手失败: %w", err)
+	}
+	if err := loadAssistantSettings(assistants); err != nil {
+		return nil, fmt.Errorf("查询助手设置失败: %w", err)
+	}
+	return assistants, nil
+}
+
+// GetAssistant 获取助手及其当前版本的设置，个人助手只有创建者可以查看，工作区助手成员均可查看
+func GetAssistant(userID, assistantID uint) (*models.Assistant, error) {
+	var assistant models.Assistant
+	if err := database.GetDB().First(&assistant, assistantID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAssistantNotFound
+		}
+		return nil, err
+	}
+
+	if assistant.WorkspaceID == nil {
+		if assistant.UserID != userID {
+			return nil, ErrAssistantNotFound
+		}
+	} else {
+		role, err := GetWorkspaceRole(*assistant.WorkspaceID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if role == "" {
+			return nil, ErrAssistantNotFound
+		}
+	}
+
+	settings, err := getAssistantVersion(assistant.ID, assistant.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+	assistant.Settings = settings
+	return &assistant, nil
+}
+
+// getEditableAssistant 获取用户可以修改的助手
+// 工作区助手可以由创建者（至少为编辑者）或工作区所有者修改
+func getEditableAssistant(userID, assistantID uint) (*models.Assistant, error) {
+	assistant, err := GetAssistant(userID, assistantID)
+	if err != nil {
+		return nil, err
+	}
+	if assistant.WorkspaceID == nil {
+		return assistant, nil
+	}
+	role, err := GetWorkspaceRole(*assistant.WorkspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == models.WorkspaceRoleOwner ||
+		(assistant.UserID == userID && workspaceRoleRank[role] >= workspaceRoleRank[models.WorkspaceRoleEditor]) {
+		return assistant, nil
+	}
+	return nil, ErrAssistantForbidden
+}
+
+// CreateAssistant 创建助手及其第一个版本，在工作区中创建需要编辑者权限
+func CreateAssistant(userID uint, req models.CreateAssistantRequest) (*models.Assistant, error) {
+	if req.WorkspaceID != nil {
+		if _, err := RequireWorkspaceRole(*req.WorkspaceID, userID, models.WorkspaceRoleEditor); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateAssistantSettings(userID, &req.Settings); err != nil {
+		return nil, err
+	}
+
+	assistant := models.Assistant{
+		UserID:         userID,
+		WorkspaceID:    req.WorkspaceID,
+		Name:           req.Name,
+		Description:    req.Description,
+		CurrentVersion: 1,
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&assistant).Error; err != nil {
+			return err
+		}
+		settings := models.AssistantVersion{
+			AssistantID:       assistant.ID,
+			Version:           1,
+			CreatedBy:         userID,
+			AssistantSettings: req.Settings,
+		}
+		if err := tx.Create(&settings).Error; err != nil {
+			return err
+		}
+		assistant.Settings = &settings
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
+
+// UpdateAssistant 修改助手，设置发生变化时生成新版本，已有会话继续使用原来的版本
+func UpdateAssistant(userID, assistantID uint, req models.UpdateAssistantRequest) (*models.Assistant, error) {
+	assistant, err := getEditableAssistant(userID, assistantID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	var settings *models.AssistantVersion
+	if req.Settings != nil {
+		if err := validateAssistantSettings(userID, req.Settings); err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(*req.Settings, assistant.Settings.AssistantSettings) {
+			settings = &models.AssistantVersion{
+				AssistantID:       assistant.ID,
+				Version:           assistant.CurrentVersion + 1,
+				CreatedBy:         userID,
+				AssistantSettings: *req.Settings,
+			}
+			updates["current_version"] = settings.Version
+		}
+	}
+	if len(updates) == 0 {
+		return assistant, nil
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if settings != nil {
+			// 唯一索引保证并发修改时不会生成重复的版本号
+			if err := tx.Create(settings).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(assistant).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetAssistant(userID, assistantID)
+}
+
+// DeleteAssistant 删除助手，历史版本保留，使用该助手的会话不受影响
+func DeleteAssistant(userID, assistantID uint) error {
+	assistant, err := getEditableAssistant(userID, assistantID)
+	if err != nil {
+		return err
+	}
+	return database.GetDB().Delete(assistant).Error
+}
+
+// ListAssistantVersions 获取助手的全部版本，最新的在前
+func ListAssistantVersions(userID, assistantID uint) ([]models.AssistantVersion, error) {
+	if _, err := GetAssistant(userID, assistantID); err != nil {
+		return nil, err
+	}
+	var versions []models.AssistantVersion
+	if err := database.GetDB().Where("assistant_id = ?", assistantID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("查询助手版本失败: %w", err)
+	}
+	return versions, nil
+}
+
+// ApplyAssistant 让会话使用助手的当前版本，并关联助手设置的知识库
+func ApplyAssistant(userID uint, session *models.ChatSession, assistantID uint) error {
+	assistant, err := GetAssistant(userID, assistantID)
+	if err != nil {
+		return err
+	}
+	session.AssistantID = &assistant.ID
+	session.AssistantVersion = assistant.CurrentVersion
+	session.KnowledgeBaseID = assistant.Settings.KnowledgeBaseID
+	return nil
+}
+
+// applyAssistantOptions 用会话固定的助手版本覆盖对话参数，助手已删除时仍然使用该版本
+func applyAssistantOptions(session *models.ChatSession, opts *ChatOptions) error {
+	if session.AssistantID == nil {
+		return nil
+	}
+	settings, err := getAssistantVersion(*session.AssistantID, session.AssistantVersion)
+	if err != nil {
+		if errors.Is(err, ErrAssistantNotFound) {
+			return nil
+		}
+		return err
+	}
+	if settings.SystemPrompt != "" {
+		opts.SystemPrompt = settings.SystemPrompt
+	}
+	if settings.Model != "" {
+		opts.Model = settings.Model
+	}
+	opts.Params = settings.GenerationParams
+	opts.AllowedTools = append([]string{}, settings.Tools...)
+	return nil
+}
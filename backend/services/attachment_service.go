@@ -0,0 +1,438 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrAttachmentTooLarge  = errors.New("attachment too large")
+	ErrTooManyAttachments  = errors.New("too many attachments")
+	ErrEmptyAttachmentName = errors.New("attachment name is empty")
+)
+
+// 附件相关限制
+const (
+	attachmentKeyPrefix    = "attachments/"
+	attachmentTextMaxBytes = 1 << 20 // 提取的文本最多保存1MB
+)
+
+// attachmentTextExts 按纯文本处理的文件扩展名
+var attachmentTextExts = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".log": true, ".csv": true, ".tsv": true,
+	".json": true, ".jsonl": true, ".yaml": true, ".yml": true, ".xml": true, ".toml": true, ".ini": true,
+	".html": true, ".htm": true, ".css": true, ".scss": true, ".sql": true, ".sh": true,
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".vue": true,
+	".java": true, ".kt": true, ".c": true, ".h": true, ".cpp": true, ".hpp": true, ".cs": true,
+	".rs": true, ".rb": true, ".php": true, ".swift": true,
+}
+
+// attachmentImageTypes 可以作为图片发送给模型的类型
+var attachmentImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// AttachmentUpload 待保存的上传文件
+type AttachmentUpload struct {
+	FileName string
+	Data     []byte
+}
+
+// IsImage 上传的文件是否为可以发送给模型的图片
+func (u AttachmentUpload) IsImage() bool {
+	return attachmentImageTypes[http.DetectContentType(u.Data)]
+}
+
+// isImageAttachment 附件是否为可以发送给模型的图片
+func isImageAttachment(attachment models.Attachment) bool {
+	return attachmentImageTypes[attachment.ContentType]
+}
+
+// AttachmentMaxSize 单个附件的大小上限
+func AttachmentMaxSize() int64 {
+	if size := config.AppConfig.Chat.AttachmentMaxSize; size > 0 {
+		return size
+	}
+	return 10 << 20
+}
+
+// AttachmentMaxFiles 每条消息的附件数量上限
+func AttachmentMaxFiles() int {
+	if n := config.AppConfig.Chat.AttachmentMaxFiles; n > 0 {
+		return n
+	}
+	return 5
+}
+
+// attachmentContextChars 附件内容注入模型上下文的总字符数上限
+func attachmentContextChars() int {
+	if n := config.AppConfig.Chat.AttachmentContextChars; n > 0 {
+		return n
+	}
+	return 30000
+}
+
+// extractAttachmentText 提取文本文件和PDF的文本内容，不支持的类型返回 false
+func extractAttachmentText(fileName, contentType string, data []byte) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+
+	if ext == ".pdf" || contentType == "application/pdf" {
+		text, err := extractPDFText(data)
+		if err != nil {
+			return "", false
+		}
+		return text, true
+	}
+
+	if attachmentTextExts[ext] || strings.HasPrefix(contentType, "text/") {
+		data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+		if !utf8.Valid(data) {
+			return "", false
+		}
+		return string(data), true
+	}
+	return "", false
+}
+
+// extractPDFText 提取PDF的纯文本，损坏的文件可能导致解析库崩溃，因此需要恢复
+func extractPDFText(data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("解析PDF失败: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(io.LimitReader(plain, attachmentTextMaxBytes*2))
+	if err != nil {
+		return "", err
+	}
+	// PDF中提取的文本可能包含无效的UTF-8序列，先清除以免写入数据库失败
+	return strings.TrimSpace(strings.ToValidUTF8(string(content), "")), nil
+}
+
+// truncateUTF8 按字节数截断字符串，不截断多字节字符
+func truncateUTF8(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	// 截断点最多向前回退3个字节即可到达字符的起始位置
+	end := maxBytes
+	for i := 0; i < utf8.UTFMax-1 && end > 0 && !utf8.RuneStart(s[end]); i++ {
+		end--
+	}
+	return s[:end]
+}
+
+// SaveAttachments 保存消息的附件并提取文本，任一文件失败时删除已保存的文件
+func SaveAttachments(ctx context.Context, userID uint, sessionID, messageID string, uploads []AttachmentUpload) ([]models.Attachment, error) {
+	if len(uploads) > AttachmentMaxFiles() {
+		return nil, ErrTooManyAttachments
+	}
+	store := GetBlobStore()
+	if store == nil {
+		return nil, errors.New("未配置文件存储")
+	}
+
+	attachments := make([]models.Attachment, 0, len(uploads))
+	keys := make([]string, 0, len(uploads))
+	cleanup := func() { deleteBlobs(context.Background(), store, keys) }
+
+	for _, upload := range uploads {
+		name := filepath.Base(strings.ReplaceAll(upload.FileName, "\\", "/"))
+		if name == "" || name == "." || name == "/" {
+			cleanup()
+			return nil, ErrEmptyAttachmentName
+		}
+		if int64(len(upload.Data)) > AttachmentMaxSize() {
+			cleanup()
+			return nil, ErrAttachmentTooLarge
+		}
+		name = truncateUTF8(name, 255)
+
+		contentType := http.DetectContentType(upload.Data)
+		text, extracted := extractAttachmentText(name, contentType, upload.Data)
+
+		random := make([]byte, 8)
+		if _, err := rand.Read(random); err != nil {
+			cleanup()
+			return nil, err
+		}
+		// 文件名只保留扩展名，避免特殊字符影响存储路径
+		key := attachmentKeyPrefix + sessionID + "/" + hex.EncodeToString(random) + strings.ToLower(filepath.Ext(name))
+		if err := store.Put(ctx, key, upload.Data, contentType); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("保存附件失败: %w", err)
+		}
+		keys = append(keys, key)
+
+		attachments = append(attachments, models.Attachment{
+			UserID:      userID,
+			SessionID:   sessionID,
+			MessageID:   messageID,
+			FileName:    name,
+			ContentType: contentType,
+			Size:        int64(len(upload.Data)),
+			BlobKey:     key,
+			Text:        truncateUTF8(text, attachmentTextMaxBytes),
+			TextLength:  utf8.RuneCountInString(text),
+			Extracted:   extracted,
+		})
+	}
+
+	if len(attachments) == 0 {
+		return attachments, nil
+	}
+	if err := database.GetDB().Create(&attachments).Error; err != nil {
+		cleanup()
+		return nil, fmt.Errorf("保存附件记录失败: %w", err)
+	}
+	return attachments, nil
+}
+
+// GetMessageAttachments 获取消息的附件
+func GetMessageAttachments(messageID string) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := database.GetDB().Where("message_id = ?", messageID).Order("id").Find(&attachments).Error
+	return attachments, err
+}
+
+// loadMessageAttachments 批量加载用户消息的附件
+func loadMessageAttachments(messages []models.ChatMessage) error {
+	messageIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == "user" {
+			messageIDs = append(messageIDs, message.MessageID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	var attachments []models.Attachment
+	if err := database.GetDB().Where("message_id IN ?", messageIDs).Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+	byMessage := make(map[string][]models.Attachment, len(messageIDs))
+	for _, attachment := range attachments {
+		byMessage[attachment.MessageID] = append(byMessage[attachment.MessageID], attachment)
+	}
+	for i := range messages {
+		if messages[i].Role == "user" {
+			messages[i].Attachments = byMessage[messages[i].MessageID]
+		}
+	}
+	return nil
+}
+
+// DeleteAttachments 删除附件记录和文件，用于消息保存失败时的清理
+func DeleteAttachments(ctx context.Context, attachments []models.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+	ids := make([]uint, 0, len(attachments))
+	keys := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		ids = append(ids, attachment.ID)
+		keys = append(keys, attachment.BlobKey)
+	}
+	database.GetDB().Unscoped().Delete(&models.Attachment{}, ids)
+	if store := GetBlobStore(); store != nil {
+		deleteBlobs(ctx, store, keys)
+	}
+}
+
+// OpenAttachment 打开附件文件，需要对所在会话有查看权限
+func OpenAttachment(ctx context.Context, userID, attachmentID uint) (*models.Attachment, io.ReadCloser, error) {
+	db := database.GetDB()
+	var attachment models.Attachment
+	if err := db.First(&attachment, attachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		return nil, nil, err
+	}
+
+	session, err := GetSessionByID(attachment.SessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		return nil, nil, err
+	}
+	if err := CheckSessionAccess(userID, session, SessionPermissionRead); err != nil {
+		return nil, nil, err
+	}
+
+	store := GetBlobStore()
+	if store == nil {
+		return nil, nil, ErrBlobNotFound
+	}
+	reader, _, err := store.Get(ctx, attachment.BlobKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &attachment, reader, nil
+}
+
+// sessionAttachmentKeys 获取会话全部附件的文件路径，用于彻底删除会话后清理文件
+func sessionAttachmentKeys(tx *gorm.DB, sessionIDs interface{}) ([]string, error) {
+	var keys []string
+	err := tx.Unscoped().Model(&models.Attachment{}).Where("session_id IN (?)", sessionIDs).Pluck("blob_key", &keys).Error
+	return keys, err
+}
+
+// deleteAttachmentBlobs 删除附件文件，失败只记录日志
+func deleteAttachmentBlobs(keys []string) {
+	if store := GetBlobStore(); store != nil && len(keys) > 0 {
+		deleteBlobs(context.Background(), store, keys)
+	}
+}
+
+// allocateAttachmentBudget 将字符预算分配给各个附件，内容较短的附件完整保留，剩余预算由较长的附件平分
+func allocateAttachmentBudget(lengths []int, budget int) []int {
+	shares := make([]int, len(lengths))
+	remaining := make([]int, 0, len(lengths))
+	for i := range lengths {
+		remaining = append(remaining, i)
+	}
+
+	for len(remaining) > 0 {
+		fair := budget / len(remaining)
+		next := remaining[:0]
+		allocated := false
+		for _, i := range remaining {
+			if lengths[i] <= fair {
+				shares[i] = lengths[i]
+				budget -= lengths[i]
+				allocated = true
+			} else {
+				next = append(next, i)
+			}
+		}
+		remaining = next
+		if !allocated {
+			for _, i := range remaining {
+				shares[i] = fair
+			}
+			break
+		}
+	}
+	return shares
+}
+
+// truncateAttachmentText 截断到指定字符数，保留开头和结尾，便于查看日志的最新内容
+func truncateAttachmentText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	if limit <= 0 {
+		return fmt.Sprintf("[内容过长已省略，共%d字符]", len(runes))
+	}
+	head := limit * 2 / 3
+	tail := limit - head
+	return string(runes[:head]) +
+		fmt.Sprintf("\n...[内容过长，中间省略%d字符]...\n", len(runes)-limit) +
+		string(runes[len(runes)-tail:])
+}
+
+// BuildAttachmentPrompt 将附件的文本内容和用户问题组合为发送给模型的内容
+// 附件内容按总字符数上限截断，较短的附件优先完整保留，图片附件不在其中
+func BuildAttachmentPrompt(attachments []models.Attachment, question string) string {
+	files := make([]models.Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		if !isImageAttachment(attachment) {
+			files = append(files, attachment)
+		}
+	}
+	if len(files) == 0 {
+		return question
+	}
+	attachments = files
+
+	lengths := make([]int, len(attachments))
+	for i, attachment := range attachments {
+		if attachment.Extracted {
+			lengths[i] = utf8.RuneCountInString(attachment.Text)
+		}
+	}
+	shares := allocateAttachmentBudget(lengths, attachmentContextChars())
+
+	var builder strings.Builder
+	builder.WriteString("以下是用户上传的文件内容：\n\n")
+	for i, attachment := range attachments {
+		fmt.Fprintf(&builder, "<file name=%q>\n", attachment.FileName)
+		if attachment.Extracted {
+			builder.WriteString(truncateAttachmentText(attachment.Text, shares[i]))
+		} else {
+			fmt.Fprintf(&builder, "[无法提取该文件的文本内容，类型: %s]", attachment.ContentType)
+		}
+		builder.WriteString("\n</file>\n\n")
+	}
+	builder.WriteString("用户的问题：\n")
+	builder.WriteString(question)
+	return builder.String()
+}
+
+// BuildUserChatMessage 根据用户问题和附件构建发送给模型的消息
+// 文本类附件合并到问题中，图片附件以 data URL 形式作为 image_url 内容段发送
+func BuildUserChatMessage(ctx context.Context, attachments []models.Attachment, question string) (ChatMessage, error) {
+	message := ChatMessage{Role: "user", Content: BuildAttachmentPrompt(attachments, question)}
+
+	var images []ContentPart
+	for _, attachment := range attachments {
+		if !isImageAttachment(attachment) {
+			continue
+		}
+		store := GetBlobStore()
+		if store == nil {
+			return message, ErrBlobNotFound
+		}
+		reader, _, err := store.Get(ctx, attachment.BlobKey)
+		if err != nil {
+			return message, fmt.Errorf("读取图片 %s 失败: %w", attachment.FileName, err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return message, fmt.Errorf("读取图片 %s 失败: %w", attachment.FileName, err)
+		}
+		images = append(images, ContentPart{
+			Type:     "image_url",
+			ImageURL: &ContentImage{URL: "data:" + attachment.ContentType + ";base64," + base64.StdEncoding.EncodeToString(data)},
+		})
+	}
+
+	if len(images) > 0 {
+		message.Parts = append([]ContentPart{{Type: "text", Text: message.Content}}, images...)
+	}
+	return message, nil
+}
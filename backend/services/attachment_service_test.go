@@ -0,0 +1,33 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s        string
+		maxBytes int
+		want     string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"你好世界", 7, "你好"},
+		{"你好世界", 6, "你好"},
+		{"a😀b", 4, "a"},
+		{"😀", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.maxBytes); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.maxBytes, got, tt.want)
+		}
+	}
+
+	// 无效的UTF-8序列不会导致逐字节回退到开头
+	invalid := strings.Repeat("\x80", 1<<20)
+	if got := truncateUTF8(invalid, 1000); len(got) < 1000-utf8.UTFMax {
+		t.Errorf("invalid input truncated to %d bytes", len(got))
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// auditExportBatchSize 导出时每批读取的记录数
+const auditExportBatchSize = 500
+
+// RecordAudit 写入一条审计日志，写入失败只记录错误不影响业务
+func RecordAudit(entry *models.AuditLog) {
+	db := database.GetDB()
+	if err := db.Create(entry).Error; err != nil {
+		log.Printf("写入审计日志失败: %v", err)
+	}
+}
+
+// auditLogScope 根据查询条件构建过滤
+func auditLogScope(query models.AuditLogQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if query.ActorID != 0 {
+			tx = tx.Where("actor_id = ? OR impersonator_id = ?", query.ActorID, query.ActorID)
+		}
+		if query.Action != "" {
+			tx = tx.Where("action LIKE ?", query.Action+"%")
+		}
+		if query.TargetType != "" {
+			tx = tx.Where("target_type = ?", query.TargetType)
+		}
+		if query.TargetID != "" {
+			tx = tx.Where("target_id = ?", query.TargetID)
+		}
+		if query.Result != "" {
+			tx = tx.Where("result = ?", query.Result)
+		}
+		if query.IP != "" {
+			tx = tx.Where("ip = ?", query.IP)
+		}
+		if !query.From.IsZero() {
+			tx = tx.Where("created_at >= ?", query.From)
+		}
+		if !query.To.IsZero() {
+			tx = tx.Where("created_at < ?", query.To)
+		}
+		return tx
+	}
+}
+
+// QueryAuditLogs 分页查询审计日志，按时间倒序
+func QueryAuditLogs(query models.AuditLogQuery) ([]models.AuditLog, int64, error) {
+	db := database.GetDB()
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 || query.PageSize > 200 {
+		query.PageSize = 50
+	}
+
+	var total int64
+	if err := db.Model(&models.AuditLog{}).Scopes(auditLogScope(query)).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志总数失败: %w", err)
+	}
+
+	var logs []models.AuditLog
+	err := db.Scopes(auditLogScope(query)).
+		Order("id DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&logs).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询审计日志失败: %w", err)
+	}
+
+	return logs, total, nil
+}
+
+// ExportAuditLogsCSV 将符合条件的审计日志以CSV格式写出，分批读取避免占用过多内存
+func ExportAuditLogsCSV(query models.AuditLogQuery, w io.Writer) error {
+	db := database.GetDB()
+	writer := csv.NewWriter(w)
+
+	header := []string{"id", "created_at", "actor_id", "impersonator_id", "action", "target_type", "target_id", "ip", "user_agent", "result", "detail"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	var batch []models.AuditLog
+	result := db.Scopes(auditLogScope(query)).
+		Order("id ASC").
+		FindInBatches(&batch, auditExportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, entry := range batch {
+				record := []string{
+					strconv.FormatUint(uint64(entry.ID), 10),
+					entry.CreatedAt.Format(time.RFC3339),
+					strconv.FormatUint(uint64(entry.ActorID), 10),
+					strconv.FormatUint(uint64(entry.ImpersonatorID), 10),
+					csvSafe(entry.Action),
+					csvSafe(entry.TargetType),
+					csvSafe(entry.TargetID),
+					csvSafe(entry.IP),
+					csvSafe(entry.UserAgent),
+					csvSafe(entry.Result),
+					csvSafe(entry.Detail),
+				}
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		})
+	if result.Error != nil {
+		return fmt.Errorf("导出审计日志失败: %w", result.Error)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvSafe 防止以公式字符开头的内容在表格软件中被当作公式执行
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
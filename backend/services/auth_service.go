@@ -21,20 +21,40 @@ var (
 
 // TokenClaims 令牌声明
 type TokenClaims struct {
-	UserID uint `json:"user_id"`
+	UserID         uint     `json:"user_id"`
+	Roles          []string `json:"roles"`                     // 签发时的角色，仅供前端展示，不用于权限判断
+	ImpersonatorID uint     `json:"impersonator_id,omitempty"` // 管理员代登录时的管理员ID
 	jwt.RegisteredClaims
 }
 
 // GenerateToken 生成JWT令牌
 func GenerateToken(userID uint) (string, error) {
+	return generateToken(userID, 0, time.Duration(config.AppConfig.JWT.ExpiresIn)*time.Hour)
+}
+
+// GenerateImpersonationToken 为管理员生成以目标用户身份登录的短期令牌
+func GenerateImpersonationToken(userID, impersonatorID uint, ttl time.Duration) (string, error) {
+	return generateToken(userID, impersonatorID, ttl)
+}
+
+// generateToken 生成JWT令牌并存储会话
+func generateToken(userID, impersonatorID uint, ttl time.Duration) (string, error) {
 	db := database.GetDB()
 
+	// 查询用户角色，写入令牌
+	roles, err := GetUserRoleNames(userID)
+	if err != nil {
+		return "", err
+	}
+
 	// 设置令牌过期时间
-	expirationTime := time.Now().Add(time.Duration(config.AppConfig.JWT.ExpiresIn) * time.Hour)
+	expirationTime := time.Now().Add(ttl)
 
 	// 创建JWT声明
 	claims := &TokenClaims{
-		UserID: userID,
+		UserID:         userID,
+		Roles:          roles,
+		ImpersonatorID: impersonatorID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -114,6 +134,12 @@ func InvalidateToken(tokenString string) error {
 	return db.Where("token = ?", tokenString).Delete(&models.UserSession{}).Error
 }
 
+// RevokeUserTokens 使用户的全部令牌失效
+func RevokeUserTokens(userID uint) error {
+	db := database.GetDB()
+	return db.Where("user_id = ?", userID).Delete(&models.UserSession{}).Error
+}
+
 // CleanupExpiredTokens 清理过期会话
 func CleanupExpiredTokens() error {
 	db := database.GetDB()
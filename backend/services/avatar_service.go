@@ -0,0 +1,228 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+var (
+	// ErrUnsupportedImageType 不支持的图片格式错误
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+
+	// ErrImageTooLarge 图片文件过大错误
+	ErrImageTooLarge = errors.New("image file too large")
+
+	// ErrInvalidImageDimensions 图片尺寸不符合要求错误
+	ErrInvalidImageDimensions = errors.New("invalid image dimensions")
+)
+
+// 头像相关限制
+const (
+	defaultAvatarMaxSize = 5 << 20 // 默认头像文件大小上限
+	avatarMinDimension   = 32      // 头像最小边长
+	avatarMaxDimension   = 4096    // 头像最大边长，防止解码超大图片耗尽内存
+	avatarKeyPrefix      = "avatars/"
+)
+
+// AvatarSizes 生成的头像缩略图边长，最后一个作为默认头像
+var AvatarSizes = []int{64, 128, 256}
+
+// allowedAvatarTypes 允许上传的头像类型
+var allowedAvatarTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// publicBlobPrefixes 允许通过公开地址访问的文件键前缀
+var publicBlobPrefixes = []string{avatarKeyPrefix}
+
+// AvatarMaxSize 返回头像文件大小上限
+func AvatarMaxSize() int64 {
+	if size := config.AppConfig.Storage.AvatarMaxSize; size > 0 {
+		return size
+	}
+	return defaultAvatarMaxSize
+}
+
+// PublicFileURL 返回文件键对应的公开访问地址
+func PublicFileURL(key string) string {
+	base := strings.TrimRight(config.AppConfig.Storage.PublicURL, "/")
+	if base == "" {
+		base = "/api/files"
+	}
+	return base + "/" + key
+}
+
+// OpenPublicFile 读取允许公开访问的文件
+func OpenPublicFile(ctx context.Context, key string) (io.ReadCloser, *BlobInfo, error) {
+	store := GetBlobStore()
+	if store == nil {
+		return nil, nil, ErrBlobNotFound
+	}
+	if err := validateBlobKey(key); err != nil {
+		return nil, nil, ErrBlobNotFound
+	}
+	for _, prefix := range publicBlobPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return store.Get(ctx, key)
+		}
+	}
+	return nil, nil, ErrBlobNotFound
+}
+
+// decodeAvatar 校验并解码头像图片
+func decodeAvatar(data []byte) (image.Image, string, error) {
+	if int64(len(data)) > AvatarMaxSize() {
+		return nil, "", ErrImageTooLarge
+	}
+
+	// 根据文件内容判断类型，不信任客户端提供的Content-Type
+	contentType := http.DetectContentType(data)
+	if !allowedAvatarTypes[contentType] {
+		return nil, "", ErrUnsupportedImageType
+	}
+
+	// 解码前先检查尺寸
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImageType
+	}
+	if cfg.Width < avatarMinDimension || cfg.Height < avatarMinDimension ||
+		cfg.Width > avatarMaxDimension || cfg.Height > avatarMaxDimension {
+		return nil, "", ErrInvalidImageDimensions
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupportedImageType
+	}
+	return img, contentType, nil
+}
+
+// resizeAvatar 居中裁剪为正方形并缩放到指定边长
+func resizeAvatar(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	square := image.Rect(x0, y0, x0+side, y0+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, square, draw.Src, nil)
+	return dst
+}
+
+// encodeAvatar 编码缩略图，JPEG保持JPEG，其余格式统一为PNG以保留透明度
+func encodeAvatar(img image.Image, sourceType string) ([]byte, string, string, error) {
+	var buf bytes.Buffer
+	if sourceType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), "image/jpeg", "jpg", nil
+	}
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, "", "", err
+	}
+	return buf.Bytes(), "image/png", "png", nil
+}
+
+// UploadAvatar 校验并保存用户头像，生成各尺寸缩略图并更新用户资料
+// 返回各尺寸对应的访问地址
+func UploadAvatar(ctx context.Context, userID uint, data []byte) (map[string]string, error) {
+	store := GetBlobStore()
+	if store == nil {
+		return nil, errors.New("未配置文件存储")
+	}
+
+	img, contentType, err := decodeAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUserAnyStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每次上传使用新的目录，地址可以长期缓存
+	version, err := randomURLString(12)
+	if err != nil {
+		return nil, err
+	}
+	dir := fmt.Sprintf("%s%d/%s/", avatarKeyPrefix, userID, version)
+
+	urls := make(map[string]string, len(AvatarSizes))
+	keys := make([]string, 0, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		encoded, thumbType, ext, err := encodeAvatar(resizeAvatar(img, size), contentType)
+		if err != nil {
+			return nil, fmt.Errorf("生成缩略图失败: %w", err)
+		}
+		key := dir + strconv.Itoa(size) + "." + ext
+		if err := store.Put(ctx, key, encoded, thumbType); err != nil {
+			deleteBlobs(ctx, store, keys)
+			return nil, fmt.Errorf("保存头像失败: %w", err)
+		}
+		keys = append(keys, key)
+		urls[strconv.Itoa(size)] = PublicFileURL(key)
+	}
+
+	avatarURL := urls[strconv.Itoa(AvatarSizes[len(AvatarSizes)-1])]
+	db := database.GetDB()
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Update("avatar", avatarURL).Error; err != nil {
+		deleteBlobs(ctx, store, keys)
+		return nil, err
+	}
+
+	deleteAvatarFiles(ctx, userID, user.Avatar)
+	return urls, nil
+}
+
+// deleteAvatarFiles 删除用户之前上传的头像文件，外部地址不处理
+func deleteAvatarFiles(ctx context.Context, userID uint, avatarURL string) {
+	store := GetBlobStore()
+	prefix := PublicFileURL(fmt.Sprintf("%s%d/", avatarKeyPrefix, userID))
+	if store == nil || !strings.HasPrefix(avatarURL, prefix) {
+		return
+	}
+
+	key := strings.TrimPrefix(avatarURL, PublicFileURL(""))
+	dir := key[:strings.LastIndex(key, "/")+1]
+	ext := key[strings.LastIndex(key, ".")+1:]
+
+	keys := make([]string, 0, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		keys = append(keys, dir+strconv.Itoa(size)+"."+ext)
+	}
+	deleteBlobs(ctx, store, keys)
+}
+
+// deleteBlobs 删除文件，失败只记录日志
+func deleteBlobs(ctx context.Context, store BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("删除文件 %s 失败: %v", key, err)
+		}
+	}
+}
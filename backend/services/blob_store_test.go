@@ -0,0 +1,251 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubS3 本地模拟的S3兼容对象存储，独立校验 Signature V4 签名
+type stubS3 struct {
+	t         *testing.T
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	objects map[string]stubObject // host + path -> 对象
+}
+
+type stubObject struct {
+	data        []byte
+	contentType string
+}
+
+func newStubS3(t *testing.T) (*stubS3, *httptest.Server) {
+	s := &stubS3{
+		t:         t,
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "secret",
+		region:    "us-east-1",
+		objects:   make(map[string]stubObject),
+	}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func (s *stubS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !s.verify(r, body) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>")
+		return
+	}
+
+	key := r.Host + r.URL.EscapedPath()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = stubObject{data: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		obj, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Write(obj.data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verify 按请求中声明的签名头重新计算签名
+func (s *stubS3) verify(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	const prefix = "AWS4-HMAC-SHA256 "
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, prefix), ", ") {
+		name, value, _ := strings.Cut(part, "=")
+		fields[name] = value
+	}
+	credential := strings.SplitN(fields["Credential"], "/", 2)
+	if len(credential) != 2 || credential[0] != s.accessKey {
+		return false
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(bodyHash[:]) {
+		return false
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	scope := credential[1]
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	date := strings.SplitN(scope, "/", 2)[0]
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign)) == fields["Signature"]
+}
+
+// testBlobStoreRoundTrip 对任意 BlobStore 实现执行读写删除的通用检查
+func testBlobStoreRoundTrip(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	keys := []string{"avatars/1/a.png", "attachments/2/报告 v1+final.txt"}
+
+	for _, key := range keys {
+		if err := store.Put(ctx, key, []byte("hello "+key), "text/plain"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+		r, info, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		if string(data) != "hello "+key {
+			t.Fatalf("Get(%q) = %q", key, data)
+		}
+		if info.Size != int64(len(data)) {
+			t.Fatalf("Get(%q) size = %d, want %d", key, info.Size, len(data))
+		}
+	}
+
+	// 覆盖已有文件
+	if err := store.Put(ctx, keys[0], []byte("v2"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := store.Get(ctx, keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "v2" {
+		t.Fatalf("overwrite: got %q", data)
+	}
+
+	if err := store.Delete(ctx, keys[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := store.Get(ctx, keys[0]); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("Get after delete: got %v, want ErrBlobNotFound", err)
+	}
+	// 删除不存在的文件不报错
+	if err := store.Delete(ctx, keys[0]); err != nil {
+		t.Fatalf("Delete missing: %v", err)
+	}
+
+	for _, key := range []string{"", "/abs", "a/../b", "a//b", `a\b`} {
+		if err := store.Put(ctx, key, []byte("x"), ""); !errors.Is(err, ErrInvalidBlobKey) {
+			t.Fatalf("Put(%q): got %v, want ErrInvalidBlobKey", key, err)
+		}
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStoreRoundTrip(t, store)
+}
+
+func TestS3BlobStorePathStyle(t *testing.T) {
+	stub, server := newStubS3(t)
+	store, err := NewS3BlobStore(config.S3StorageConfig{
+		Endpoint:  server.URL,
+		Bucket:    "files",
+		AccessKey: stub.accessKey,
+		SecretKey: stub.secretKey,
+		PathStyle: true,
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStoreRoundTrip(t, store)
+}
+
+func TestS3BlobStoreVirtualHostStyle(t *testing.T) {
+	stub, server := newStubS3(t)
+	// 将 bucket.127.0.0.1:port 形式的地址连接到本地模拟服务
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}}
+	store, err := NewS3BlobStore(config.S3StorageConfig{
+		Endpoint:  server.URL,
+		Bucket:    "files",
+		AccessKey: stub.accessKey,
+		SecretKey: stub.secretKey,
+	}, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStoreRoundTrip(t, store)
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	for key := range stub.objects {
+		if !strings.HasPrefix(key, "files.") {
+			t.Fatalf("object %q not addressed by bucket host", key)
+		}
+	}
+}
+
+func TestS3BlobStoreWrongSecret(t *testing.T) {
+	stub, server := newStubS3(t)
+	store, err := NewS3BlobStore(config.S3StorageConfig{
+		Endpoint:  server.URL,
+		Bucket:    "files",
+		AccessKey: stub.accessKey,
+		SecretKey: "wrong",
+		PathStyle: true,
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(context.Background(), "a.txt", []byte("x"), "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("got %v, want 403 error", err)
+	}
+}
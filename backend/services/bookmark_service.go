@@ -0,0 +1,275 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBookmarkNotFound = errors.New("bookmark not found")
+	ErrBookmarkExists   = errors.New("bookmark already exists")
+)
+
+// getUserBookmark 获取用户自己的收藏
+func getUserBookmark(tx *gorm.DB, userID, bookmarkID uint) (*models.Bookmark, error) {
+	var bookmark models.Bookmark
+	if err := tx.Where("id = ? AND user_id = ?", bookmarkID, userID).First(&bookmark).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBookmarkNotFound
+		}
+		return nil, err
+	}
+	return &bookmark, nil
+}
+
+// setBookmarkTags 替换收藏的标签
+func setBookmarkTags(tx *gorm.DB, userID, bookmarkID uint, tagIDs []uint) error {
+	for _, tagID := range tagIDs {
+		if _, err := getUserTag(tx, userID, tagID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("bookmark_id = ?", bookmarkID).Delete(&models.BookmarkTag{}).Error; err != nil {
+		return err
+	}
+
+	seen := make(map[uint]bool, len(tagIDs))
+	links := make([]models.BookmarkTag, 0, len(tagIDs))
+	now := time.Now()
+	for _, tagID := range tagIDs {
+		if seen[tagID] {
+			continue
+		}
+		seen[tagID] = true
+		links = append(links, models.BookmarkTag{BookmarkID: bookmarkID, TagID: tagID, CreatedAt: now})
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return tx.Create(&links).Error
+}
+
+// CreateBookmark 收藏消息的指定版本，需要对所在会话有查看权限
+func CreateBookmark(userID uint, req models.CreateBookmarkRequest) (*models.Bookmark, error) {
+	role := req.Role
+	if role == "" {
+		role = "ai"
+	}
+
+	db := database.GetDB()
+	var bookmark models.Bookmark
+	err := db.Transaction(func(tx *gorm.DB) error {
+		target, err := resolveMessageVersion(tx, req.MessageID, role, req.Version)
+		if err != nil {
+			return err
+		}
+
+		session, err := GetSessionByID(target.SessionID)
+		if err != nil {
+			return err
+		}
+		if err := CheckSessionAccess(userID, session, SessionPermissionRead); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Bookmark{}).
+			Where("user_id = ? AND message_id = ? AND role = ? AND version = ?", userID, req.MessageID, role, target.Version).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrBookmarkExists
+		}
+
+		bookmark = models.Bookmark{
+			UserID:    userID,
+			SessionID: target.SessionID,
+			MessageID: req.MessageID,
+			Role:      role,
+			Version:   target.Version,
+			Note:      req.Note,
+		}
+		if err := tx.Create(&bookmark).Error; err != nil {
+			return err
+		}
+		return setBookmarkTags(tx, userID, bookmark.ID, req.TagIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadBookmarkTags([]*models.Bookmark{&bookmark}); err != nil {
+		return nil, err
+	}
+	return &bookmark, nil
+}
+
+// UpdateBookmark 修改收藏的备注和标签
+func UpdateBookmark(userID, bookmarkID uint, req models.UpdateBookmarkRequest) (*models.Bookmark, error) {
+	db := database.GetDB()
+	var bookmark *models.Bookmark
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		bookmark, err = getUserBookmark(tx, userID, bookmarkID)
+		if err != nil {
+			return err
+		}
+
+		if req.Note != nil {
+			bookmark.Note = *req.Note
+			if err := tx.Model(bookmark).Update("note", bookmark.Note).Error; err != nil {
+				return err
+			}
+		}
+		if req.TagIDs != nil {
+			return setBookmarkTags(tx, userID, bookmark.ID, *req.TagIDs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadBookmarkTags([]*models.Bookmark{bookmark}); err != nil {
+		return nil, err
+	}
+	return bookmark, nil
+}
+
+// DeleteBookmark 取消收藏
+func DeleteBookmark(userID, bookmarkID uint) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		bookmark, err := getUserBookmark(tx, userID, bookmarkID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("bookmark_id = ?", bookmark.ID).Delete(&models.BookmarkTag{}).Error; err != nil {
+			return err
+		}
+		// 彻底删除，以便之后可以重新收藏同一版本
+		return tx.Unscoped().Delete(bookmark).Error
+	})
+}
+
+// ListBookmarks 分页获取用户在各个会话中的收藏，按收藏时间倒序
+// 只返回会话仍然存在且用户仍有查看权限的收藏
+func ListBookmarks(userID uint, query models.BookmarkQuery) ([]models.BookmarkDetail, int64, error) {
+	db := database.GetDB()
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+
+	memberWorkspaces := db.Model(&models.WorkspaceMember{}).Select("workspace_id").Where("user_id = ?", userID)
+	scope := func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Model(&models.Bookmark{}).
+			Joins("JOIN chat_sessions ON chat_sessions.session_id = bookmarks.session_id AND chat_sessions.deleted_at IS NULL").
+			Where("bookmarks.user_id = ?", userID).
+			Where(db.Where("chat_sessions.workspace_id IS NULL").Or("chat_sessions.workspace_id IN (?)", memberWorkspaces))
+		if query.SessionID != "" {
+			tx = tx.Where("bookmarks.session_id = ?", query.SessionID)
+		}
+		if query.TagID != 0 {
+			tx = tx.Where("bookmarks.id IN (?)", db.Model(&models.BookmarkTag{}).Select("bookmark_id").Where("tag_id = ?", query.TagID))
+		}
+		if query.Keyword != "" {
+			tx = tx.Where("bookmarks.note LIKE ?", "%"+query.Keyword+"%")
+		}
+		return tx
+	}
+
+	var total int64
+	if err := db.Scopes(scope).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询收藏总数失败: %w", err)
+	}
+
+	var details []models.BookmarkDetail
+	err := db.Scopes(scope).
+		Select("bookmarks.*, chat_sessions.title AS session_title, chat_sessions.workspace_id").
+		Order("bookmarks.id DESC").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Scan(&details).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询收藏失败: %w", err)
+	}
+
+	bookmarks := make([]*models.Bookmark, 0, len(details))
+	for i := range details {
+		detail := &details[i]
+		bookmarks = append(bookmarks, &detail.Bookmark)
+
+		// 被收藏的版本已不存在时仍返回收藏本身，内容为空
+		target, err := resolveMessageVersion(db, detail.MessageID, detail.Role, detail.Version)
+		if err != nil {
+			if errors.Is(err, ErrMessageNotFound) {
+				continue
+			}
+			return nil, 0, fmt.Errorf("查询收藏内容失败: %w", err)
+		}
+		detail.Content = target.Content
+		detail.ThinkContent = target.ThinkContent
+		detail.IsActive = target.IsActive
+		detail.MessageAt = &target.CreatedAt
+
+		if detail.Role == "ai" {
+			var question models.ChatMessage
+			if err := db.Where("message_id = ? AND role = ?", detail.MessageID, "user").First(&question).Error; err == nil {
+				detail.Question = question.Content
+			}
+		}
+	}
+
+	if err := loadBookmarkTags(bookmarks); err != nil {
+		return nil, 0, fmt.Errorf("加载收藏标签失败: %w", err)
+	}
+	return details, total, nil
+}
+
+// loadBookmarkTags 批量加载收藏的标签
+func loadBookmarkTags(bookmarks []*models.Bookmark) error {
+	if len(bookmarks) == 0 {
+		return nil
+	}
+
+	bookmarkIDs := make([]uint, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		bookmarkIDs = append(bookmarkIDs, bookmark.ID)
+	}
+
+	var rows []struct {
+		models.Tag
+		BookmarkID uint
+	}
+	db := database.GetDB()
+	err := db.Model(&models.Tag{}).Select("tags.*, bookmark_tags.bookmark_id").
+		Joins("JOIN bookmark_tags ON bookmark_tags.tag_id = tags.id").
+		Where("bookmark_tags.bookmark_id IN ?", bookmarkIDs).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	tags := make(map[uint][]models.Tag, len(bookmarks))
+	for _, row := range rows {
+		tags[row.BookmarkID] = append(tags[row.BookmarkID], row.Tag)
+	}
+	for _, bookmark := range bookmarks {
+		bookmark.Tags = tags[bookmark.ID]
+		if bookmark.Tags == nil {
+			bookmark.Tags = []models.Tag{}
+		}
+	}
+	return nil
+}
@@ -5,10 +5,12 @@ import (
 	"aiChat/backend/models"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // SaveChatSession 保存聊天会话
@@ -18,21 +20,39 @@ func SaveChatSession(session *models.ChatSession) error {
 	return result.Error
 }
 
-// GetSessionsByUserID 获取用户的所有会话
-func GetSessionsByUserID(userID uint) ([]models.ChatSession, error) {
+// GetSessionsByUserID 获取用户的个人会话，支持按文件夹、标签和归档状态过滤
+// 工作区会话通过 GetSessionsByWorkspace 获取
+func GetSessionsByUserID(userID uint, query models.SessionListQuery) ([]models.ChatSession, error) {
 	db := database.GetDB()
 	var sessions []models.ChatSession
 
+	tx := db.Where("user_id = ? AND workspace_id IS NULL AND is_archived = ?", userID, query.Archived)
+	if query.FolderID != nil {
+		if *query.FolderID == 0 {
+			tx = tx.Where("folder_id IS NULL")
+		} else {
+			tx = tx.Where("folder_id = ?", *query.FolderID)
+		}
+	}
+	if query.TagID != 0 {
+		tx = tx.Where("session_id IN (?)", db.Model(&models.SessionTag{}).Select("session_id").Where("tag_id = ?", query.TagID))
+	}
+
 	// 使用GORM查询会话列表
-	err := db.Where("user_id = ?", userID).
-		Order("is_pinned DESC, updated_at DESC").
+	err := tx.Order("is_pinned DESC, updated_at DESC").
 		Find(&sessions).Error
 
 	if err != nil {
 		return nil, fmt.Errorf("查询会话失败: %w", err)
 	}
 
-	// 获取每个会话的消息数量和最后一条消息
+	fillSessionSummaries(sessions)
+	return sessions, nil
+}
+
+// fillSessionSummaries 获取每个会话的消息数量和最后一条消息
+func fillSessionSummaries(sessions []models.ChatSession) {
+	db := database.GetDB()
 	for i := range sessions {
 		var messageCount int64
 		db.Model(&models.ChatMessage{}).
@@ -49,7 +69,9 @@ func GetSessionsByUserID(userID uint) ([]models.ChatSession, error) {
 		}
 	}
 
-	return sessions, nil
+	if err := loadSessionTags(sessions); err != nil {
+		log.Printf("加载会话标签失败: %v", err)
+	}
 }
 
 // GetSessionByID 根据会话ID获取会话
@@ -60,7 +82,7 @@ func GetSessionByID(sessionID string) (*models.ChatSession, error) {
 	err := db.Where("session_id = ?", sessionID).First(&session).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("会话不存在")
+			return nil, ErrSessionNotFound
 		}
 		return nil, fmt.Errorf("查询会话失败: %w", err)
 	}
@@ -68,18 +90,17 @@ func GetSessionByID(sessionID string) (*models.ChatSession, error) {
 	return &session, nil
 }
 
-// UpdateSession 更新会话信息
+// UpdateSession 更新会话信息，generation_params 使用 JSON 序列化，需要通过结构体更新
 func UpdateSession(session *models.ChatSession) error {
 	db := database.GetDB()
-	result := db.Model(session).Updates(map[string]interface{}{
-		"title":      session.Title,
-		"is_pinned":  session.IsPinned,
-		"updated_at": time.Now(),
-	})
+	session.UpdatedAt = time.Now()
+	result := db.Model(session).
+		Select("title", "is_pinned", "is_archived", "knowledge_base_id", "assistant_version", "generation_params", "updated_at").
+		Updates(session)
 	return result.Error
 }
 
-// DeleteSession 删除会话及其消息
+// DeleteSession 将会话及其消息移入回收站，标签关联保留以便恢复
 func DeleteSession(sessionID string) error {
 	db := database.GetDB()
 	return db.Transaction(func(tx *gorm.DB) error {
@@ -114,11 +135,56 @@ func SaveMessage(message *models.ChatMessage) error {
 	return result.Error
 }
 
-// SaveAIResponse 保存AI响应
+// ReserveResponseVersions 为消息预留 count 个新的回答版本，返回预留的版本号
+// 在事务中锁定原始消息后按已有的最大版本号递增，并先写入空的回答占位，
+// 唯一索引保证并发重试或对比时不会得到相同的版本号
+func ReserveResponseVersions(sessionID, messageID string, count int) ([]int, error) {
+	var versions []int
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var messages []models.ChatMessage
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("message_id = ?", messageID).Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return ErrMessageNotFound
+		}
+
+		// 原始消息是版本1，已删除的版本号也不再使用
+		var maxVersion int
+		if err := tx.Unscoped().Model(&models.AIResponse{}).Select("COALESCE(MAX(version), 1)").
+			Where("message_id = ?", messageID).Scan(&maxVersion).Error; err != nil {
+			return err
+		}
+
+		responses := make([]models.AIResponse, count)
+		versions = make([]int, count)
+		for i := range responses {
+			versions[i] = maxVersion + i + 1
+			responses[i] = models.AIResponse{MessageID: messageID, SessionID: sessionID, Version: versions[i]}
+		}
+		return tx.Create(&responses).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// SaveAIResponse 保存AI响应，版本号需要先通过 ReserveResponseVersions 预留
 func SaveAIResponse(response *models.AIResponse) error {
 	db := database.GetDB()
-	result := db.Create(response)
-	return result.Error
+	result := db.Model(&models.AIResponse{}).
+		Where("message_id = ? AND version = ?", response.MessageID, response.Version).
+		Select("think_content", "content", "is_active", "model", "generation_params", "system_prompt").
+		Updates(response)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMessageNotFound
+	}
+	return db.Where("message_id = ? AND version = ?", response.MessageID, response.Version).First(response).Error
 }
 
 // GetMessagesBySessionID 获取会话的所有消息
@@ -126,8 +192,8 @@ func GetMessagesBySessionID(sessionID string) ([]models.ChatMessage, error) {
 	db := database.GetDB()
 	var messages []models.ChatMessage
 
-	// 获取活跃的消息
-	err := db.Where("session_id = ? AND is_active = ?", sessionID, true).
+	// 获取活跃的消息，AI回答的版本1未激活时也需要返回，其他版本作为替代回答附带在其中
+	err := db.Where("session_id = ? AND (is_active = ? OR role = ?)", sessionID, true, "ai").
 		Order("created_at ASC").
 		Find(&messages).Error
 
@@ -135,6 +201,10 @@ func GetMessagesBySessionID(sessionID string) ([]models.ChatMessage, error) {
 		return nil, fmt.Errorf("查询消息失败: %w", err)
 	}
 
+	if err := loadMessageAttachments(messages); err != nil {
+		log.Printf("加载消息附件失败: %v", err)
+	}
+
 	// 加载每条AI消息的替代回答
 	for i, msg := range messages {
 		if msg.Role == "ai" {
@@ -145,9 +215,18 @@ func GetMessagesBySessionID(sessionID string) ([]models.ChatMessage, error) {
 		}
 	}
 
+	if err := loadMessageCitations(messages); err != nil {
+		log.Printf("加载回答引用失败: %v", err)
+	}
+	if err := loadMessageToolCalls(messages); err != nil {
+		log.Printf("加载工具调用记录失败: %v", err)
+	}
+
 	return messages, nil
 }
 
+var ErrMessageNotFound = errors.New("message not found")
+
 // GetMessageByID 根据消息ID获取消息
 func GetMessageByID(messageID string) (*models.ChatMessage, error) {
 	db := database.GetDB()
@@ -164,6 +243,99 @@ func GetMessageByID(messageID string) (*models.ChatMessage, error) {
 	return &message, nil
 }
 
+// messageVersion 消息某个版本的内容
+type messageVersion struct {
+	SessionID    string
+	Version      int
+	Content      string
+	ThinkContent string
+	IsActive     bool
+	Model        string
+	CreatedAt    time.Time
+	// 生成回答时的参数和系统提示词
+	GenerationParams *models.GenerationParams
+	SystemPrompt     string
+}
+
+// resolveMessageVersion 查找消息的指定版本，version 为 0 时取当前活跃版本
+// 用户消息只有一个版本，AI回答的版本 1 存在 chat_messages 中，重试生成的版本存在 ai_responses 中
+func resolveMessageVersion(tx *gorm.DB, messageID, role string, version int) (*messageVersion, error) {
+	if role == "user" {
+		var message models.ChatMessage
+		if err := tx.Where("message_id = ? AND role = ?", messageID, "user").First(&message).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrMessageNotFound
+			}
+			return nil, err
+		}
+		if version > 1 {
+			return nil, ErrMessageNotFound
+		}
+		return &messageVersion{SessionID: message.SessionID, Version: 1, Content: message.Content, IsActive: true, CreatedAt: message.CreatedAt}, nil
+	}
+
+	if version == 0 {
+		var message models.ChatMessage
+		err := tx.Where("message_id = ? AND role = ? AND is_active = ?", messageID, "ai", true).First(&message).Error
+		if err == nil {
+			version = 1
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			var response models.AIResponse
+			if err := tx.Where("message_id = ? AND is_active = ?", messageID, true).First(&response).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, ErrMessageNotFound
+				}
+				return nil, err
+			}
+			version = response.Version
+		} else {
+			return nil, err
+		}
+	}
+
+	if version == 1 {
+		var message models.ChatMessage
+		if err := tx.Where("message_id = ? AND role = ?", messageID, "ai").First(&message).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrMessageNotFound
+			}
+			return nil, err
+		}
+		return &messageVersion{
+			SessionID:    message.SessionID,
+			Version:      1,
+			Content:      message.Content,
+			ThinkContent: message.ThinkContent,
+			IsActive:     message.IsActive,
+			Model:        message.ModelName,
+			CreatedAt:    message.CreatedAt,
+
+			GenerationParams: message.GenerationParams,
+			SystemPrompt:     message.SystemPrompt,
+		}, nil
+	}
+
+	var response models.AIResponse
+	if err := tx.Where("message_id = ? AND version = ?", messageID, version).First(&response).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMessageNotFound
+		}
+		return nil, err
+	}
+	return &messageVersion{
+		SessionID:    response.SessionID,
+		Version:      response.Version,
+		Content:      response.Content,
+		ThinkContent: response.ThinkContent,
+		IsActive:     response.IsActive,
+		Model:        response.ModelName,
+		CreatedAt:    response.CreatedAt,
+
+		GenerationParams: response.GenerationParams,
+		SystemPrompt:     response.SystemPrompt,
+	}, nil
+}
+
 // GetAIResponsesByMessageID 根据原始消息ID获取所有AI回答
 func GetAIResponsesByMessageID(messageID string) ([]models.AIResponse, error) {
 	db := database.GetDB()
@@ -186,9 +358,9 @@ func SetActiveAIResponse(messageID string, version int) error {
 
 	// 开始事务
 	return db.Transaction(func(tx *gorm.DB) error {
-		// 1. 先将所有相关的AI响应和消息设为非活跃
+		// 1. 先将所有相关的AI响应和消息设为非活跃，用户的提问不受影响
 		if err := tx.Model(&models.ChatMessage{}).
-			Where("message_id = ?", messageID).
+			Where("message_id = ? AND role = ?", messageID, "ai").
 			Update("is_active", false).Error; err != nil {
 			return err
 		}
@@ -203,7 +375,7 @@ func SetActiveAIResponse(messageID string, version int) error {
 		if version == 1 {
 			// 激活原始消息
 			if err := tx.Model(&models.ChatMessage{}).
-				Where("message_id = ? AND version = ?", messageID, 1).
+				Where("message_id = ? AND role = ? AND version = ?", messageID, "ai", 1).
 				Update("is_active", true).Error; err != nil {
 				return err
 			}
@@ -228,14 +400,14 @@ func GetChatHistoryWithPagination(sessionID string, page, pageSize int) ([]model
 
 	// 获取消息总数
 	if err := db.Model(&models.ChatMessage{}).
-		Where("session_id = ? AND is_active = ?", sessionID, true).
+		Where("session_id = ? AND (is_active = ? OR role = ?)", sessionID, true, "ai").
 		Count(&total).Error; err != nil {
 		return nil, 0, fmt.Errorf("获取消息总数失败: %w", err)
 	}
 
 	// 获取分页消息
 	offset := (page - 1) * pageSize
-	err := db.Where("session_id = ? AND is_active = ?", sessionID, true).
+	err := db.Where("session_id = ? AND (is_active = ? OR role = ?)", sessionID, true, "ai").
 		Order("created_at ASC").
 		Offset(offset).
 		Limit(pageSize).
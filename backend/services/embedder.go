@@ -0,0 +1,295 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ErrEmbedderNotConfigured 未配置向量化模型错误
+var ErrEmbedderNotConfigured = errors.New("embedder not configured")
+
+// Embedder 文本向量化接口
+type Embedder interface {
+	// Embed 将文本批量转换为向量，返回的向量与 texts 一一对应
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Name 返回模型标识，用于判断已有向量是否由同一模型生成
+	Name() string
+}
+
+var (
+	embedder   Embedder
+	embedderMu sync.RWMutex
+)
+
+// SetEmbedder 设置全局向量化模型
+func SetEmbedder(e Embedder) {
+	embedderMu.Lock()
+	defer embedderMu.Unlock()
+	embedder = e
+}
+
+// GetEmbedder 获取全局向量化模型
+func GetEmbedder() Embedder {
+	embedderMu.RLock()
+	defer embedderMu.RUnlock()
+	return embedder
+}
+
+// NewEmbedder 根据配置创建向量化模型
+func NewEmbedder(cfg config.EmbedderConfig) (Embedder, error) {
+	switch cfg.Provider {
+	case "", "hash":
+		return NewHashEmbedder(cfg.Dimensions), nil
+	case "openai":
+		if cfg.BaseURL == "" || cfg.Model == "" {
+			return nil, fmt.Errorf("openai 向量化模型需要配置 base_url 和 model")
+		}
+		return &OpenAIEmbedder{BaseURL: cfg.BaseURL, APIKey: cfg.APIKey, Model: cfg.Model, Dimensions: cfg.Dimensions}, nil
+	case "ollama":
+		if cfg.BaseURL == "" || cfg.Model == "" {
+			return nil, fmt.Errorf("ollama 向量化模型需要配置 base_url 和 model")
+		}
+		return &OllamaEmbedder{BaseURL: cfg.BaseURL, Model: cfg.Model}, nil
+	default:
+		return nil, fmt.Errorf("不支持的向量化模型: %s", cfg.Provider)
+	}
+}
+
+// embedderBatchSize 每次请求向量化的文本数量
+func embedderBatchSize() int {
+	if n := config.AppConfig.RAG.Embedder.BatchSize; n > 0 {
+		return n
+	}
+	return 32
+}
+
+// embedInBatches 分批调用向量化模型
+func embedInBatches(ctx context.Context, e Embedder, texts []string) ([][]float32, error) {
+	size := embedderBatchSize()
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := start + size
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.Embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) != end-start {
+			return nil, fmt.Errorf("向量化结果数量不匹配: 期望 %d, 实际 %d", end-start, len(batch))
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+var embedderHTTPClient = &http.Client{Timeout: 60 * time.Second}
+
+// postEmbeddingJSON 发送向量化请求并解析JSON响应
+func postEmbeddingJSON(ctx context.Context, url, apiKey string, body, out interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := embedderHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("向量化请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(data))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析响应失败: %v", err)
+	}
+	return nil
+}
+
+// OpenAIEmbedder 兼容OpenAI embeddings 接口的向量化模型
+type OpenAIEmbedder struct {
+	BaseURL    string // 完整的接口地址
+	APIKey     string
+	Model      string
+	Dimensions int // 大于 0 时请求指定维度的向量
+}
+
+// Name 返回模型标识
+func (e *OpenAIEmbedder) Name() string {
+	if e.Dimensions > 0 {
+		return fmt.Sprintf("openai:%s:%d", e.Model, e.Dimensions)
+	}
+	return "openai:" + e.Model
+}
+
+// Embed 调用 embeddings 接口
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body := map[string]interface{}{"model": e.Model, "input": texts}
+	if e.Dimensions > 0 {
+		body["dimensions"] = e.Dimensions
+	}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := postEmbeddingJSON(ctx, e.BaseURL, e.APIKey, body, &resp); err != nil {
+		return nil, err
+	}
+
+	// 按 index 排序，接口不保证返回顺序
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(vectors) {
+			return nil, fmt.Errorf("向量化结果的序号无效: %d", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("缺少第 %d 条文本的向量", i)
+		}
+	}
+	return vectors, nil
+}
+
+// OllamaEmbedder 调用 Ollama /api/embed 接口的向量化模型
+type OllamaEmbedder struct {
+	BaseURL string // 完整的接口地址，例如 http://127.0.0.1:11434/api/embed
+	Model   string
+}
+
+// Name 返回模型标识
+func (e *OllamaEmbedder) Name() string {
+	return "ollama:" + e.Model
+}
+
+// Embed 调用 Ollama 的向量化接口
+func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := postEmbeddingJSON(ctx, e.BaseURL, "", map[string]interface{}{"model": e.Model, "input": texts}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("向量化结果数量不匹配: 期望 %d, 实际 %d", len(texts), len(resp.Embeddings))
+	}
+	return resp.Embeddings, nil
+}
+
+// HashEmbedder 基于特征哈希的向量化模型，结果确定且不依赖外部服务，用于测试和本地开发
+// 英文和数字按单词切分，中日韩文字按单字和相邻两字切分
+type HashEmbedder struct {
+	Dimensions int
+}
+
+// NewHashEmbedder 创建特征哈希向量化模型
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = 256
+	}
+	return &HashEmbedder{Dimensions: dimensions}
+}
+
+// Name 返回模型标识
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash:%d", e.Dimensions)
+}
+
+// Embed 计算文本的特征哈希向量并归一化
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, e.Dimensions)
+		for _, token := range hashTokens(text) {
+			h := fnv.New64a()
+			h.Write([]byte(token))
+			sum := h.Sum64()
+			// 最高位决定符号，减少哈希冲突带来的偏差
+			if sum>>63 == 1 {
+				vector[sum%uint64(e.Dimensions)] -= 1
+			} else {
+				vector[sum%uint64(e.Dimensions)] += 1
+			}
+		}
+		normalizeVector(vector)
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// hashTokens 切分文本，用于特征哈希
+func hashTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+	var prevCJK rune
+
+	flushWord := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flushWord()
+			tokens = append(tokens, string(r))
+			if prevCJK != 0 {
+				tokens = append(tokens, string([]rune{prevCJK, r}))
+			}
+			prevCJK = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flushWord()
+		}
+		prevCJK = 0
+	}
+	flushWord()
+	return tokens
+}
+
+// normalizeVector 将向量归一化为单位长度，零向量保持不变
+func normalizeVector(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrFeedbackNotFound = errors.New("feedback not found")
+
+// feedbackExportBatchSize 导出反馈时每批读取的条数
+const feedbackExportBatchSize = 500
+
+// SubmitFeedback 评价AI回答的某个版本，重复评价同一版本时覆盖原评价
+func SubmitFeedback(userID uint, messageID string, req models.MessageFeedbackRequest) (*models.MessageFeedback, error) {
+	db := database.GetDB()
+
+	target, err := resolveMessageVersion(db, messageID, "ai", req.Version)
+	if err != nil {
+		return nil, err
+	}
+	session, err := GetSessionByID(target.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckSessionAccess(userID, session, SessionPermissionRead); err != nil {
+		return nil, err
+	}
+
+	var question models.ChatMessage
+	if err := db.Where("message_id = ? AND role = ?", messageID, "user").First(&question).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var feedback models.MessageFeedback
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND message_id = ? AND version = ?", userID, messageID, target.Version).
+			First(&feedback).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		feedback.UserID = userID
+		feedback.SessionID = target.SessionID
+		feedback.MessageID = messageID
+		feedback.Version = target.Version
+		feedback.Rating = req.Rating
+		feedback.Reason = req.Reason
+		feedback.Comment = req.Comment
+		// 模型、参数和系统提示词取自生成回答时的记录，不受会话之后修改的影响
+		feedback.ModelName = target.Model
+		feedback.GenerationParams = target.GenerationParams
+		feedback.SystemPrompt = target.SystemPrompt
+		feedback.Prompt = question.Content
+		feedback.Answer = target.Content
+		return tx.Save(&feedback).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// DeleteFeedback 撤回对AI回答某个版本的评价
+func DeleteFeedback(userID uint, messageID string, version int) error {
+	db := database.GetDB()
+	if version == 0 {
+		target, err := resolveMessageVersion(db, messageID, "ai", 0)
+		if err != nil {
+			return err
+		}
+		version = target.Version
+	}
+
+	result := db.Unscoped().Where("user_id = ? AND message_id = ? AND version = ?", userID, messageID, version).
+		Delete(&models.MessageFeedback{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFeedbackNotFound
+	}
+	return nil
+}
+
+// feedbackScope 根据查询条件过滤反馈
+func feedbackScope(query models.FeedbackQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Model(&models.MessageFeedback{})
+		if query.Model != "" {
+			tx = tx.Where("model = ?", query.Model)
+		}
+		if query.Rating != 0 {
+			tx = tx.Where("rating = ?", query.Rating)
+		}
+		if query.Reason != "" {
+			tx = tx.Where("reason = ?", query.Reason)
+		}
+		if !query.From.IsZero() {
+			tx = tx.Where("created_at >= ?", query.From)
+		}
+		if !query.To.IsZero() {
+			tx = tx.Where("created_at < ?", query.To)
+		}
+		return tx
+	}
+}
+
+// GetFeedbackStats 按模型汇总反馈数量、好评率和原因分布
+func GetFeedbackStats(query models.FeedbackQuery) ([]models.FeedbackModelStats, error) {
+	db := database.GetDB()
+
+	var rows []struct {
+		Model  string
+		Rating int
+		Reason string
+		Count  int64
+	}
+	err := db.Scopes(feedbackScope(query)).
+		Select("model, rating, reason, COUNT(*) AS count").
+		Group("model, rating, reason").
+		Order("model").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("统计反馈失败: %w", err)
+	}
+
+	statsByModel := make(map[string]*models.FeedbackModelStats)
+	stats := make([]models.FeedbackModelStats, 0)
+	order := make([]string, 0)
+	for _, row := range rows {
+		item, ok := statsByModel[row.Model]
+		if !ok {
+			item = &models.FeedbackModelStats{Model: row.Model, Reasons: make(map[string]int64)}
+			statsByModel[row.Model] = item
+			order = append(order, row.Model)
+		}
+		item.Total += row.Count
+		if row.Rating == models.FeedbackRatingUp {
+			item.Positive += row.Count
+		} else {
+			item.Negative += row.Count
+		}
+		if row.Reason != "" {
+			item.Reasons[row.Reason] += row.Count
+		}
+	}
+	for _, model := range order {
+		item := statsByModel[model]
+		if item.Total > 0 {
+			item.PositiveRate = float64(item.Positive) / float64(item.Total)
+		}
+		stats = append(stats, *item)
+	}
+	return stats, nil
+}
+
+// feedbackRecord 导出的评测数据，不包含用户身份
+type feedbackRecord struct {
+	ID           uint      `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Model        string    `json:"model"`
+	Rating       int       `json:"rating"`
+	Reason       string    `json:"reason,omitempty"`
+	Comment      string    `json:"comment,omitempty"`
+	SystemPrompt string    `json:"system_prompt,omitempty"`
+	Prompt       string    `json:"prompt"`
+	Answer       string    `json:"answer"`
+	MessageID    string    `json:"message_id"`
+	Version      int       `json:"version"`
+
+	// 生成回答时使用的参数
+	GenerationParams *models.GenerationParams `json:"generation_params,omitempty"`
+}
+
+// ExportFeedbackJSONL 将符合条件的反馈按JSON Lines格式写出，分批读取避免占用过多内存
+func ExportFeedbackJSONL(query models.FeedbackQuery, w io.Writer) error {
+	db := database.GetDB()
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	var batch []models.MessageFeedback
+	result := db.Scopes(feedbackScope(query)).
+		Order("id ASC").
+		FindInBatches(&batch, feedbackExportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, feedback := range batch {
+				if err := encoder.Encode(feedbackRecord{
+					ID:           feedback.ID,
+					CreatedAt:    feedback.CreatedAt,
+					Model:        feedback.ModelName,
+					Rating:       feedback.Rating,
+					Reason:       feedback.Reason,
+					Comment:      feedback.Comment,
+					SystemPrompt: feedback.SystemPrompt,
+					Prompt:       feedback.Prompt,
+					Answer:       feedback.Answer,
+					MessageID:    feedback.MessageID,
+					Version:      feedback.Version,
+
+					GenerationParams: feedback.GenerationParams,
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return fmt.Errorf("导出反馈失败: %w", result.Error)
+	}
+	return nil
+}
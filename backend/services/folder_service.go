@@ -0,0 +1,441 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrFolderNotFound 文件夹不存在错误
+	ErrFolderNotFound = errors.New("folder not found")
+
+	// ErrFolderCycle 文件夹不能移动到自身或子文件夹下错误
+	ErrFolderCycle = errors.New("folder cannot be moved into itself or its descendants")
+
+	// ErrFolderTooDeep 文件夹层级过深错误
+	ErrFolderTooDeep = errors.New("folder nesting too deep")
+
+	// ErrTagNotFound 标签不存在错误
+	ErrTagNotFound = errors.New("tag not found")
+
+	// ErrTagExists 标签已存在错误
+	ErrTagExists = errors.New("tag already exists")
+)
+
+// maxFolderDepth 文件夹最大嵌套层数
+const maxFolderDepth = 8
+
+// getUserFolder 获取属于用户的文件夹
+func getUserFolder(tx *gorm.DB, userID, folderID uint) (*models.Folder, error) {
+	var folder models.Folder
+	if err := tx.Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// folderDepth 返回文件夹所在的层级，根目录下的文件夹为1
+// 沿上级链查找时遇到 folderID 说明存在循环
+func folderDepth(tx *gorm.DB, userID, parentID, folderID uint) (int, error) {
+	depth := 1
+	for current := parentID; current != 0; depth++ {
+		if current == folderID {
+			return 0, ErrFolderCycle
+		}
+		if depth > maxFolderDepth {
+			return 0, ErrFolderTooDeep
+		}
+		parent, err := getUserFolder(tx, userID, current)
+		if err != nil {
+			return 0, err
+		}
+		if parent.ParentID == nil {
+			current = 0
+		} else {
+			current = *parent.ParentID
+		}
+	}
+	if depth > maxFolderDepth {
+		return 0, ErrFolderTooDeep
+	}
+	return depth, nil
+}
+
+// folderSubtreeHeight 返回以文件夹为根的子树层数，没有子文件夹时为1
+func folderSubtreeHeight(tx *gorm.DB, userID, folderID uint) (int, error) {
+	var folders []models.Folder
+	if err := tx.Select("id", "parent_id").Where("user_id = ? AND parent_id IS NOT NULL", userID).Find(&folders).Error; err != nil {
+		return 0, err
+	}
+	children := make(map[uint][]uint, len(folders))
+	for _, folder := range folders {
+		children[*folder.ParentID] = append(children[*folder.ParentID], folder.ID)
+	}
+
+	// 按层遍历，层数超过上限时提前结束，数据中存在的循环也不会导致死循环
+	height := 0
+	for level := []uint{folderID}; len(level) > 0 && height <= maxFolderDepth; height++ {
+		var next []uint
+		for _, id := range level {
+			next = append(next, children[id]...)
+		}
+		level = next
+	}
+	return height, nil
+}
+
+// ListFolders 获取用户的全部文件夹及其中的会话数
+func ListFolders(userID uint) ([]models.Folder, error) {
+	db := database.GetDB()
+
+	var folders []models.Folder
+	if err := db.Where("user_id = ?", userID).Order("sort_order, id").Find(&folders).Error; err != nil {
+		return nil, fmt.Errorf("查询文件夹失败: %w", err)
+	}
+
+	var counts []struct {
+		FolderID uint
+		Count    int64
+	}
+	if err := db.Model(&models.ChatSession{}).Select("folder_id, COUNT(*) AS count").
+		Where("user_id = ? AND folder_id IS NOT NULL", userID).Group("folder_id").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("统计文件夹会话数失败: %w", err)
+	}
+	sessionCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		sessionCounts[count.FolderID] = count.Count
+	}
+	for i := range folders {
+		folders[i].SessionCount = sessionCounts[folders[i].ID]
+	}
+
+	return folders, nil
+}
+
+// CreateFolder 创建文件夹
+func CreateFolder(userID uint, req models.CreateFolderRequest) (*models.Folder, error) {
+	db := database.GetDB()
+
+	folder := models.Folder{UserID: userID, Name: req.Name, SortOrder: req.SortOrder}
+	if req.ParentID != nil && *req.ParentID != 0 {
+		if _, err := folderDepth(db, userID, *req.ParentID, 0); err != nil {
+			return nil, err
+		}
+		folder.ParentID = req.ParentID
+	}
+
+	if err := db.Create(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// UpdateFolder 重命名或移动文件夹
+func UpdateFolder(userID, folderID uint, req models.UpdateFolderRequest) (*models.Folder, error) {
+	db := database.GetDB()
+
+	folder, err := getUserFolder(db, userID, folderID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.SortOrder != nil {
+		updates["sort_order"] = *req.SortOrder
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			updates["parent_id"] = nil
+		} else {
+			depth, err := folderDepth(db, userID, *req.ParentID, folderID)
+			if err != nil {
+				return nil, err
+			}
+			// 移动后整个子树的最深一层也不能超过上限
+			height, err := folderSubtreeHeight(db, userID, folderID)
+			if err != nil {
+				return nil, err
+			}
+			if depth+height-1 > maxFolderDepth {
+				return nil, ErrFolderTooDeep
+			}
+			updates["parent_id"] = *req.ParentID
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(folder).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return getUserFolder(db, userID, folderID)
+}
+
+// DeleteFolder 删除文件夹，其中的子文件夹和会话移动到上一级
+func DeleteFolder(userID, folderID uint) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		folder, err := getUserFolder(tx, userID, folderID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Folder{}).Where("user_id = ? AND parent_id = ?", userID, folderID).
+			Update("parent_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ChatSession{}).Where("user_id = ? AND folder_id = ?", userID, folderID).
+			Update("folder_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(folder).Error
+	})
+}
+
+// getUserTag 获取属于用户的标签
+func getUserTag(tx *gorm.DB, userID, tagID uint) (*models.Tag, error) {
+	var tag models.Tag
+	if err := tx.Where("id = ? AND user_id = ?", tagID, userID).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// tagNameExists 检查用户是否已有同名标签
+func tagNameExists(tx *gorm.DB, userID uint, name string, excludeID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Tag{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListTags 获取用户的全部标签及使用次数
+func ListTags(userID uint) ([]models.Tag, error) {
+	db := database.GetDB()
+
+	var tags []models.Tag
+	if err := db.Where("user_id = ?", userID).Order("name").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("查询标签失败: %w", err)
+	}
+
+	var counts []struct {
+		TagID uint
+		Count int64
+	}
+	if err := db.Model(&models.SessionTag{}).Select("session_tags.tag_id, COUNT(*) AS count").
+		Joins("JOIN tags ON tags.id = session_tags.tag_id").
+		Joins("JOIN chat_sessions ON chat_sessions.session_id = session_tags.session_id AND chat_sessions.deleted_at IS NULL").
+		Where("tags.user_id = ?", userID).Group("session_tags.tag_id").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("统计标签使用次数失败: %w", err)
+	}
+	sessionCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		sessionCounts[count.TagID] = count.Count
+	}
+	for i := range tags {
+		tags[i].SessionCount = sessionCounts[tags[i].ID]
+	}
+
+	return tags, nil
+}
+
+// CreateTag 创建标签，同一用户的标签名不能重复
+func CreateTag(userID uint, req models.CreateTagRequest) (*models.Tag, error) {
+	db := database.GetDB()
+
+	exists, err := tagNameExists(db, userID, req.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrTagExists
+	}
+
+	tag := models.Tag{UserID: userID, Name: req.Name, Color: req.Color}
+	if err := db.Create(&tag).Error; err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// UpdateTag 修改标签名称或颜色
+func UpdateTag(userID, tagID uint, req models.UpdateTagRequest) (*models.Tag, error) {
+	db := database.GetDB()
+
+	tag, err := getUserTag(db, userID, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil && *req.Name != tag.Name {
+		exists, err := tagNameExists(db, userID, *req.Name, tagID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrTagExists
+		}
+		updates["name"] = *req.Name
+	}
+	if req.Color != nil {
+		updates["color"] = *req.Color
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(tag).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return getUserTag(db, userID, tagID)
+}
+
+// DeleteTag 删除标签及其与会话的关联，标签名可以重新使用
+func DeleteTag(userID, tagID uint) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		tag, err := getUserTag(tx, userID, tagID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.SessionTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.BookmarkTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(tag).Error
+	})
+}
+
+// requireOwnedPersonalSessions 检查会话均为用户自己的个人会话
+// 文件夹和标签属于个人，不能用于工作区的共享会话
+func requireOwnedPersonalSessions(tx *gorm.DB, userID uint, sessionIDs []string) error {
+	var sessions []models.ChatSession
+	if err := tx.Where("session_id IN ?", sessionIDs).Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	found := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		if session.UserID != userID || session.WorkspaceID != nil {
+			return ErrSessionForbidden
+		}
+		found[session.SessionID] = true
+	}
+	for _, sessionID := range sessionIDs {
+		if !found[sessionID] {
+			return ErrSessionNotFound
+		}
+	}
+	return nil
+}
+
+// MoveSessions 批量移动会话到文件夹，folderID 为 0 时移出文件夹
+func MoveSessions(userID uint, sessionIDs []string, folderID uint) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := requireOwnedPersonalSessions(tx, userID, sessionIDs); err != nil {
+			return err
+		}
+
+		var target interface{}
+		if folderID != 0 {
+			if _, err := getUserFolder(tx, userID, folderID); err != nil {
+				return err
+			}
+			target = folderID
+		}
+
+		return tx.Model(&models.ChatSession{}).Where("session_id IN ?", sessionIDs).
+			Update("folder_id", target).Error
+	})
+}
+
+// TagSessions 批量为会话添加和移除标签
+func TagSessions(userID uint, sessionIDs []string, add, remove []uint) error {
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := requireOwnedPersonalSessions(tx, userID, sessionIDs); err != nil {
+			return err
+		}
+
+		for _, tagID := range append(append([]uint{}, add...), remove...) {
+			if _, err := getUserTag(tx, userID, tagID); err != nil {
+				return err
+			}
+		}
+
+		if len(remove) > 0 {
+			if err := tx.Where("session_id IN ? AND tag_id IN ?", sessionIDs, remove).
+				Delete(&models.SessionTag{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(add) > 0 {
+			links := make([]models.SessionTag, 0, len(sessionIDs)*len(add))
+			now := time.Now()
+			for _, sessionID := range sessionIDs {
+				for _, tagID := range add {
+					links = append(links, models.SessionTag{SessionID: sessionID, TagID: tagID, CreatedAt: now})
+				}
+			}
+			// 已存在的关联忽略
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadSessionTags 批量加载会话的标签
+func loadSessionTags(sessions []models.ChatSession) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		sessionIDs = append(sessionIDs, session.SessionID)
+	}
+
+	var rows []struct {
+		models.Tag
+		SessionID string
+	}
+	db := database.GetDB()
+	err := db.Model(&models.Tag{}).Select("tags.*, session_tags.session_id").
+		Joins("JOIN session_tags ON session_tags.tag_id = tags.id").
+		Where("session_tags.session_id IN ?", sessionIDs).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	tags := make(map[string][]models.Tag, len(sessions))
+	for _, row := range rows {
+		tags[row.SessionID] = append(tags[row.SessionID], row.Tag)
+	}
+	for i := range sessions {
+		sessions[i].Tags = tags[sessions[i].SessionID]
+	}
+	return nil
+}
@@ -0,0 +1,575 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// InvalidResponseFormatError 请求指定的输出格式或其中的 JSON Schema 无效
+type InvalidResponseFormatError struct {
+	Reason string // 中文说明，直接返回给用户
+}
+
+func (e *InvalidResponseFormatError) Error() string {
+	return "invalid response format: " + e.Reason
+}
+
+// invalidResponseFormat 创建输出格式无效的错误
+func invalidResponseFormat(format string, args ...interface{}) error {
+	return &InvalidResponseFormatError{Reason: fmt.Sprintf(format, args...)}
+}
+
+const (
+	jsonSchemaMaxErrors = 10  // 校验时最多返回的错误数量
+	jsonSchemaMaxDepth  = 128 // 校验时 schema 的最大嵌套层数，超过时不再继续
+)
+
+// jsonSchema 编译后的 JSON Schema，支持结构化输出常用的关键字：
+// type、enum、const、properties、required、additionalProperties、items、
+// 字符串长度和 pattern、数值范围、数组长度和 uniqueItems、allOf、anyOf、oneOf、not，
+// 以及指向同一文档内的 $ref（例如 #/$defs/item），其余关键字会被忽略
+type jsonSchema struct {
+	reject bool // 布尔 schema false，任何值都不符合
+
+	types    []string
+	enum     []interface{}
+	hasConst bool
+	constVal interface{}
+
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+
+	items       *jsonSchema
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+
+	allOf []*jsonSchema
+	anyOf []*jsonSchema
+	oneOf []*jsonSchema
+	not   *jsonSchema
+	ref   *jsonSchema
+}
+
+// jsonSchemaCompiler 编译 schema，$ref 指向的子 schema 只编译一次，允许递归引用
+type jsonSchemaCompiler struct {
+	root interface{}
+	refs map[string]*jsonSchema
+}
+
+// compileJSONSchema 编译 JSON Schema，schema 无效时返回 InvalidResponseFormatError
+func compileJSONSchema(raw json.RawMessage) (*jsonSchema, error) {
+	var root interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, invalidResponseFormat("不是有效的JSON")
+	}
+	if _, ok := root.(map[string]interface{}); !ok {
+		return nil, invalidResponseFormat("schema 必须是对象")
+	}
+	compiler := &jsonSchemaCompiler{root: root, refs: map[string]*jsonSchema{}}
+	schema, err := compiler.compile(root, "#")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkJSONSchemaCycles(schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// checkJSONSchemaCycles 检查不经过 properties、items 等子值关键字就回到自身的引用
+// 例如 {"$ref":"#"} 或两个 $defs 互相引用，这样的 schema 校验时会无限递归
+func checkJSONSchemaCycles(root *jsonSchema) error {
+	// 先找出全部子 schema
+	all := []*jsonSchema{root}
+	seen := map[*jsonSchema]bool{root: true}
+	for i := 0; i < len(all); i++ {
+		for _, next := range append(all[i].inPlaceSchemas(), all[i].childSchemas()...) {
+			if !seen[next] {
+				seen[next] = true
+				all = append(all, next)
+			}
+		}
+	}
+
+	// 只沿作用于同一个值的关键字查找环
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[*jsonSchema]int, len(all))
+	var visit func(s *jsonSchema) error
+	visit = func(s *jsonSchema) error {
+		switch state[s] {
+		case visiting:
+			return invalidResponseFormat("$ref 存在循环引用，引用链中没有 properties、items 等作用于子值的关键字")
+		case done:
+			return nil
+		}
+		state[s] = visiting
+		for _, next := range s.inPlaceSchemas() {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[s] = done
+		return nil
+	}
+	for _, s := range all {
+		if err := visit(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inPlaceSchemas 返回作用于同一个值的子 schema
+func (s *jsonSchema) inPlaceSchemas() []*jsonSchema {
+	var list []*jsonSchema
+	if s.ref != nil {
+		list = append(list, s.ref)
+	}
+	list = append(list, s.allOf...)
+	list = append(list, s.anyOf...)
+	list = append(list, s.oneOf...)
+	if s.not != nil {
+		list = append(list, s.not)
+	}
+	return list
+}
+
+// childSchemas 返回作用于对象字段或数组元素的子 schema
+func (s *jsonSchema) childSchemas() []*jsonSchema {
+	list := make([]*jsonSchema, 0, len(s.properties)+2)
+	for _, prop := range s.properties {
+		list = append(list, prop)
+	}
+	if s.additionalProperties != nil {
+		list = append(list, s.additionalProperties)
+	}
+	if s.items != nil {
+		list = append(list, s.items)
+	}
+	return list
+}
+
+// compile 编译 schema 中的一个节点，path 用于错误提示
+func (c *jsonSchemaCompiler) compile(node interface{}, path string) (*jsonSchema, error) {
+	if b, ok := node.(bool); ok {
+		return &jsonSchema{reject: !b}, nil
+	}
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, invalidResponseFormat("%s 必须是对象或布尔值", path)
+	}
+
+	schema := &jsonSchema{}
+	var err error
+	if ref, ok := obj["$ref"]; ok {
+		refPath, ok := ref.(string)
+		if !ok {
+			return nil, invalidResponseFormat("%s/$ref 必须是字符串", path)
+		}
+		if schema.ref, err = c.resolveRef(refPath); err != nil {
+			return nil, err
+		}
+	}
+
+	switch t := obj["type"].(type) {
+	case nil:
+	case string:
+		schema.types = []string{t}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, invalidResponseFormat("%s/type 无效", path)
+			}
+			schema.types = append(schema.types, name)
+		}
+	default:
+		return nil, invalidResponseFormat("%s/type 无效", path)
+	}
+	for _, name := range schema.types {
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, invalidResponseFormat("%s/type 不支持 %s", path, name)
+		}
+	}
+
+	if enum, ok := obj["enum"]; ok {
+		values, ok := enum.([]interface{})
+		if !ok {
+			return nil, invalidResponseFormat("%s/enum 必须是数组", path)
+		}
+		schema.enum = values
+	}
+	if value, ok := obj["const"]; ok {
+		schema.hasConst = true
+		schema.constVal = value
+	}
+
+	if props, ok := obj["properties"]; ok {
+		propMap, ok := props.(map[string]interface{})
+		if !ok {
+			return nil, invalidResponseFormat("%s/properties 必须是对象", path)
+		}
+		schema.properties = make(map[string]*jsonSchema, len(propMap))
+		for name, prop := range propMap {
+			if schema.properties[name], err = c.compile(prop, path+"/properties/"+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if required, ok := obj["required"]; ok {
+		names, ok := required.([]interface{})
+		if !ok {
+			return nil, invalidResponseFormat("%s/required 必须是数组", path)
+		}
+		for _, item := range names {
+			name, ok := item.(string)
+			if !ok {
+				return nil, invalidResponseFormat("%s/required 必须是字符串数组", path)
+			}
+			schema.required = append(schema.required, name)
+		}
+	}
+	if additional, ok := obj["additionalProperties"]; ok {
+		if schema.additionalProperties, err = c.compile(additional, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+
+	if items, ok := obj["items"]; ok {
+		if schema.items, err = c.compile(items, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	if unique, ok := obj["uniqueItems"].(bool); ok {
+		schema.uniqueItems = unique
+	}
+
+	for keyword, target := range map[string]**int{
+		"minItems": &schema.minItems, "maxItems": &schema.maxItems,
+		"minLength": &schema.minLength, "maxLength": &schema.maxLength,
+	} {
+		if value, ok := obj[keyword]; ok {
+			n, ok := value.(float64)
+			if !ok || n < 0 || n != math.Trunc(n) {
+				return nil, invalidResponseFormat("%s/%s 必须是非负整数", path, keyword)
+			}
+			count := int(n)
+			*target = &count
+		}
+	}
+	for keyword, target := range map[string]**float64{
+		"minimum": &schema.minimum, "maximum": &schema.maximum,
+		"exclusiveMinimum": &schema.exclusiveMinimum, "exclusiveMaximum": &schema.exclusiveMaximum,
+	} {
+		if value, ok := obj[keyword]; ok {
+			n, ok := value.(float64)
+			if !ok {
+				return nil, invalidResponseFormat("%s/%s 必须是数值", path, keyword)
+			}
+			*target = &n
+		}
+	}
+
+	if pattern, ok := obj["pattern"]; ok {
+		expr, ok := pattern.(string)
+		if !ok {
+			return nil, invalidResponseFormat("%s/pattern 必须是字符串", path)
+		}
+		if schema.pattern, err = regexp.Compile(expr); err != nil {
+			return nil, invalidResponseFormat("%s/pattern 不是有效的正则表达式", path)
+		}
+	}
+
+	for keyword, target := range map[string]*[]*jsonSchema{"allOf": &schema.allOf, "anyOf": &schema.anyOf, "oneOf": &schema.oneOf} {
+		value, ok := obj[keyword]
+		if !ok {
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, invalidResponseFormat("%s/%s 必须是非空数组", path, keyword)
+		}
+		for i, item := range list {
+			sub, err := c.compile(item, fmt.Sprintf("%s/%s/%d", path, keyword, i))
+			if err != nil {
+				return nil, err
+			}
+			*target = append(*target, sub)
+		}
+	}
+	if not, ok := obj["not"]; ok {
+		if schema.not, err = c.compile(not, path+"/not"); err != nil {
+			return nil, err
+		}
+	}
+	return schema, nil
+}
+
+// resolveRef 解析同一文档内的 $ref，先放入占位的 schema 再编译，递归引用会指向同一个 schema
+func (c *jsonSchemaCompiler) resolveRef(ref string) (*jsonSchema, error) {
+	if schema, ok := c.refs[ref]; ok {
+		return schema, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, invalidResponseFormat("只支持文档内的 $ref: %s", ref)
+	}
+
+	node := c.root
+	if ref != "#" {
+		for _, token := range strings.Split(ref[2:], "/") {
+			token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+			switch current := node.(type) {
+			case map[string]interface{}:
+				next, ok := current[token]
+				if !ok {
+					return nil, invalidResponseFormat("$ref 指向的位置不存在: %s", ref)
+				}
+				node = next
+			case []interface{}:
+				index, err := strconv.Atoi(token)
+				if err != nil || index < 0 || index >= len(current) {
+					return nil, invalidResponseFormat("$ref 指向的位置不存在: %s", ref)
+				}
+				node = current[index]
+			default:
+				return nil, invalidResponseFormat("$ref 指向的位置不存在: %s", ref)
+			}
+		}
+	}
+
+	schema := &jsonSchema{}
+	c.refs[ref] = schema
+	compiled, err := c.compile(node, ref)
+	if err != nil {
+		return nil, err
+	}
+	*schema = *compiled
+	return schema, nil
+}
+
+// validate 校验JSON值，返回不符合的地方，path 使用 $.a[0].b 的形式
+func (s *jsonSchema) validate(value interface{}) []string {
+	var errs []string
+	s.validateAt(value, "$", 0, &errs)
+	return errs
+}
+
+// matchesAt 判断值是否符合 schema，用于 anyOf、oneOf 和 not
+func (s *jsonSchema) matchesAt(value interface{}, path string, depth int) bool {
+	var errs []string
+	s.validateAt(value, path, depth, &errs)
+	return len(errs) == 0
+}
+
+// validateAt 校验指定位置的值，错误超过上限或嵌套层数超过上限后不再继续
+func (s *jsonSchema) validateAt(value interface{}, path string, depth int, errs *[]string) {
+	if len(*errs) >= jsonSchemaMaxErrors {
+		return
+	}
+	addError := func(format string, args ...interface{}) {
+		if len(*errs) < jsonSchemaMaxErrors {
+			*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+	if depth > jsonSchemaMaxDepth {
+		addError("嵌套层数超过 %d", jsonSchemaMaxDepth)
+		return
+	}
+
+	if s.reject {
+		addError("不允许出现")
+		return
+	}
+	if s.ref != nil {
+		s.ref.validateAt(value, path, depth+1, errs)
+	}
+
+	if len(s.types) > 0 && !jsonTypeMatches(value, s.types) {
+		addError("类型应为 %s，实际为 %s", strings.Join(s.types, " 或 "), jsonTypeName(value))
+		return
+	}
+	if s.enum != nil {
+		matched := false
+		for _, candidate := range s.enum {
+			if reflect.DeepEqual(candidate, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addError("取值不在允许的范围内")
+		}
+	}
+	if s.hasConst && !reflect.DeepEqual(s.constVal, value) {
+		addError("取值应为 %s", jsonString(s.constVal))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				addError("缺少必填字段 %s", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			childPath := path + "." + name
+			if prop, ok := s.properties[name]; ok {
+				prop.validateAt(v[name], childPath, depth+1, errs)
+			} else if s.additionalProperties != nil {
+				if s.additionalProperties.reject {
+					addError("不允许的字段 %s", name)
+				} else {
+					s.additionalProperties.validateAt(v[name], childPath, depth+1, errs)
+				}
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			addError("至少需要 %d 项", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			addError("最多只能有 %d 项", *s.maxItems)
+		}
+		if s.uniqueItems {
+			for i := 0; i < len(v); i++ {
+				for j := i + 1; j < len(v); j++ {
+					if reflect.DeepEqual(v[i], v[j]) {
+						addError("第 %d 项与第 %d 项重复", i, j)
+					}
+				}
+			}
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validateAt(item, fmt.Sprintf("%s[%d]", path, i), depth+1, errs)
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			addError("长度不能小于 %d", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			addError("长度不能大于 %d", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			addError("不符合格式 %s", s.pattern.String())
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			addError("不能小于 %v", *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			addError("不能大于 %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			addError("必须大于 %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			addError("必须小于 %v", *s.exclusiveMaximum)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		sub.validateAt(value, path, depth+1, errs)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.matchesAt(value, path, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			addError("不符合 anyOf 中的任何一种结构")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.matchesAt(value, path, depth+1) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			addError("应当恰好符合 oneOf 中的一种结构，实际符合 %d 种", matches)
+		}
+	}
+	if s.not != nil && s.not.matchesAt(value, path, depth+1) {
+		addError("不能符合 not 中的结构")
+	}
+}
+
+// jsonTypeMatches 判断值是否属于指定的类型之一，integer 为没有小数部分的数值
+func jsonTypeMatches(value interface{}, types []string) bool {
+	actual := jsonTypeName(value)
+	for _, name := range types {
+		if name == actual {
+			return true
+		}
+		if actual == "integer" && name == "number" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeName 获取JSON值的类型名称
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+// jsonString 将值序列化为JSON文本，用于错误提示
+func jsonString(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaRejectsRefCycles(t *testing.T) {
+	schemas := map[string]string{
+		"self":           `{"$ref":"#"}`,
+		"self with type": `{"type":"object","$ref":"#"}`,
+		"mutual defs":    `{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`,
+		"through allOf":  `{"$defs":{"a":{"allOf":[{"type":"object"},{"$ref":"#/$defs/a"}]}},"properties":{"x":{"$ref":"#/$defs/a"}}}`,
+		"through anyOf":  `{"$defs":{"a":{"anyOf":[{"not":{"$ref":"#/$defs/b"}}]},"b":{"oneOf":[{"$ref":"#/$defs/a"}]}},"items":{"$ref":"#/$defs/b"}}`,
+	}
+	for name, raw := range schemas {
+		_, err := compileJSONSchema(json.RawMessage(raw))
+		var formatErr *InvalidResponseFormatError
+		if !errors.As(err, &formatErr) || !strings.Contains(formatErr.Reason, "循环引用") {
+			t.Errorf("%s: got %v, want cycle error", name, err)
+		}
+	}
+}
+
+func TestJSONSchemaRecursiveRefs(t *testing.T) {
+	// 经过 properties 或 items 的递归引用是有效的，例如树形结构
+	schema, err := compileJSONSchema(json.RawMessage(`{
+		"$defs": {
+			"node": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string"},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/node"}},
+					"parent": {"$ref": "#"}
+				},
+				"additionalProperties": false
+			}
+		},
+		"$ref": "#/$defs/node"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var valid interface{}
+	json.Unmarshal([]byte(`{"name":"root","children":[{"name":"a","children":[{"name":"b"}]},{"name":"c","parent":{"name":"p"}}]}`), &valid)
+	if errs := schema.validate(valid); len(errs) != 0 {
+		t.Fatalf("valid tree: %v", errs)
+	}
+
+	var invalid interface{}
+	json.Unmarshal([]byte(`{"name":"root","children":[{"children":[{"name":1}]}]}`), &invalid)
+	errs := schema.validate(invalid)
+	want := []string{"$.children[0]: 缺少必填字段 name", "$.children[0].children[0].name: 类型应为 string，实际为 integer"}
+	if strings.Join(errs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("invalid tree: got %q, want %q", errs, want)
+	}
+}
+
+func TestJSONSchemaDepthLimit(t *testing.T) {
+	schema, err := compileJSONSchema(json.RawMessage(`{"type":"array","items":{"$ref":"#"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	json.Unmarshal([]byte(strings.Repeat("[", 1000)+strings.Repeat("]", 1000)), &value)
+	errs := schema.validate(value)
+	if len(errs) != 1 || !strings.Contains(errs[0], "嵌套层数超过") {
+		t.Fatalf("got %v, want depth error", errs)
+	}
+
+	json.Unmarshal([]byte(`[[[]],[]]`), &value)
+	if errs := schema.validate(value); len(errs) != 0 {
+		t.Fatalf("shallow value: %v", errs)
+	}
+}
@@ -0,0 +1,750 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrKnowledgeBaseNotFound     = errors.New("knowledge base not found")
+	ErrKnowledgeDocumentNotFound = errors.New("knowledge document not found")
+	ErrDocumentTooLarge          = errors.New("document too large")
+	ErrUnsupportedDocument       = errors.New("unsupported document type")
+	ErrEmptyDocument             = errors.New("document has no text")
+	ErrEmbeddingModelChanged     = errors.New("embedding model changed, reindex required")
+)
+
+const knowledgeKeyPrefix = "knowledge/"
+
+// KnowledgeSearchResult 知识库检索结果
+type KnowledgeSearchResult struct {
+	ChunkID    uint    `json:"chunk_id"`
+	DocumentID uint    `json:"document_id"`
+	FileName   string  `json:"file_name"`
+	Seq        int     `json:"seq"`
+	Content    string  `json:"content"`
+	Score      float64 `json:"score"`
+}
+
+// knowledgeChunkSize 文档切块的字符数
+func knowledgeChunkSize() int {
+	if n := config.AppConfig.RAG.ChunkSize; n > 0 {
+		return n
+	}
+	return 800
+}
+
+// knowledgeChunkOverlap 相邻切块重叠的字符数
+func knowledgeChunkOverlap() int {
+	n := config.AppConfig.RAG.ChunkOverlap
+	if n < 0 || n >= knowledgeChunkSize() {
+		return 0
+	}
+	return n
+}
+
+// knowledgeTopK 每次提问检索的切块数量
+func knowledgeTopK() int {
+	if n := config.AppConfig.RAG.TopK; n > 0 {
+		return n
+	}
+	return 5
+}
+
+// KnowledgeDocumentMaxSize 单个文档的大小上限
+func KnowledgeDocumentMaxSize() int64 {
+	if size := config.AppConfig.RAG.DocumentMaxSize; size > 0 {
+		return size
+	}
+	return 20 << 20
+}
+
+// getUserKnowledgeBase 获取用户自己的知识库
+func getUserKnowledgeBase(tx *gorm.DB, userID, knowledgeBaseID uint) (*models.KnowledgeBase, error) {
+	var kb models.KnowledgeBase
+	if err := tx.Where("id = ? AND user_id = ?", knowledgeBaseID, userID).First(&kb).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKnowledgeBaseNotFound
+		}
+		return nil, err
+	}
+	return &kb, nil
+}
+
+// CheckKnowledgeBaseAccess 检查用户是否可以使用知识库，只有创建者可以将知识库关联到会话
+func CheckKnowledgeBaseAccess(userID, knowledgeBaseID uint) error {
+	_, err := getUserKnowledgeBase(database.GetDB(), userID, knowledgeBaseID)
+	return err
+}
+
+// ListKnowledgeBases 获取用户的知识库列表
+func ListKnowledgeBases(userID uint) ([]models.KnowledgeBase, error) {
+	db := database.GetDB()
+	var kbs []models.KnowledgeBase
+	if err := db.Where("user_id = ?", userID).Order("id DESC").Find(&kbs).Error; err != nil {
+		return nil, fmt.Errorf("查询知识库失败: %w", err)
+	}
+	if len(kbs) == 0 {
+		return kbs, nil
+	}
+
+	var counts []struct {
+		KnowledgeBaseID uint
+		Count           int64
+	}
+	if err := db.Model(&models.KnowledgeDocument{}).Select("knowledge_base_id, COUNT(*) AS count").
+		Where("user_id = ?", userID).Group("knowledge_base_id").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("统计知识库文档失败: %w", err)
+	}
+	byKB := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		byKB[count.KnowledgeBaseID] = count.Count
+	}
+	for i := range kbs {
+		kbs[i].DocumentCount = byKB[kbs[i].ID]
+	}
+	return kbs, nil
+}
+
+// CreateKnowledgeBase 创建知识库
+func CreateKnowledgeBase(userID uint, req models.CreateKnowledgeBaseRequest) (*models.KnowledgeBase, error) {
+	kb := models.KnowledgeBase{UserID: userID, Name: req.Name, Description: req.Description}
+	if e := GetEmbedder(); e != nil {
+		kb.EmbeddingModel = e.Name()
+	}
+	if err := database.GetDB().Create(&kb).Error; err != nil {
+		return nil, fmt.Errorf("创建知识库失败: %w", err)
+	}
+	return &kb, nil
+}
+
+// UpdateKnowledgeBase 修改知识库名称和描述
+func UpdateKnowledgeBase(userID, knowledgeBaseID uint, req models.UpdateKnowledgeBaseRequest) (*models.KnowledgeBase, error) {
+	db := database.GetDB()
+	kb, err := getUserKnowledgeBase(db, userID, knowledgeBaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		kb.Name = *req.Name
+		updates["name"] = kb.Name
+	}
+	if req.Description != nil {
+		kb.Description = *req.Description
+		updates["description"] = kb.Description
+	}
+	if len(updates) > 0 {
+		if err := db.Model(kb).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("修改知识库失败: %w", err)
+		}
+	}
+	return kb, nil
+}
+
+// purgeKnowledgeBases 删除知识库及其文档和切块，取消会话和助手的关联，返回需要在事务提交后删除的文件
+// knowledgeBaseIDs 可以是知识库ID列表或子查询
+func purgeKnowledgeBases(tx *gorm.DB, knowledgeBaseIDs interface{}) ([]string, error) {
+	var keys []string
+	if err := tx.Unscoped().Model(&models.KnowledgeDocument{}).
+		Where("knowledge_base_id IN (?)", knowledgeBaseIDs).Pluck("blob_key", &keys).Error; err != nil {
+		return nil, fmt.Errorf("查询知识库文档失败: %w", err)
+	}
+	if err := tx.Unscoped().Model(&models.ChatSession{}).Where("knowledge_base_id IN (?)", knowledgeBaseIDs).
+		Update("knowledge_base_id", nil).Error; err != nil {
+		return nil, fmt.Errorf("取消会话关联失败: %w", err)
+	}
+	if err := tx.Model(&models.AssistantVersion{}).Where("knowledge_base_id IN (?)", knowledgeBaseIDs).
+		Update("knowledge_base_id", nil).Error; err != nil {
+		return nil, fmt.Errorf("取消助手关联失败: %w", err)
+	}
+	if err := tx.Where("knowledge_base_id IN (?)", knowledgeBaseIDs).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+		return nil, fmt.Errorf("删除文档切块失败: %w", err)
+	}
+	if err := tx.Unscoped().Where("knowledge_base_id IN (?)", knowledgeBaseIDs).Delete(&models.KnowledgeDocument{}).Error; err != nil {
+		return nil, fmt.Errorf("删除知识库文档失败: %w", err)
+	}
+	if err := tx.Unscoped().Where("id IN (?)", knowledgeBaseIDs).Delete(&models.KnowledgeBase{}).Error; err != nil {
+		return nil, fmt.Errorf("删除知识库失败: %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteKnowledgeBase 删除知识库及其全部文档，已关联的会话不再检索该知识库
+func DeleteKnowledgeBase(ctx context.Context, userID, knowledgeBaseID uint) error {
+	db := database.GetDB()
+	var keys []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := getUserKnowledgeBase(tx, userID, knowledgeBaseID); err != nil {
+			return err
+		}
+		var err error
+		keys, err = purgeKnowledgeBases(tx, []uint{knowledgeBaseID})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if store := GetVectorStore(); store != nil {
+		if err := store.DeleteKnowledgeBase(ctx, knowledgeBaseID); err != nil {
+			return fmt.Errorf("删除知识库向量失败: %w", err)
+		}
+	}
+	deleteAttachmentBlobs(keys)
+	return nil
+}
+
+// ListKnowledgeDocuments 获取知识库中的文档
+func ListKnowledgeDocuments(userID, knowledgeBaseID uint) ([]models.KnowledgeDocument, error) {
+	db := database.GetDB()
+	if _, err := getUserKnowledgeBase(db, userID, knowledgeBaseID); err != nil {
+		return nil, err
+	}
+	var documents []models.KnowledgeDocument
+	if err := db.Where("knowledge_base_id = ?", knowledgeBaseID).Order("id DESC").Find(&documents).Error; err != nil {
+		return nil, fmt.Errorf("查询知识库文档失败: %w", err)
+	}
+	return documents, nil
+}
+
+// AddKnowledgeDocument 上传文档到知识库，提取文本后切块并向量化
+// 向量化失败时文档保留为失败状态，可以在修复配置后重建索引
+func AddKnowledgeDocument(ctx context.Context, userID, knowledgeBaseID uint, upload AttachmentUpload) (*models.KnowledgeDocument, error) {
+	db := database.GetDB()
+	kb, err := getUserKnowledgeBase(db, userID, knowledgeBaseID)
+	if err != nil {
+		return nil, err
+	}
+	embedder, err := knowledgeBaseEmbedder(kb)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(strings.ReplaceAll(upload.FileName, "\\", "/"))
+	if name == "" || name == "." || name == "/" {
+		return nil, ErrEmptyAttachmentName
+	}
+	if int64(len(upload.Data)) > KnowledgeDocumentMaxSize() {
+		return nil, ErrDocumentTooLarge
+	}
+	name = truncateUTF8(name, 255)
+
+	contentType := http.DetectContentType(upload.Data)
+	text, extracted := extractAttachmentText(name, contentType, upload.Data)
+	if !extracted {
+		return nil, ErrUnsupportedDocument
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, ErrEmptyDocument
+	}
+
+	store := GetBlobStore()
+	if store == nil {
+		return nil, errors.New("未配置文件存储")
+	}
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s%d/%s%s", knowledgeKeyPrefix, kb.ID, hex.EncodeToString(random), strings.ToLower(filepath.Ext(name)))
+	if err := store.Put(ctx, key, upload.Data, contentType); err != nil {
+		return nil, fmt.Errorf("保存文档失败: %w", err)
+	}
+
+	document := models.KnowledgeDocument{
+		KnowledgeBaseID: kb.ID,
+		UserID:          userID,
+		FileName:        name,
+		ContentType:     contentType,
+		Size:            int64(len(upload.Data)),
+		BlobKey:         key,
+		Status:          models.KnowledgeDocumentFailed,
+	}
+	if err := db.Create(&document).Error; err != nil {
+		deleteBlobs(context.Background(), store, []string{key})
+		return nil, fmt.Errorf("保存文档记录失败: %w", err)
+	}
+
+	if err := indexKnowledgeDocument(ctx, embedder, &document, text); err != nil {
+		return &document, err
+	}
+	if kb.EmbeddingModel == "" {
+		db.Model(kb).Update("embedding_model", embedder.Name())
+	}
+	return &document, nil
+}
+
+// knowledgeBaseEmbedder 获取向量化模型，知识库已有向量由其他模型生成时返回 ErrEmbeddingModelChanged
+func knowledgeBaseEmbedder(kb *models.KnowledgeBase) (Embedder, error) {
+	embedder := GetEmbedder()
+	if embedder == nil || GetVectorStore() == nil {
+		return nil, ErrEmbedderNotConfigured
+	}
+	if kb.EmbeddingModel != "" && kb.EmbeddingModel != embedder.Name() {
+		return nil, ErrEmbeddingModelChanged
+	}
+	return embedder, nil
+}
+
+// indexKnowledgeDocument 重新切块并向量化文档，处理结果记录在文档状态中
+func indexKnowledgeDocument(ctx context.Context, embedder Embedder, document *models.KnowledgeDocument, text string) error {
+	db := database.GetDB()
+	vectors := GetVectorStore()
+
+	fail := func(err error) error {
+		document.Status = models.KnowledgeDocumentFailed
+		document.Error = truncateUTF8(err.Error(), 500)
+		document.ChunkCount = 0
+		db.Model(document).Updates(map[string]interface{}{"status": document.Status, "error": document.Error, "chunk_count": 0})
+		return err
+	}
+
+	// 清除上一次的结果
+	if err := vectors.DeleteDocument(ctx, document.ID); err != nil {
+		return fail(fmt.Errorf("删除文档向量失败: %w", err))
+	}
+	if err := db.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+		return fail(fmt.Errorf("删除文档切块失败: %w", err))
+	}
+
+	pieces := chunkText(text, knowledgeChunkSize(), knowledgeChunkOverlap())
+	if len(pieces) == 0 {
+		return fail(ErrEmptyDocument)
+	}
+	embeddings, err := embedInBatches(ctx, embedder, pieces)
+	if err != nil {
+		return fail(fmt.Errorf("文档向量化失败: %w", err))
+	}
+
+	chunks := make([]models.KnowledgeChunk, 0, len(pieces))
+	for i, piece := range pieces {
+		chunks = append(chunks, models.KnowledgeChunk{
+			KnowledgeBaseID: document.KnowledgeBaseID,
+			DocumentID:      document.ID,
+			Seq:             i,
+			Content:         piece,
+		})
+	}
+	if err := db.CreateInBatches(&chunks, 200).Error; err != nil {
+		return fail(fmt.Errorf("保存文档切块失败: %w", err))
+	}
+
+	items := make([]VectorItem, 0, len(chunks))
+	for i, chunk := range chunks {
+		items = append(items, VectorItem{
+			ChunkID:         chunk.ID,
+			KnowledgeBaseID: chunk.KnowledgeBaseID,
+			DocumentID:      chunk.DocumentID,
+			Vector:          embeddings[i],
+		})
+	}
+	if err := vectors.Upsert(ctx, items); err != nil {
+		db.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{})
+		return fail(fmt.Errorf("保存文档向量失败: %w", err))
+	}
+
+	document.Status = models.KnowledgeDocumentReady
+	document.Error = ""
+	document.ChunkCount = len(chunks)
+	return db.Model(document).Updates(map[string]interface{}{
+		"status": document.Status, "error": "", "chunk_count": document.ChunkCount,
+	}).Error
+}
+
+// DeleteKnowledgeDocument 删除知识库中的文档
+func DeleteKnowledgeDocument(ctx context.Context, userID, knowledgeBaseID, documentID uint) error {
+	db := database.GetDB()
+	if _, err := getUserKnowledgeBase(db, userID, knowledgeBaseID); err != nil {
+		return err
+	}
+	var document models.KnowledgeDocument
+	if err := db.Where("id = ? AND knowledge_base_id = ?", documentID, knowledgeBaseID).First(&document).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrKnowledgeDocumentNotFound
+		}
+		return err
+	}
+
+	if store := GetVectorStore(); store != nil {
+		if err := store.DeleteDocument(ctx, document.ID); err != nil {
+			return fmt.Errorf("删除文档向量失败: %w", err)
+		}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&document).Error
+	})
+	if err != nil {
+		return fmt.Errorf("删除文档失败: %w", err)
+	}
+	deleteAttachmentBlobs([]string{document.BlobKey})
+	return nil
+}
+
+// ReindexKnowledgeBase 使用当前的向量化模型和切块设置重新处理知识库的全部文档，返回处理失败的文档数量
+func ReindexKnowledgeBase(ctx context.Context, userID, knowledgeBaseID uint) (*models.KnowledgeBase, int, error) {
+	db := database.GetDB()
+	kb, err := getUserKnowledgeBase(db, userID, knowledgeBaseID)
+	if err != nil {
+		return nil, 0, err
+	}
+	embedder := GetEmbedder()
+	blobs := GetBlobStore()
+	if embedder == nil || GetVectorStore() == nil {
+		return nil, 0, ErrEmbedderNotConfigured
+	}
+	if blobs == nil {
+		return nil, 0, errors.New("未配置文件存储")
+	}
+
+	// 先切换模型标识，失败的文档可以再次重建
+	kb.EmbeddingModel = embedder.Name()
+	if err := db.Model(kb).Update("embedding_model", kb.EmbeddingModel).Error; err != nil {
+		return nil, 0, fmt.Errorf("更新知识库失败: %w", err)
+	}
+
+	var documents []models.KnowledgeDocument
+	if err := db.Where("knowledge_base_id = ?", kb.ID).Order("id").Find(&documents).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询知识库文档失败: %w", err)
+	}
+
+	failed := 0
+	for i := range documents {
+		document := &documents[i]
+		reader, _, err := blobs.Get(ctx, document.BlobKey)
+		if err != nil {
+			indexFailed(document, fmt.Errorf("读取文档失败: %w", err))
+			failed++
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			indexFailed(document, fmt.Errorf("读取文档失败: %w", err))
+			failed++
+			continue
+		}
+		text, _ := extractAttachmentText(document.FileName, document.ContentType, data)
+		if err := indexKnowledgeDocument(ctx, embedder, document, text); err != nil {
+			failed++
+		}
+	}
+	return kb, failed, nil
+}
+
+// indexFailed 记录文档处理失败的原因
+func indexFailed(document *models.KnowledgeDocument, err error) {
+	document.Status = models.KnowledgeDocumentFailed
+	document.Error = truncateUTF8(err.Error(), 500)
+	database.GetDB().Model(document).Updates(map[string]interface{}{"status": document.Status, "error": document.Error})
+}
+
+// matchKnowledgeChunks 将问题向量化后在知识库中检索，返回不低于最小相似度的切块，按相似度从高到低排序
+func matchKnowledgeChunks(ctx context.Context, kb *models.KnowledgeBase, query string, topK int) ([]VectorMatch, error) {
+	embedder, err := knowledgeBaseEmbedder(kb)
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("问题向量化失败: %w", err)
+	}
+	if len(embeddings) != 1 {
+		return nil, errors.New("问题向量化失败")
+	}
+
+	matches, err := GetVectorStore().Search(ctx, kb.ID, embeddings[0], topK)
+	if err != nil {
+		return nil, fmt.Errorf("检索知识库失败: %w", err)
+	}
+	minScore := config.AppConfig.RAG.MinScore
+	filtered := matches[:0]
+	for _, match := range matches {
+		if match.Score >= minScore {
+			filtered = append(filtered, match)
+		}
+	}
+	return filtered, nil
+}
+
+// searchKnowledgeBase 在知识库中检索与问题最相关的切块，低于最小相似度的结果会被过滤
+func searchKnowledgeBase(ctx context.Context, kb *models.KnowledgeBase, query string, topK int) ([]KnowledgeSearchResult, error) {
+	matches, err := matchKnowledgeChunks(ctx, kb, query, topK)
+	if err != nil {
+		return nil, err
+	}
+	chunkIDs := make([]uint, 0, len(matches))
+	for _, match := range matches {
+		chunkIDs = append(chunkIDs, match.ChunkID)
+	}
+	if len(chunkIDs) == 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+
+	var rows []struct {
+		models.KnowledgeChunk
+		FileName string
+	}
+	db := database.GetDB()
+	if err := db.Model(&models.KnowledgeChunk{}).Select("knowledge_chunks.*, knowledge_documents.file_name").
+		Joins("JOIN knowledge_documents ON knowledge_documents.id = knowledge_chunks.document_id AND knowledge_documents.deleted_at IS NULL").
+		Where("knowledge_chunks.id IN ?", chunkIDs).
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("查询文档切块失败: %w", err)
+	}
+	byID := make(map[uint]int, len(rows))
+	for i, row := range rows {
+		byID[row.ID] = i
+	}
+
+	results := make([]KnowledgeSearchResult, 0, len(chunkIDs))
+	for _, match := range matches {
+		i, ok := byID[match.ChunkID]
+		if !ok {
+			continue
+		}
+		results = append(results, KnowledgeSearchResult{
+			ChunkID:    rows[i].ID,
+			DocumentID: rows[i].DocumentID,
+			FileName:   rows[i].FileName,
+			Seq:        rows[i].Seq,
+			Content:    rows[i].Content,
+			Score:      match.Score,
+		})
+	}
+	return results, nil
+}
+
+// SearchKnowledgeBase 在用户自己的知识库中检索，用于调试检索效果
+func SearchKnowledgeBase(ctx context.Context, userID, knowledgeBaseID uint, req models.KnowledgeSearchRequest) ([]KnowledgeSearchResult, error) {
+	kb, err := getUserKnowledgeBase(database.GetDB(), userID, knowledgeBaseID)
+	if err != nil {
+		return nil, err
+	}
+	topK := req.TopK
+	if topK <= 0 {
+		topK = knowledgeTopK()
+	}
+	return searchKnowledgeBase(ctx, kb, req.Query, topK)
+}
+
+// RetrieveSessionKnowledge 在会话关联的知识库中检索与问题相关的片段，会话未关联知识库时返回空
+// 知识库由关联它的用户提供，会话的其他成员提问时同样可以检索
+func RetrieveSessionKnowledge(ctx context.Context, session *models.ChatSession, question string) ([]models.MessageCitation, error) {
+	if session.KnowledgeBaseID == nil {
+		return nil, nil
+	}
+	var kb models.KnowledgeBase
+	if err := database.GetDB().First(&kb, *session.KnowledgeBaseID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	usable, err := knowledgeBaseUsableInSession(&kb, session)
+	if err != nil || !usable {
+		return nil, err
+	}
+
+	results, err := searchKnowledgeBase(ctx, &kb, question, knowledgeTopK())
+	if err != nil {
+		return nil, err
+	}
+	citations := make([]models.MessageCitation, 0, len(results))
+	for i, result := range results {
+		citations = append(citations, models.MessageCitation{
+			Index:           i + 1,
+			KnowledgeBaseID: kb.ID,
+			DocumentID:      result.DocumentID,
+			ChunkID:         result.ChunkID,
+			FileName:        result.FileName,
+			Content:         result.Content,
+			Score:           result.Score,
+		})
+	}
+	return citations, nil
+}
+
+// knowledgeBaseUsableInSession 检查会话关联的知识库当前是否仍可使用
+// 个人会话可以使用自己的知识库，或通过工作区助手关联的知识库；
+// 知识库来自工作区时，其所有者必须仍是该工作区的编辑者或所有者，
+// 否则所有者退出工作区或被降级后，其个人知识库不再向其他成员提供内容
+func knowledgeBaseUsableInSession(kb *models.KnowledgeBase, session *models.ChatSession) (bool, error) {
+	if session.WorkspaceID == nil && kb.UserID == session.UserID {
+		return true, nil
+	}
+
+	workspaceID := session.WorkspaceID
+	if workspaceID == nil {
+		// 个人会话中使用他人的知识库只能来自工作区助手，会话用户也必须仍是该工作区的成员
+		if session.AssistantID == nil {
+			return false, nil
+		}
+		var assistant models.Assistant
+		if err := database.GetDB().Unscoped().Select("workspace_id").First(&assistant, *session.AssistantID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		if assistant.WorkspaceID == nil {
+			return false, nil
+		}
+		workspaceID = assistant.WorkspaceID
+		role, err := GetWorkspaceRole(*workspaceID, session.UserID)
+		if err != nil || role == "" {
+			return false, err
+		}
+	}
+
+	role, err := GetWorkspaceRole(*workspaceID, kb.UserID)
+	if err != nil {
+		return false, err
+	}
+	return workspaceRoleRank[role] >= workspaceRoleRank[models.WorkspaceRoleEditor], nil
+}
+
+// BuildKnowledgePrompt 将检索到的片段作为参考资料放在问题之前，并要求模型按编号标注引用
+func BuildKnowledgePrompt(citations []models.MessageCitation, question string) string {
+	if len(citations) == 0 {
+		return question
+	}
+
+	var builder strings.Builder
+	builder.WriteString("以下是从知识库中检索到的参考资料。请优先依据这些资料回答，引用时在句末用 [编号] 标注来源；资料中没有相关内容时请说明。\n\n")
+	for _, citation := range citations {
+		fmt.Fprintf(&builder, "<source id=\"%d\" file=\"%s\">\n", citation.Index, citation.FileName)
+		builder.WriteString(citation.Content)
+		builder.WriteString("\n</source>\n\n")
+	}
+	builder.WriteString("用户的问题：\n")
+	builder.WriteString(question)
+	return builder.String()
+}
+
+// SaveMessageCitations 保存回答某个版本引用的知识库片段
+func SaveMessageCitations(sessionID, messageID string, version int, citations []models.MessageCitation) error {
+	if len(citations) == 0 {
+		return nil
+	}
+	for i := range citations {
+		citations[i].SessionID = sessionID
+		citations[i].MessageID = messageID
+		citations[i].Version = version
+	}
+	return database.GetDB().Create(&citations).Error
+}
+
+// loadMessageCitations 批量加载AI回答及其替代版本引用的知识库片段
+func loadMessageCitations(messages []models.ChatMessage) error {
+	messageIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == "ai" {
+			messageIDs = append(messageIDs, message.MessageID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	var citations []models.MessageCitation
+	if err := database.GetDB().Where("message_id IN ?", messageIDs).Order("id").Find(&citations).Error; err != nil {
+		return err
+	}
+	if len(citations) == 0 {
+		return nil
+	}
+	type versionKey struct {
+		messageID string
+		version   int
+	}
+	byVersion := make(map[versionKey][]models.MessageCitation)
+	for _, citation := range citations {
+		key := versionKey{citation.MessageID, citation.Version}
+		byVersion[key] = append(byVersion[key], citation)
+	}
+	for i := range messages {
+		if messages[i].Role != "ai" {
+			continue
+		}
+		messages[i].Citations = byVersion[versionKey{messages[i].MessageID, messages[i].Version}]
+		for j := range messages[i].AlternativeResponses {
+			response := &messages[i].AlternativeResponses[j]
+			response.Citations = byVersion[versionKey{response.MessageID, response.Version}]
+		}
+	}
+	return nil
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// chunkText 按字符数切分文本，尽量在段落、换行、句子或空格处断开，相邻切块保留 overlap 个字符的重叠
+func chunkText(text string, size, overlap int) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) == 0 || size <= 0 {
+		return nil
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else {
+			end = chunkBreak(runes, start, end)
+		}
+
+		if piece := strings.TrimSpace(string(runes[start:end])); piece != "" {
+			chunks = append(chunks, piece)
+		}
+		if end == len(runes) {
+			break
+		}
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// chunkBreak 在切块的后半段寻找合适的断开位置，找不到时在 end 处断开
+func chunkBreak(runes []rune, start, end int) int {
+	lower := start + (end-start)/2
+	for _, isBreak := range []func(i int) bool{
+		func(i int) bool { return i >= 2 && runes[i-1] == '\n' && runes[i-2] == '\n' },
+		func(i int) bool { return runes[i-1] == '\n' },
+		func(i int) bool { return strings.ContainsRune("。！？；.!?;", runes[i-1]) },
+		func(i int) bool { return runes[i-1] == ' ' || runes[i-1] == '\t' },
+	} {
+		for i := end; i > lower; i-- {
+			if isBreak(i) {
+				return i
+			}
+		}
+	}
+	return end
+}
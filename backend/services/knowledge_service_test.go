@@ -0,0 +1,208 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/models"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKnowledgeChunk 测试用的知识库切块
+type testKnowledgeChunk struct {
+	id              uint
+	knowledgeBaseID uint
+	documentID      uint
+	content         string
+}
+
+// setupTestKnowledge 使用特征哈希向量化模型和内存向量存储，写入切块的向量
+func setupTestKnowledge(t *testing.T, minScore float64, chunks []testKnowledgeChunk) *HashEmbedder {
+	t.Helper()
+	prev := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = prev })
+	config.AppConfig = &config.Config{}
+	config.AppConfig.RAG.MinScore = minScore
+
+	prevEmbedder, prevStore := GetEmbedder(), GetVectorStore()
+	t.Cleanup(func() {
+		SetEmbedder(prevEmbedder)
+		SetVectorStore(prevStore)
+	})
+	embedder := NewHashEmbedder(1024)
+	store := NewMemoryVectorStore()
+	SetEmbedder(embedder)
+	SetVectorStore(store)
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.content
+	}
+	vectors, err := embedder.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]VectorItem, len(chunks))
+	for i, chunk := range chunks {
+		items[i] = VectorItem{ChunkID: chunk.id, KnowledgeBaseID: chunk.knowledgeBaseID, DocumentID: chunk.documentID, Vector: vectors[i]}
+	}
+	if err := store.Upsert(context.Background(), items); err != nil {
+		t.Fatal(err)
+	}
+	return embedder
+}
+
+// testKnowledgeBase 创建测试用的知识库
+func testKnowledgeBase(id uint, embeddingModel string) *models.KnowledgeBase {
+	kb := &models.KnowledgeBase{EmbeddingModel: embeddingModel}
+	kb.ID = id
+	return kb
+}
+
+// matchedChunkIDs 返回检索结果的切块ID
+func matchedChunkIDs(matches []VectorMatch) []uint {
+	ids := make([]uint, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ChunkID
+	}
+	return ids
+}
+
+func TestKnowledgeRetrievalRanking(t *testing.T) {
+	embedder := setupTestKnowledge(t, 0.1, []testKnowledgeChunk{
+		{1, 1, 10, "报销流程：差旅费用需要在出差结束后十五天内提交报销单，并附上发票。"},
+		{2, 1, 10, "年假制度：员工入职满一年后每年享有十天带薪年假。"},
+		{3, 1, 11, "The VPN must be enabled before accessing the internal wiki from home."},
+	})
+	kb := testKnowledgeBase(1, embedder.Name())
+	ctx := context.Background()
+
+	tests := []struct {
+		query string
+		want  uint
+	}{
+		{"差旅报销需要提交发票吗", 1},
+		{"年假有几天", 2},
+		{"how do I access the internal wiki from home", 3},
+	}
+	for _, tt := range tests {
+		matches, err := matchKnowledgeChunks(ctx, kb, tt.query, 3)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if len(matches) == 0 || matches[0].ChunkID != tt.want {
+			t.Fatalf("%q: got %v, want chunk %d first", tt.query, matchedChunkIDs(matches), tt.want)
+		}
+		for i := 1; i < len(matches); i++ {
+			if matches[i].Score > matches[i-1].Score {
+				t.Fatalf("%q: results not sorted by score: %+v", tt.query, matches)
+			}
+		}
+	}
+
+	// 与知识库内容无关的问题不返回任何片段
+	matches, err := matchKnowledgeChunks(ctx, kb, "quantum chromodynamics lattice", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("unrelated query: got %v, want none", matchedChunkIDs(matches))
+	}
+
+	// topK 限制返回数量
+	config.AppConfig.RAG.MinScore = -1
+	matches, err = matchKnowledgeChunks(ctx, kb, "报销", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("topK: got %d results, want 2", len(matches))
+	}
+}
+
+func TestKnowledgeRetrievalIsolation(t *testing.T) {
+	// 其他用户的知识库中有与问题完全相同的内容，不设最小相似度
+	embedder := setupTestKnowledge(t, -1, []testKnowledgeChunk{
+		{1, 1, 10, "报销流程：差旅费用需要在出差结束后十五天内提交报销单。"},
+		{2, 2, 20, "机密：下季度裁员名单"},
+		{3, 2, 20, "下季度裁员名单有哪些人"},
+	})
+	ctx := context.Background()
+
+	own := testKnowledgeBase(1, embedder.Name())
+	matches, err := matchKnowledgeChunks(ctx, own, "下季度裁员名单有哪些人", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := matchedChunkIDs(matches); len(ids) != 1 || ids[0] != 1 {
+		t.Fatalf("search in knowledge base 1: got chunks %v, want only [1]", ids)
+	}
+
+	// 删除文档和知识库后不再返回其中的切块
+	other := testKnowledgeBase(2, embedder.Name())
+	if err := GetVectorStore().DeleteDocument(ctx, 20); err != nil {
+		t.Fatal(err)
+	}
+	if matches, err = matchKnowledgeChunks(ctx, other, "下季度裁员名单", 5); err != nil || len(matches) != 0 {
+		t.Fatalf("after DeleteDocument: got %v, %v", matchedChunkIDs(matches), err)
+	}
+	if err := GetVectorStore().DeleteKnowledgeBase(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if matches, err = matchKnowledgeChunks(ctx, own, "差旅报销", 5); err != nil || len(matches) != 0 {
+		t.Fatalf("after DeleteKnowledgeBase: got %v, %v", matchedChunkIDs(matches), err)
+	}
+}
+
+func TestKnowledgeRetrievalEmbedderChanged(t *testing.T) {
+	setupTestKnowledge(t, 0, []testKnowledgeChunk{{1, 1, 10, "报销流程"}})
+
+	// 已有向量由其他模型生成时不能直接比较
+	kb := testKnowledgeBase(1, "openai:text-embedding-3-small")
+	if _, err := matchKnowledgeChunks(context.Background(), kb, "报销", 3); !errors.Is(err, ErrEmbeddingModelChanged) {
+		t.Fatalf("got %v, want ErrEmbeddingModelChanged", err)
+	}
+
+	SetEmbedder(nil)
+	if _, err := matchKnowledgeChunks(context.Background(), kb, "报销", 3); !errors.Is(err, ErrEmbedderNotConfigured) {
+		t.Fatalf("got %v, want ErrEmbedderNotConfigured", err)
+	}
+}
+
+func TestHashEmbedderDeterministic(t *testing.T) {
+	embedder := NewHashEmbedder(64)
+	ctx := context.Background()
+	a, err := embedder.Embed(ctx, []string{"知识库检索 Retrieval"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := embedder.Embed(ctx, []string{"知识库检索 retrieval"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range a[0] {
+		if a[0][i] != b[0][i] {
+			t.Fatalf("vectors differ at %d: %v vs %v", i, a[0][i], b[0][i])
+		}
+	}
+	if norm := vectorNorm(a[0]); norm < 0.999 || norm > 1.001 {
+		t.Fatalf("vector not normalized: %v", norm)
+	}
+}
+
+func TestChunkTextOverlap(t *testing.T) {
+	text := strings.Repeat("第一段内容。", 20) + "\n\n" + strings.Repeat("second paragraph. ", 20)
+	chunks := chunkText(text, 50, 10)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := len([]rune(chunk)); n > 50 {
+			t.Fatalf("chunk %d has %d runes, want <= 50", i, n)
+		}
+	}
+	if !strings.Contains(strings.Join(chunks, ""), "second paragraph.") {
+		t.Fatal("text lost while chunking")
+	}
+}
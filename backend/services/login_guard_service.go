@@ -0,0 +1,217 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrAccountLocked 账号因连续登录失败被临时锁定错误
+	ErrAccountLocked = errors.New("account is temporarily locked")
+
+	// ErrIPLocked IP因连续登录失败被临时限制错误
+	ErrIPLocked = errors.New("too many failed login attempts from this ip")
+)
+
+// LockoutError 登录锁定错误，携带剩余锁定时长
+type LockoutError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+// Error 实现error接口
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", e.Err, e.RetryAfter.Round(time.Second))
+}
+
+// Unwrap 支持errors.Is判断具体的锁定类型
+func (e *LockoutError) Unwrap() error {
+	return e.Err
+}
+
+// loginProtectionSettings 返回填充了默认值的登录保护配置
+func loginProtectionSettings() config.LoginProtectionConfig {
+	cfg := config.AppConfig.Security.Login
+	if cfg.AccountMaxFailures <= 0 {
+		cfg.AccountMaxFailures = 5
+	}
+	if cfg.IPMaxFailures <= 0 {
+		cfg.IPMaxFailures = 20
+	}
+	if cfg.FailureWindow <= 0 {
+		cfg.FailureWindow = 15
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = 15
+	}
+	if cfg.DelayBase < 0 {
+		cfg.DelayBase = 0
+	}
+	if cfg.DelayMax <= 0 {
+		cfg.DelayMax = 3000
+	}
+	return cfg
+}
+
+// normalizeLoginAccount 统一账号格式，避免大小写或空格绕过计数
+func normalizeLoginAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+// CheckLoginAllowed 检查账号和IP当前是否允许尝试登录
+func CheckLoginAllowed(account, ip string) error {
+	db := database.GetDB()
+	now := time.Now()
+
+	var records []models.LoginFailure
+	err := db.Where("(scope = ? AND identifier = ?) OR (scope = ? AND identifier = ?)",
+		models.LoginFailureScopeAccount, normalizeLoginAccount(account),
+		models.LoginFailureScopeIP, ip).
+		Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.LockedUntil == nil || !record.LockedUntil.After(now) {
+			continue
+		}
+		lockErr := ErrAccountLocked
+		if record.Scope == models.LoginFailureScopeIP {
+			lockErr = ErrIPLocked
+		}
+		return &LockoutError{Err: lockErr, RetryAfter: record.LockedUntil.Sub(now)}
+	}
+
+	return nil
+}
+
+// RecordLoginFailure 记录一次登录失败，返回本次应施加的延迟
+func RecordLoginFailure(account, ip string) (time.Duration, error) {
+	cfg := loginProtectionSettings()
+
+	accountFailures, err := incrementLoginFailure(models.LoginFailureScopeAccount, normalizeLoginAccount(account), cfg.AccountMaxFailures, cfg)
+	if err != nil {
+		return 0, err
+	}
+	ipFailures, err := incrementLoginFailure(models.LoginFailureScopeIP, ip, cfg.IPMaxFailures, cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	failures := accountFailures
+	if ipFailures > failures {
+		failures = ipFailures
+	}
+	return loginFailureDelay(failures, cfg), nil
+}
+
+// loginFailureDelay 按失败次数指数递增的延迟，不超过配置的最大值
+func loginFailureDelay(failures int, cfg config.LoginProtectionConfig) time.Duration {
+	if failures <= 0 || cfg.DelayBase == 0 {
+		return 0
+	}
+	delay := cfg.DelayBase
+	for i := 1; i < failures && delay < cfg.DelayMax; i++ {
+		delay *= 2
+	}
+	if delay > cfg.DelayMax {
+		delay = cfg.DelayMax
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+// incrementLoginFailure 增加指定维度的失败计数，达到阈值时锁定
+func incrementLoginFailure(scope, identifier string, maxFailures int, cfg config.LoginProtectionConfig) (int, error) {
+	if identifier == "" {
+		return 0, nil
+	}
+
+	db := database.GetDB()
+	now := time.Now()
+	var failures int
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 首次失败时并发请求可能同时插入，使用 ON DUPLICATE KEY UPDATE 保证记录存在并加行锁，
+		// 之后的读取和更新都在锁内进行
+		initial := models.LoginFailure{
+			Scope:          scope,
+			Identifier:     identifier,
+			FirstFailureAt: now,
+			LastFailureAt:  now,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{"deleted_at": nil}),
+		}).Create(&initial).Error; err != nil {
+			return err
+		}
+		var record models.LoginFailure
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("scope = ? AND identifier = ?", scope, identifier).
+			First(&record).Error; err != nil {
+			return err
+		}
+
+		// 超出统计窗口或锁定已过期时重新计数
+		window := time.Duration(cfg.FailureWindow) * time.Minute
+		expired := record.LockedUntil != nil && !record.LockedUntil.After(now)
+		if now.Sub(record.LastFailureAt) > window || expired {
+			record.Failures = 0
+			record.FirstFailureAt = now
+			record.LockedUntil = nil
+		}
+
+		record.Failures++
+		record.LastFailureAt = now
+		if record.Failures >= maxFailures {
+			lockedUntil := now.Add(time.Duration(cfg.LockoutDuration) * time.Minute)
+			record.LockedUntil = &lockedUntil
+		}
+		failures = record.Failures
+
+		return tx.Save(&record).Error
+	})
+
+	return failures, err
+}
+
+// ResetLoginFailures 登录成功后清除账号的失败计数
+// IP维度的计数不清除，避免攻击者用自己的账号登录来重置计数
+func ResetLoginFailures(account string) error {
+	db := database.GetDB()
+	return db.Unscoped().
+		Where("scope = ? AND identifier = ?", models.LoginFailureScopeAccount, normalizeLoginAccount(account)).
+		Delete(&models.LoginFailure{}).Error
+}
+
+// UnlockLogin 管理员解除账号或IP的登录锁定
+func UnlockLogin(scope, identifier string) error {
+	if scope == models.LoginFailureScopeAccount {
+		identifier = normalizeLoginAccount(identifier)
+	}
+	db := database.GetDB()
+	return db.Unscoped().
+		Where("scope = ? AND identifier = ?", scope, identifier).
+		Delete(&models.LoginFailure{}).Error
+}
+
+// GetActiveLoginLocks 获取当前处于锁定状态的账号和IP
+func GetActiveLoginLocks() ([]models.LoginFailure, error) {
+	db := database.GetDB()
+	var records []models.LoginFailure
+	err := db.Where("locked_until > ?", time.Now()).
+		Order("locked_until DESC").
+		Find(&records).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询登录锁定失败: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	mcpProtocolVersion = "2025-03-26"
+	mcpMessageMaxBytes = 16 << 20 // stdio 单条消息的上限
+)
+
+var (
+	// ErrMCPClosed MCP连接已断开错误
+	ErrMCPClosed = errors.New("mcp connection closed")
+
+	// errMCPSessionExpired HTTP 服务器不再认可会话，需要重新初始化
+	errMCPSessionExpired = errors.New("mcp session expired")
+)
+
+// jsonRPCMessage JSON-RPC 2.0 消息，请求、响应和通知共用
+type jsonRPCMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+// JSONRPCError JSON-RPC 错误，表示服务器已处理请求但返回失败
+type JSONRPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *JSONRPCError) Error() string {
+	return fmt.Sprintf("MCP错误 %d: %s", e.Code, e.Message)
+}
+
+// mcpTransport MCP传输层
+type mcpTransport interface {
+	// call 发送请求并等待响应，result 为 nil 时忽略结果
+	call(ctx context.Context, method string, params interface{}, result interface{}) error
+	// notify 发送不需要响应的通知
+	notify(ctx context.Context, method string, params interface{}) error
+	close() error
+}
+
+// decodeRPCResult 解析响应结果
+func decodeRPCResult(msg *jsonRPCMessage, result interface{}) error {
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if result == nil || len(msg.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// rpcID 解析数字形式的消息ID，不是数字时返回 false
+func rpcID(raw json.RawMessage) (int64, bool) {
+	var id int64
+	if len(raw) == 0 || json.Unmarshal(raw, &id) != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// mcpStdioTransport 通过子进程的标准输入输出通信，每行一条JSON消息
+type mcpStdioTransport struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	nextID  int64
+
+	mu      sync.Mutex
+	pending map[int64]chan *jsonRPCMessage
+	done    chan struct{}
+	err     error
+}
+
+// startMCPStdio 启动MCP服务器子进程
+func startMCPStdio(cfg config.MCPServerConfig) (*mcpStdioTransport, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("MCP服务器 %s 未配置 command", cfg.Name)
+	}
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for key, value := range cfg.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stderr = &mcpLogWriter{name: cfg.Name}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动MCP服务器 %s 失败: %w", cfg.Name, err)
+	}
+
+	t := &mcpStdioTransport{
+		name:    cfg.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan *jsonRPCMessage),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+// readLoop 读取子进程输出，将响应分发给等待中的请求
+func (t *mcpStdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), mcpMessageMaxBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg jsonRPCMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("MCP服务器 %s 输出了无法解析的消息: %v", t.name, err)
+			continue
+		}
+		if msg.Method != "" {
+			// 服务器发来的请求只支持 ping，通知直接忽略
+			if len(msg.ID) > 0 {
+				t.replyServerRequest(&msg)
+			}
+			continue
+		}
+		id, ok := rpcID(msg.ID)
+		if !ok {
+			continue
+		}
+		t.mu.Lock()
+		ch := t.pending[id]
+		delete(t.pending, id)
+		t.mu.Unlock()
+		if ch != nil {
+			ch <- &msg
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = ErrMCPClosed
+	}
+	t.mu.Lock()
+	t.err = err
+	t.pending = map[int64]chan *jsonRPCMessage{}
+	t.mu.Unlock()
+	close(t.done)
+	t.cmd.Wait()
+}
+
+// replyServerRequest 响应服务器发来的请求
+func (t *mcpStdioTransport) replyServerRequest(msg *jsonRPCMessage) {
+	reply := jsonRPCMessage{JSONRPC: "2.0", ID: msg.ID}
+	if msg.Method == "ping" {
+		reply.Result = json.RawMessage("{}")
+	} else {
+		reply.Error = &JSONRPCError{Code: -32601, Message: "method not found"}
+	}
+	t.write(&reply)
+}
+
+// write 写入一行消息
+func (t *mcpStdioTransport) write(msg *jsonRPCMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *mcpStdioTransport) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := atomic.AddInt64(&t.nextID, 1)
+	ch := make(chan *jsonRPCMessage, 1)
+
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return t.err
+	}
+	t.pending[id] = ch
+	t.mu.Unlock()
+
+	rawID, _ := json.Marshal(id)
+	if err := t.write(&jsonRPCMessage{JSONRPC: "2.0", ID: rawID, Method: method, Params: params}); err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return fmt.Errorf("%w: %v", ErrMCPClosed, err)
+	}
+
+	select {
+	case msg := <-ch:
+		return decodeRPCResult(msg, result)
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (t *mcpStdioTransport) notify(ctx context.Context, method string, params interface{}) error {
+	return t.write(&jsonRPCMessage{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// close 关闭标准输入让服务器退出，超时后强制结束进程
+func (t *mcpStdioTransport) close() error {
+	t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(3 * time.Second):
+		if t.cmd.Process != nil {
+			t.cmd.Process.Kill()
+		}
+	}
+	return nil
+}
+
+// mcpLogWriter 将子进程的错误输出写入日志
+type mcpLogWriter struct {
+	name string
+}
+
+func (w *mcpLogWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		log.Printf("[mcp:%s] %s", w.name, line)
+	}
+	return len(p), nil
+}
+
+// mcpHTTPTransport streamable HTTP 传输，每个请求单独 POST，响应可以是JSON或SSE流
+type mcpHTTPTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	nextID  int64
+
+	mu        sync.Mutex
+	sessionID string // 服务器在初始化时分配的会话ID
+}
+
+// newMCPHTTP 创建 streamable HTTP 传输
+func newMCPHTTP(cfg config.MCPServerConfig, client *http.Client) (*mcpHTTPTransport, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("MCP服务器 %s 未配置 url", cfg.Name)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 120 * time.Second}
+	}
+	return &mcpHTTPTransport{url: cfg.URL, headers: cfg.Headers, client: client}, nil
+}
+
+// post 发送一条消息，返回的响应由调用方关闭
+func (t *mcpHTTPTransport) post(ctx context.Context, msg *jsonRPCMessage) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	req.Header.Set("MCP-Protocol-Version", mcpProtocolVersion)
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMCPClosed, err)
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+		resp.Body.Close()
+		return nil, errMCPSessionExpired
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: 状态码 %d, 响应: %s", ErrMCPClosed, resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (t *mcpHTTPTransport) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := atomic.AddInt64(&t.nextID, 1)
+	rawID, _ := json.Marshal(id)
+	resp, err := t.post(ctx, &jsonRPCMessage{JSONRPC: "2.0", ID: rawID, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var msg jsonRPCMessage
+		if err := json.NewDecoder(io.LimitReader(resp.Body, mcpMessageMaxBytes)).Decode(&msg); err != nil {
+			return fmt.Errorf("解析MCP响应失败: %w", err)
+		}
+		return decodeRPCResult(&msg, result)
+	}
+
+	// SSE 流中可能先有服务器的通知，找到与请求ID对应的响应为止
+	reader := bufio.NewReader(resp.Body)
+	var data strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		} else if line == "" && data.Len() > 0 {
+			var msg jsonRPCMessage
+			if json.Unmarshal([]byte(data.String()), &msg) == nil && msg.Method == "" {
+				if got, ok := rpcID(msg.ID); ok && got == id {
+					return decodeRPCResult(&msg, result)
+				}
+			}
+			data.Reset()
+		}
+		if err != nil {
+			return fmt.Errorf("%w: 响应流在返回结果前结束", ErrMCPClosed)
+		}
+	}
+}
+
+func (t *mcpHTTPTransport) notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := t.post(ctx, &jsonRPCMessage{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// close 通知服务器结束会话
+func (t *mcpHTTPTransport) close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "DELETE", t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// MCPTool MCP服务器提供的工具
+type MCPTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+// mcpClient 已完成初始化的MCP连接
+type mcpClient struct {
+	name      string
+	transport mcpTransport
+	tools     []MCPTool
+}
+
+// connectMCPServer 连接MCP服务器，完成初始化并获取工具列表
+func connectMCPServer(ctx context.Context, cfg config.MCPServerConfig, httpClient *http.Client) (*mcpClient, error) {
+	var transport mcpTransport
+	var err error
+	switch cfg.Transport {
+	case "stdio":
+		transport, err = startMCPStdio(cfg)
+	case "http":
+		transport, err = newMCPHTTP(cfg, httpClient)
+	default:
+		err = fmt.Errorf("MCP服务器 %s 的 transport 不支持: %s", cfg.Name, cfg.Transport)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &mcpClient{name: cfg.Name, transport: transport}
+	if err := client.initialize(ctx); err != nil {
+		transport.close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// initialize 协商协议版本并获取工具列表
+func (c *mcpClient) initialize(ctx context.Context) error {
+	params := map[string]interface{}{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "aiChat", "version": "1.0.0"},
+	}
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Capabilities    struct {
+			Tools *json.RawMessage `json:"tools"`
+		} `json:"capabilities"`
+	}
+	if err := c.transport.call(ctx, "initialize", params, &result); err != nil {
+		return fmt.Errorf("初始化MCP服务器 %s 失败: %w", c.name, err)
+	}
+	if err := c.transport.notify(ctx, "notifications/initialized", nil); err != nil {
+		return fmt.Errorf("初始化MCP服务器 %s 失败: %w", c.name, err)
+	}
+	if result.Capabilities.Tools == nil {
+		return nil
+	}
+
+	// 工具列表可能分页返回
+	cursor := ""
+	for page := 0; page < 100; page++ {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var list struct {
+			Tools      []MCPTool `json:"tools"`
+			NextCursor string    `json:"nextCursor"`
+		}
+		if err := c.transport.call(ctx, "tools/list", params, &list); err != nil {
+			return fmt.Errorf("获取MCP服务器 %s 的工具失败: %w", c.name, err)
+		}
+		c.tools = append(c.tools, list.Tools...)
+		if list.NextCursor == "" {
+			break
+		}
+		cursor = list.NextCursor
+	}
+	return nil
+}
+
+// callTool 调用工具并将返回的内容转换为文本，工具返回 isError 时作为错误返回
+func (c *mcpClient) callTool(ctx context.Context, name string, arguments json.RawMessage) (string, error) {
+	var result struct {
+		Content []struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			MimeType string `json:"mimeType"`
+			Resource *struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"resource"`
+		} `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent"`
+		IsError           bool            `json:"isError"`
+	}
+	params := map[string]interface{}{"name": name, "arguments": arguments}
+	if err := c.transport.call(ctx, "tools/call", params, &result); err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, len(result.Content))
+	for _, item := range result.Content {
+		switch item.Type {
+		case "text":
+			parts = append(parts, item.Text)
+		case "resource":
+			if item.Resource != nil && item.Resource.Text != "" {
+				parts = append(parts, item.Resource.Text)
+			} else if item.Resource != nil {
+				parts = append(parts, "[资源] "+item.Resource.URI)
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s %s]", item.Type, item.MimeType))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if text == "" && len(result.StructuredContent) > 0 {
+		text = string(result.StructuredContent)
+	}
+	if result.IsError {
+		return "", errors.New(text)
+	}
+	return text, nil
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mcpFixtureReply 测试用MCP服务器对请求的响应，通知返回 nil
+func mcpFixtureReply(msg *jsonRPCMessage) *jsonRPCMessage {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+	reply := &jsonRPCMessage{JSONRPC: "2.0", ID: msg.ID}
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "fixture", "version": "1.0.0"},
+		}
+	case "tools/list":
+		// 分两页返回，覆盖分页逻辑
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		data, _ := json.Marshal(msg.Params)
+		json.Unmarshal(data, &params)
+		if params.Cursor == "" {
+			result = map[string]interface{}{
+				"tools":      []MCPTool{{Name: "echo", Description: "返回输入的文本", InputSchema: json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}}}`)}},
+				"nextCursor": "page2",
+			}
+		} else {
+			result = map[string]interface{}{"tools": []MCPTool{{Name: "fail"}}}
+		}
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		data, _ := json.Marshal(msg.Params)
+		json.Unmarshal(data, &params)
+		content := []map[string]string{{"type": "text", "text": "echo: " + params.Arguments.Text}}
+		result = map[string]interface{}{"content": content, "isError": params.Name == "fail"}
+	default:
+		reply.Error = &JSONRPCError{Code: -32601, Message: "method not found"}
+		return reply
+	}
+	reply.Result, _ = json.Marshal(result)
+	return reply
+}
+
+// mcpHTTPFixture 测试用的 streamable HTTP MCP服务器
+type mcpHTTPFixture struct {
+	server      *httptest.Server
+	initialized int32
+	// 为 true 时以SSE流返回响应
+	sse bool
+	// initialize 请求在收到 release 之前不返回，用于模拟缓慢的连接
+	release chan struct{}
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	nextID   int
+}
+
+func newMCPHTTPFixture(t *testing.T) *mcpHTTPFixture {
+	f := &mcpHTTPFixture{sessions: make(map[string]bool)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *mcpHTTPFixture) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.Header.Get("Mcp-Session-Id")
+	if r.Method == http.MethodDelete {
+		f.expire(sessionID)
+		return
+	}
+
+	var msg jsonRPCMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg.Method == "initialize" {
+		atomic.AddInt32(&f.initialized, 1)
+		if f.release != nil {
+			<-f.release
+		}
+		f.mu.Lock()
+		f.nextID++
+		sessionID = fmt.Sprintf("session-%d", f.nextID)
+		f.sessions[sessionID] = true
+		f.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", sessionID)
+	} else {
+		f.mu.Lock()
+		ok := f.sessions[sessionID]
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	reply := mcpFixtureReply(&msg)
+	if reply == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	data, _ := json.Marshal(reply)
+	if f.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 响应之前先发送一条服务器通知
+		fmt.Fprintf(w, "data: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// expire 让服务器不再认可会话
+func (f *mcpHTTPFixture) expire(sessionID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, sessionID)
+}
+
+// expireAll 让服务器不再认可所有会话
+func (f *mcpHTTPFixture) expireAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sessions = make(map[string]bool)
+}
+
+func (f *mcpHTTPFixture) config() config.MCPServerConfig {
+	return config.MCPServerConfig{Name: "fixture", Transport: "http", URL: f.server.URL}
+}
+
+// mcpToolNames 返回工具名称
+func mcpToolNames(tools []MCPTool) []string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Name
+	}
+	return names
+}
+
+func TestMCPHTTPClient(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sse=%v", sse), func(t *testing.T) {
+			fixture := newMCPHTTPFixture(t)
+			fixture.sse = sse
+			ctx := context.Background()
+
+			client, err := connectMCPServer(ctx, fixture.config(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.transport.close()
+			if names := strings.Join(mcpToolNames(client.tools), ","); names != "echo,fail" {
+				t.Fatalf("tools: got %s, want echo,fail", names)
+			}
+
+			text, err := client.callTool(ctx, "echo", json.RawMessage(`{"text":"你好"}`))
+			if err != nil || text != "echo: 你好" {
+				t.Fatalf("echo: got %q, %v", text, err)
+			}
+			if _, err := client.callTool(ctx, "fail", json.RawMessage(`{"text":"x"}`)); err == nil || err.Error() != "echo: x" {
+				t.Fatalf("fail: got %v, want tool error", err)
+			}
+		})
+	}
+}
+
+func TestMCPServerReconnectsExpiredSession(t *testing.T) {
+	fixture := newMCPHTTPFixture(t)
+	server := &mcpServer{cfg: fixture.config()}
+	defer server.disconnect()
+	ctx := context.Background()
+
+	if text, err := server.callTool(ctx, "echo", json.RawMessage(`{"text":"a"}`)); err != nil || text != "echo: a" {
+		t.Fatalf("first call: got %q, %v", text, err)
+	}
+	// 服务器丢失会话后重新初始化并重试
+	fixture.expireAll()
+	if text, err := server.callTool(ctx, "echo", json.RawMessage(`{"text":"b"}`)); err != nil || text != "echo: b" {
+		t.Fatalf("after expiry: got %q, %v", text, err)
+	}
+	if n := atomic.LoadInt32(&fixture.initialized); n != 2 {
+		t.Fatalf("initialize called %d times, want 2", n)
+	}
+
+	// 工具列表使用缓存，连接断开后不重新连接
+	server.disconnect()
+	tools, err := server.sessionTools(ctx)
+	if err != nil || len(tools) != 2 {
+		t.Fatalf("cached tools: got %v, %v", mcpToolNames(tools), err)
+	}
+	if n := atomic.LoadInt32(&fixture.initialized); n != 2 {
+		t.Fatalf("sessionTools reconnected: initialize called %d times", n)
+	}
+}
+
+func TestMCPServerConnectDoesNotHoldLock(t *testing.T) {
+	fixture := newMCPHTTPFixture(t)
+	fixture.release = make(chan struct{})
+	server := &mcpServer{cfg: fixture.config()}
+	defer server.disconnect()
+
+	// 并发的连接请求共用一次连接
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := server.connect(context.Background())
+			errs <- err
+		}()
+	}
+	for atomic.LoadInt32(&fixture.initialized) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 连接过程中查询状态不被阻塞，等待连接的调用可以单独取消
+	done := make(chan struct{})
+	go func() {
+		server.status()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("status blocked while connecting")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := server.connect(ctx); err != context.Canceled {
+		t.Fatalf("canceled connect: got %v, want context.Canceled", err)
+	}
+
+	close(fixture.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&fixture.initialized); n != 1 {
+		t.Fatalf("initialize called %d times, want 1", n)
+	}
+}
+
+func TestMCPServerConnectFailureBacksOff(t *testing.T) {
+	fixture := newMCPHTTPFixture(t)
+	fixture.server.Close()
+	server := &mcpServer{cfg: fixture.config()}
+
+	if _, err := server.connect(context.Background()); err == nil {
+		t.Fatal("connect to closed server succeeded")
+	}
+	if _, err := server.sessionTools(context.Background()); err == nil {
+		t.Fatal("sessionTools succeeded without a connection")
+	}
+	if server.retryAt.IsZero() {
+		t.Fatal("retry time not set after failure")
+	}
+}
+
+// TestMCPFixtureProcess 作为 stdio MCP服务器运行的子进程，仅在 TestMCPStdioClient 中启动
+func TestMCPFixtureProcess(t *testing.T) {
+	if os.Getenv("AICHAT_MCP_FIXTURE") != "1" {
+		t.Skip("helper process for TestMCPStdioClient")
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var msg jsonRPCMessage
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if reply := mcpFixtureReply(&msg); reply != nil {
+			data, _ := json.Marshal(reply)
+			os.Stdout.Write(append(data, '\n'))
+		}
+	}
+	os.Exit(0)
+}
+
+func TestMCPStdioClient(t *testing.T) {
+	cfg := config.MCPServerConfig{
+		Name:      "stdio-fixture",
+		Transport: "stdio",
+		Command:   os.Args[0],
+		Args:      []string{"-test.run=^TestMCPFixtureProcess$"},
+		Env:       map[string]string{"AICHAT_MCP_FIXTURE": "1"},
+	}
+	server := &mcpServer{cfg: cfg}
+	defer server.disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tools, err := server.sessionTools(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := strings.Join(mcpToolNames(tools), ","); names != "echo,fail" {
+		t.Fatalf("tools: got %s, want echo,fail", names)
+	}
+	if text, err := server.callTool(ctx, "echo", json.RawMessage(`{"text":"stdio"}`)); err != nil || text != "echo: stdio" {
+		t.Fatalf("echo: got %q, %v", text, err)
+	}
+}
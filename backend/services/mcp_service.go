@@ -0,0 +1,370 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// ErrMCPServerNotFound MCP服务器不存在错误
+var ErrMCPServerNotFound = errors.New("mcp server not found")
+
+const (
+	mcpConnectTimeout = 15 * time.Second
+	mcpRetryInterval  = 30 * time.Second // 连接失败后再次尝试的间隔
+	mcpToolNameMaxLen = 64
+)
+
+var (
+	mcpServerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	mcpToolNameReplacer  = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+// mcpServer 配置的MCP服务器，首次使用时才建立连接
+type mcpServer struct {
+	cfg config.MCPServerConfig
+
+	mu      sync.Mutex
+	client  *mcpClient
+	tools   []MCPTool     // 最近一次连接获取的工具列表，连接断开后仍保留
+	dialing chan struct{} // 正在建立连接时不为空，连接完成后关闭
+	lastErr error
+	retryAt time.Time
+}
+
+var (
+	mcpServers   []*mcpServer
+	mcpServersMu sync.RWMutex
+)
+
+// SetMCPServers 设置MCP服务器配置，已有的连接会被关闭
+func SetMCPServers(servers []config.MCPServerConfig) error {
+	seen := make(map[string]bool, len(servers))
+	list := make([]*mcpServer, 0, len(servers))
+	for _, cfg := range servers {
+		if !mcpServerNamePattern.MatchString(cfg.Name) || len(cfg.Name) > 32 {
+			return fmt.Errorf("MCP服务器名称无效: %q", cfg.Name)
+		}
+		if seen[cfg.Name] {
+			return fmt.Errorf("MCP服务器名称重复: %s", cfg.Name)
+		}
+		seen[cfg.Name] = true
+		switch cfg.Transport {
+		case "stdio":
+			if cfg.Command == "" {
+				return fmt.Errorf("MCP服务器 %s 未配置 command", cfg.Name)
+			}
+		case "http":
+			if cfg.URL == "" {
+				return fmt.Errorf("MCP服务器 %s 未配置 url", cfg.Name)
+			}
+		default:
+			return fmt.Errorf("MCP服务器 %s 的 transport 不支持: %s", cfg.Name, cfg.Transport)
+		}
+		list = append(list, &mcpServer{cfg: cfg})
+	}
+
+	mcpServersMu.Lock()
+	old := mcpServers
+	mcpServers = list
+	mcpServersMu.Unlock()
+	for _, server := range old {
+		server.disconnect()
+	}
+	return nil
+}
+
+// CloseMCPServers 关闭全部MCP连接，stdio 服务器的子进程随之退出
+func CloseMCPServers() {
+	mcpServersMu.RLock()
+	servers := mcpServers
+	mcpServersMu.RUnlock()
+	for _, server := range servers {
+		server.disconnect()
+	}
+}
+
+// getMCPServers 获取配置的MCP服务器
+func getMCPServers() []*mcpServer {
+	mcpServersMu.RLock()
+	defer mcpServersMu.RUnlock()
+	return mcpServers
+}
+
+// findMCPServer 根据名称查找MCP服务器
+func findMCPServer(name string) *mcpServer {
+	for _, server := range getMCPServers() {
+		if server.cfg.Name == name {
+			return server
+		}
+	}
+	return nil
+}
+
+// isMCPToolName 判断工具名是否属于已配置的MCP服务器
+func isMCPToolName(name string) bool {
+	for _, server := range getMCPServers() {
+		if strings.HasPrefix(name, server.cfg.Name+"__") {
+			return true
+		}
+	}
+	return false
+}
+
+// connect 获取已建立的连接，没有时建立连接，连接失败后一段时间内不再重试
+// 建立连接时不持有锁，同时到达的调用等待同一次连接的结果
+func (s *mcpServer) connect(ctx context.Context) (*mcpClient, error) {
+	for {
+		s.mu.Lock()
+		if s.client != nil {
+			client := s.client
+			s.mu.Unlock()
+			return client, nil
+		}
+		if time.Now().Before(s.retryAt) {
+			err := s.lastErr
+			s.mu.Unlock()
+			return nil, err
+		}
+		if s.dialing == nil {
+			break
+		}
+		dialing := s.dialing
+		s.mu.Unlock()
+		select {
+		case <-dialing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	dialing := make(chan struct{})
+	s.dialing = dialing
+	s.mu.Unlock()
+
+	// 连接不受单次请求取消的影响，结果供其他等待的调用使用
+	dialCtx, cancel := context.WithTimeout(context.Background(), mcpConnectTimeout)
+	client, err := connectMCPServer(dialCtx, s.cfg, nil)
+	cancel()
+
+	s.mu.Lock()
+	s.dialing = nil
+	if err != nil {
+		log.Printf("连接MCP服务器 %s 失败: %v", s.cfg.Name, err)
+		s.lastErr = err
+		s.retryAt = time.Now().Add(mcpRetryInterval)
+	} else {
+		s.client = client
+		// 没有工具的服务器也记录为已获取，避免每次都重新连接
+		s.tools = append([]MCPTool{}, client.tools...)
+		s.lastErr = nil
+	}
+	close(dialing)
+	s.mu.Unlock()
+	return client, err
+}
+
+// sessionTools 获取工具列表，已获取过时直接使用缓存，不重新连接
+func (s *mcpServer) sessionTools(ctx context.Context) ([]MCPTool, error) {
+	s.mu.Lock()
+	tools := s.tools
+	s.mu.Unlock()
+	if tools != nil {
+		return tools, nil
+	}
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.tools, nil
+}
+
+// status 获取当前连接状态
+func (s *mcpServer) status() (*mcpClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client, s.lastErr
+}
+
+// drop 连接断开时丢弃连接，下次使用时重新建立
+func (s *mcpServer) drop(client *mcpClient, err error) {
+	s.mu.Lock()
+	if s.client != client {
+		s.mu.Unlock()
+		return
+	}
+	s.client = nil
+	s.lastErr = err
+	s.mu.Unlock()
+	client.transport.close()
+}
+
+// disconnect 关闭连接
+func (s *mcpServer) disconnect() {
+	s.mu.Lock()
+	client := s.client
+	s.client = nil
+	s.mu.Unlock()
+	if client != nil {
+		client.transport.close()
+	}
+}
+
+// callTool 调用MCP服务器的工具，连接断开时重新连接后重试一次
+func (s *mcpServer) callTool(ctx context.Context, name string, arguments json.RawMessage) (string, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := s.connect(ctx)
+		if err != nil {
+			return "", fmt.Errorf("MCP服务器 %s 不可用: %w", s.cfg.Name, err)
+		}
+		result, err := client.callTool(ctx, name, arguments)
+		if err != nil && (errors.Is(err, ErrMCPClosed) || errors.Is(err, errMCPSessionExpired)) {
+			s.drop(client, err)
+			if attempt == 0 && ctx.Err() == nil {
+				continue
+			}
+		}
+		return result, err
+	}
+}
+
+// MCPServerStatus 会话中MCP服务器的状态
+type MCPServerStatus struct {
+	Name      string   `json:"name"`
+	Transport string   `json:"transport"`
+	Enabled   bool     `json:"enabled"`   // 当前会话是否启用
+	Default   bool     `json:"default"`   // 配置中的默认值
+	Connected bool     `json:"connected"` // 是否已建立连接
+	Error     string   `json:"error,omitempty"`
+	Tools     []string `json:"tools"`
+}
+
+// sessionMCPSettings 获取会话对MCP服务器的单独设置
+func sessionMCPSettings(sessionID string) (map[string]bool, error) {
+	var settings []models.SessionMCPServer
+	if err := database.GetDB().Where("session_id = ?", sessionID).Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]bool, len(settings))
+	for _, setting := range settings {
+		enabled[setting.ServerName] = setting.Enabled
+	}
+	return enabled, nil
+}
+
+// sessionMCPEnabled 判断服务器在会话中是否启用，会话未单独设置时使用配置的默认值
+func sessionMCPEnabled(settings map[string]bool, server *mcpServer) bool {
+	if enabled, ok := settings[server.cfg.Name]; ok {
+		return enabled
+	}
+	return server.cfg.Enabled
+}
+
+// ListSessionMCPServers 获取会话可用的MCP服务器，已启用的服务器会尝试连接以获取工具列表
+func ListSessionMCPServers(ctx context.Context, sessionID string) ([]MCPServerStatus, error) {
+	settings, err := sessionMCPSettings(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("查询MCP设置失败: %w", err)
+	}
+
+	servers := getMCPServers()
+	statuses := make([]MCPServerStatus, 0, len(servers))
+	for _, server := range servers {
+		status := MCPServerStatus{
+			Name:      server.cfg.Name,
+			Transport: server.cfg.Transport,
+			Enabled:   sessionMCPEnabled(settings, server),
+			Default:   server.cfg.Enabled,
+			Tools:     []string{},
+		}
+		var client *mcpClient
+		var connErr error
+		if status.Enabled {
+			client, connErr = server.connect(ctx)
+		} else {
+			client, connErr = server.status()
+		}
+		if client != nil {
+			status.Connected = true
+			for _, tool := range client.tools {
+				status.Tools = append(status.Tools, tool.Name)
+			}
+		} else if connErr != nil {
+			status.Error = connErr.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// SetSessionMCPServer 启用或停用会话的MCP服务器
+func SetSessionMCPServer(sessionID, name string, enabled bool) error {
+	if findMCPServer(name) == nil {
+		return ErrMCPServerNotFound
+	}
+	setting := models.SessionMCPServer{SessionID: sessionID, ServerName: name, Enabled: enabled}
+	return database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}, {Name: "server_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+	}).Create(&setting).Error
+}
+
+// SessionMCPTools 获取会话已启用的MCP服务器提供的工具，工具名为 服务器名__工具名
+// 工具列表在首次连接后缓存，连接断开时在调用工具时重新连接；无法连接的服务器会被跳过，不影响对话
+func SessionMCPTools(ctx context.Context, sessionID string) []Tool {
+	servers := getMCPServers()
+	if len(servers) == 0 {
+		return nil
+	}
+	settings, err := sessionMCPSettings(sessionID)
+	if err != nil {
+		log.Printf("查询MCP设置失败: %v", err)
+		return nil
+	}
+
+	var tools []Tool
+	for _, server := range servers {
+		if !sessionMCPEnabled(settings, server) {
+			continue
+		}
+		serverTools, err := server.sessionTools(ctx)
+		if err != nil {
+			continue
+		}
+		for _, mcpTool := range serverTools {
+			tools = append(tools, newMCPTool(server, mcpTool))
+		}
+	}
+	return tools
+}
+
+// newMCPTool 将MCP工具包装为可供模型调用的工具
+func newMCPTool(server *mcpServer, mcpTool MCPTool) Tool {
+	name := mcpToolNameReplacer.ReplaceAllString(server.cfg.Name+"__"+mcpTool.Name, "_")
+	if len(name) > mcpToolNameMaxLen {
+		name = name[:mcpToolNameMaxLen]
+	}
+	parameters := mcpTool.InputSchema
+	if len(parameters) == 0 || string(parameters) == "null" {
+		parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	toolName := mcpTool.Name
+	return Tool{
+		Name:        name,
+		Description: strings.TrimSpace(fmt.Sprintf("[%s] %s", server.cfg.Name, mcpTool.Description)),
+		Parameters:  parameters,
+		Handler: func(ctx context.Context, env ToolEnv, arguments json.RawMessage) (string, error) {
+			return server.callTool(ctx, toolName, arguments)
+		},
+	}
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	ErrUnknownModel       = errors.New("unknown model")
+	ErrVisionNotSupported = errors.New("model does not support image input")
+)
+
+// ModelInfo 可供选择的模型
+type ModelInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Provider string `json:"provider,omitempty"`
+	Vision   bool   `json:"vision"` // 是否支持图片输入
+	Tools    bool   `json:"tools"`  // 是否支持工具调用
+	// 是否原生支持 response_format 的 json_object 和 json_schema，不支持时通过提示词要求输出JSON
+	JSONOutput bool `json:"json_output"`
+	JSONSchema bool `json:"json_schema"`
+}
+
+// modelCatalog 返回配置的模型列表，未配置时使用 deepseek 的默认模型和思考模型
+func modelCatalog() []config.ModelConfig {
+	if config.AppConfig != nil && len(config.AppConfig.Models) > 0 {
+		return config.AppConfig.Models
+	}
+
+	base := GetDefaultDeepSeekService().Config
+	catalog := []config.ModelConfig{{ID: base.Model, Name: base.Model, Provider: "deepseek"}}
+	if base.ReasonerModel != "" && base.ReasonerModel != base.Model {
+		catalog = append(catalog, config.ModelConfig{ID: base.ReasonerModel, Name: base.ReasonerModel, Provider: "deepseek"})
+	}
+	return catalog
+}
+
+// ListModels 获取可供选择的模型
+func ListModels() []ModelInfo {
+	catalog := modelCatalog()
+	models := make([]ModelInfo, 0, len(catalog))
+	for _, entry := range catalog {
+		name := entry.Name
+		if name == "" {
+			name = entry.ID
+		}
+		models = append(models, ModelInfo{
+			ID:         entry.ID,
+			Name:       name,
+			Provider:   entry.Provider,
+			Vision:     entry.Vision,
+			Tools:      entry.Tools,
+			JSONOutput: entry.JSONOutput || entry.JSONSchema,
+			JSONSchema: entry.JSONSchema,
+		})
+	}
+	return models
+}
+
+// findModelConfig 查找模型的配置，model 可以是模型标识或服务商的模型名
+func findModelConfig(model string) (config.ModelConfig, bool) {
+	for _, entry := range modelCatalog() {
+		if entry.ID == model || (entry.Model != "" && entry.Model == model) {
+			return entry, true
+		}
+	}
+	return config.ModelConfig{}, false
+}
+
+// ModelExists 检查模型是否在可选模型中，model 可以是模型标识或服务商的模型名
+func ModelExists(model string) bool {
+	_, ok := findModelConfig(model)
+	return ok
+}
+
+// ModelSupportsVision 检查模型是否支持图片输入，model 可以是模型标识或服务商的模型名
+func ModelSupportsVision(model string) bool {
+	entry, _ := findModelConfig(model)
+	return entry.Vision
+}
+
+// ModelSupportsTools 检查模型是否支持工具调用，model 可以是模型标识或服务商的模型名
+func ModelSupportsTools(model string) bool {
+	entry, _ := findModelConfig(model)
+	return entry.Tools
+}
+
+// InvalidGenerationParamsError 请求指定的生成参数不被模型支持或超出模型的限制
+type InvalidGenerationParamsError struct {
+	Param  string
+	Reason string // 中文说明，直接返回给用户
+}
+
+func (e *InvalidGenerationParamsError) Error() string {
+	return "invalid generation param " + e.Param + ": " + e.Reason
+}
+
+// defaultTemperature 未指定采样温度时使用的默认值
+const defaultTemperature = 0.7
+
+// setGenerationParams 返回已设置的生成参数名称
+func setGenerationParams(params models.GenerationParams) []string {
+	var names []string
+	if params.Temperature != nil {
+		names = append(names, "temperature")
+	}
+	if params.TopP != nil {
+		names = append(names, "top_p")
+	}
+	if params.MaxTokens != nil {
+		names = append(names, "max_tokens")
+	}
+	if len(params.Stop) > 0 {
+		names = append(names, "stop")
+	}
+	if params.PresencePenalty != nil {
+		names = append(names, "presence_penalty")
+	}
+	if params.FrequencyPenalty != nil {
+		names = append(names, "frequency_penalty")
+	}
+	return names
+}
+
+// clearGenerationParam 清除指定的生成参数
+func clearGenerationParam(params *models.GenerationParams, name string) {
+	switch name {
+	case "temperature":
+		params.Temperature = nil
+	case "top_p":
+		params.TopP = nil
+	case "max_tokens":
+		params.MaxTokens = nil
+	case "stop":
+		params.Stop = nil
+	case "presence_penalty":
+		params.PresencePenalty = nil
+	case "frequency_penalty":
+		params.FrequencyPenalty = nil
+	}
+}
+
+// MergeGenerationParams 用 override 中已设置的参数覆盖 base
+func MergeGenerationParams(base, override models.GenerationParams) models.GenerationParams {
+	if override.Temperature != nil {
+		base.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		base.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		base.MaxTokens = override.MaxTokens
+	}
+	if len(override.Stop) > 0 {
+		base.Stop = override.Stop
+	}
+	if override.PresencePenalty != nil {
+		base.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		base.FrequencyPenalty = override.FrequencyPenalty
+	}
+	return base
+}
+
+// ValidateGenerationParams 检查请求指定的生成参数是否被模型支持且不超过模型的输出长度上限
+func ValidateGenerationParams(model string, params models.GenerationParams) error {
+	entry, _ := findModelConfig(model)
+	for _, name := range setGenerationParams(params) {
+		for _, unsupported := range entry.UnsupportedParams {
+			if name == unsupported {
+				return &InvalidGenerationParamsError{Param: name, Reason: fmt.Sprintf("模型 %s 不支持参数 %s", model, name)}
+			}
+		}
+	}
+	if params.MaxTokens != nil && entry.MaxTokens > 0 && *params.MaxTokens > entry.MaxTokens {
+		return &InvalidGenerationParamsError{Param: "max_tokens", Reason: fmt.Sprintf("max_tokens 不能超过模型 %s 的上限 %d", model, entry.MaxTokens)}
+	}
+	return nil
+}
+
+// finalizeGenerationParams 生成实际发送给模型的参数
+// 去掉模型不支持的参数，将输出长度限制在模型上限内，未设置的温度和输出长度使用默认值
+func finalizeGenerationParams(model string, params models.GenerationParams) models.GenerationParams {
+	entry, _ := findModelConfig(model)
+	unsupported := make(map[string]bool, len(entry.UnsupportedParams))
+	for _, name := range entry.UnsupportedParams {
+		unsupported[name] = true
+		clearGenerationParam(&params, name)
+	}
+
+	if params.Temperature == nil && !unsupported["temperature"] {
+		temperature := defaultTemperature
+		params.Temperature = &temperature
+	}
+	if params.MaxTokens == nil && !unsupported["max_tokens"] && config.AppConfig != nil && config.AppConfig.DeepSeek.MaxTokens > 0 {
+		maxTokens := int(config.AppConfig.DeepSeek.MaxTokens)
+		params.MaxTokens = &maxTokens
+	}
+	if params.MaxTokens != nil && entry.MaxTokens > 0 && *params.MaxTokens > entry.MaxTokens {
+		maxTokens := entry.MaxTokens
+		params.MaxTokens = &maxTokens
+	}
+	return params
+}
+
+// CheckVisionSupport 消息包含图片而模型不支持图片输入时返回 ErrVisionNotSupported
+func CheckVisionSupport(model string, message ChatMessage) error {
+	if message.HasImages() && !ModelSupportsVision(model) {
+		return fmt.Errorf("%w: %s", ErrVisionNotSupported, model)
+	}
+	return nil
+}
+
+// GetModelService 根据模型标识创建对应服务商的客户端
+func GetModelService(modelID string) (*DeepSeekService, error) {
+	for _, entry := range modelCatalog() {
+		if entry.ID != modelID {
+			continue
+		}
+
+		cfg := GetDefaultDeepSeekService().Config
+		if entry.BaseURL != "" {
+			cfg.BaseURL = entry.BaseURL
+		}
+		if entry.APIKey != "" {
+			cfg.APIKey = entry.APIKey
+		}
+		cfg.Model = entry.Model
+		if cfg.Model == "" {
+			cfg.Model = entry.ID
+		}
+		// 模型已明确指定，不再切换到思考模型
+		cfg.ReasonerModel = ""
+		return NewDeepSeekService(cfg), nil
+	}
+	return nil, ErrUnknownModel
+}
+
+// ResolveChatService 返回对话参数对应的服务，opts.Model 应为应用了工作区和助手设置之后的模型
+// 指定的模型在可选模型中时使用该模型的服务商配置，并将 opts.Model 换成服务商的模型名
+// 未指定模型或指定的是默认服务的默认模型时使用默认服务，深度思考时由默认服务切换到思考模型
+func ResolveChatService(opts *ChatOptions) *DeepSeekService {
+	service := GetDefaultDeepSeekService()
+	if opts.Model == "" {
+		return service
+	}
+	entry, ok := findModelConfig(opts.Model)
+	if !ok {
+		return service
+	}
+	modelService, err := GetModelService(entry.ID)
+	if err != nil {
+		return service
+	}
+	if opts.DeepThinking && service.Config.ReasonerModel != "" &&
+		modelService.Config.BaseURL == service.Config.BaseURL && modelService.Config.Model == service.Config.Model {
+		return service
+	}
+	opts.Model = modelService.Config.Model
+	return modelService
+}
+
+// CompareResult 单个模型的对比结果
+type CompareResult struct {
+	Model    string
+	Version  int
+	Content  string
+	Thinking string
+	Params   models.GenerationParams // 实际使用的生成参数
+	// 使用的系统提示词
+	SystemPrompt string
+	Err          error
+}
+
+// CompareModels 将同一组消息并发发送给多个模型，每个模型的流式输出写入各自的 writer
+// opts 提供系统提示词和生成参数，生成参数按各模型的限制调整，其中的模型和深度思考设置不使用
+// versions 与 modelIDs 一一对应，结果按 modelIDs 的顺序返回
+func CompareModels(messages []ChatMessage, opts ChatOptions, modelIDs []string, versions []int, newWriter func(model string, version int) io.Writer) []CompareResult {
+	results := make([]CompareResult, len(modelIDs))
+
+	var wg sync.WaitGroup
+	for i, modelID := range modelIDs {
+		results[i] = CompareResult{Model: modelID, Version: versions[i], SystemPrompt: opts.SystemPrompt}
+
+		service, err := GetModelService(modelID)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, service *DeepSeekService) {
+			defer wg.Done()
+			// 每个模型使用独立的消息副本，避免追加系统提示词时相互影响
+			history := append([]ChatMessage(nil), messages...)
+			result := &results[i]
+			reply, err := service.RunChat(history, ChatOptions{SystemPrompt: opts.SystemPrompt, Params: opts.Params},
+				newWriter(result.Model, result.Version))
+			result.Content, result.Thinking, result.Params, result.Err = reply.Content, reply.Thinking, reply.Params, err
+		}(i, service)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"testing"
+)
+
+func TestResolveChatService(t *testing.T) {
+	prev := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = prev })
+	config.AppConfig = &config.Config{}
+	config.AppConfig.Models = []config.ModelConfig{
+		{ID: "deepseek-chat", Provider: "deepseek"},
+		{ID: "claude", Provider: "anthropic", Model: "claude-x", BaseURL: "https://claude.example.com/v1/chat/completions", APIKey: "sk-claude"},
+	}
+	defaults := GetDefaultDeepSeekService().Config
+
+	tests := []struct {
+		name         string
+		opts         ChatOptions
+		wantBaseURL  string
+		wantModel    string // 实际请求的模型
+		wantOptModel string
+	}{
+		{"no model", ChatOptions{}, defaults.BaseURL, defaults.Model, ""},
+		{"unknown model", ChatOptions{Model: "gpt-unknown"}, defaults.BaseURL, "gpt-unknown", "gpt-unknown"},
+		{"catalog model", ChatOptions{Model: "claude"}, "https://claude.example.com/v1/chat/completions", "claude-x", "claude-x"},
+		{"provider model name", ChatOptions{Model: "claude-x"}, "https://claude.example.com/v1/chat/completions", "claude-x", "claude-x"},
+		// 助手或工作区指定的其他服务商的模型在深度思考时也不切换到默认的思考模型
+		{"catalog model with deep thinking", ChatOptions{Model: "claude", DeepThinking: true}, "https://claude.example.com/v1/chat/completions", "claude-x", "claude-x"},
+		{"default model with deep thinking", ChatOptions{Model: "deepseek-chat", DeepThinking: true}, defaults.BaseURL, defaults.ReasonerModel, "deepseek-chat"},
+		{"no model with deep thinking", ChatOptions{DeepThinking: true}, defaults.BaseURL, defaults.ReasonerModel, ""},
+	}
+	for _, tt := range tests {
+		opts := tt.opts
+		service := ResolveChatService(&opts)
+		if service.Config.BaseURL != tt.wantBaseURL {
+			t.Errorf("%s: base url %q, want %q", tt.name, service.Config.BaseURL, tt.wantBaseURL)
+		}
+		if model := service.ResolveModel(opts); model != tt.wantModel {
+			t.Errorf("%s: model %q, want %q", tt.name, model, tt.wantModel)
+		}
+		if opts.Model != tt.wantOptModel {
+			t.Errorf("%s: opts.Model %q, want %q", tt.name, opts.Model, tt.wantOptModel)
+		}
+	}
+}
@@ -0,0 +1,757 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOIDCDisabled 未启用单点登录错误
+	ErrOIDCDisabled = errors.New("oidc login is disabled")
+
+	// ErrOIDCInvalidState 无效或过期的state错误
+	ErrOIDCInvalidState = errors.New("invalid or expired oidc state")
+
+	// ErrOIDCInvalidIDToken ID Token校验失败错误
+	ErrOIDCInvalidIDToken = errors.New("invalid oidc id token")
+
+	// ErrOIDCEmailNotVerified 身份提供方未验证邮箱错误
+	ErrOIDCEmailNotVerified = errors.New("oidc email is not verified")
+
+	// ErrOIDCLinkRequired 邮箱已被本地账号使用，需要登录该账号后手动绑定
+	ErrOIDCLinkRequired = errors.New("oidc identity must be linked from the existing account")
+
+	// ErrOIDCIdentityInUse 外部身份已绑定其他账号错误
+	ErrOIDCIdentityInUse = errors.New("oidc identity is linked to another account")
+
+	// ErrOIDCIdentityMismatch 重新认证的外部身份不属于当前用户错误
+	ErrOIDCIdentityMismatch = errors.New("oidc identity does not belong to the current user")
+)
+
+// 授权请求的用途
+const (
+	OIDCPurposeLogin  = ""       // 登录或注册
+	OIDCPurposeLink   = "link"   // 已登录用户绑定外部身份
+	OIDCPurposeReauth = "reauth" // 已登录用户重新认证，用于注销账号等敏感操作
+)
+
+const (
+	// OIDCStateCookie 保存授权状态的Cookie名称
+	OIDCStateCookie = "oidc_auth"
+	// OIDCStateTTL 授权请求的有效期
+	OIDCStateTTL = 10 * time.Minute
+	// oidcDiscoveryTTL 发现文档的缓存时间
+	oidcDiscoveryTTL = time.Hour
+	// oidcKeysMinRefresh 公钥集合的最小刷新间隔，防止未知kid导致频繁请求
+	oidcKeysMinRefresh = time.Minute
+)
+
+// oidcDiscovery OpenID Provider 发现文档中用到的字段
+type oidcDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// oidcAuthState 一次授权请求的状态，签名后保存在发起登录的浏览器的Cookie中
+// 回调时要求Cookie与state参数一致，防止攻击者把自己的授权回调交给受害者完成登录，也不依赖单个实例的内存
+type oidcAuthState struct {
+	State        string `json:"s"`
+	Nonce        string `json:"n"`
+	CodeVerifier string `json:"v"`
+	ExpireTime   int64  `json:"e"`
+	Purpose      string `json:"p,omitempty"`
+	UserID       uint   `json:"u,omitempty"` // 绑定或重新认证时发起请求的已登录用户
+}
+
+// OIDCCallbackResult 回调的处理结果，按授权请求的用途只有一个字段不为空
+type OIDCCallbackResult struct {
+	Login       *models.LoginResponse
+	Linked      *models.User
+	ReauthToken string // 重新认证凭证，见 IssueReauthToken
+}
+
+// oidcIDTokenClaims ID Token 中使用的声明
+type oidcIDTokenClaims struct {
+	Nonce             string       `json:"nonce"`
+	Email             string       `json:"email"`
+	EmailVerified     flexibleBool `json:"email_verified"`
+	Name              string       `json:"name"`
+	PreferredUsername string       `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// flexibleBool 兼容部分身份提供方以字符串形式返回的布尔值
+type flexibleBool bool
+
+// UnmarshalJSON 实现json.Unmarshaler接口
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// OIDCProvider 对接单个OpenID Connect身份提供方
+type OIDCProvider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	discoveredAt time.Time
+	keys         map[string]interface{}
+	keysLoadedAt time.Time
+}
+
+var oidcProvider *OIDCProvider
+
+// NewOIDCProvider 创建OIDC身份提供方客户端，client为空时使用默认HTTP客户端
+func NewOIDCProvider(cfg config.OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// SetOIDCProvider 设置默认的OIDC身份提供方，传入nil表示关闭单点登录
+func SetOIDCProvider(provider *OIDCProvider) {
+	oidcProvider = provider
+}
+
+// GetOIDCProvider 获取默认的OIDC身份提供方
+func GetOIDCProvider() (*OIDCProvider, error) {
+	if oidcProvider == nil {
+		return nil, ErrOIDCDisabled
+	}
+	return oidcProvider, nil
+}
+
+// FrontendURL 登录完成后跳转的前端地址
+func (p *OIDCProvider) FrontendURL() string {
+	return p.cfg.FrontendURL
+}
+
+// randomURLString 生成URL安全的随机字符串
+func randomURLString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// getDiscovery 获取并缓存发现文档
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < oidcDiscoveryTTL {
+		d := p.discovery
+		p.mu.Unlock()
+		return d, nil
+	}
+	p.mu.Unlock()
+
+	var d oidcDiscovery
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("获取OIDC发现文档失败: %w", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("OIDC发现文档中的issuer不匹配: %s", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("OIDC发现文档缺少必要的端点")
+	}
+
+	p.mu.Lock()
+	p.discovery = &d
+	p.discoveredAt = time.Now()
+	p.mu.Unlock()
+	return &d, nil
+}
+
+// getJSON 发送GET请求并解析JSON响应
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址（授权码模式 + PKCE），同时返回需要写入 OIDCStateCookie 的值
+// 绑定和重新认证需要传入当前登录的用户，登录时userID为0
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, purpose string, userID uint) (string, string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomURLString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomURLString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomURLString(48)
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	cookie, err := encodeOIDCState(oidcAuthState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpireTime:   time.Now().Add(OIDCStateTTL).Unix(),
+		Purpose:      purpose,
+		UserID:       userID,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + params.Encode(), cookie, nil
+}
+
+// oidcStateMAC 计算授权状态的签名
+func oidcStateMAC(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWT.Secret))
+	mac.Write([]byte("oidc-state:" + payload))
+	return mac.Sum(nil)
+}
+
+// encodeOIDCState 将授权状态编码为带签名的Cookie值
+func encodeOIDCState(s oidcAuthState) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(oidcStateMAC(payload)), nil
+}
+
+// decodeOIDCState 校验Cookie的签名和有效期，并要求其中的state与回调参数一致
+func decodeOIDCState(cookie, state string) (*oidcAuthState, error) {
+	payload, sig, ok := strings.Cut(cookie, ".")
+	if !ok || state == "" {
+		return nil, ErrOIDCInvalidState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, oidcStateMAC(payload)) {
+		return nil, ErrOIDCInvalidState
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrOIDCInvalidState
+	}
+	var s oidcAuthState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, ErrOIDCInvalidState
+	}
+	if subtle.ConstantTimeCompare([]byte(s.State), []byte(state)) != 1 || time.Now().Unix() > s.ExpireTime {
+		return nil, ErrOIDCInvalidState
+	}
+	return &s, nil
+}
+
+// HandleCallback 处理身份提供方的回调：校验state、换取令牌、校验ID Token，然后登录本地账号或绑定外部身份
+// cookie 为发起授权时写入 OIDCStateCookie 的值，调用方应在回调后清除该Cookie
+func (p *OIDCProvider) HandleCallback(ctx context.Context, cookie, state, code, ip string) (*OIDCCallbackResult, error) {
+	authState, claims, err := p.authenticate(ctx, cookie, state, code)
+	if err != nil {
+		return nil, err
+	}
+
+	switch authState.Purpose {
+	case OIDCPurposeLink:
+		user, err := linkOIDCIdentity(authState.UserID, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &OIDCCallbackResult{Linked: user}, nil
+	case OIDCPurposeReauth:
+		if err := checkOIDCIdentityOwner(authState.UserID, claims); err != nil {
+			return nil, err
+		}
+		return &OIDCCallbackResult{ReauthToken: IssueReauthToken(authState.UserID)}, nil
+	}
+
+	user, err := p.resolveUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	resp, err := issueLoginResponse(*user, ip)
+	if err != nil {
+		return nil, err
+	}
+	return &OIDCCallbackResult{Login: resp}, nil
+}
+
+// authenticate 完成与身份提供方的交互，返回授权状态和校验通过的ID Token声明
+func (p *OIDCProvider) authenticate(ctx context.Context, cookie, state, code string) (*oidcAuthState, *oidcIDTokenClaims, error) {
+	authState, err := decodeOIDCState(cookie, state)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawIDToken, err := p.exchangeCode(ctx, d, code, authState.CodeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claims, err := p.verifyIDToken(ctx, d, rawIDToken, authState.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authState, claims, nil
+}
+
+// exchangeCode 使用授权码换取ID Token
+func (p *OIDCProvider) exchangeCode(ctx context.Context, d *oidcDiscovery, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", verifier)
+
+	// 只声明支持client_secret_post时使用表单传递密钥，否则使用Basic认证
+	usePost := len(d.TokenEndpointAuthMethodsSupported) > 0
+	for _, m := range d.TokenEndpointAuthMethodsSupported {
+		if m == "client_secret_basic" {
+			usePost = false
+		}
+	}
+	if p.cfg.ClientSecret != "" && usePost {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" && !usePost {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求令牌端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("读取令牌响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("令牌端点返回错误，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", fmt.Errorf("解析令牌响应失败: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return "", ErrOIDCInvalidIDToken
+	}
+	return tokenResp.IDToken, nil
+}
+
+// verifyIDToken 校验ID Token的签名、签发者、受众、有效期和nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, d *oidcDiscovery, rawIDToken, nonce string) (*oidcIDTokenClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+
+	claims := &oidcIDTokenClaims{}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, d, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidIDToken, err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce不匹配", ErrOIDCInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: 缺少sub", ErrOIDCInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// publicKey 根据kid查找签名公钥，找不到时刷新一次公钥集合
+func (p *OIDCProvider) publicKey(ctx context.Context, d *oidcDiscovery, kid string) (interface{}, error) {
+	p.mu.Lock()
+	keys := p.keys
+	loadedAt := p.keysLoadedAt
+	p.mu.Unlock()
+
+	if key := selectKey(keys, kid); key != nil {
+		return key, nil
+	}
+	if keys != nil && time.Since(loadedAt) < oidcKeysMinRefresh {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx, d.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.keysLoadedAt = time.Now()
+	p.mu.Unlock()
+
+	if key := selectKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+// selectKey 按kid选择公钥；令牌未携带kid且只有一个公钥时直接使用
+func selectKey(keys map[string]interface{}, kid string) interface{} {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// fetchKeys 下载并解析JWKS公钥集合
+func (p *OIDCProvider) fetchKeys(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("获取JWKS失败: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				continue
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil {
+				continue
+			}
+			y, err := base64.RawURLEncoding.DecodeString(k.Y)
+			if err != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS中没有可用的签名公钥")
+	}
+	return keys, nil
+}
+
+// resolveUser 查找或创建外部身份对应的本地用户
+// 优先使用已绑定的身份；邮箱已被本地账号使用时不自动绑定，避免不可信的邮箱声明接管本地账号，
+// 需要用户登录该账号后主动绑定；都没有则以已验证的邮箱创建新账号
+func (p *OIDCProvider) resolveUser(claims *oidcIDTokenClaims) (*models.User, error) {
+	db := database.GetDB()
+
+	var identity models.UserIdentity
+	err := db.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := db.First(&user, identity.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrUserNotFound
+			}
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	var user models.User
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("email = ?", claims.Email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOIDCLinkRequired
+		}
+		created, err := createOIDCUser(tx, claims)
+		if err != nil {
+			return err
+		}
+		user = *created
+
+		return tx.Create(&models.UserIdentity{
+			UserID:  user.ID,
+			Issuer:  claims.Issuer,
+			Subject: claims.Subject,
+			Email:   claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// checkOIDCIdentityOwner 确认外部身份已绑定到指定用户
+func checkOIDCIdentityOwner(userID uint, claims *oidcIDTokenClaims) error {
+	var count int64
+	err := database.GetDB().Model(&models.UserIdentity{}).
+		Where("issuer = ? AND subject = ? AND user_id = ?", claims.Issuer, claims.Subject, userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrOIDCIdentityMismatch
+	}
+	return nil
+}
+
+// linkOIDCIdentity 将外部身份绑定到已登录的用户，外部身份已绑定其他账号时返回 ErrOIDCIdentityInUse
+func linkOIDCIdentity(userID uint, claims *oidcIDTokenClaims) (*models.User, error) {
+	db := database.GetDB()
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	var identity models.UserIdentity
+	err := db.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		if identity.UserID != userID {
+			return nil, ErrOIDCIdentityInUse
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = db.Create(&models.UserIdentity{
+		UserID:  userID,
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return nil, ErrOIDCIdentityInUse
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// oidcUsernameBase 根据身份提供方的用户名或邮箱生成用户名，按字符截断，避免截断多字节字符
+func oidcUsernameBase(claims *oidcIDTokenClaims) string {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = strings.ToValidUTF8(base, "")
+	if utf8.RuneCountInString(base) < 3 {
+		base = "user_" + base
+	}
+	if runes := []rune(base); len(runes) > 40 {
+		base = string(runes[:40])
+	}
+	return base
+}
+
+// createOIDCUser 为首次单点登录的用户创建本地账号
+func createOIDCUser(tx *gorm.DB, claims *oidcIDTokenClaims) (*models.User, error) {
+	base := oidcUsernameBase(claims)
+	username := base
+	for i := 0; ; i++ {
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			break
+		}
+		if i >= 5 {
+			return nil, ErrUsernameExists
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		username = base + "_" + hex.EncodeToString(suffix)
+	}
+
+	// 单点登录账号不设置可用密码
+	randomPassword, err := randomURLString(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username:  username,
+		Password:  string(hashedPassword),
+		Email:     claims.Email,
+		LoginType: models.LoginTypeOIDC,
+		Status:    1,
+	}
+	if err := tx.Create(&user).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.UserSettings{UserID: user.ID}).Error; err != nil {
+		return nil, err
+	}
+	if err := assignDefaultRole(tx, user.ID); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
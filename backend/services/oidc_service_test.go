@@ -0,0 +1,316 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIdP 本地模拟的身份提供方，实现发现文档、JWKS和令牌端点
+type stubIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]stubAuthorization // 授权码 -> 授权请求
+	// claims 用于修改签发的ID Token，例如模拟错误的nonce
+	claims func(jwt.MapClaims)
+}
+
+// stubAuthorization 授权请求中需要在换取令牌时核对的参数
+type stubAuthorization struct {
+	nonce     string
+	challenge string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{t: t, key: key, codes: make(map[string]stubAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize 模拟用户在身份提供方完成登录，返回授权码
+func (idp *stubIdP) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("未使用PKCE: %s", authURL)
+	}
+	code = "code-" + q.Get("state")
+	idp.mu.Lock()
+	idp.codes[code] = stubAuthorization{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+// token 令牌端点，校验授权码和PKCE后签发ID Token，授权码只能使用一次
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "user-1",
+		"aud":            "client",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          auth.nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+}
+
+func newTestOIDCProvider(t *testing.T) (*OIDCProvider, *stubIdP) {
+	prev := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = prev })
+	config.AppConfig = &config.Config{}
+	config.AppConfig.JWT.Secret = "test-secret"
+	idp := newStubIdP(t)
+	provider := NewOIDCProvider(config.OIDCConfig{
+		Issuer:      idp.server.URL,
+		ClientID:    "client",
+		RedirectURL: "http://localhost/api/auth/oidc/callback",
+	}, idp.server.Client())
+	return provider, idp
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	authURL, cookie, err := provider.AuthCodeURL(ctx, OIDCPurposeLogin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(authURL)
+
+	authState, claims, err := provider.authenticate(ctx, cookie, state, code)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "alice@example.com" || !bool(claims.EmailVerified) {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if authState.Purpose != OIDCPurposeLogin || authState.UserID != 0 {
+		t.Fatalf("unexpected state: %+v", authState)
+	}
+
+	// 授权码只能使用一次
+	if _, _, err := provider.authenticate(ctx, cookie, state, code); err == nil {
+		t.Fatal("expected reused code to fail")
+	}
+}
+
+func TestOIDCLinkState(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	authURL, cookie, err := provider.AuthCodeURL(ctx, OIDCPurposeLink, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(authURL)
+
+	authState, _, err := provider.authenticate(ctx, cookie, state, code)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if authState.Purpose != OIDCPurposeLink || authState.UserID != 42 {
+		t.Fatalf("unexpected state: %+v", authState)
+	}
+}
+
+func TestOIDCStateBoundToBrowser(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	// 攻击者发起登录拿到自己的授权码，受害者浏览器中是另一次登录的Cookie
+	attackerURL, _, err := provider.AuthCodeURL(ctx, OIDCPurposeLogin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attackerCode, attackerState := idp.authorize(attackerURL)
+	_, victimCookie, err := provider.AuthCodeURL(ctx, OIDCPurposeLogin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := provider.authenticate(ctx, victimCookie, attackerState, attackerCode); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Fatalf("cross-browser callback: got %v, want ErrOIDCInvalidState", err)
+	}
+	if _, _, err := provider.authenticate(ctx, "", attackerState, attackerCode); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Fatalf("missing cookie: got %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCStateCookieTampered(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	ctx := context.Background()
+
+	authURL, cookie, err := provider.AuthCodeURL(ctx, OIDCPurposeLogin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(authURL)
+
+	// 篡改Cookie中的绑定用户
+	payload, sig, _ := strings.Cut(cookie, ".")
+	data, _ := base64.RawURLEncoding.DecodeString(payload)
+	var s oidcAuthState
+	json.Unmarshal(data, &s)
+	s.Purpose = OIDCPurposeLink
+	s.UserID = 1
+	data, _ = json.Marshal(s)
+	tampered := base64.RawURLEncoding.EncodeToString(data) + "." + sig
+
+	if _, _, err := provider.authenticate(ctx, tampered, state, code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Fatalf("tampered cookie: got %v, want ErrOIDCInvalidState", err)
+	}
+
+	// 过期的授权状态
+	s.Purpose = OIDCPurposeLogin
+	s.UserID = 0
+	s.ExpireTime = time.Now().Add(-time.Second).Unix()
+	expired, err := encodeOIDCState(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := provider.authenticate(ctx, expired, state, code); !errors.Is(err, ErrOIDCInvalidState) {
+		t.Fatalf("expired cookie: got %v, want ErrOIDCInvalidState", err)
+	}
+}
+
+func TestOIDCIDTokenValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, idp := newTestOIDCProvider(t)
+			idp.claims = tt.modify
+			ctx := context.Background()
+
+			authURL, cookie, err := provider.AuthCodeURL(ctx, OIDCPurposeLogin, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state := idp.authorize(authURL)
+			if _, _, err := provider.authenticate(ctx, cookie, state, code); !errors.Is(err, ErrOIDCInvalidIDToken) {
+				t.Fatalf("got %v, want ErrOIDCInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestOIDCEmailVerifiedClaim(t *testing.T) {
+	provider, idp := newTestOIDCProvider(t)
+	idp.claims = func(c jwt.MapClaims) { c["email_verified"] = "false" }
+	ctx := context.Background()
+
+	authURL, cookie, err := provider.AuthCodeURL(ctx, OIDCPurposeLogin, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(authURL)
+	_, claims, err := provider.authenticate(ctx, cookie, state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bool(claims.EmailVerified) {
+		t.Fatal("expected email_verified=false")
+	}
+}
+
+func TestOIDCUsernameBase(t *testing.T) {
+	long := strings.Repeat("张", 45)
+	tests := []struct {
+		claims oidcIDTokenClaims
+		want   string
+	}{
+		{oidcIDTokenClaims{PreferredUsername: "alice"}, "alice"},
+		{oidcIDTokenClaims{Email: "bo@example.com"}, "user_bo"},
+		{oidcIDTokenClaims{PreferredUsername: long}, strings.Repeat("张", 40)},
+		{oidcIDTokenClaims{Email: strings.Repeat("é", 41) + "@example.com"}, strings.Repeat("é", 40)},
+		{oidcIDTokenClaims{PreferredUsername: "a\xffb"}, "user_ab"},
+	}
+	for _, tt := range tests {
+		got := oidcUsernameBase(&tt.claims)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("%+v: got %q, want %q", tt.claims, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/models"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// apiSessionTitleMaxRunes 通过API记录的会话标题的最大长度
+const apiSessionTitleMaxRunes = 30
+
+// ResolveAPIChatOptions 生成兼容OpenAI接口的对话参数
+// 配置的系统提示词总是放在最前面，记录到已有会话时再附加会话所属工作区和助手的设置，模型以请求为准
+func ResolveAPIChatOptions(session *models.ChatSession) (ChatOptions, error) {
+	var opts ChatOptions
+	if session != nil {
+		resolved, err := ResolveChatOptions(session, false)
+		if err != nil {
+			return opts, err
+		}
+		opts.SystemPrompt = resolved.SystemPrompt
+		opts.Params = resolved.Params
+	}
+	if policy := strings.TrimSpace(config.AppConfig.OpenAI.SystemPrompt); policy != "" {
+		if opts.SystemPrompt != "" {
+			opts.SystemPrompt = policy + "\n\n" + opts.SystemPrompt
+		} else {
+			opts.SystemPrompt = policy
+		}
+	}
+	return opts, nil
+}
+
+// CreateAPISession 为通过API发起的对话创建个人会话，标题取自提问
+func CreateAPISession(userID uint, question string) (*models.ChatSession, error) {
+	title := strings.TrimSpace(question)
+	if runes := []rune(title); len(runes) > apiSessionTitleMaxRunes {
+		title = string(runes[:apiSessionTitleMaxRunes])
+	}
+	if title == "" {
+		title = "API 对话"
+	}
+	session := &models.ChatSession{
+		SessionID: uuid.New().String(),
+		UserID:    userID,
+		Title:     title,
+	}
+	if err := SaveChatSession(session); err != nil {
+		return nil, fmt.Errorf("创建会话失败: %w", err)
+	}
+	return session, nil
+}
+
+// SaveAPIExchange 将通过API完成的一问一答记录到会话中，只记录最后一条用户消息和回答
+func SaveAPIExchange(session *models.ChatSession, userID uint, question, model string, result ChatResult) error {
+	messageID := uuid.New().String()
+	userMessage := models.ChatMessage{
+		UserID:    userID,
+		SessionID: session.SessionID,
+		Role:      "user",
+		MessageID: messageID,
+		Content:   question,
+		IsActive:  true,
+		Version:   1,
+	}
+	if err := SaveMessage(&userMessage); err != nil {
+		return fmt.Errorf("保存消息失败: %w", err)
+	}
+	PublishSessionEvent(session.SessionID, SessionEventMessageCreated, userID, userMessage)
+
+	params := result.Params
+	aiMessage := models.ChatMessage{
+		SessionID:        session.SessionID,
+		Role:             "ai",
+		MessageID:        messageID,
+		ThinkContent:     result.Thinking,
+		Content:          result.Content,
+		Version:          1,
+		IsActive:         true,
+		ModelName:        model,
+		GenerationParams: &params,
+		SystemPrompt:     result.SystemPrompt,
+	}
+	if err := SaveMessage(&aiMessage); err != nil {
+		return fmt.Errorf("保存回答失败: %w", err)
+	}
+	PublishSessionEvent(session.SessionID, SessionEventMessageCompleted, userID, aiMessage)
+
+	return UpdateLastMessageTime(session.SessionID)
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPromptTemplateNotFound 模板不存在错误
+	ErrPromptTemplateNotFound = errors.New("prompt template not found")
+
+	// ErrPromptTemplateForbidden 无权修改模板错误
+	ErrPromptTemplateForbidden = errors.New("prompt template permission denied")
+)
+
+// MissingPromptVariablesError 渲染模板时缺少必填变量
+type MissingPromptVariablesError struct {
+	Names []string
+}
+
+func (e *MissingPromptVariablesError) Error() string {
+	return "missing prompt variables: " + strings.Join(e.Names, ", ")
+}
+
+// promptVariablePattern 匹配 {{变量名}}，变量名两侧允许空格
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([\p{L}\p{N}_.-]+)\s*\}\}`)
+
+// parsePromptVariables 按首次出现的顺序提取内容中的变量，并合并请求中对变量的说明
+// 说明中不存在于内容的变量会被忽略
+func parsePromptVariables(content string, declared []models.PromptVariable) []models.PromptVariable {
+	byName := make(map[string]models.PromptVariable, len(declared))
+	for _, variable := range declared {
+		byName[variable.Name] = variable
+	}
+
+	variables := []models.PromptVariable{}
+	seen := make(map[string]bool)
+	for _, match := range promptVariablePattern.FindAllStringSubmatch(content, -1) {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		variable := byName[name]
+		variable.Name = name
+		variable.Description = truncateUTF8(variable.Description, 200)
+		variable.Required = variable.Default == ""
+		variables = append(variables, variable)
+	}
+	return variables
+}
+
+// RenderPromptTemplate 用变量值替换模板中的变量，缺少必填变量时返回 MissingPromptVariablesError
+func RenderPromptTemplate(template *models.PromptTemplate, values map[string]string) (string, error) {
+	resolved := make(map[string]string, len(template.Variables))
+	var missing []string
+	for _, variable := range template.Variables {
+		value, ok := values[variable.Name]
+		if !ok || strings.TrimSpace(value) == "" {
+			value = variable.Default
+		}
+		if value == "" && variable.Required {
+			missing = append(missing, variable.Name)
+		}
+		resolved[variable.Name] = value
+	}
+	if len(missing) > 0 {
+		return "", &MissingPromptVariablesError{Names: missing}
+	}
+
+	return promptVariablePattern.ReplaceAllStringFunc(template.Content, func(placeholder string) string {
+		name := promptVariablePattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := resolved[name]; ok {
+			return value
+		}
+		return placeholder
+	}), nil
+}
+
+// ListPromptTemplates 获取用户可以使用的模板
+func ListPromptTemplates(userID uint, query models.PromptTemplateListQuery) ([]models.PromptTemplate, error) {
+	db := database.GetDB()
+	tx := db.Model(&models.PromptTemplate{})
+	switch {
+	case query.WorkspaceID == nil:
+		workspaceIDs := db.Model(&models.WorkspaceMember{}).Select("workspace_id").Where("user_id = ?", userID)
+		tx = tx.Where("(workspace_id IS NULL AND user_id = ?) OR workspace_id IN (?)", userID, workspaceIDs)
+	case *query.WorkspaceID == 0:
+		tx = tx.Where("workspace_id IS NULL AND user_id = ?", userID)
+	default:
+		if _, err := RequireWorkspaceRole(*query.WorkspaceID, userID, models.WorkspaceRoleViewer); err != nil {
+			return nil, err
+		}
+		tx = tx.Where("workspace_id = ?", *query.WorkspaceID)
+	}
+	if query.Keyword != "" {
+		like := "%" + query.Keyword + "%"
+		tx = tx.Where("title LIKE ? OR description LIKE ?", like, like)
+	}
+	if query.Sort == "popular" {
+		tx = tx.Order("usage_count DESC, updated_at DESC")
+	} else {
+		tx = tx.Order("updated_at DESC")
+	}
+
+	var templates []models.PromptTemplate
+	if err := tx.Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("查询模板失败: %w", err)
+	}
+	return templates, nil
+}
+
+// GetPromptTemplate 获取模板，个人模板只有创建者可以查看，工作区模板成员均可查看
+func GetPromptTemplate(userID, templateID uint) (*models.PromptTemplate, error) {
+	var template models.PromptTemplate
+	if err := database.GetDB().First(&template, templateID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return nil, err
+	}
+
+	if template.WorkspaceID == nil {
+		if template.UserID != userID {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return &template, nil
+	}
+	role, err := GetWorkspaceRole(*template.WorkspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, ErrPromptTemplateNotFound
+	}
+	return &template, nil
+}
+
+// getEditablePromptTemplate 获取用户可以修改的模板
+// 工作区模板可以由创建者（至少为编辑者）或工作区所有者修改
+func getEditablePromptTemplate(userID, templateID uint) (*models.PromptTemplate, error) {
+	template, err := GetPromptTemplate(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template.WorkspaceID == nil {
+		return template, nil
+	}
+	role, err := GetWorkspaceRole(*template.WorkspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == models.WorkspaceRoleOwner ||
+		(template.UserID == userID && workspaceRoleRank[role] >= workspaceRoleRank[models.WorkspaceRoleEditor]) {
+		return template, nil
+	}
+	return nil, ErrPromptTemplateForbidden
+}
+
+// CreatePromptTemplate 创建模板，在工作区中创建需要编辑者权限
+func CreatePromptTemplate(userID uint, req models.CreatePromptTemplateRequest) (*models.PromptTemplate, error) {
+	if req.WorkspaceID != nil {
+		if _, err := RequireWorkspaceRole(*req.WorkspaceID, userID, models.WorkspaceRoleEditor); err != nil {
+			return nil, err
+		}
+	}
+
+	template := models.PromptTemplate{
+		UserID:      userID,
+		WorkspaceID: req.WorkspaceID,
+		Title:       req.Title,
+		Description: req.Description,
+		Content:     req.Content,
+		Variables:   parsePromptVariables(req.Content, req.Variables),
+	}
+	if err := database.GetDB().Create(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// UpdatePromptTemplate 修改模板，修改内容或变量说明时重新提取变量
+func UpdatePromptTemplate(userID, templateID uint, req models.UpdatePromptTemplateRequest) (*models.PromptTemplate, error) {
+	template, err := getEditablePromptTemplate(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	// variables 使用 JSON 序列化，需要通过结构体更新
+	var columns []string
+	if req.Title != nil {
+		template.Title = *req.Title
+		columns = append(columns, "title")
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+		columns = append(columns, "description")
+	}
+	if req.Content != nil || req.Variables != nil {
+		if req.Content != nil {
+			template.Content = *req.Content
+		}
+		declared := template.Variables
+		if req.Variables != nil {
+			declared = req.Variables
+		}
+		template.Variables = parsePromptVariables(template.Content, declared)
+		columns = append(columns, "content", "variables")
+	}
+
+	if len(columns) > 0 {
+		if err := database.GetDB().Model(template).Select(columns).Updates(template).Error; err != nil {
+			return nil, err
+		}
+	}
+	return GetPromptTemplate(userID, templateID)
+}
+
+// DeletePromptTemplate 删除模板
+func DeletePromptTemplate(userID, templateID uint) error {
+	template, err := getEditablePromptTemplate(userID, templateID)
+	if err != nil {
+		return err
+	}
+	return database.GetDB().Delete(template).Error
+}
+
+// RenderPromptTemplateForUser 获取用户可以使用的模板并用变量值渲染
+func RenderPromptTemplateForUser(userID, templateID uint, values map[string]string) (string, error) {
+	template, err := GetPromptTemplate(userID, templateID)
+	if err != nil {
+		return "", err
+	}
+	return RenderPromptTemplate(template, values)
+}
+
+// IncrementPromptTemplateUsage 增加模板的使用次数
+func IncrementPromptTemplateUsage(templateID uint) error {
+	return database.GetDB().Model(&models.PromptTemplate{}).Where("id = ?", templateID).
+		UpdateColumn("usage_count", gorm.Expr("usage_count + 1")).Error
+}
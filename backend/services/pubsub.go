@@ -0,0 +1,115 @@
+package services
+
+import (
+	"sync"
+)
+
+// PubSub 发布订阅接口，目前使用进程内实现，多实例部署时可替换为Redis等实现
+type PubSub interface {
+	// Publish 向主题发布消息
+	Publish(topic string, payload []byte) error
+	// Subscribe 订阅主题，使用完毕后需调用 Subscription.Close
+	Subscribe(topic string) (Subscription, error)
+}
+
+// Subscription 主题订阅
+type Subscription interface {
+	// Messages 返回接收消息的通道，订阅关闭后通道关闭
+	Messages() <-chan []byte
+	// Close 取消订阅
+	Close()
+}
+
+// subscriptionBuffer 每个订阅缓存的消息数，消费过慢时丢弃新消息
+const subscriptionBuffer = 256
+
+var (
+	pubSub   PubSub = NewMemoryPubSub()
+	pubSubMu sync.RWMutex
+)
+
+// SetPubSub 设置全局发布订阅实现
+func SetPubSub(ps PubSub) {
+	pubSubMu.Lock()
+	defer pubSubMu.Unlock()
+	pubSub = ps
+}
+
+// GetPubSub 获取全局发布订阅实现
+func GetPubSub() PubSub {
+	pubSubMu.RLock()
+	defer pubSubMu.RUnlock()
+	return pubSub
+}
+
+// MemoryPubSub 进程内发布订阅
+type MemoryPubSub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*memorySubscription]struct{}
+}
+
+// NewMemoryPubSub 创建进程内发布订阅
+func NewMemoryPubSub() *MemoryPubSub {
+	return &MemoryPubSub{topics: make(map[string]map[*memorySubscription]struct{})}
+}
+
+// Publish 向主题的全部订阅者发送消息，订阅者缓冲区已满时丢弃该消息，避免阻塞发布方
+func (h *MemoryPubSub) Publish(topic string, payload []byte) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.topics[topic] {
+		select {
+		case sub.ch <- payload:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅主题
+func (h *MemoryPubSub) Subscribe(topic string) (Subscription, error) {
+	sub := &memorySubscription{hub: h, topic: topic, ch: make(chan []byte, subscriptionBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*memorySubscription]struct{})
+	}
+	h.topics[topic][sub] = struct{}{}
+	return sub, nil
+}
+
+// unsubscribe 移除订阅并关闭通道
+func (h *MemoryPubSub) unsubscribe(sub *memorySubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs, ok := h.topics[sub.topic]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.topics, sub.topic)
+	}
+	close(sub.ch)
+}
+
+// memorySubscription 进程内订阅
+type memorySubscription struct {
+	hub   *MemoryPubSub
+	topic string
+	ch    chan []byte
+}
+
+// Messages 返回接收消息的通道
+func (s *memorySubscription) Messages() <-chan []byte {
+	return s.ch
+}
+
+// Close 取消订阅，可重复调用
+func (s *memorySubscription) Close() {
+	s.hub.unsubscribe(s)
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RealtimeTicketTTL 实时协作连接票据的有效期，票据只能使用一次
+const RealtimeTicketTTL = 30 * time.Second
+
+// ErrInvalidRealtimeTicket 票据不存在、已使用或已过期错误
+var ErrInvalidRealtimeTicket = errors.New("invalid realtime ticket")
+
+// 会话实时事件类型
+const (
+	SessionEventMessageCreated    = "message.created"    // 新的用户消息
+	SessionEventMessageDelta      = "message.delta"      // AI回答的流式片段，格式与HTTP流式响应一致
+	SessionEventMessageCompleted  = "message.completed"  // AI回答生成完成
+	SessionEventResponseActivated = "response.activated" // 切换了回答版本
+	SessionEventSessionUpdated    = "session.updated"    // 会话标题或置顶状态变化
+	SessionEventSessionDeleted    = "session.deleted"    // 会话被删除
+	SessionEventPresence          = "presence"           // 在线查看者变化
+)
+
+// SessionEvent 推送给会话查看者的事件
+type SessionEvent struct {
+	Type      string      `json:"type"`
+	SessionID string      `json:"session_id"`
+	UserID    uint        `json:"user_id,omitempty"` // 触发事件的用户
+	Data      interface{} `json:"data,omitempty"`
+	Time      time.Time   `json:"time"`
+}
+
+// sessionTopic 返回会话对应的发布订阅主题
+func sessionTopic(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// PublishSessionEvent 向会话的全部查看者广播事件，失败只记录日志
+func PublishSessionEvent(sessionID, eventType string, userID uint, data interface{}) {
+	payload, err := json.Marshal(SessionEvent{
+		Type:      eventType,
+		SessionID: sessionID,
+		UserID:    userID,
+		Data:      data,
+		Time:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("序列化会话事件失败: %v", err)
+		return
+	}
+	if err := GetPubSub().Publish(sessionTopic(sessionID), payload); err != nil {
+		log.Printf("发布会话事件失败: %v", err)
+	}
+}
+
+// SubscribeSession 订阅会话事件
+func SubscribeSession(sessionID string) (Subscription, error) {
+	return GetPubSub().Subscribe(sessionTopic(sessionID))
+}
+
+// SessionStreamWriter 将AI回答的流式输出同步广播给会话的其他查看者
+type SessionStreamWriter struct {
+	SessionID string
+	MessageID string
+	Version   int
+	UserID    uint
+}
+
+// Write 实现io.Writer接口，广播失败不影响流式输出
+func (w *SessionStreamWriter) Write(p []byte) (int, error) {
+	PublishSessionEvent(w.SessionID, SessionEventMessageDelta, w.UserID, map[string]interface{}{
+		"message_id": w.MessageID,
+		"version":    w.Version,
+		"delta":      string(p),
+	})
+	return len(p), nil
+}
+
+// PresenceUser 正在查看会话的用户
+type PresenceUser struct {
+	UserID      uint   `json:"user_id"`
+	Username    string `json:"username"`
+	Avatar      string `json:"avatar"`
+	Connections int    `json:"connections"` // 同一用户可能打开多个窗口
+}
+
+// sessionPresence 记录本实例上每个会话的在线查看者
+var sessionPresence = struct {
+	sync.Mutex
+	sessions map[string]map[uint]*PresenceUser
+}{sessions: make(map[string]map[uint]*PresenceUser)}
+
+// presenceSnapshot 返回会话当前的查看者列表，调用方需持有锁
+func presenceSnapshot(sessionID string) []PresenceUser {
+	users := make([]PresenceUser, 0, len(sessionPresence.sessions[sessionID]))
+	for _, user := range sessionPresence.sessions[sessionID] {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users
+}
+
+// JoinSessionPresence 记录用户开始查看会话并广播最新的查看者列表
+func JoinSessionPresence(sessionID string, user *models.User) []PresenceUser {
+	sessionPresence.Lock()
+	viewers := sessionPresence.sessions[sessionID]
+	if viewers == nil {
+		viewers = make(map[uint]*PresenceUser)
+		sessionPresence.sessions[sessionID] = viewers
+	}
+	if existing, ok := viewers[user.ID]; ok {
+		existing.Connections++
+	} else {
+		viewers[user.ID] = &PresenceUser{UserID: user.ID, Username: user.Username, Avatar: user.Avatar, Connections: 1}
+	}
+	snapshot := presenceSnapshot(sessionID)
+	sessionPresence.Unlock()
+
+	PublishSessionEvent(sessionID, SessionEventPresence, user.ID, map[string]interface{}{"action": "join", "viewers": snapshot})
+	return snapshot
+}
+
+// LeaveSessionPresence 记录用户离开会话并广播最新的查看者列表
+func LeaveSessionPresence(sessionID string, userID uint) {
+	sessionPresence.Lock()
+	if viewers := sessionPresence.sessions[sessionID]; viewers != nil {
+		if existing, ok := viewers[userID]; ok {
+			existing.Connections--
+			if existing.Connections <= 0 {
+				delete(viewers, userID)
+			}
+		}
+		if len(viewers) == 0 {
+			delete(sessionPresence.sessions, sessionID)
+		}
+	}
+	snapshot := presenceSnapshot(sessionID)
+	sessionPresence.Unlock()
+
+	PublishSessionEvent(sessionID, SessionEventPresence, userID, map[string]interface{}{"action": "leave", "viewers": snapshot})
+}
+
+// IssueRealtimeTicket 为已登录用户签发连接会话实时协作的一次性票据，数据库只保存哈希值
+func IssueRealtimeTicket(token string, userID uint, sessionID string) (string, error) {
+	db := database.GetDB()
+	var userSession models.UserSession
+	if err := db.Where("token = ? AND user_id = ?", token, userID).First(&userSession).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrInvalidToken
+		}
+		return "", err
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("生成票据失败: %w", err)
+	}
+	ticket := hex.EncodeToString(random)
+
+	now := time.Now()
+	// 顺便清理过期未使用的票据
+	if err := db.Where("expire_time < ?", now).Delete(&models.RealtimeTicket{}).Error; err != nil {
+		return "", err
+	}
+	err := db.Create(&models.RealtimeTicket{
+		TicketHash:    hashAPIKey(ticket),
+		UserID:        userID,
+		UserSessionID: userSession.ID,
+		SessionID:     sessionID,
+		ExpireTime:    now.Add(RealtimeTicketTTL),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// ConsumeRealtimeTicket 校验并作废票据，票据必须是为该会话签发的
+func ConsumeRealtimeTicket(ticket, sessionID string) (*models.RealtimeTicket, error) {
+	db := database.GetDB()
+	var record models.RealtimeTicket
+	if err := db.Where("ticket_hash = ?", hashAPIKey(ticket)).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRealtimeTicket
+		}
+		return nil, err
+	}
+	// 并发使用同一票据时只有一个请求能删除成功
+	result := db.Delete(&models.RealtimeTicket{}, record.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 || record.SessionID != sessionID || !record.ExpireTime.After(time.Now()) {
+		return nil, ErrInvalidRealtimeTicket
+	}
+	return &record, nil
+}
+
+// CheckRealtimeAccess 检查实时协作连接是否仍然有效：登录会话未登出或过期，会话未删除且用户仍有查看权限
+func CheckRealtimeAccess(userSessionID, userID uint, sessionID string) error {
+	var count int64
+	err := database.GetDB().Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND expire_time > ?", userSessionID, userID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidToken
+	}
+
+	session, err := GetSessionByID(sessionID)
+	if err != nil {
+		return err
+	}
+	return CheckSessionAccess(userID, session, SessionPermissionRead)
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRoleNotFound 角色不存在错误
+	ErrRoleNotFound = errors.New("role not found")
+
+	// ErrRoleExists 角色已存在错误
+	ErrRoleExists = errors.New("role already exists")
+
+	// ErrBuiltInRole 内置角色不可修改或删除错误
+	ErrBuiltInRole = errors.New("built-in role cannot be modified")
+
+	// ErrUnknownPermission 未知权限错误
+	ErrUnknownPermission = errors.New("unknown permission")
+
+	// ErrPermissionEscalation 授予了操作人自己没有的权限错误
+	ErrPermissionEscalation = errors.New("cannot grant permissions the operator does not hold")
+)
+
+// SeedBuiltInRoles 确保内置角色存在
+func SeedBuiltInRoles() error {
+	db := database.GetDB()
+	builtIns := []models.Role{
+		{Name: models.RoleUser, Description: "普通用户", Permissions: []string{}, BuiltIn: true},
+		{Name: models.RoleAdmin, Description: "管理员", Permissions: []string{models.PermissionAll}, BuiltIn: true},
+	}
+
+	for i := range builtIns {
+		if err := db.Where("name = ?", builtIns[i].Name).FirstOrCreate(&builtIns[i]).Error; err != nil {
+			return fmt.Errorf("初始化角色 %s 失败: %w", builtIns[i].Name, err)
+		}
+	}
+
+	// 为引入角色之前注册、尚无任何角色的用户补充普通用户角色
+	err := db.Exec(`INSERT INTO user_roles (user_id, role_id, created_at, updated_at)
+		SELECT u.id, ?, NOW(), NOW() FROM users u
+		WHERE u.deleted_at IS NULL AND NOT EXISTS (
+			SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id AND ur.deleted_at IS NULL
+		)`, builtIns[0].ID).Error
+	if err != nil {
+		return fmt.Errorf("补充默认角色失败: %w", err)
+	}
+	return nil
+}
+
+// BootstrapAdmins 为配置中指定的账号（用户名、邮箱或手机号）授予管理员角色
+func BootstrapAdmins(accounts []string) error {
+	db := database.GetDB()
+	for _, account := range accounts {
+		var user models.User
+		err := db.Where("username = ? OR email = ? OR phone = ?", account, account, account).First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("初始管理员账号不存在: %s", account)
+				continue
+			}
+			return err
+		}
+		if err := AssignRole(user.ID, models.RoleAdmin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignDefaultRole 为新注册用户分配普通用户角色
+func assignDefaultRole(tx *gorm.DB, userID uint) error {
+	var role models.Role
+	if err := tx.Where("name = ?", models.RoleUser).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	return tx.Create(&models.UserRole{UserID: userID, RoleID: role.ID}).Error
+}
+
+// AssignRole 为用户分配角色，已拥有时忽略
+func AssignRole(userID uint, roleName string) error {
+	db := database.GetDB()
+
+	var role models.Role
+	if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+
+	userRole := models.UserRole{UserID: userID, RoleID: role.ID}
+	return db.Where("user_id = ? AND role_id = ?", userID, role.ID).FirstOrCreate(&userRole).Error
+}
+
+// RemoveRole 移除用户的角色
+func RemoveRole(userID uint, roleName string) error {
+	db := database.GetDB()
+
+	var role models.Role
+	if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+
+	return db.Unscoped().Where("user_id = ? AND role_id = ?", userID, role.ID).Delete(&models.UserRole{}).Error
+}
+
+// GetUserRoleNames 获取用户拥有的角色名称
+func GetUserRoleNames(userID uint) ([]string, error) {
+	db := database.GetDB()
+	var names []string
+	err := db.Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id AND user_roles.deleted_at IS NULL").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询用户角色失败: %w", err)
+	}
+	return names, nil
+}
+
+// GetUserPermissions 获取用户通过角色获得的全部权限
+// 权限在每次请求时从数据库读取，不使用令牌中的角色，修改角色权限或分配关系后立即生效
+func GetUserPermissions(userID uint) ([]string, error) {
+	db := database.GetDB()
+	var roles []models.Role
+	err := db.Joins("JOIN user_roles ON user_roles.role_id = roles.id AND user_roles.deleted_at IS NULL").
+		Where("user_roles.user_id = ?", userID).
+		Find(&roles).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询用户权限失败: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// hasPermission 判断权限集合是否包含指定权限，拥有全部权限时总是返回true
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == models.PermissionAll || p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCanGrant 校验操作人拥有全部指定权限，防止通过角色授予自己或他人更高的权限
+// 授予全部权限（*）要求操作人本身拥有全部权限
+func checkCanGrant(operatorPermissions, permissions []string) error {
+	for _, p := range permissions {
+		if !hasPermission(operatorPermissions, p) {
+			return fmt.Errorf("%w: %s", ErrPermissionEscalation, p)
+		}
+	}
+	return nil
+}
+
+// UserHasPermission 判断用户当前是否拥有指定权限
+func UserHasPermission(userID uint, permission string) (bool, error) {
+	permissions, err := GetUserPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+	return hasPermission(permissions, permission), nil
+}
+
+// validatePermissions 校验权限标识是否合法
+func validatePermissions(permissions []string) error {
+	for _, p := range permissions {
+		known := false
+		for _, k := range models.AllPermissions {
+			if p == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+	}
+	return nil
+}
+
+// ListRoles 获取全部角色
+func ListRoles() ([]models.Role, error) {
+	db := database.GetDB()
+	var roles []models.Role
+	if err := db.Order("id ASC").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("查询角色失败: %w", err)
+	}
+	return roles, nil
+}
+
+// CreateRole 创建自定义角色，角色的权限不能超出操作人拥有的权限
+func CreateRole(operatorID uint, req models.CreateRoleRequest) (*models.Role, error) {
+	db := database.GetDB()
+
+	if err := validatePermissions(req.Permissions); err != nil {
+		return nil, err
+	}
+	operatorPermissions, err := GetUserPermissions(operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCanGrant(operatorPermissions, req.Permissions); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := db.Model(&models.Role{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrRoleExists
+	}
+	// 清理早期版本软删除后残留的同名角色，否则会与名称的唯一索引冲突
+	if err := db.Unscoped().Where("name = ? AND deleted_at IS NOT NULL", req.Name).Delete(&models.Role{}).Error; err != nil {
+		return nil, err
+	}
+
+	permissions := req.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+	role := models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+	}
+	if err := db.Create(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrRoleExists
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UpdateRole 更新自定义角色的描述和权限，修改前后的权限都不能超出操作人拥有的权限
+func UpdateRole(operatorID, roleID uint, req models.UpdateRoleRequest) (*models.Role, error) {
+	db := database.GetDB()
+
+	var role models.Role
+	if err := db.First(&role, roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+
+	// 内置角色的权限固定，只允许修改描述
+	if req.Permissions != nil {
+		if role.BuiltIn {
+			return nil, ErrBuiltInRole
+		}
+		if err := validatePermissions(req.Permissions); err != nil {
+			return nil, err
+		}
+		operatorPermissions, err := GetUserPermissions(operatorID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCanGrant(operatorPermissions, append(req.Permissions, role.Permissions...)); err != nil {
+			return nil, err
+		}
+		role.Permissions = req.Permissions
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+
+	if err := db.Save(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// DeleteRole 删除自定义角色及其分配关系，角色直接物理删除以便之后重新创建同名角色
+func DeleteRole(roleID uint) error {
+	db := database.GetDB()
+
+	var role models.Role
+	if err := db.First(&role, roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRoleNotFound
+		}
+		return err
+	}
+	if role.BuiltIn {
+		return ErrBuiltInRole
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("role_id = ?", role.ID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&role).Error
+	})
+}
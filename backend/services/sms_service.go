@@ -0,0 +1,403 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSMSTooFrequent 验证码发送过于频繁错误
+	ErrSMSTooFrequent = errors.New("sms code requested too frequently")
+
+	// ErrSMSDailyLimitExceeded 当日验证码发送次数超限错误
+	ErrSMSDailyLimitExceeded = errors.New("sms daily limit exceeded")
+
+	// ErrInvalidSMSCode 验证码错误
+	ErrInvalidSMSCode = errors.New("invalid sms code")
+
+	// ErrSMSCodeExpired 验证码不存在或已过期错误
+	ErrSMSCodeExpired = errors.New("sms code expired or not found")
+
+	// ErrSMSCodeAttemptsExceeded 验证码校验次数超限错误
+	ErrSMSCodeAttemptsExceeded = errors.New("sms code attempts exceeded")
+
+	// ErrPhoneNotBound 账号未绑定手机号错误
+	ErrPhoneNotBound = errors.New("phone number not bound")
+
+	// ErrInvalidPhone 手机号格式不正确错误
+	ErrInvalidPhone = errors.New("invalid phone number")
+)
+
+// 验证码用途，不同用途的验证码不能混用
+const (
+	smsPurposeLogin         = "login"
+	smsPurposeDeleteAccount = "delete_account"
+)
+
+// SMSSender 短信网关接口，不同的短信服务商实现该接口即可接入
+type SMSSender interface {
+	Send(phone, content string) error
+}
+
+// ConsoleSMSSender 将短信内容打印到日志，仅用于开发环境
+type ConsoleSMSSender struct{}
+
+// Send 实现SMSSender接口
+func (ConsoleSMSSender) Send(phone, content string) error {
+	log.Printf("[SMS] 发送至 %s: %s", phone, content)
+	return nil
+}
+
+var smsSender SMSSender = ConsoleSMSSender{}
+
+// NewSMSSender 根据配置的服务商名称创建短信网关
+func NewSMSSender(provider string) (SMSSender, error) {
+	switch provider {
+	case "", "console":
+		return ConsoleSMSSender{}, nil
+	default:
+		return nil, fmt.Errorf("不支持的短信服务商: %s", provider)
+	}
+}
+
+// SetSMSSender 设置短信网关
+func SetSMSSender(sender SMSSender) {
+	smsSender = sender
+}
+
+// smsSettings 返回填充了默认值的短信配置
+func smsSettings() config.SMSConfig {
+	cfg := config.AppConfig.SMS
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 300
+	}
+	if cfg.SendInterval <= 0 {
+		cfg.SendInterval = 60
+	}
+	if cfg.DailyLimit <= 0 {
+		cfg.DailyLimit = 10
+	}
+	if cfg.IPHourlyLimit <= 0 {
+		cfg.IPHourlyLimit = 20
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.DefaultCountryCode == "" {
+		cfg.DefaultCountryCode = "86"
+	}
+	return cfg
+}
+
+// NormalizePhone 将手机号统一为 E.164 格式，例如 +8613800000000
+// 允许空格、连字符和括号，00 开头视为国际区号，不带区号的号码使用配置的默认区号
+// 发送频率、校验次数和账号查询都以统一后的号码为准，避免同一号码的不同写法绕过限制
+func NormalizePhone(phone string) (string, error) {
+	countryCode := strings.TrimPrefix(smsSettings().DefaultCountryCode, "+")
+
+	var digits strings.Builder
+	international := false
+	for _, r := range phone {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && digits.Len() == 0 && !international:
+			international = true
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		number, international = number[2:], true
+	}
+	if !international {
+		// 国内号码去掉长途前缀 0，已带默认区号的号码不再重复添加
+		number = strings.TrimPrefix(number, "0")
+		if !(strings.HasPrefix(number, countryCode) && len(number) >= len(countryCode)+10) {
+			number = countryCode + number
+		}
+	}
+	// E.164 最长 15 位
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// canonicalPhone 返回已保存手机号的统一格式，无法识别时原样返回
+func canonicalPhone(phone string) string {
+	if normalized, err := NormalizePhone(phone); err == nil {
+		return normalized
+	}
+	return phone
+}
+
+// phoneLookupValues 返回查询账号时匹配的手机号，包括统一格式之前保存的不带默认区号的写法
+func phoneLookupValues(phone string) []string {
+	values := []string{phone}
+	prefix := "+" + strings.TrimPrefix(smsSettings().DefaultCountryCode, "+")
+	if national := strings.TrimPrefix(phone, prefix); national != phone {
+		values = append(values, national)
+	}
+	return values
+}
+
+// hashSMSCode 计算验证码的哈希值，绑定手机号防止跨号码复用
+func hashSMSCode(phone, code string) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWT.Secret))
+	mac.Write([]byte(phone + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSMSCode 生成6位数字验证码
+func generateSMSCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// SendSMSCode 向手机号发送登录验证码，手机号格式不正确时返回 ErrInvalidPhone
+func SendSMSCode(phone, ip string) error {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return err
+	}
+	return sendSMSCode(phone, ip, smsPurposeLogin, "您的登录验证码为 %s，%d 分钟内有效，请勿泄露给他人。")
+}
+
+// SendAccountDeletionSMSCode 向用户绑定的手机号发送注销账号的确认验证码
+func SendAccountDeletionSMSCode(userID uint, ip string) error {
+	var user models.User
+	if err := database.GetDB().Select("id, phone").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if user.Phone == "" {
+		return ErrPhoneNotBound
+	}
+	return sendSMSCode(canonicalPhone(user.Phone), ip, smsPurposeDeleteAccount, "您正在申请注销账号，验证码为 %s，%d 分钟内有效。如非本人操作请忽略。")
+}
+
+// sendSMSCode 发送指定用途的验证码，content 为包含验证码和有效分钟数的短信模板
+func sendSMSCode(phone, ip, purpose, content string) error {
+	db := database.GetDB()
+	cfg := smsSettings()
+	now := time.Now()
+
+	// 同一手机号发送间隔限制
+	var count int64
+	if err := db.Model(&models.SMSCode{}).
+		Where("phone = ? AND created_at > ?", phone, now.Add(-time.Duration(cfg.SendInterval)*time.Second)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSMSTooFrequent
+	}
+
+	// 同一IP每小时发送次数限制
+	if err := db.Model(&models.SMSCode{}).
+		Where("ip = ? AND created_at > ?", ip, now.Add(-time.Hour)).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(cfg.IPHourlyLimit) {
+		return ErrSMSTooFrequent
+	}
+
+	// 同一手机号每日发送次数限制
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if err := db.Model(&models.SMSCode{}).
+		Where("phone = ? AND created_at >= ?", phone, startOfDay).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count >= int64(cfg.DailyLimit) {
+		return ErrSMSDailyLimitExceeded
+	}
+
+	code, err := generateSMSCode()
+	if err != nil {
+		return err
+	}
+
+	// 上面的计数检查无法阻止并发请求同时通过，发送间隔序号的唯一索引保证同一间隔内只有一条能写入
+	sendSlot := now.Unix() / int64(cfg.SendInterval)
+	smsCode := models.SMSCode{
+		Phone:      phone,
+		CodeHash:   hashSMSCode(phone, code),
+		Purpose:    purpose,
+		ExpireTime: now.Add(time.Duration(cfg.CodeTTL) * time.Second),
+		IP:         ip,
+		SendSlot:   &sendSlot,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 旧验证码作废，保证只有最新的验证码有效
+		if err := tx.Model(&models.SMSCode{}).
+			Where("phone = ? AND purpose = ? AND used = ?", phone, purpose, false).
+			Update("used", true).Error; err != nil {
+			return err
+		}
+		return tx.Create(&smsCode).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrSMSTooFrequent
+		}
+		return err
+	}
+
+	if err := smsSender.Send(phone, fmt.Sprintf(content, code, cfg.CodeTTL/60)); err != nil {
+		db.Model(&smsCode).Update("used", true)
+		return fmt.Errorf("发送短信失败: %w", err)
+	}
+
+	return nil
+}
+
+// VerifySMSCode 校验验证码并登录，手机号未注册时自动注册
+func VerifySMSCode(req models.SMSLoginRequest, ip string) (*models.LoginResponse, error) {
+	db := database.GetDB()
+
+	phone, err := NormalizePhone(req.Phone)
+	if err != nil {
+		return nil, err
+	}
+	if err := consumeSMSCode(phone, smsPurposeLogin, req.Code); err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	err = db.Where("phone IN ?", phoneLookupValues(phone)).Order("id").First(&user).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		created, err := registerPhoneUser(phone)
+		if err != nil {
+			return nil, err
+		}
+		user = *created
+	}
+
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	return issueLoginResponse(user, ip)
+}
+
+// consumeSMSCode 校验指定用途的最新验证码，校验通过后验证码作废
+func consumeSMSCode(phone, purpose, code string) error {
+	db := database.GetDB()
+	cfg := smsSettings()
+
+	var smsCode models.SMSCode
+	err := db.Where("phone = ? AND purpose = ? AND used = ? AND expire_time > ?",
+		phone, purpose, false, time.Now()).
+		Order("id DESC").
+		First(&smsCode).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSMSCodeExpired
+		}
+		return err
+	}
+
+	// 先占用一次校验次数再比对，条件更新保证并发猜测也不会超过次数上限
+	result := db.Model(&models.SMSCode{}).
+		Where("id = ? AND used = ? AND attempts < ?", smsCode.ID, false, cfg.MaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSMSCodeAttemptsExceeded
+	}
+
+	if !hmac.Equal([]byte(smsCode.CodeHash), []byte(hashSMSCode(phone, code))) {
+		// 次数用尽后作废验证码
+		if err := db.Model(&models.SMSCode{}).
+			Where("id = ? AND attempts >= ?", smsCode.ID, cfg.MaxAttempts).
+			Update("used", true).Error; err != nil {
+			return err
+		}
+		return ErrInvalidSMSCode
+	}
+
+	// 标记为已使用，并发请求中只有一个能成功
+	result = db.Model(&models.SMSCode{}).
+		Where("id = ? AND used = ?", smsCode.ID, false).
+		Update("used", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSMSCodeExpired
+	}
+	return nil
+}
+
+// registerPhoneUser 为首次使用验证码登录的手机号创建账号
+func registerPhoneUser(phone string) (*models.User, error) {
+	db := database.GetDB()
+
+	// 账号不设置可用密码，用户可通过验证码登录
+	randomPassword := make([]byte, 32)
+	if _, err := rand.Read(randomPassword); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomPassword)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Username:  "user_" + hex.EncodeToString(suffix),
+		Password:  string(hashedPassword),
+		Phone:     phone,
+		LoginType: models.LoginTypePhone,
+		Status:    1,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.UserSettings{UserID: user.ID}).Error; err != nil {
+			return err
+		}
+		return assignDefaultRole(tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"errors"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	prev := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = prev })
+	config.AppConfig = &config.Config{}
+
+	// 同一号码的不同写法统一为相同的格式
+	for _, phone := range []string{
+		"13800000000",
+		"+8613800000000",
+		"8613800000000",
+		"008613800000000",
+		"+86 138 0000 0000",
+		"138-0000-0000",
+		" (+86) 13800000000 ",
+	} {
+		got, err := NormalizePhone(phone)
+		if err != nil || got != "+8613800000000" {
+			t.Errorf("%q: got %q, %v, want +8613800000000", phone, got, err)
+		}
+	}
+
+	if got, err := NormalizePhone("+1 415 555 0123"); err != nil || got != "+14155550123" {
+		t.Errorf("international: got %q, %v", got, err)
+	}
+	if got, err := NormalizePhone("010-12345678"); err != nil || got != "+861012345678" {
+		t.Errorf("landline: got %q, %v", got, err)
+	}
+
+	for _, phone := range []string{"", "12345", "1380000000a", "+86+13800000000", "+0123456789", "+1234567890123456"} {
+		if got, err := NormalizePhone(phone); !errors.Is(err, ErrInvalidPhone) {
+			t.Errorf("%q: got %q, %v, want ErrInvalidPhone", phone, got, err)
+		}
+	}
+
+	values := phoneLookupValues("+8613800000000")
+	if len(values) != 2 || values[1] != "13800000000" {
+		t.Errorf("lookup values: got %v", values)
+	}
+
+	config.AppConfig.SMS.DefaultCountryCode = "+1"
+	if got, err := NormalizePhone("4155550123"); err != nil || got != "+14155550123" {
+		t.Errorf("default country code 1: got %q, %v", got, err)
+	}
+}
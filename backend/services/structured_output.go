@@ -0,0 +1,168 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/models"
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// 结构化输出的格式
+const (
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat 要求模型输出JSON的设置，通过 NewResponseFormat 创建
+type ResponseFormat struct {
+	Type        string // json_object 或 json_schema
+	Name        string
+	Description string
+	Schema      json.RawMessage // 为 json_schema 时回答需要符合的 schema
+	Strict      bool
+
+	schema *jsonSchema
+}
+
+// StructuredOutput 结构化输出的校验结果，在回复流最后以 $structured$ 的形式返回
+type StructuredOutput struct {
+	Valid   bool            `json:"valid"`
+	Data    json.RawMessage `json:"data,omitempty"`   // 解析后的JSON对象
+	Errors  []string        `json:"errors,omitempty"` // 最后一次校验不通过的原因
+	Repairs int             `json:"repairs"`          // 要求模型修复的次数
+}
+
+// responseFormatRequest 请求中的 response_format，兼容OpenAI的格式
+type responseFormatRequest struct {
+	Type       string                     `json:"type"`
+	JSONSchema *responseJSONSchemaRequest `json:"json_schema,omitempty"`
+}
+
+type responseJSONSchemaRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema"`
+	Strict      bool            `json:"strict,omitempty"`
+}
+
+// NewResponseFormat 根据请求创建结构化输出设置，未指定或为 text 时返回 nil
+// json_schema 中的 schema 无效时返回 InvalidResponseFormatError
+func NewResponseFormat(format *models.ResponseFormat) (*ResponseFormat, error) {
+	if format == nil || format.Type == "" || format.Type == "text" {
+		return nil, nil
+	}
+	switch format.Type {
+	case ResponseFormatJSONObject:
+		return &ResponseFormat{Type: ResponseFormatJSONObject}, nil
+	case ResponseFormatJSONSchema:
+		if format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+			return nil, invalidResponseFormat("缺少 schema")
+		}
+		schema, err := compileJSONSchema(format.JSONSchema.Schema)
+		if err != nil {
+			return nil, err
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, format.JSONSchema.Schema); err != nil {
+			return nil, invalidResponseFormat("不是有效的JSON")
+		}
+		name := format.JSONSchema.Name
+		if name == "" {
+			name = "response"
+		}
+		return &ResponseFormat{
+			Type:        ResponseFormatJSONSchema,
+			Name:        name,
+			Description: format.JSONSchema.Description,
+			Schema:      compact.Bytes(),
+			Strict:      format.JSONSchema.Strict,
+			schema:      schema,
+		}, nil
+	}
+	return nil, invalidResponseFormat("不支持的输出格式 %s", format.Type)
+}
+
+// requestFormat 生成发送给模型的 response_format，模型不支持 json_schema 时退回 json_object，都不支持时返回 nil
+func (f *ResponseFormat) requestFormat(model string) *responseFormatRequest {
+	entry, _ := findModelConfig(model)
+	if f.Type == ResponseFormatJSONSchema && entry.JSONSchema {
+		return &responseFormatRequest{
+			Type: ResponseFormatJSONSchema,
+			JSONSchema: &responseJSONSchemaRequest{
+				Name:        f.Name,
+				Description: f.Description,
+				Schema:      f.Schema,
+				Strict:      f.Strict,
+			},
+		}
+	}
+	if entry.JSONOutput || entry.JSONSchema {
+		return &responseFormatRequest{Type: ResponseFormatJSONObject}
+	}
+	return nil
+}
+
+// instruction 要求模型输出JSON的系统提示词，模型不能直接按 schema 约束输出时在提示词中给出 schema
+// 部分服务商要求开启 json_object 时提示词中包含 JSON 字样，因此总是添加
+func (f *ResponseFormat) instruction(model string) string {
+	var b strings.Builder
+	b.WriteString("请只输出一个合法的 JSON 对象，不要使用 Markdown 代码块，也不要输出任何其他说明文字。")
+	request := f.requestFormat(model)
+	if f.Type == ResponseFormatJSONSchema && (request == nil || request.Type != ResponseFormatJSONSchema) {
+		b.WriteString("\nJSON 必须符合以下 JSON Schema：\n")
+		b.Write(f.Schema)
+	}
+	return b.String()
+}
+
+// check 解析并校验回答，允许回答被 Markdown 代码块包裹
+func (f *ResponseFormat) check(content string) StructuredOutput {
+	text := strings.TrimSpace(content)
+	if strings.HasPrefix(text, "```") && strings.HasSuffix(text, "```") && len(text) >= 6 {
+		text = strings.TrimSpace(strings.TrimSuffix(text, "```"))
+		if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+			text = text[newline+1:]
+		} else {
+			text = strings.TrimPrefix(text, "```")
+		}
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return StructuredOutput{Errors: []string{"回答不是有效的JSON: " + err.Error()}}
+	}
+	if _, ok := value.(map[string]interface{}); !ok && f.Type == ResponseFormatJSONObject {
+		return StructuredOutput{Errors: []string{"$: 回答必须是JSON对象"}}
+	}
+	if f.schema != nil {
+		if errs := f.schema.validate(value); len(errs) > 0 {
+			return StructuredOutput{Errors: errs}
+		}
+	}
+
+	var compact bytes.Buffer
+	json.Compact(&compact, []byte(text))
+	return StructuredOutput{Valid: true, Data: compact.Bytes()}
+}
+
+// repairPrompt 校验失败后要求模型修正回答的提示
+func (f *ResponseFormat) repairPrompt(output StructuredOutput) string {
+	var b strings.Builder
+	b.WriteString("你的上一个回答不符合要求：\n")
+	for _, err := range output.Errors {
+		b.WriteString("- ")
+		b.WriteString(err)
+		b.WriteString("\n")
+	}
+	b.WriteString("请修正后重新输出完整的 JSON，不要输出其他内容。")
+	return b.String()
+}
+
+// jsonRepairRetries 结构化输出校验失败后要求模型修复的最大次数
+func jsonRepairRetries() int {
+	if n := config.AppConfig.Chat.JSONRepairRetries; n > 0 {
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 内置工具只读取当前用户自己的数据，不访问外部网络
+func init() {
+	RegisterTool(Tool{
+		Name:        "calculator",
+		Description: "计算数学表达式，支持 + - * / % ^、括号、sqrt abs sin cos tan ln log10 exp floor ceil round pow min max 以及常量 pi 和 e",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string","description":"要计算的表达式，例如 (1+2)*3^2"}},"required":["expression"]}`),
+		Handler:     calculatorTool,
+	})
+	RegisterTool(Tool{
+		Name:        "current_time",
+		Description: "获取当前的日期和时间",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"timezone":{"type":"string","description":"IANA时区名称，例如 Asia/Shanghai，默认为服务器时区"}}}`),
+		Handler:     currentTimeTool,
+	})
+	RegisterTool(Tool{
+		Name:        "search_chat_history",
+		Description: "在用户自己的历史会话中按关键词搜索消息，只搜索与当前会话同属个人或同一工作区的会话",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"query":{"type":"string","description":"搜索关键词"},"limit":{"type":"integer","description":"返回的消息数量，默认5，最多20"}},"required":["query"]}`),
+		Handler:     searchChatHistoryTool,
+	})
+}
+
+// calculatorTool 计算数学表达式
+func calculatorTool(ctx context.Context, env ToolEnv, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("参数格式有误: %v", err)
+	}
+	value, err := evalExpression(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(value) < 1e15 {
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// currentTimeTool 获取当前时间
+func currentTimeTool(ctx context.Context, env ToolEnv, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("参数格式有误: %v", err)
+	}
+
+	now := time.Now()
+	if args.Timezone != "" {
+		location, err := time.LoadLocation(args.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("未知的时区: %s", args.Timezone)
+		}
+		now = now.In(location)
+	}
+	data, _ := json.Marshal(map[string]string{
+		"datetime": now.Format(time.RFC3339),
+		"weekday":  now.Weekday().String(),
+		"timezone": now.Location().String(),
+	})
+	return string(data), nil
+}
+
+// searchChatHistoryTool 搜索用户自己创建的会话中的消息，不包括正在回答的问题
+// 个人会话中只搜索个人会话，工作区会话中只搜索同一工作区的会话，避免私人内容出现在共享会话的回答中
+func searchChatHistoryTool(ctx context.Context, env ToolEnv, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("参数格式有误: %v", err)
+	}
+	args.Query = strings.TrimSpace(args.Query)
+	if args.Query == "" {
+		return "", errors.New("搜索关键词不能为空")
+	}
+	if args.Limit <= 0 {
+		args.Limit = 5
+	} else if args.Limit > 20 {
+		args.Limit = 20
+	}
+
+	session, err := GetSessionByID(env.SessionID)
+	if err != nil {
+		return "", err
+	}
+	scope := database.GetDB().Where("chat_sessions.workspace_id IS NULL")
+	if session.WorkspaceID != nil {
+		scope = database.GetDB().Where("chat_sessions.workspace_id = ?", *session.WorkspaceID)
+	}
+
+	var rows []struct {
+		SessionID    string
+		SessionTitle string
+		Role         string
+		Content      string
+		CreatedAt    time.Time
+	}
+	err = database.GetDB().WithContext(ctx).Model(&models.ChatMessage{}).
+		Select("chat_messages.session_id, chat_sessions.title AS session_title, chat_messages.role, chat_messages.content, chat_messages.created_at").
+		Joins("JOIN chat_sessions ON chat_sessions.session_id = chat_messages.session_id AND chat_sessions.deleted_at IS NULL").
+		Where("chat_sessions.user_id = ? AND chat_messages.message_id <> ?", env.UserID, env.MessageID).
+		Where(scope).
+		Where("chat_messages.content LIKE ?", "%"+args.Query+"%").
+		Order("chat_messages.id DESC").
+		Limit(args.Limit).
+		Scan(&rows).Error
+	if err != nil {
+		return "", fmt.Errorf("搜索历史消息失败: %w", err)
+	}
+
+	type item struct {
+		SessionID    string `json:"session_id"`
+		SessionTitle string `json:"session_title"`
+		Role         string `json:"role"`
+		Content      string `json:"content"`
+		CreatedAt    string `json:"created_at"`
+	}
+	items := make([]item, 0, len(rows))
+	for _, row := range rows {
+		content := []rune(row.Content)
+		if len(content) > 500 {
+			content = append(content[:500], '…')
+		}
+		items = append(items, item{
+			SessionID:    row.SessionID,
+			SessionTitle: row.SessionTitle,
+			Role:         row.Role,
+			Content:      string(content),
+			CreatedAt:    row.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// evalExpression 计算数学表达式
+func evalExpression(expression string) (float64, error) {
+	if len(expression) > 1000 {
+		return 0, errors.New("表达式过长")
+	}
+	p := &exprParser{input: []rune(expression)}
+	value, err := p.parseExpr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("无法识别的字符: %q", string(p.input[p.pos]))
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("计算结果无效")
+	}
+	return value, nil
+}
+
+// exprParser 递归下降的表达式解析器
+// expr = term {("+"|"-") term}; term = unary {("*"|"/"|"%") unary}
+// unary = ("+"|"-") unary | power; power = primary ["^" unary]
+type exprParser struct {
+	input []rune
+	pos   int
+	depth int
+}
+
+var exprConstants = map[string]float64{"pi": math.Pi, "e": math.E}
+
+var exprFunctions = map[string]func(args []float64) (float64, error){
+	"sqrt":  exprFunc1(math.Sqrt),
+	"abs":   exprFunc1(math.Abs),
+	"sin":   exprFunc1(math.Sin),
+	"cos":   exprFunc1(math.Cos),
+	"tan":   exprFunc1(math.Tan),
+	"ln":    exprFunc1(math.Log),
+	"log10": exprFunc1(math.Log10),
+	"exp":   exprFunc1(math.Exp),
+	"floor": exprFunc1(math.Floor),
+	"ceil":  exprFunc1(math.Ceil),
+	"round": exprFunc1(math.Round),
+	"pow": func(args []float64) (float64, error) {
+		if len(args) != 2 {
+			return 0, errors.New("pow 需要2个参数")
+		}
+		return math.Pow(args[0], args[1]), nil
+	},
+	"min": func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("min 至少需要1个参数")
+		}
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Min(result, v)
+		}
+		return result, nil
+	},
+	"max": func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("max 至少需要1个参数")
+		}
+		result := args[0]
+		for _, v := range args[1:] {
+			result = math.Max(result, v)
+		}
+		return result, nil
+	},
+}
+
+// exprFunc1 包装单参数函数
+func exprFunc1(fn func(float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, errors.New("函数需要1个参数")
+		}
+		return fn(args[0]), nil
+	}
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// peek 跳过空白后查看下一个字符，没有时返回 0
+func (p *exprParser) peek() rune {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseExpr() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > 100 {
+		return 0, errors.New("表达式嵌套过深")
+	}
+
+	left, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+func (p *exprParser) parseTerm() (float64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			left *= right
+		case '/':
+			if right == 0 {
+				return 0, errors.New("除数不能为0")
+			}
+			left /= right
+		case '%':
+			if right == 0 {
+				return 0, errors.New("除数不能为0")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > 100 {
+		return 0, errors.New("表达式嵌套过深")
+	}
+
+	switch p.peek() {
+	case '-':
+		p.pos++
+		value, err := p.parseUnary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	r := p.peek()
+	switch {
+	case r == '(':
+		p.pos++
+		value, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, errors.New("缺少右括号")
+		}
+		p.pos++
+		return value, nil
+	case unicode.IsDigit(r) || r == '.':
+		return p.parseNumber()
+	case unicode.IsLetter(r):
+		start := p.pos
+		for p.pos < len(p.input) && (unicode.IsLetter(p.input[p.pos]) || unicode.IsDigit(p.input[p.pos])) {
+			p.pos++
+		}
+		name := strings.ToLower(string(p.input[start:p.pos]))
+		if value, ok := exprConstants[name]; ok {
+			return value, nil
+		}
+		fn, ok := exprFunctions[name]
+		if !ok {
+			return 0, fmt.Errorf("未知的函数或常量: %s", name)
+		}
+		if p.peek() != '(' {
+			return 0, fmt.Errorf("函数 %s 缺少参数", name)
+		}
+		p.pos++
+		var args []float64
+		if p.peek() != ')' {
+			for {
+				value, err := p.parseExpr()
+				if err != nil {
+					return 0, err
+				}
+				args = append(args, value)
+				if p.peek() != ',' {
+					break
+				}
+				p.pos++
+			}
+		}
+		if p.peek() != ')' {
+			return 0, errors.New("缺少右括号")
+		}
+		p.pos++
+		return fn(args)
+	case r == 0:
+		return 0, errors.New("表达式不完整")
+	default:
+		return 0, fmt.Errorf("无法识别的字符: %q", string(r))
+	}
+}
+
+func (p *exprParser) parseNumber() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	// 科学计数法，例如 1.5e3
+	if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+		next := p.pos + 1
+		if next < len(p.input) && (p.input[next] == '+' || p.input[next] == '-') {
+			next++
+		}
+		if next < len(p.input) && unicode.IsDigit(p.input[next]) {
+			p.pos = next
+			for p.pos < len(p.input) && unicode.IsDigit(p.input[p.pos]) {
+				p.pos++
+			}
+		}
+	}
+	value, err := strconv.ParseFloat(string(p.input[start:p.pos]), 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的数字: %s", string(p.input[start:p.pos]))
+	}
+	return value, nil
+}
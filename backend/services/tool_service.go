@@ -0,0 +1,321 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 工具调用的状态
+const (
+	ToolStatusRunning = "running"
+	ToolStatusDone    = "done"
+	ToolStatusError   = "error"
+)
+
+const (
+	toolTimeout        = 30 * time.Second
+	toolResultMaxBytes = 8000 // 交给模型的工具结果上限
+)
+
+// ToolEnv 工具执行时的上下文，工具只能访问当前用户有权查看的数据
+type ToolEnv struct {
+	UserID    uint
+	SessionID string
+	MessageID string // 正在回答的消息
+}
+
+// Tool 可供模型调用的服务端工具
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage // 参数的 JSON Schema
+	// Handler 执行工具，arguments 为模型生成的JSON参数，返回交给模型的结果文本
+	Handler func(ctx context.Context, env ToolEnv, arguments json.RawMessage) (string, error)
+}
+
+// ToolDefinition 请求中的工具定义，兼容OpenAI的格式
+type ToolDefinition struct {
+	Type     string             `json:"type"`
+	Function ToolDefinitionFunc `json:"function"`
+}
+
+// ToolDefinitionFunc 工具的函数定义
+type ToolDefinitionFunc struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ToolCall 模型请求的一次工具调用
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction 调用的函数和JSON参数
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// toolCallDelta 流式响应中的工具调用片段
+type toolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ToolInvocation 一次工具调用的过程和结果，执行前后各以 $tool$...$toolEnd$ 的形式输出到回复流
+type ToolInvocation struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Status    string `json:"status"`
+	Result    string `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// modelContent 交给模型的工具结果
+func (t ToolInvocation) modelContent() string {
+	if t.Status == ToolStatusError {
+		return "工具调用失败: " + t.Error
+	}
+	return t.Result
+}
+
+var (
+	toolRegistry   = map[string]Tool{}
+	toolRegistryMu sync.RWMutex
+)
+
+// RegisterTool 注册工具，名称相同时覆盖
+func RegisterTool(tool Tool) {
+	toolRegistryMu.Lock()
+	defer toolRegistryMu.Unlock()
+	toolRegistry[tool.Name] = tool
+}
+
+// GetTool 根据名称获取已注册的工具
+func GetTool(name string) (Tool, bool) {
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	tool, ok := toolRegistry[name]
+	return tool, ok
+}
+
+// ListTools 获取全部已注册的工具，按名称排序
+func ListTools() []Tool {
+	toolRegistryMu.RLock()
+	defer toolRegistryMu.RUnlock()
+	tools := make([]Tool, 0, len(toolRegistry))
+	for _, tool := range toolRegistry {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+	return tools
+}
+
+// FilterTools 只保留允许使用的工具，allowed 为 nil 时不限制
+func FilterTools(tools []Tool, allowed []string) []Tool {
+	if allowed == nil {
+		return tools
+	}
+	names := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		names[name] = true
+	}
+	filtered := make([]Tool, 0, len(tools))
+	for _, tool := range tools {
+		if names[tool.Name] {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
+
+// maxToolRounds 单次回答中工具调用的最大轮数
+func maxToolRounds() int {
+	if n := config.AppConfig.Chat.MaxToolRounds; n > 0 {
+		return n
+	}
+	return 5
+}
+
+// toolDefinitions 生成请求中的工具定义
+func toolDefinitions(tools []Tool) []ToolDefinition {
+	if len(tools) == 0 {
+		return nil
+	}
+	definitions := make([]ToolDefinition, 0, len(tools))
+	for _, tool := range tools {
+		definitions = append(definitions, ToolDefinition{
+			Type:     "function",
+			Function: ToolDefinitionFunc{Name: tool.Name, Description: tool.Description, Parameters: tool.Parameters},
+		})
+	}
+	return definitions
+}
+
+// mergeToolCallDeltas 将流式返回的工具调用片段按 index 合并
+func mergeToolCallDeltas(calls []ToolCall, deltas []toolCallDelta) []ToolCall {
+	for _, delta := range deltas {
+		for len(calls) <= delta.Index {
+			calls = append(calls, ToolCall{Type: "function"})
+		}
+		call := &calls[delta.Index]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Type != "" {
+			call.Type = delta.Type
+		}
+		call.Function.Name += delta.Function.Name
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return calls
+}
+
+// writeToolEvent 将工具调用的状态输出到回复流
+func writeToolEvent(writer io.Writer, invocation ToolInvocation) {
+	data, err := json.Marshal(invocation)
+	if err != nil {
+		return
+	}
+	writer.Write([]byte("$tool$"))
+	writer.Write(data)
+	writer.Write([]byte("$toolEnd$"))
+}
+
+// runToolCall 执行模型请求的工具调用，只允许调用本次对话提供的工具
+func runToolCall(tools []Tool, env ToolEnv, call ToolCall, writer io.Writer) ToolInvocation {
+	invocation := ToolInvocation{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments, Status: ToolStatusRunning}
+	writeToolEvent(writer, invocation)
+
+	var tool *Tool
+	for i := range tools {
+		if tools[i].Name == call.Function.Name {
+			tool = &tools[i]
+			break
+		}
+	}
+
+	var result string
+	var err error
+	if tool == nil {
+		err = fmt.Errorf("未知的工具: %s", call.Function.Name)
+	} else {
+		arguments := json.RawMessage(call.Function.Arguments)
+		if len(arguments) == 0 {
+			arguments = json.RawMessage("{}")
+		}
+		if !json.Valid(arguments) {
+			err = fmt.Errorf("工具参数不是有效的JSON")
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), toolTimeout)
+			result, err = callToolHandler(ctx, tool, env, arguments)
+			cancel()
+		}
+	}
+
+	if err != nil {
+		invocation.Status = ToolStatusError
+		invocation.Error = err.Error()
+	} else {
+		invocation.Status = ToolStatusDone
+		invocation.Result = truncateUTF8(result, toolResultMaxBytes)
+	}
+	writeToolEvent(writer, invocation)
+	return invocation
+}
+
+// callToolHandler 执行工具，工具崩溃时作为调用失败处理
+func callToolHandler(ctx context.Context, tool *Tool, env ToolEnv, arguments json.RawMessage) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("工具 %s 执行崩溃: %v", tool.Name, r)
+			err = fmt.Errorf("工具执行失败")
+		}
+	}()
+	return tool.Handler(ctx, env, arguments)
+}
+
+// SaveToolCalls 保存回答某个版本的工具调用记录
+func SaveToolCalls(sessionID, messageID string, version int, invocations []ToolInvocation) ([]models.MessageToolCall, error) {
+	if len(invocations) == 0 {
+		return nil, nil
+	}
+	records := make([]models.MessageToolCall, 0, len(invocations))
+	for i, invocation := range invocations {
+		records = append(records, models.MessageToolCall{
+			SessionID: sessionID,
+			MessageID: messageID,
+			Version:   version,
+			Seq:       i,
+			CallID:    invocation.ID,
+			Name:      invocation.Name,
+			Arguments: invocation.Arguments,
+			Status:    invocation.Status,
+			Result:    invocation.Result,
+			Error:     truncateUTF8(invocation.Error, 500),
+		})
+	}
+	if err := database.GetDB().Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// loadMessageToolCalls 批量加载AI回答及其替代版本的工具调用记录
+func loadMessageToolCalls(messages []models.ChatMessage) error {
+	messageIDs := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == "ai" {
+			messageIDs = append(messageIDs, message.MessageID)
+		}
+	}
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	var calls []models.MessageToolCall
+	if err := database.GetDB().Where("message_id IN ?", messageIDs).Order("seq").Find(&calls).Error; err != nil {
+		return err
+	}
+	if len(calls) == 0 {
+		return nil
+	}
+	type versionKey struct {
+		messageID string
+		version   int
+	}
+	byVersion := make(map[versionKey][]models.MessageToolCall)
+	for _, call := range calls {
+		key := versionKey{call.MessageID, call.Version}
+		byVersion[key] = append(byVersion[key], call)
+	}
+	for i := range messages {
+		if messages[i].Role != "ai" {
+			continue
+		}
+		messages[i].ToolCalls = byVersion[versionKey{messages[i].MessageID, messages[i].Version}]
+		for j := range messages[i].AlternativeResponses {
+			response := &messages[i].AlternativeResponses[j]
+			response.ToolCalls = byVersion[versionKey{response.MessageID, response.Version}]
+		}
+	}
+	return nil
+}
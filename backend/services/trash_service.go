@@ -0,0 +1,261 @@
+package services
+
+import (
+	"aiChat/backend/config"
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// trashRetention 回收站中会话的保留期
+func trashRetention() time.Duration {
+	days := config.AppConfig.Chat.TrashRetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// trashScope 限定为用户有权彻底删除或恢复的已删除会话
+// 个人会话只有本人可见，工作区会话对所有者可见，对编辑者只显示自己创建的会话
+func trashScope(db *gorm.DB, userID uint) *gorm.DB {
+	ownerWorkspaces := db.Model(&models.WorkspaceMember{}).Select("workspace_id").
+		Where("user_id = ? AND role = ?", userID, models.WorkspaceRoleOwner)
+	editorWorkspaces := db.Model(&models.WorkspaceMember{}).Select("workspace_id").
+		Where("user_id = ? AND role IN ?", userID, []string{models.WorkspaceRoleOwner, models.WorkspaceRoleEditor})
+
+	return db.Unscoped().Model(&models.ChatSession{}).
+		Where("deleted_at IS NOT NULL").
+		Where(db.Where("user_id = ? AND workspace_id IS NULL", userID).
+			Or("workspace_id IN (?)", ownerWorkspaces).
+			Or("user_id = ? AND workspace_id IN (?)", userID, editorWorkspaces))
+}
+
+// ListTrashSessions 获取回收站中的会话，按删除时间倒序
+func ListTrashSessions(userID uint) ([]models.TrashSession, error) {
+	db := database.GetDB()
+	var sessions []models.ChatSession
+	if err := trashScope(db, userID).Order("deleted_at DESC").Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("查询回收站失败: %w", err)
+	}
+
+	retention := trashRetention()
+	items := make([]models.TrashSession, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, models.TrashSession{
+			ChatSession: session,
+			PurgeAt:     session.DeletedAt.Time.Add(retention),
+		})
+	}
+	return items, nil
+}
+
+// getTrashSession 获取回收站中用户有权操作的会话
+func getTrashSession(db *gorm.DB, userID uint, sessionID string) (*models.ChatSession, error) {
+	var session models.ChatSession
+	err := trashScope(db, userID).Where("session_id = ?", sessionID).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+	return &session, nil
+}
+
+// RestoreSession 从回收站恢复会话及其消息
+// 原文件夹已被删除时会话恢复到根目录
+func RestoreSession(userID uint, sessionID string) (*models.ChatSession, error) {
+	db := database.GetDB()
+	var session *models.ChatSession
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		session, err = getTrashSession(tx, userID, sessionID)
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()}
+		if session.FolderID != nil {
+			var count int64
+			if err := tx.Model(&models.Folder{}).Where("id = ?", *session.FolderID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				updates["folder_id"] = nil
+				session.FolderID = nil
+			}
+		}
+
+		if err := tx.Unscoped().Model(&models.ChatSession{}).Where("session_id = ?", sessionID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("恢复会话失败: %w", err)
+		}
+		if err := tx.Unscoped().Model(&models.ChatMessage{}).Where("session_id = ?", sessionID).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("恢复会话消息失败: %w", err)
+		}
+		if err := tx.Unscoped().Model(&models.AIResponse{}).Where("session_id = ?", sessionID).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("恢复会话AI响应失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session.DeletedAt = gorm.DeletedAt{}
+	return session, nil
+}
+
+// purgeSessionContents 彻底删除指定会话的AI响应、消息、标签关联、收藏、评价、附件记录、引用和工具调用记录
+// sessionIDs 可以是会话ID列表或子查询，附件文件需要调用方在事务提交后删除
+func purgeSessionContents(tx *gorm.DB, sessionIDs interface{}) error {
+	if err := tx.Unscoped().Where("session_id IN (?)", sessionIDs).Delete(&models.AIResponse{}).Error; err != nil {
+		return fmt.Errorf("删除会话AI响应失败: %w", err)
+	}
+	if err := tx.Unscoped().Where("session_id IN (?)", sessionIDs).Delete(&models.ChatMessage{}).Error; err != nil {
+		return fmt.Errorf("删除会话消息失败: %w", err)
+	}
+	if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.SessionTag{}).Error; err != nil {
+		return fmt.Errorf("删除会话标签失败: %w", err)
+	}
+
+	bookmarkIDs := tx.Unscoped().Model(&models.Bookmark{}).Select("id").Where("session_id IN (?)", sessionIDs)
+	if err := tx.Where("bookmark_id IN (?)", bookmarkIDs).Delete(&models.BookmarkTag{}).Error; err != nil {
+		return fmt.Errorf("删除收藏标签失败: %w", err)
+	}
+	if err := tx.Unscoped().Where("session_id IN (?)", sessionIDs).Delete(&models.Bookmark{}).Error; err != nil {
+		return fmt.Errorf("删除会话收藏失败: %w", err)
+	}
+	if err := tx.Unscoped().Where("session_id IN (?)", sessionIDs).Delete(&models.MessageFeedback{}).Error; err != nil {
+		return fmt.Errorf("删除回答评价失败: %w", err)
+	}
+	if err := tx.Unscoped().Where("session_id IN (?)", sessionIDs).Delete(&models.Attachment{}).Error; err != nil {
+		return fmt.Errorf("删除会话附件失败: %w", err)
+	}
+	if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.MessageCitation{}).Error; err != nil {
+		return fmt.Errorf("删除回答引用失败: %w", err)
+	}
+	if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.MessageToolCall{}).Error; err != nil {
+		return fmt.Errorf("删除工具调用记录失败: %w", err)
+	}
+	if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.SessionMCPServer{}).Error; err != nil {
+		return fmt.Errorf("删除MCP设置失败: %w", err)
+	}
+	return nil
+}
+
+// purgeSessions 彻底删除会话及其全部内容，返回需要在事务提交后删除的附件文件
+func purgeSessions(tx *gorm.DB, sessionIDs []string) ([]string, error) {
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+	keys, err := sessionAttachmentKeys(tx, sessionIDs)
+	if err != nil {
+		return nil, fmt.Errorf("查询会话附件失败: %w", err)
+	}
+	if err := purgeSessionContents(tx, sessionIDs); err != nil {
+		return nil, err
+	}
+	if err := tx.Unscoped().Where("session_id IN ?", sessionIDs).Delete(&models.ChatSession{}).Error; err != nil {
+		return nil, fmt.Errorf("删除会话失败: %w", err)
+	}
+	return keys, nil
+}
+
+// PurgeSession 彻底删除回收站中的会话，无法恢复
+func PurgeSession(userID uint, sessionID string) error {
+	db := database.GetDB()
+	var keys []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := getTrashSession(tx, userID, sessionID); err != nil {
+			return err
+		}
+		var err error
+		keys, err = purgeSessions(tx, []string{sessionID})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	deleteAttachmentBlobs(keys)
+	return nil
+}
+
+// EmptyTrash 清空用户的回收站，返回删除的会话数量
+func EmptyTrash(userID uint) (int, error) {
+	db := database.GetDB()
+	var sessionIDs, keys []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := trashScope(tx, userID).Pluck("session_id", &sessionIDs).Error; err != nil {
+			return err
+		}
+		var err error
+		keys, err = purgeSessions(tx, sessionIDs)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	deleteAttachmentBlobs(keys)
+	return len(sessionIDs), nil
+}
+
+// PurgeExpiredTrash 彻底删除超过保留期的已删除会话，返回删除的会话数量
+func PurgeExpiredTrash() (int, error) {
+	db := database.GetDB()
+	cutoff := time.Now().Add(-trashRetention())
+
+	const batchSize = 100
+	total := 0
+	for {
+		var sessionIDs []string
+		if err := db.Unscoped().Model(&models.ChatSession{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Limit(batchSize).Pluck("session_id", &sessionIDs).Error; err != nil {
+			return total, err
+		}
+		if len(sessionIDs) == 0 {
+			return total, nil
+		}
+
+		var keys []string
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			keys, err = purgeSessions(tx, sessionIDs)
+			return err
+		}); err != nil {
+			return total, err
+		}
+		deleteAttachmentBlobs(keys)
+		total += len(sessionIDs)
+		if len(sessionIDs) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// RunTrashPurgeWorker 定期清理回收站中过期的会话，直到 ctx 被取消
+func RunTrashPurgeWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := PurgeExpiredTrash(); err != nil {
+			log.Printf("清理回收站失败: %v", err)
+		} else if n > 0 {
+			log.Printf("已彻底删除 %d 个过期的会话", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -29,6 +29,9 @@ var (
 
 	// ErrInvalidLoginType 无效的登录类型错误
 	ErrInvalidLoginType = errors.New("invalid login type")
+
+	// ErrUserDisabled 用户已被禁用错误
+	ErrUserDisabled = errors.New("user is disabled")
 )
 
 // RegisterUser 注册新用户
@@ -61,7 +64,12 @@ func RegisterUser(req models.RegisterRequest) (uint, error) {
 		if req.Phone == "" {
 			return 0, errors.New("phone is required for phone login type")
 		}
-		if err := db.Model(&models.User{}).Where("phone = ?", req.Phone).Count(&count).Error; err != nil {
+		phone, err := NormalizePhone(req.Phone)
+		if err != nil {
+			return 0, err
+		}
+		req.Phone = phone
+		if err := db.Model(&models.User{}).Where("phone IN ?", phoneLookupValues(phone)).Count(&count).Error; err != nil {
 			return 0, err
 		}
 		if count > 0 {
@@ -108,7 +116,7 @@ func RegisterUser(req models.RegisterRequest) (uint, error) {
 			return err
 		}
 
-		return nil
+		return assignDefaultRole(tx, userID)
 	})
 
 	if err != nil {
@@ -119,19 +127,31 @@ func RegisterUser(req models.RegisterRequest) (uint, error) {
 }
 
 // LoginUser 用户登录
-func LoginUser(req models.LoginRequest) (*models.LoginResponse, error) {
+func LoginUser(req models.LoginRequest, ip string) (*models.LoginResponse, error) {
 	db := database.GetDB()
 	var user models.User
 
-	// 基于登录类型选择查询方式
-	query := db.Where("status = ?", 1)
+	// 手机号统一格式后再计算失败次数，同一号码的不同写法共用锁定状态
+	if req.LoginType == 2 {
+		if phone, err := NormalizePhone(req.Account); err == nil {
+			req.Account = phone
+		}
+	}
+
+	// 检查账号或IP是否因连续失败被锁定
+	if err := CheckLoginAllowed(req.Account, ip); err != nil {
+		return nil, err
+	}
+
+	// 基于登录类型选择查询方式，禁用的账号在密码校验通过后单独提示
+	query := db
 
 	if req.LoginType == 1 {
 		// 邮箱登录
 		query = query.Where("email = ?", req.Account)
 	} else if req.LoginType == 2 {
 		// 手机号登录
-		query = query.Where("phone = ?", req.Account)
+		query = query.Where("phone IN ?", phoneLookupValues(req.Account))
 	} else {
 		return nil, ErrInvalidLoginType
 	}
@@ -139,7 +159,7 @@ func LoginUser(req models.LoginRequest) (*models.LoginResponse, error) {
 	// 查询用户
 	if err := query.First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, ErrUserNotFound
+			return nil, loginFailed(req.Account, ip, ErrUserNotFound)
 		}
 		return nil, err
 	}
@@ -147,9 +167,34 @@ func LoginUser(req models.LoginRequest) (*models.LoginResponse, error) {
 	// 验证密码
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
-		return nil, ErrInvalidCredentials
+		return nil, loginFailed(req.Account, ip, ErrInvalidCredentials)
 	}
 
+	if user.Status != 1 {
+		return nil, ErrUserDisabled
+	}
+
+	if err := ResetLoginFailures(req.Account); err != nil {
+		return nil, err
+	}
+
+	return issueLoginResponse(user, ip)
+}
+
+// loginFailed 记录登录失败并按失败次数延迟返回，减缓暴力破解
+func loginFailed(account, ip string, cause error) error {
+	delay, err := RecordLoginFailure(account, ip)
+	if err != nil {
+		return err
+	}
+	time.Sleep(delay)
+	return cause
+}
+
+// issueLoginResponse 为已通过认证的用户签发令牌并记录登录信息
+func issueLoginResponse(user models.User, ip string) (*models.LoginResponse, error) {
+	db := database.GetDB()
+
 	// 生成令牌
 	token, err := GenerateToken(user.ID)
 	if err != nil {
@@ -158,9 +203,13 @@ func LoginUser(req models.LoginRequest) (*models.LoginResponse, error) {
 
 	// 更新最后登录时间
 	now := time.Now()
-	if err := db.Model(&user).Updates(map[string]interface{}{
+	updates := map[string]interface{}{
 		"last_login_time": &now,
-	}).Error; err != nil {
+	}
+	if ip != "" {
+		updates["last_login_ip"] = ip
+	}
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
 		return nil, err
 	}
 
@@ -227,7 +276,7 @@ func UpdateUserProfile(userID uint, req models.UpdateProfileRequest) error {
 }
 
 // UpdateUserPassword 更新用户密码
-func UpdateUserPassword(userID uint64, req models.UpdatePasswordRequest) error {
+func UpdateUserPassword(userID uint, req models.UpdatePasswordRequest) error {
 	db := database.GetDB()
 
 	// 获取用户当前密码
@@ -281,7 +330,7 @@ func GetUserSettings(userID uint) (*models.UserSettings, error) {
 }
 
 // UpdateUserSettings 更新用户设置
-func UpdateUserSettings(userID uint64, req models.UpdateSettingsRequest) error {
+func UpdateUserSettings(userID uint, req models.UpdateSettingsRequest) error {
 	db := database.GetDB()
 
 	// 准备更新数据
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// VectorItem 待写入向量存储的切块向量
+type VectorItem struct {
+	ChunkID         uint
+	KnowledgeBaseID uint
+	DocumentID      uint
+	Vector          []float32
+}
+
+// VectorMatch 检索结果，Score 为余弦相似度
+type VectorMatch struct {
+	ChunkID uint
+	Score   float64
+}
+
+// VectorStore 向量存储接口
+type VectorStore interface {
+	// Upsert 写入切块的向量，切块已存在时覆盖
+	Upsert(ctx context.Context, items []VectorItem) error
+	// Search 在指定知识库中检索与 vector 最相似的 topK 个切块，按相似度从高到低排序
+	Search(ctx context.Context, knowledgeBaseID uint, vector []float32, topK int) ([]VectorMatch, error)
+	// DeleteDocument 删除文档的全部向量
+	DeleteDocument(ctx context.Context, documentID uint) error
+	// DeleteKnowledgeBase 删除知识库的全部向量
+	DeleteKnowledgeBase(ctx context.Context, knowledgeBaseID uint) error
+}
+
+var (
+	vectorStore   VectorStore
+	vectorStoreMu sync.RWMutex
+)
+
+// SetVectorStore 设置全局向量存储
+func SetVectorStore(store VectorStore) {
+	vectorStoreMu.Lock()
+	defer vectorStoreMu.Unlock()
+	vectorStore = store
+}
+
+// GetVectorStore 获取全局向量存储
+func GetVectorStore() VectorStore {
+	vectorStoreMu.RLock()
+	defer vectorStoreMu.RUnlock()
+	return vectorStore
+}
+
+// NewVectorStore 根据配置创建向量存储
+func NewVectorStore(driver string) (VectorStore, error) {
+	switch driver {
+	case "", "db":
+		return &DBVectorStore{}, nil
+	case "memory":
+		return NewMemoryVectorStore(), nil
+	default:
+		return nil, fmt.Errorf("不支持的向量存储: %s", driver)
+	}
+}
+
+// DBVectorStore 将向量保存在数据库中，检索时逐个计算相似度，适合文档数量不多的场景
+type DBVectorStore struct{}
+
+// Upsert 写入切块的向量
+func (s *DBVectorStore) Upsert(ctx context.Context, items []VectorItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	rows := make([]models.KnowledgeVector, 0, len(items))
+	for _, item := range items {
+		rows = append(rows, models.KnowledgeVector{
+			ChunkID:         item.ChunkID,
+			KnowledgeBaseID: item.KnowledgeBaseID,
+			DocumentID:      item.DocumentID,
+			Vector:          encodeVector(item.Vector),
+		})
+	}
+	return database.GetDB().WithContext(ctx).Save(&rows).Error
+}
+
+// Search 分批读取知识库的向量并保留相似度最高的 topK 个
+func (s *DBVectorStore) Search(ctx context.Context, knowledgeBaseID uint, vector []float32, topK int) ([]VectorMatch, error) {
+	collector := newVectorCollector(vector, topK)
+	if collector == nil {
+		return nil, nil
+	}
+
+	var batch []models.KnowledgeVector
+	err := database.GetDB().WithContext(ctx).
+		Where("knowledge_base_id = ?", knowledgeBaseID).
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for _, row := range batch {
+				collector.add(row.ChunkID, decodeVector(row.Vector))
+			}
+			// 只保留当前最相似的结果，避免占用过多内存
+			collector.trim()
+			return nil
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+	return collector.result(), nil
+}
+
+// DeleteDocument 删除文档的全部向量
+func (s *DBVectorStore) DeleteDocument(ctx context.Context, documentID uint) error {
+	return database.GetDB().WithContext(ctx).Where("document_id = ?", documentID).Delete(&models.KnowledgeVector{}).Error
+}
+
+// DeleteKnowledgeBase 删除知识库的全部向量
+func (s *DBVectorStore) DeleteKnowledgeBase(ctx context.Context, knowledgeBaseID uint) error {
+	return database.GetDB().WithContext(ctx).Where("knowledge_base_id = ?", knowledgeBaseID).Delete(&models.KnowledgeVector{}).Error
+}
+
+// MemoryVectorStore 将向量保存在内存中，进程重启后丢失，用于测试和本地开发
+type MemoryVectorStore struct {
+	mu    sync.RWMutex
+	items map[uint]VectorItem // 切块ID -> 向量
+}
+
+// NewMemoryVectorStore 创建内存向量存储
+func NewMemoryVectorStore() *MemoryVectorStore {
+	return &MemoryVectorStore{items: make(map[uint]VectorItem)}
+}
+
+// Upsert 写入切块的向量
+func (s *MemoryVectorStore) Upsert(ctx context.Context, items []VectorItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range items {
+		item.Vector = append([]float32(nil), item.Vector...)
+		s.items[item.ChunkID] = item
+	}
+	return nil
+}
+
+// Search 逐个计算知识库中向量的相似度
+func (s *MemoryVectorStore) Search(ctx context.Context, knowledgeBaseID uint, vector []float32, topK int) ([]VectorMatch, error) {
+	collector := newVectorCollector(vector, topK)
+	if collector == nil {
+		return nil, nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, item := range s.items {
+		if item.KnowledgeBaseID == knowledgeBaseID {
+			collector.add(item.ChunkID, item.Vector)
+		}
+	}
+	return collector.result(), nil
+}
+
+// DeleteDocument 删除文档的全部向量
+func (s *MemoryVectorStore) DeleteDocument(ctx context.Context, documentID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, item := range s.items {
+		if item.DocumentID == documentID {
+			delete(s.items, id)
+		}
+	}
+	return nil
+}
+
+// DeleteKnowledgeBase 删除知识库的全部向量
+func (s *MemoryVectorStore) DeleteKnowledgeBase(ctx context.Context, knowledgeBaseID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, item := range s.items {
+		if item.KnowledgeBaseID == knowledgeBaseID {
+			delete(s.items, id)
+		}
+	}
+	return nil
+}
+
+// vectorCollector 计算候选向量与查询向量的余弦相似度，保留最相似的 topK 个
+type vectorCollector struct {
+	query     []float32
+	queryNorm float64
+	topK      int
+	matches   []VectorMatch
+}
+
+// newVectorCollector 创建相似度收集器，topK 不大于 0 或查询向量为零向量时返回 nil
+func newVectorCollector(query []float32, topK int) *vectorCollector {
+	norm := vectorNorm(query)
+	if topK <= 0 || norm == 0 {
+		return nil
+	}
+	return &vectorCollector{query: query, queryNorm: norm, topK: topK}
+}
+
+// add 计算候选向量的相似度，维度不同或为零向量时忽略
+func (c *vectorCollector) add(chunkID uint, candidate []float32) {
+	if len(candidate) != len(c.query) {
+		return
+	}
+	norm := vectorNorm(candidate)
+	if norm == 0 {
+		return
+	}
+	var dot float64
+	for i := range c.query {
+		dot += float64(c.query[i]) * float64(candidate[i])
+	}
+	c.matches = append(c.matches, VectorMatch{ChunkID: chunkID, Score: dot / (c.queryNorm * norm)})
+}
+
+// trim 只保留当前最相似的 topK 个结果
+func (c *vectorCollector) trim() {
+	if len(c.matches) > c.topK {
+		sortVectorMatches(c.matches)
+		c.matches = c.matches[:c.topK]
+	}
+}
+
+// result 返回按相似度从高到低排序的结果
+func (c *vectorCollector) result() []VectorMatch {
+	sortVectorMatches(c.matches)
+	c.trim()
+	return c.matches
+}
+
+// sortVectorMatches 按相似度从高到低排序，相同时按切块顺序
+func sortVectorMatches(matches []VectorMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ChunkID < matches[j].ChunkID
+	})
+}
+
+// vectorNorm 计算向量的长度
+func vectorNorm(vector []float32) float64 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum)
+}
+
+// encodeVector 将向量编码为 float32 小端序字节
+func encodeVector(vector []float32) []byte {
+	data := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+// decodeVector 解码 encodeVector 生成的字节
+func decodeVector(data []byte) []float32 {
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
@@ -0,0 +1,457 @@
+package services
+
+import (
+	"aiChat/backend/database"
+	"aiChat/backend/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrWorkspaceNotFound 工作区不存在错误
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+
+	// ErrWorkspaceForbidden 无权操作工作区错误
+	ErrWorkspaceForbidden = errors.New("workspace permission denied")
+
+	// ErrWorkspaceMemberExists 用户已是工作区成员错误
+	ErrWorkspaceMemberExists = errors.New("user is already a workspace member")
+
+	// ErrWorkspaceMemberNotFound 工作区成员不存在错误
+	ErrWorkspaceMemberNotFound = errors.New("workspace member not found")
+
+	// ErrLastWorkspaceOwner 不能移除或降级最后一个所有者错误
+	ErrLastWorkspaceOwner = errors.New("workspace must keep at least one owner")
+
+	// ErrSessionNotFound 会话不存在错误
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionForbidden 无权访问会话错误
+	ErrSessionForbidden = errors.New("session permission denied")
+)
+
+// SessionPermission 会话操作权限
+type SessionPermission int
+
+const (
+	SessionPermissionRead   SessionPermission = iota // 查看会话和消息
+	SessionPermissionWrite                           // 发送消息、重试、切换回答版本、修改会话
+	SessionPermissionDelete                          // 删除会话
+)
+
+// workspaceRoleRank 工作区角色的权限等级
+var workspaceRoleRank = map[string]int{
+	models.WorkspaceRoleViewer: 1,
+	models.WorkspaceRoleEditor: 2,
+	models.WorkspaceRoleOwner:  3,
+}
+
+// GetWorkspaceRole 获取用户在工作区中的角色，不是成员时返回空字符串
+func GetWorkspaceRole(workspaceID, userID uint) (string, error) {
+	db := database.GetDB()
+	var member models.WorkspaceMember
+	err := db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// RequireWorkspaceRole 检查用户在工作区中至少拥有指定角色，非成员视为工作区不存在
+func RequireWorkspaceRole(workspaceID, userID uint, minRole string) (string, error) {
+	if _, err := GetWorkspace(workspaceID); err != nil {
+		return "", err
+	}
+	role, err := GetWorkspaceRole(workspaceID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		// 非成员看不到工作区
+		return "", ErrWorkspaceNotFound
+	}
+	if workspaceRoleRank[role] < workspaceRoleRank[minRole] {
+		return role, ErrWorkspaceForbidden
+	}
+	return role, nil
+}
+
+// CheckSessionAccess 检查用户对会话是否拥有指定权限
+// 个人会话只有创建者可以访问；工作区会话按成员角色判断：
+// 查看者可读，编辑者可写，删除需要会话创建者或工作区所有者
+func CheckSessionAccess(userID uint, session *models.ChatSession, permission SessionPermission) error {
+	if session.WorkspaceID == nil {
+		if session.UserID != userID {
+			return ErrSessionForbidden
+		}
+		return nil
+	}
+
+	role, err := GetWorkspaceRole(*session.WorkspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrSessionForbidden
+	}
+
+	switch permission {
+	case SessionPermissionRead:
+		return nil
+	case SessionPermissionWrite:
+		if workspaceRoleRank[role] >= workspaceRoleRank[models.WorkspaceRoleEditor] {
+			return nil
+		}
+	case SessionPermissionDelete:
+		if role == models.WorkspaceRoleOwner ||
+			(session.UserID == userID && workspaceRoleRank[role] >= workspaceRoleRank[models.WorkspaceRoleEditor]) {
+			return nil
+		}
+	}
+	return ErrSessionForbidden
+}
+
+// GetWorkspace 根据ID获取工作区
+func GetWorkspace(workspaceID uint) (*models.Workspace, error) {
+	db := database.GetDB()
+	var workspace models.Workspace
+	if err := db.First(&workspace, workspaceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// GetWorkspaceForMember 获取工作区详情，只有成员可以查看
+func GetWorkspaceForMember(workspaceID, userID uint) (*models.WorkspaceSummary, error) {
+	role, err := RequireWorkspaceRole(workspaceID, userID, models.WorkspaceRoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := GetWorkspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.WorkspaceSummary{Workspace: *workspace, Role: role}
+	db := database.GetDB()
+	if err := db.Model(&models.WorkspaceMember{}).Where("workspace_id = ?", workspaceID).
+		Count(&summary.MemberCount).Error; err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// CreateWorkspace 创建工作区，创建者成为所有者
+func CreateWorkspace(userID uint, req models.CreateWorkspaceRequest) (*models.Workspace, error) {
+	workspace := models.Workspace{
+		Name:          req.Name,
+		Description:   req.Description,
+		CreatedBy:     userID,
+		DefaultPrompt: req.DefaultPrompt,
+		DefaultModel:  req.DefaultModel,
+	}
+
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        models.WorkspaceRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// ListUserWorkspaces 获取用户加入的全部工作区
+func ListUserWorkspaces(userID uint) ([]models.WorkspaceSummary, error) {
+	db := database.GetDB()
+
+	var members []models.WorkspaceMember
+	if err := db.Where("user_id = ?", userID).Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("查询工作区失败: %w", err)
+	}
+	if len(members) == 0 {
+		return []models.WorkspaceSummary{}, nil
+	}
+
+	roles := make(map[uint]string, len(members))
+	ids := make([]uint, 0, len(members))
+	for _, member := range members {
+		roles[member.WorkspaceID] = member.Role
+		ids = append(ids, member.WorkspaceID)
+	}
+
+	var workspaces []models.Workspace
+	if err := db.Where("id IN ?", ids).Order("id").Find(&workspaces).Error; err != nil {
+		return nil, fmt.Errorf("查询工作区失败: %w", err)
+	}
+
+	var counts []struct {
+		WorkspaceID uint
+		Count       int64
+	}
+	if err := db.Model(&models.WorkspaceMember{}).Select("workspace_id, COUNT(*) AS count").
+		Where("workspace_id IN ?", ids).Group("workspace_id").Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("查询工作区成员数失败: %w", err)
+	}
+	memberCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		memberCounts[count.WorkspaceID] = count.Count
+	}
+
+	result := make([]models.WorkspaceSummary, 0, len(workspaces))
+	for _, workspace := range workspaces {
+		result = append(result, models.WorkspaceSummary{
+			Workspace:   workspace,
+			Role:        roles[workspace.ID],
+			MemberCount: memberCounts[workspace.ID],
+		})
+	}
+	return result, nil
+}
+
+// UpdateWorkspace 更新工作区信息，需要所有者权限
+func UpdateWorkspace(workspaceID, userID uint, req models.UpdateWorkspaceRequest) (*models.Workspace, error) {
+	if _, err := RequireWorkspaceRole(workspaceID, userID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+	if req.DefaultPrompt != nil {
+		updates["default_prompt"] = *req.DefaultPrompt
+	}
+	if req.DefaultModel != nil {
+		updates["default_model"] = *req.DefaultModel
+	}
+
+	if len(updates) > 0 {
+		db := database.GetDB()
+		if err := db.Model(&models.Workspace{}).Where("id = ?", workspaceID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return GetWorkspace(workspaceID)
+}
+
+// DeleteWorkspace 删除工作区及其成员、共享会话、共享模板和助手，需要所有者权限
+func DeleteWorkspace(workspaceID, userID uint) error {
+	if _, err := RequireWorkspaceRole(workspaceID, userID, models.WorkspaceRoleOwner); err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		sessionIDs := tx.Model(&models.ChatSession{}).Select("session_id").Where("workspace_id = ?", workspaceID)
+		if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.AIResponse{}).Error; err != nil {
+			return fmt.Errorf("删除会话AI响应失败: %w", err)
+		}
+		if err := tx.Where("session_id IN (?)", sessionIDs).Delete(&models.ChatMessage{}).Error; err != nil {
+			return fmt.Errorf("删除会话消息失败: %w", err)
+		}
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.ChatSession{}).Error; err != nil {
+			return fmt.Errorf("删除会话失败: %w", err)
+		}
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.PromptTemplate{}).Error; err != nil {
+			return fmt.Errorf("删除工作区模板失败: %w", err)
+		}
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(&models.Assistant{}).Error; err != nil {
+			return fmt.Errorf("删除工作区助手失败: %w", err)
+		}
+		if err := tx.Unscoped().Where("workspace_id = ?", workspaceID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return fmt.Errorf("删除工作区成员失败: %w", err)
+		}
+		return tx.Delete(&models.Workspace{}, workspaceID).Error
+	})
+}
+
+// ListWorkspaceMembers 获取工作区成员列表，成员均可查看
+func ListWorkspaceMembers(workspaceID, userID uint) ([]models.WorkspaceMemberInfo, error) {
+	if _, err := RequireWorkspaceRole(workspaceID, userID, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	var members []models.WorkspaceMemberInfo
+	err := db.Table("workspace_members").
+		Select("workspace_members.user_id, users.username, users.avatar, workspace_members.role").
+		Joins("JOIN users ON users.id = workspace_members.user_id AND users.deleted_at IS NULL").
+		Where("workspace_members.workspace_id = ? AND workspace_members.deleted_at IS NULL", workspaceID).
+		Order("workspace_members.id").
+		Scan(&members).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询工作区成员失败: %w", err)
+	}
+	return members, nil
+}
+
+// AddWorkspaceMember 按账号添加工作区成员，需要所有者权限
+func AddWorkspaceMember(workspaceID, operatorID uint, req models.AddWorkspaceMemberRequest) (*models.WorkspaceMember, error) {
+	if _, err := RequireWorkspaceRole(workspaceID, operatorID, models.WorkspaceRoleOwner); err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	var user models.User
+	err := db.Where("(username = ? OR email = ? OR phone = ?) AND status = ?", req.Account, req.Account, req.Account, 1).
+		First(&user).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	role, err := GetWorkspaceRole(workspaceID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		return nil, ErrWorkspaceMemberExists
+	}
+
+	member := models.WorkspaceMember{WorkspaceID: workspaceID, UserID: user.ID, Role: req.Role}
+	// 成员被移除时是软删除，重新加入前清理旧记录以满足唯一索引
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("workspace_id = ? AND user_id = ?", workspaceID, user.ID).
+			Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// countWorkspaceOwners 统计工作区所有者数量
+func countWorkspaceOwners(tx *gorm.DB, workspaceID uint) (int64, error) {
+	var count int64
+	err := tx.Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND role = ?", workspaceID, models.WorkspaceRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+// UpdateWorkspaceMemberRole 修改成员角色，需要所有者权限，至少保留一个所有者
+func UpdateWorkspaceMemberRole(workspaceID, operatorID, memberID uint, role string) error {
+	if _, err := RequireWorkspaceRole(workspaceID, operatorID, models.WorkspaceRoleOwner); err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var member models.WorkspaceMember
+		if err := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, memberID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWorkspaceMemberNotFound
+			}
+			return err
+		}
+
+		if member.Role == models.WorkspaceRoleOwner && role != models.WorkspaceRoleOwner {
+			owners, err := countWorkspaceOwners(tx, workspaceID)
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastWorkspaceOwner
+			}
+		}
+
+		return tx.Model(&member).Update("role", role).Error
+	})
+}
+
+// RemoveWorkspaceMember 移除工作区成员，所有者可以移除任何人，成员可以退出工作区
+// 被移除成员创建的会话仍保留在工作区中
+func RemoveWorkspaceMember(workspaceID, operatorID, memberID uint) error {
+	minRole := models.WorkspaceRoleOwner
+	if operatorID == memberID {
+		minRole = models.WorkspaceRoleViewer
+	}
+	if _, err := RequireWorkspaceRole(workspaceID, operatorID, minRole); err != nil {
+		return err
+	}
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		var member models.WorkspaceMember
+		if err := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, memberID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWorkspaceMemberNotFound
+			}
+			return err
+		}
+
+		if member.Role == models.WorkspaceRoleOwner {
+			owners, err := countWorkspaceOwners(tx, workspaceID)
+			if err != nil {
+				return err
+			}
+			if owners <= 1 {
+				return ErrLastWorkspaceOwner
+			}
+		}
+
+		return tx.Delete(&member).Error
+	})
+}
+
+// GetSessionsByWorkspace 获取工作区的共享会话，需要成员身份
+func GetSessionsByWorkspace(workspaceID, userID uint, archived bool) ([]models.ChatSession, error) {
+	if _, err := RequireWorkspaceRole(workspaceID, userID, models.WorkspaceRoleViewer); err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	var sessions []models.ChatSession
+	err := db.Where("workspace_id = ? AND is_archived = ?", workspaceID, archived).
+		Order("is_pinned DESC, updated_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询会话失败: %w", err)
+	}
+
+	fillSessionSummaries(sessions)
+	return sessions, nil
+}
+
+// ResolveChatOptions 根据会话所属工作区的默认设置和会话使用的助手生成对话参数，助手的设置优先
+func ResolveChatOptions(session *models.ChatSession, deepThinking bool) (ChatOptions, error) {
+	opts := ChatOptions{DeepThinking: deepThinking}
+	if session.WorkspaceID != nil {
+		workspace, err := GetWorkspace(*session.WorkspaceID)
+		if err != nil {
+			return opts, err
+		}
+		opts.SystemPrompt = workspace.DefaultPrompt
+		opts.Model = workspace.DefaultModel
+	}
+
+	if err := applyAssistantOptions(session, &opts); err != nil {
+		return opts, err
+	}
+	opts.Params = MergeGenerationParams(opts.Params, session.GenerationParams)
+	return opts, nil
+}